@@ -0,0 +1,590 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/handlers"
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/utils"
+	"go.uber.org/zap"
+	networking "k8s.io/api/networking/v1beta1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	migrateCommand  = "migrate"
+	planCommand     = "plan"
+	statusCommand   = "status"
+	rollbackCommand = "rollback"
+	cleanupCommand  = "cleanup"
+	promoteCommand  = "promote"
+	watchCommand    = "watch"
+	helpCommand     = "help"
+)
+
+// command represents a single subcommand of the migration tool
+type command struct {
+	name        string
+	description string
+	// run is canceled when the migration tool receives SIGINT or SIGTERM
+	run func(ctx context.Context, args []string) (commandResult, error)
+}
+
+// commandResult contains the information the summary of the command is built from
+type commandResult struct {
+	outputDir string
+	// status is the migration status recorded by the command, it is nil if the status is not available
+	status *model.MigrationStatus
+	// report is saved into the output directory in the report formats, it is nil if the command has no report
+	report        *model.Report
+	reportFormats []string
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: migrateCommand, description: "migrates the IKS ConfigMap and Ingress resources (default command)", run: runMigrate},
+		{name: planCommand, description: "runs the migration without changing the cluster and saves the resources that would be applied", run: runPlan},
+		{name: statusCommand, description: "prints the status of the last migration from the status ConfigMap", run: runStatus},
+		{name: rollbackCommand, description: "removes the resources created by every migration run recorded in the status ConfigMap and restores the changed resources", run: runRollback},
+		{name: cleanupCommand, description: "deletes the test Ingress resources and ConfigMaps created by the last 'test' or 'test-with-private' mode migration", run: runCleanup},
+		{name: promoteCommand, description: "turns the resources of the last 'test' or 'test-with-private' mode migration into production resources", run: runPromote},
+		{name: watchCommand, description: "migrates the changes of the IKS ConfigMap and Ingress resources continuously until it is stopped", run: runWatch},
+		{name: helpCommand, description: "prints this help", run: func(_ context.Context, _ []string) (commandResult, error) { printUsage(); return commandResult{}, nil }},
+	}
+}
+
+// lookupCommand returns the command with the specified name or nil if there is no such command
+func lookupCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: ingress-migrator <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'ingress-migrator <command> --help' for the flags of a command.\n")
+}
+
+// loadConfig parses the arguments of the command and returns the validated configuration
+func loadConfig(name string, args []string, requireOutputDir bool) (*utils.Config, error) {
+	cfg := utils.NewConfig()
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	cfg.RegisterFlags(fs)
+	if err := utils.LoadConfig(fs, args); err != nil {
+		return nil, &utils.ConfigError{Err: err}
+	}
+	if err := cfg.Validate(requireOutputDir); err != nil {
+		return nil, &utils.ConfigError{Err: err}
+	}
+	cfg.Apply()
+	return cfg, nil
+}
+
+// withTimeout returns the context of the command, which is canceled when the global timeout of the configuration expires
+func withTimeout(ctx context.Context, cfg *utils.Config) (context.Context, context.CancelFunc) {
+	if cfg.Timeout > 0 {
+		return context.WithTimeout(ctx, cfg.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// interruptedError wraps the error of the command if the command was canceled by a signal or its timeout expired
+func interruptedError(ctx context.Context, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	return &utils.InterruptedError{Err: ctx.Err(), Cause: err}
+}
+
+// newLogger returns a logger writing into the output directory, or a no-op logger when the output directory is not set
+func newLogger(cfg *utils.Config) (*zap.Logger, error) {
+	if cfg.OutputDir == "" {
+		return zap.NewNop(), nil
+	}
+	return utils.GetZapLogger(cfg.OutputDir)
+}
+
+// newKubeClient returns a KubeClient reading the manifests in offline mode, or connecting to the cluster selected by the configuration otherwise
+func newKubeClient(cfg *utils.Config, logger *zap.Logger) (utils.KubeClient, utils.ConnectionInfo, error) {
+	if cfg.Offline() {
+		kc, err := utils.NewFileKubeClient(cfg.InputDir, logger)
+		if err != nil {
+			// the manifests in the input directory are provided by the user
+			return nil, utils.ConnectionInfo{}, &utils.ConfigError{Err: err}
+		}
+		return kc, utils.ConnectionInfo{}, nil
+	}
+
+	options := cfg.KubeClientOptions()
+	restConfig, connection, err := utils.GetRestConfig(options, logger)
+	if err != nil {
+		// the kubeconfig or the selected context is invalid
+		return nil, connection, &utils.ConfigError{Err: fmt.Errorf("error getting cluster configuration: %v", err)}
+	}
+
+	kc, err := utils.NewKubeClient(restConfig, options, logger)
+	if err != nil || kc == nil {
+		logger.Error("error getting kubeclient interface", zap.Error(err))
+		return nil, connection, &utils.APIError{Err: fmt.Errorf("error getting kubeclient interface %v", err)}
+	}
+	return kc, connection, nil
+}
+
+// loadAcknowledgements loads the acknowledgements of the migration warnings from the file and the acknowledgements configmap
+func loadAcknowledgements(ctx context.Context, cfg *utils.Config, kc utils.KubeClient, logger *zap.Logger) error {
+	acks, err := utils.LoadAcknowledgements(ctx, kc, cfg.Acknowledgements, logger)
+	if err != nil {
+		logger.Error("error loading acknowledgements", zap.Error(err))
+		return err
+	}
+	utils.SetAcknowledgements(acks)
+	return nil
+}
+
+func runMigrate(ctx context.Context, args []string) (commandResult, error) {
+	cfg, err := loadConfig(migrateCommand, args, true)
+	if err != nil {
+		return commandResult{}, err
+	}
+	return migrate(ctx, migrateCommand, cfg)
+}
+
+// runPlan runs the whole migration in read-only mode, so its changes can be reviewed before applying them
+func runPlan(ctx context.Context, args []string) (commandResult, error) {
+	cfg, err := loadConfig(planCommand, args, true)
+	if err != nil {
+		return commandResult{}, err
+	}
+	cfg.ReadOnly = true
+	cfg.DumpResources = true
+	return migrate(ctx, planCommand, cfg)
+}
+
+// migrate runs the migration phases selected by the configuration
+func migrate(ctx context.Context, name string, cfg *utils.Config) (commandResult, error) {
+	result := commandResult{outputDir: cfg.OutputDir}
+
+	ctx, cancel := withTimeout(ctx, cfg)
+	defer cancel()
+
+	logger, err := newLogger(cfg)
+	if err != nil {
+		return result, err
+	}
+	logger.Info("starting ingress migrator", zap.String("command", name), zap.String("mode", cfg.Mode), zap.String("phase", cfg.Phase), zap.Int("concurrency", cfg.Concurrency), zap.Duration("timeout", cfg.Timeout))
+
+	// the offline migration never touches the cluster, the resources can be inspected in the dumped YAML files only
+	cfg.DumpResources = cfg.DumpResources || cfg.Offline()
+
+	kc, connection, err := newKubeClient(cfg, logger)
+	if err != nil {
+		return result, err
+	}
+	logger.Info("successfully initialized kube client")
+
+	if err := loadAcknowledgements(ctx, cfg, kc, logger); err != nil {
+		return result, err
+	}
+
+	// the resources processed before a partial failure are still dumped and reported
+	var partialMigrationErrors []error
+
+	// the status of the previous migration is kept when only the ingress phase is running,
+	// as the status of the configmap phase was recorded there
+	if cfg.Phase != utils.PhaseIngress {
+		resetStatus(ctx, kc, cfg.Mode, logger)
+
+		if err := handlers.HandleConfigMap(ctx, kc, cfg.Mode, logger); err != nil {
+			logger.Error("error handling configmap data", zap.Error(err))
+			if !isPartialMigrationError(err) && ctx.Err() == nil {
+				return result, err
+			}
+			partialMigrationErrors = append(partialMigrationErrors, err)
+		} else {
+			logger.Info("successfully migrated configmap parameters from iks to k8s")
+		}
+	}
+
+	if cfg.Phase != utils.PhaseConfigMap && ctx.Err() == nil {
+		if err := handlers.HandleIngressResources(ctx, kc, cfg.Mode, cfg.IngressFilter(), cfg.Concurrency, logger); err != nil {
+			logger.Error("error handling ingress resources", zap.Error(err))
+			if !isPartialMigrationError(err) && ctx.Err() == nil {
+				return result, err
+			}
+			partialMigrationErrors = append(partialMigrationErrors, err)
+		} else {
+			logger.Info("successfully migrated ingress resources")
+		}
+	}
+
+	if ctx.Err() != nil {
+		logger.Warn("the migration was interrupted, reporting the processed resources", zap.Error(ctx.Err()))
+	}
+	reportCtx, cancelReport := utils.ReportContext(ctx)
+	defer cancelReport()
+
+	result.status = getRecordedStatus(reportCtx, kc, logger)
+	newReport(reportCtx, cfg, kc, name, connection, &result, logger)
+
+	if cfg.DumpResources {
+		if err := dumpResources(cfg.OutputDir, kc); err != nil {
+			return result, err
+		}
+
+		if cfg.PrintsReport() {
+			if err := utils.PrintStatus(cfg.OutputDir, connection, result.status); err != nil {
+				return result, fmt.Errorf("error printing status output: %v", err)
+			}
+		}
+	}
+
+	if name == planCommand {
+		if err := printPlan(reportCtx, cfg, kc, logger); err != nil {
+			return result, err
+		}
+	}
+
+	switch len(partialMigrationErrors) {
+	case 0:
+		return result, interruptedError(ctx, checkPolicy(reportCtx, cfg, kc, result.status, logger))
+	case 1:
+		return result, interruptedError(ctx, partialMigrationErrors[0])
+	default:
+		return result, interruptedError(ctx, &utils.PartialMigrationError{Operation: "migrating the resources", Errors: partialMigrationErrors})
+	}
+}
+
+// checkPolicy returns a PolicyViolationError if the warnings in the scope of the run violate the policy
+func checkPolicy(ctx context.Context, cfg *utils.Config, kc utils.KubeClient, status *model.MigrationStatus, logger *zap.Logger) error {
+	policy, err := cfg.Policy()
+	if err != nil {
+		return &utils.ConfigError{Err: err}
+	}
+	if policy.Empty() || status == nil {
+		return nil
+	}
+	if kc != nil {
+		var ingresses []networking.Ingress
+		if cfg.Phase != utils.PhaseConfigMap {
+			if ingresses, err = kc.GetIngressResources(ctx, cfg.IngressFilter()); err != nil {
+				logger.Error("error listing the ingress resources in the scope of the migration", zap.Error(err))
+				return &utils.APIError{Err: fmt.Errorf("error checking the migration policy: %v", err)}
+			}
+		}
+		status = utils.StatusInScope(status, cfg.Phase, ingresses)
+	}
+	violations := utils.EvaluatePolicy(policy, status)
+	if len(violations) == 0 {
+		return nil
+	}
+	logger.Warn("the migration policy was violated", zap.Strings("violations", violations))
+	return &utils.PolicyViolationError{Violations: violations}
+}
+
+// resetStatus deletes the status configmap recorded by a migration in another mode or that can not be parsed
+func resetStatus(ctx context.Context, kc utils.KubeClient, mode string, logger *zap.Logger) {
+	status, err := utils.GetMigrationStatus(ctx, kc)
+	if k8sErrors.IsNotFound(err) || (err == nil && status.Mode == mode) {
+		return
+	}
+	if err == nil {
+		logger.Info("the status configmap was recorded by a migration in another mode, deleting it", zap.String("recordedMode", status.Mode))
+	} else {
+		logger.Warn("could not read the status configmap, deleting it", zap.Error(err))
+	}
+	if err := kc.DeleteStatusCm(ctx); err == nil {
+		logger.Info("successfully deleted status configmap")
+	}
+}
+
+// isPartialMigrationError returns true if the handler continued after the error, so the other resources were processed
+func isPartialMigrationError(err error) bool {
+	var partialMigrationError *utils.PartialMigrationError
+	return errors.As(err, &partialMigrationError)
+}
+
+// printPlan prints the differences between the resources recorded by the migration and their current state, and saves them into the output directory
+func printPlan(ctx context.Context, cfg *utils.Config, kc utils.KubeClient, logger *zap.Logger) error {
+	// the plan runs in read-only mode, so the cluster still has the state before the migration,
+	// but the offline client applied the changes on the loaded manifests, so they are loaded again
+	live := kc
+	if cfg.Offline() {
+		var err error
+		if live, err = utils.NewFileKubeClient(cfg.InputDir, logger); err != nil {
+			return &utils.ConfigError{Err: err}
+		}
+	}
+
+	changes, err := utils.PlanChanges(ctx, kc, live)
+	if err != nil {
+		logger.Error("error comparing the migrated resources with their current state", zap.Error(err))
+		return fmt.Errorf("error planning changes: %v", err)
+	}
+
+	utils.PrintPlan(os.Stdout, changes)
+	if err := utils.WritePlan(cfg.OutputDir, changes); err != nil {
+		return fmt.Errorf("error saving planned changes: %v", err)
+	}
+	return nil
+}
+
+// getRecordedStatus returns the migration status recorded by the command, or nil if it is not available
+func getRecordedStatus(ctx context.Context, kc utils.KubeClient, logger *zap.Logger) *model.MigrationStatus {
+	status, err := utils.GetRecordedMigrationStatus(kc)
+	if err == nil {
+		return status
+	}
+	if !k8sErrors.IsNotFound(err) {
+		logger.Warn("could not parse the recorded status configmap", zap.Error(err))
+		return nil
+	}
+
+	status, err = utils.GetMigrationStatus(ctx, kc)
+	if err != nil {
+		logger.Warn("could not get the migration status", zap.Error(err))
+		return nil
+	}
+	return status
+}
+
+// newReport sets the migration report of the command based on its recorded status
+func newReport(ctx context.Context, cfg *utils.Config, kc utils.KubeClient, name string, connection utils.ConnectionInfo, result *commandResult, logger *zap.Logger) {
+	if !cfg.SavesReports() {
+		return
+	}
+	result.report = utils.NewReport(name, connection, result.status)
+	result.reportFormats = cfg.ReportFormats()
+	if utils.ItemInSlice(utils.ReportFormatHTML, result.reportFormats) {
+		utils.AddReportManifests(ctx, kc, result.report, logger)
+	}
+}
+
+// dumpResources saves the recorded resources into the output directory
+func dumpResources(outputDir string, kc utils.KubeClient) error {
+	if err := utils.DumpYAML(outputDir, kc.GetIngressContainer()); err != nil {
+		return fmt.Errorf("error while dumping resources: %v", err)
+	}
+	if err := utils.DumpYAML(outputDir, kc.GetConfigMapContainer()); err != nil {
+		return fmt.Errorf("error while dumping resources: %v", err)
+	}
+	if err := utils.DumpYAML(outputDir, kc.GetSecretContainer()); err != nil {
+		return fmt.Errorf("error while dumping resources: %v", err)
+	}
+	return nil
+}
+
+// runStatus prints the contents of the status configmap
+func runStatus(ctx context.Context, args []string) (commandResult, error) {
+	cfg, err := loadConfig(statusCommand, args, false)
+	if err != nil {
+		return commandResult{}, err
+	}
+	result := commandResult{outputDir: cfg.OutputDir}
+
+	ctx, cancel := withTimeout(ctx, cfg)
+	defer cancel()
+
+	logger, err := newLogger(cfg)
+	if err != nil {
+		return result, err
+	}
+
+	cfg.ReadOnly = true
+	cfg.DumpResources = false
+	kc, connection, err := newKubeClient(cfg, logger)
+	if err != nil {
+		return result, err
+	}
+
+	if result.status, err = utils.GetMigrationStatus(ctx, kc); err != nil {
+		logger.Error("error getting migration status", zap.Error(err))
+		var apiStatus k8sErrors.APIStatus
+		if errors.As(err, &apiStatus) {
+			return result, interruptedError(ctx, &utils.APIError{Err: fmt.Errorf("error getting status configmap: %v", err)})
+		}
+		return result, interruptedError(ctx, err)
+	}
+	newReport(ctx, cfg, kc, statusCommand, connection, &result, logger)
+
+	if cfg.PrintsReport() {
+		if err := utils.PrintStatus("", connection, result.status); err != nil {
+			return result, err
+		}
+	}
+	return result, checkPolicy(ctx, cfg, nil, result.status, logger)
+}
+
+// runRollback reverts the changes of every migration run recorded in the status configmap
+func runRollback(ctx context.Context, args []string) (commandResult, error) {
+	return runRecordedMigrationHandler(ctx, rollbackCommand, args, confirmRollback, handlers.HandleRollback)
+}
+
+// runCleanup deletes the artifacts of the test mode migration recorded in the status configmap
+func runCleanup(ctx context.Context, args []string) (commandResult, error) {
+	return runRecordedMigrationHandler(ctx, cleanupCommand, args, nil, handlers.HandleCleanup)
+}
+
+// runPromote turns the resources of the test mode migration recorded in the status configmap into production resources
+func runPromote(ctx context.Context, args []string) (commandResult, error) {
+	return runRecordedMigrationHandler(ctx, promoteCommand, args, nil, handlers.HandlePromote)
+}
+
+// confirmRollback asks the user to confirm the rollback of every recorded migration run
+func confirmRollback(ctx context.Context, cfg *utils.Config, kc utils.KubeClient, logger *zap.Logger) error {
+	if cfg.Yes || cfg.ReadOnly || cfg.DryRun || cfg.Offline() {
+		return nil
+	}
+	runIDs, err := handlers.RecordedRunIDs(ctx, kc, logger)
+	if err != nil {
+		logger.Error("error getting the recorded migration runs", zap.Error(err))
+		return err
+	}
+
+	fmt.Printf("The rollback reverts every migration run recorded in the %s/%s ConfigMap, and restores the changed resources to their state before the first run.\n", utils.KubeSystem, utils.MigrationStatusConfigMapName)
+	if len(runIDs) > 0 {
+		fmt.Printf("The recorded Ingress resources were last migrated by the runs: %s\n", strings.Join(runIDs, ", "))
+	}
+	fmt.Print("Do you want to continue? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+		return &utils.ConfigError{Err: fmt.Errorf("the rollback was not confirmed, set the --yes option to run it without confirmation")}
+	}
+	logger.Info("rollback confirmed", zap.Strings("runIds", runIDs))
+	return nil
+}
+
+// runWatch migrates the changed IKS ConfigMap and Ingress resources until it is interrupted
+func runWatch(ctx context.Context, args []string) (commandResult, error) {
+	cfg, err := loadConfig(watchCommand, args, true)
+	if err != nil {
+		return commandResult{}, err
+	}
+	if cfg.Offline() {
+		return commandResult{}, &utils.ConfigError{Err: fmt.Errorf("the %s command requires a cluster, it can not be used with an input directory", watchCommand)}
+	}
+	result := commandResult{outputDir: cfg.OutputDir}
+
+	ctx, cancel := withTimeout(ctx, cfg)
+	defer cancel()
+
+	logger, err := newLogger(cfg)
+	if err != nil {
+		return result, err
+	}
+	logger.Info("starting ingress migrator", zap.String("command", watchCommand), zap.String("mode", cfg.Mode), zap.String("phase", cfg.Phase), zap.Int("concurrency", cfg.Concurrency), zap.Duration("resyncPeriod", cfg.ResyncPeriod))
+
+	kc, connection, err := newKubeClient(cfg, logger)
+	if err != nil {
+		return result, err
+	}
+	if err := loadAcknowledgements(ctx, cfg, kc, logger); err != nil {
+		return result, err
+	}
+
+	if cfg.Phase != utils.PhaseIngress {
+		resetStatus(ctx, kc, cfg.Mode, logger)
+	}
+
+	if cfg.MetricsAddress != "" {
+		if err := utils.ServeMetrics(ctx, cfg.MetricsAddress, logger); err != nil {
+			logger.Error("error serving the metrics", zap.String("address", cfg.MetricsAddress), zap.Error(err))
+			return result, &utils.ConfigError{Err: fmt.Errorf("error serving the metrics on %s: %v", cfg.MetricsAddress, err)}
+		}
+	}
+
+	fmt.Printf("Watching the IKS Ingress resources and ConfigMap, press Ctrl+C to stop. Find the logs under the %s directory.\n", cfg.OutputDir)
+	options := handlers.WatchOptions{Mode: cfg.Mode, Filter: cfg.IngressFilter(), Phase: cfg.Phase, Concurrency: cfg.Concurrency, ResyncPeriod: cfg.ResyncPeriod}
+	if err := handlers.HandleWatch(ctx, kc, kc.GetClient(), options, logger); err != nil {
+		logger.Error("error watching the resources", zap.Error(err))
+		return result, err
+	}
+
+	reportCtx, cancelReport := utils.ReportContext(ctx)
+	defer cancelReport()
+
+	result.status = getRecordedStatus(reportCtx, kc, logger)
+	newReport(reportCtx, cfg, kc, watchCommand, connection, &result, logger)
+
+	if cfg.DumpResources {
+		if err := dumpResources(cfg.OutputDir, kc); err != nil {
+			return result, err
+		}
+		if cfg.PrintsReport() {
+			if err := utils.PrintStatus(cfg.OutputDir, connection, result.status); err != nil {
+				return result, fmt.Errorf("error printing status output: %v", err)
+			}
+		}
+	}
+	return result, nil
+}
+
+// runRecordedMigrationHandler runs a handler working on the migration recorded in the status configmap
+func runRecordedMigrationHandler(ctx context.Context, name string, args []string, confirm func(context.Context, *utils.Config, utils.KubeClient, *zap.Logger) error,
+	handle func(context.Context, utils.KubeClient, *zap.Logger) error) (commandResult, error) {
+	cfg, err := loadConfig(name, args, true)
+	if err != nil {
+		return commandResult{}, err
+	}
+	result := commandResult{outputDir: cfg.OutputDir}
+
+	ctx, cancel := withTimeout(ctx, cfg)
+	defer cancel()
+
+	logger, err := newLogger(cfg)
+	if err != nil {
+		return result, err
+	}
+	logger.Info("starting ingress migrator", zap.String("command", name), zap.Bool("readOnly", cfg.ReadOnly))
+
+	kc, _, err := newKubeClient(cfg, logger)
+	if err != nil {
+		return result, err
+	}
+
+	if confirm != nil {
+		if err := confirm(ctx, cfg, kc, logger); err != nil {
+			return result, err
+		}
+	}
+
+	if err := handle(ctx, kc, logger); err != nil {
+		logger.Error("error handling the recorded migration", zap.String("command", name), zap.Error(err))
+		return result, interruptedError(ctx, err)
+	}
+
+	if cfg.Offline() {
+		if err := dumpResources(cfg.OutputDir, kc); err != nil {
+			return result, err
+		}
+	}
+
+	fmt.Printf("The %s command finished! Find the logs under the %s directory.\n", name, cfg.OutputDir)
+	return result, nil
+}
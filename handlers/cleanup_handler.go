@@ -0,0 +1,189 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/utils"
+	"go.uber.org/zap"
+	networking "k8s.io/api/networking/v1beta1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// HandleCleanup top level function to delete the artifacts of a test mode migration
+func HandleCleanup(ctx context.Context, kc utils.KubeClient, logger *zap.Logger) error {
+	// 1.) get the migration status, check that it was recorded by a test mode migration
+	// 2.) delete the generated ingress resources that have the test ingress class and test subdomains only,
+	//     remove the back-reference annotations of the source ingress resources
+	// 3.) delete the test k8s configmap
+	// 4.) delete the TCP configmaps created by the migration, restore the original keys of the updated ones
+	// 5.) remove the backups of the cleaned up configmaps and delete the status configmap
+
+	logger.Info("starting to clean up the test mode migration artifacts")
+
+	status, err := utils.GetMigrationStatus(ctx, kc)
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			logger.Warn("status configmap is not present on the cluster, there is nothing to clean up")
+			return nil
+		}
+		logger.Error("error getting migration status", zap.Error(err))
+		return err
+	}
+
+	if status.Mode != model.MigrationModeTest && status.Mode != model.MigrationModeTestWithPrivate {
+		return fmt.Errorf("the last migration ran in '%s' mode, only the artifacts of '%s' and '%s' mode migrations can be cleaned up", status.Mode, model.MigrationModeTest, model.MigrationModeTestWithPrivate)
+	}
+
+	testSubdomains := map[string]bool{}
+	for _, testSubdomain := range status.SubdomainMap {
+		testSubdomains[testSubdomain] = true
+	}
+
+	backups, err := utils.GetBackups(ctx, kc)
+	if err != nil {
+		logger.Error("error getting resource backups", zap.Error(err))
+		return err
+	}
+	configMapBackups := map[string]model.ResourceBackup{}
+	for _, backup := range backups {
+		if backup.Kind == utils.ConfigMapKind {
+			configMapBackups[backup.Name] = backup
+		}
+	}
+
+	var errors []error
+	var cleanedBackups []string
+	processedConfigMaps := map[string]bool{}
+	for _, migratedResource := range status.MigratedResources {
+		for _, migratedAs := range migratedResource.MigratedAs {
+			kindAndName := strings.SplitN(migratedAs, "/", 2)
+			if len(kindAndName) != 2 {
+				logger.Warn("skipping migrated resource with unknown format", zap.String("migratedAs", migratedAs))
+				continue
+			}
+
+			switch kind, name := kindAndName[0], kindAndName[1]; kind {
+			case utils.IngressKind:
+				if err := cleanupTestIngress(ctx, kc, name, migratedResource.Namespace, testSubdomains, logger); err != nil {
+					errors = append(errors, err)
+				}
+			case utils.ConfigMapKind:
+				if processedConfigMaps[name] {
+					continue
+				}
+				processedConfigMaps[name] = true
+
+				backup, backedUp := configMapBackups[name]
+				switch {
+				case name == utils.K8sConfigMapName:
+					// the configmap of the community ingress controller is not changed in test modes
+					logger.Warn("skipping configmap, it is not a test artifact", zap.String("name", name))
+					continue
+				case name == utils.TestK8sConfigMapName:
+					backup = model.ResourceBackup{Kind: utils.ConfigMapKind, Name: name, Namespace: utils.KubeSystem, Created: true}
+				case !backedUp:
+					logger.Warn("skipping configmap without backup, it was not changed by the migration or was migrated by an older version", zap.String("name", name))
+					continue
+				}
+				if err := rollbackConfigMap(ctx, kc, backup, logger); err != nil {
+					errors = append(errors, err)
+					continue
+				}
+				cleanedBackups = append(cleanedBackups, utils.BackupKey(utils.ConfigMapKind, utils.KubeSystem, name))
+			}
+		}
+
+		if migratedResource.Kind == utils.IngressKind {
+			if err := kc.AnnotateIngress(ctx, migratedResource.Name, migratedResource.Namespace, nil); err != nil && !k8sErrors.IsNotFound(err) {
+				logger.Error("error removing the back-reference annotations of the source ingress resource", zap.String("name", migratedResource.Name), zap.String("namespace", migratedResource.Namespace), zap.Error(err))
+				errors = append(errors, err)
+			}
+		}
+	}
+
+	if err := utils.RemoveBackups(ctx, kc, cleanedBackups); err != nil {
+		logger.Error("error removing the backups of the cleaned up configmaps", zap.Error(err))
+		errors = append(errors, err)
+	}
+
+	if len(errors) > 0 {
+		// the status configmap is kept, so the cleanup can be retried
+		return &utils.PartialMigrationError{Operation: "cleaning up the test mode migration artifacts", Errors: errors}
+	}
+
+	if err := kc.DeleteStatusCm(ctx); err != nil && !k8sErrors.IsNotFound(err) {
+		logger.Error("error deleting status configmap", zap.Error(err))
+		return err
+	}
+	logger.Info("successfully cleaned up the test mode migration artifacts")
+
+	return nil
+}
+
+// cleanupTestIngress deletes the generated ingress resource if it has the test ingress class and uses the generated test subdomains only
+func cleanupTestIngress(ctx context.Context, kc utils.KubeClient, name, namespace string, testSubdomains map[string]bool, logger *zap.Logger) error {
+	logger = logger.With(zap.String("name", name), zap.String("namespace", namespace))
+
+	ingress, err := kc.GetIngress(ctx, name, namespace)
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			logger.Info("generated ingress resource is not present on the cluster")
+			return nil
+		}
+		logger.Error("error getting generated ingress resource", zap.Error(err))
+		return err
+	}
+
+	if !isTestIngress(*ingress, testSubdomains) {
+		logger.Warn("skipping ingress resource, it does not have the test ingress class or uses subdomains that were not generated by the migration")
+		return nil
+	}
+
+	if err := kc.DeleteIngress(ctx, name, namespace); err != nil && !k8sErrors.IsNotFound(err) {
+		logger.Error("error deleting generated ingress resource", zap.Error(err))
+		return err
+	}
+	logger.Info("successfully deleted generated ingress resource")
+	return nil
+}
+
+// isTestIngress returns true if the ingress resource has the test ingress class and all of its hosts are generated test subdomains
+func isTestIngress(ingress networking.Ingress, testSubdomains map[string]bool) bool {
+	ingressClass := ingress.Annotations[utils.IngressClassAnnotation]
+	if ingressClass == "" && ingress.Spec.IngressClassName != nil {
+		ingressClass = *ingress.Spec.IngressClassName
+	}
+	if ingressClass != utils.TestIngressClass {
+		return false
+	}
+
+	for _, rule := range ingress.Spec.Rules {
+		if !testSubdomains[rule.Host] {
+			return false
+		}
+	}
+	for _, tls := range ingress.Spec.TLS {
+		for _, host := range tls.Hosts {
+			if !testSubdomains[host] {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/utils"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	networking "k8s.io/api/networking/v1beta1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHandleCleanup(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	utils.TestDomain = "example-cluster-xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx-m000.mon01.containers.appdomain.cloud"
+	utils.TestSecret = "example-cluster-xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx-m000"
+
+	newKubeClient := func(t *testing.T) utils.KubeClient {
+		inputDir := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "manifests.yaml"), []byte(rollbackTestManifests), 0600))
+		kc, err := utils.NewFileKubeClient(inputDir, logger)
+		assert.NoError(t, err)
+		return kc
+	}
+
+	t.Run("test mode artifacts are deleted", func(t *testing.T) {
+		kc := newKubeClient(t)
+		originalIngresses, err := kc.GetIngressResources(context.Background(), model.IngressFilter{})
+		assert.NoError(t, err)
+		originalK8sCm, err := kc.GetConfigMap(context.Background(), utils.K8sConfigMapName, utils.KubeSystem)
+		assert.NoError(t, err)
+
+		assert.NoError(t, HandleConfigMap(context.Background(), kc, model.MigrationModeTest, logger))
+		assert.NoError(t, HandleIngressResources(context.Background(), kc, model.MigrationModeTest, model.IngressFilter{}, 1, logger))
+
+		// generated ingress resource changed by the user to serve a production host must be kept
+		changedIngress, err := kc.GetIngress(context.Background(), "tea-ingress-server", "default")
+		assert.NoError(t, err)
+		changedIngress.Spec.Rules = append(changedIngress.Spec.Rules, networking.IngressRule{Host: "tea.example.com"})
+		assert.NoError(t, kc.CreateOrUpdateIngress(context.Background(), *changedIngress))
+
+		assert.NoError(t, HandleCleanup(context.Background(), kc, logger))
+
+		ingresses, err := kc.GetIngressResources(context.Background(), model.IngressFilter{})
+		assert.NoError(t, err)
+		assert.Equal(t, append(originalIngresses, *changedIngress), ingresses)
+
+		k8sCm, err := kc.GetConfigMap(context.Background(), utils.K8sConfigMapName, utils.KubeSystem)
+		assert.NoError(t, err)
+		assert.Equal(t, originalK8sCm.Data, k8sCm.Data)
+
+		for _, name := range []string{utils.TestK8sConfigMapName, utils.GenericK8sTCPConfigMapName, utils.MigrationStatusConfigMapName, utils.StatusShardName(0)} {
+			_, err = kc.GetConfigMap(context.Background(), name, utils.KubeSystem)
+			assert.True(t, k8sErrors.IsNotFound(err), name)
+		}
+
+		// the backup of the proxy secret is kept for the rollback of a later production migration
+		backups, err := utils.GetBackups(context.Background(), kc)
+		assert.NoError(t, err)
+		assert.Len(t, backups, 1)
+		assert.Equal(t, utils.SecretKind, backups[0].Kind)
+	})
+
+	t.Run("production mode migration is not cleaned up", func(t *testing.T) {
+		kc := newKubeClient(t)
+		assert.NoError(t, HandleIngressResources(context.Background(), kc, model.MigrationModeProduction, model.IngressFilter{}, 1, logger))
+		assert.EqualError(t, HandleCleanup(context.Background(), kc, logger), "the last migration ran in 'production' mode, only the artifacts of 'test' and 'test-with-private' mode migrations can be cleaned up")
+	})
+
+	t.Run("nothing to clean up", func(t *testing.T) {
+		assert.NoError(t, HandleCleanup(context.Background(), newKubeClient(t), logger))
+	})
+}
+
+func TestIsTestIngress(t *testing.T) {
+	testClass := utils.TestIngressClass
+	testSubdomains := map[string]bool{"abcdef.test.example.com": true}
+
+	testCases := []struct {
+		description    string
+		ingress        networking.Ingress
+		expectedResult bool
+	}{
+		{
+			description: "test ingress class annotation and test subdomain",
+			ingress: networking.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{utils.IngressClassAnnotation: utils.TestIngressClass}},
+				Spec: networking.IngressSpec{
+					Rules: []networking.IngressRule{{Host: "abcdef.test.example.com"}},
+					TLS:   []networking.IngressTLS{{Hosts: []string{"abcdef.test.example.com"}}},
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			description: "test ingress class name and test subdomain",
+			ingress: networking.Ingress{
+				Spec: networking.IngressSpec{
+					IngressClassName: &testClass,
+					Rules:            []networking.IngressRule{{Host: "abcdef.test.example.com"}},
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			description: "public ingress class",
+			ingress: networking.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{utils.IngressClassAnnotation: utils.PublicIngressClass}},
+				Spec:       networking.IngressSpec{Rules: []networking.IngressRule{{Host: "abcdef.test.example.com"}}},
+			},
+			expectedResult: false,
+		},
+		{
+			description: "not generated subdomain",
+			ingress: networking.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{utils.IngressClassAnnotation: utils.TestIngressClass}},
+				Spec:       networking.IngressSpec{Rules: []networking.IngressRule{{Host: "abcdef.test.example.com"}, {Host: "tea.example.com"}}},
+			},
+			expectedResult: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expectedResult, isTestIngress(tc.ingress, testSubdomains))
+		})
+	}
+}
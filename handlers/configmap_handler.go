@@ -14,6 +14,7 @@ limitations under the License.
 package handlers
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
@@ -26,27 +27,27 @@ import (
 )
 
 // HandleConfigMap top level function to parse the iks configmap and migrate to the k8s configmap
-func HandleConfigMap(kc utils.KubeClient, mode string, logger *zap.Logger) error {
+func HandleConfigMap(ctx context.Context, kc utils.KubeClient, mode string, logger *zap.Logger) error {
 	// 1.) get data from k8s configmap
 	// 2.) get data from iks configmap
 	// 3.) for keys in iks cm data
 	// 3a.) parse values and convert
 	// 		to k8s keys: value pairs
 	// 3b.) add/replace key value pair to/in k8s data map
-	// 4.) apply k8s configmap
+	// 4.) back up the original state and apply k8s configmap
 	// 4a.) in test mode:	create/update test k8s configmap
 	// 4b.) in prod mode:	update k8s configmap
 	// 5.) create/update status cm
 
 	logger.Info("starting to migrate iks controller configmap to k8s controller configmap", zap.String("mode", mode))
 
-	k8sCm, err := kc.GetConfigMap(utils.K8sConfigMapName, utils.KubeSystem)
+	k8sCm, err := kc.GetConfigMap(ctx, utils.K8sConfigMapName, utils.KubeSystem)
 	if err != nil {
 		logger.Error("error getting k8s configmap", zap.String("namespace", utils.KubeSystem), zap.String("name", utils.K8sConfigMapName), zap.Error(err))
 		return err
 	}
 
-	iksCm, err := kc.GetConfigMap(utils.IKSConfigMapName, utils.KubeSystem)
+	iksCm, err := kc.GetConfigMap(ctx, utils.IKSConfigMapName, utils.KubeSystem)
 	if err != nil {
 		if k8sErrors.IsNotFound(err) {
 			logger.Warn("iks cm is not present on the cluster, skipping cm migration")
@@ -62,11 +63,15 @@ func HandleConfigMap(kc utils.KubeClient, mode string, logger *zap.Logger) error
 		Namespace: utils.KubeSystem,
 	}
 
+	originalK8sCm := k8sCm.DeepCopy()
+	migratedData := map[string]string{}
+	var applyErr error
 	for key, value := range iksCm.Data {
 		k8sKey, k8sValue, warning, err := handleConfigMapData(key, value, iksCm.Data)
-		if warning != "" {
-			migrationInfo.Warnings = append(migrationInfo.Warnings, warning)
-			logger.Info("got warning while migrating iks configmap parameter", zap.String("key", key), zap.String("value", value), zap.String("warning", warning))
+		if warning != nil {
+			migrationInfo.Warnings = append(migrationInfo.Warnings, warning.Message)
+			migrationInfo.WarningDetails = append(migrationInfo.WarningDetails, *warning)
+			logger.Info("got warning while migrating iks configmap parameter", zap.String("key", key), zap.String("value", value), zap.String("warning", warning.Message))
 		}
 		if err != nil {
 			logger.Error("error parsing configmap parameter", zap.String("key", key), zap.String("value", value), zap.Error(err))
@@ -74,9 +79,11 @@ func HandleConfigMap(kc utils.KubeClient, mode string, logger *zap.Logger) error
 		}
 		if k8sKey != "" && k8sValue != "" {
 			k8sCm.Data[k8sKey] = k8sValue
+			migratedData[k8sKey] = k8sValue
 			logger.Info("successfully parsed and migrated iks configmap parameter", zap.String("iksKey", key), zap.String("iksValue", value), zap.String("k8sKey", k8sKey), zap.String("k8sValue", k8sValue))
 		}
 	}
+	utils.AcknowledgeWarnings(&migrationInfo, nil, logger)
 	if mode == model.MigrationModeTest || mode == model.MigrationModeTestWithPrivate {
 		testK8sCm := &v1.ConfigMap{
 			TypeMeta: k8sCm.TypeMeta,
@@ -86,40 +93,94 @@ func HandleConfigMap(kc utils.KubeClient, mode string, logger *zap.Logger) error
 			},
 			Data: k8sCm.Data,
 		}
+		utils.SetProvenance(&testK8sCm.ObjectMeta, &iksCm.ObjectMeta)
 
-		if err := kc.CreateConfigMap(testK8sCm); err != nil {
-			if !k8sErrors.IsAlreadyExists(err) {
-				logger.Error("failed to create test k8s configmap", zap.String("namespace", utils.KubeSystem), zap.String("name", utils.TestK8sConfigMapName), zap.Error(err))
-				return err
-			}
-			if err := kc.UpdateConfigmap(testK8sCm); err != nil {
-				logger.Error("failed to update test k8s configmap", zap.String("namespace", utils.KubeSystem), zap.String("name", utils.TestK8sConfigMapName), zap.Error(err))
-				return err
-			}
+		// the test configmap is owned by the migration tool, so it is removed by the rollback
+		if err := kc.CreateOrUpdateBackupCm(ctx, []model.ResourceBackup{{Kind: utils.ConfigMapKind, Name: utils.TestK8sConfigMapName, Namespace: utils.KubeSystem, Created: true}}); err != nil {
+			logger.Error("failed to back up test k8s configmap", zap.String("namespace", utils.KubeSystem), zap.String("name", utils.TestK8sConfigMapName), zap.Error(err))
+			return err
+		}
+
+		err := kc.CreateConfigMap(ctx, testK8sCm)
+		if err != nil && k8sErrors.IsAlreadyExists(err) {
+			err = kc.UpdateConfigmap(ctx, testK8sCm)
+		}
+		if err != nil {
+			logger.Error("failed to apply test k8s configmap", zap.String("namespace", utils.KubeSystem), zap.String("name", utils.TestK8sConfigMapName), zap.Error(err))
+			applyErr = err
+		} else {
+			logger.Info("successfully applied test k8s configmap", zap.String("namespace", utils.KubeSystem), zap.String("name", utils.TestK8sConfigMapName))
+			migrationInfo.MigratedAs = []string{fmt.Sprintf("%s/%s", utils.ConfigMapKind, utils.TestK8sConfigMapName)}
 		}
-		logger.Info("successfully applied test k8s configmap", zap.String("namespace", utils.KubeSystem), zap.String("name", utils.TestK8sConfigMapName))
-		migrationInfo.MigratedAs = []string{fmt.Sprintf("%s/%s", utils.ConfigMapKind, utils.TestK8sConfigMapName)}
 	} else {
-		if err := kc.UpdateConfigmap(k8sCm); err != nil {
-			logger.Error("failed to update k8s configmap", zap.String("namespace", utils.KubeSystem), zap.String("name", utils.K8sConfigMapName), zap.Error(err))
+		// the original values of the overwritten keys are backed up, so the rollback can restore them
+		if err := kc.CreateOrUpdateBackupCm(ctx, []model.ResourceBackup{utils.NewConfigMapBackup(originalK8sCm, k8sCm.Data)}); err != nil {
+			logger.Error("failed to back up k8s configmap", zap.String("namespace", utils.KubeSystem), zap.String("name", utils.K8sConfigMapName), zap.Error(err))
 			return err
 		}
-		logger.Info("successfully applied k8s configmap", zap.String("namespace", utils.KubeSystem), zap.String("name", utils.K8sConfigMapName))
-		migrationInfo.MigratedAs = []string{fmt.Sprintf("%s/%s", utils.ConfigMapKind, utils.K8sConfigMapName)}
+
+		// if the k8s configmap was changed since it was read, the migrated keys are merged into its current state
+		reread := false
+		err := utils.RetryOnConflict(func() error {
+			if reread {
+				var err error
+				if k8sCm, err = remergeK8sConfigMap(ctx, kc, migratedData); err != nil {
+					return err
+				}
+			}
+			reread = true
+			return kc.UpdateConfigmap(ctx, k8sCm)
+		})
+		if err != nil {
+			logger.Error("failed to update k8s configmap", zap.String("namespace", utils.KubeSystem), zap.String("name", utils.K8sConfigMapName), zap.Error(err))
+			applyErr = err
+		} else {
+			logger.Info("successfully applied k8s configmap", zap.String("namespace", utils.KubeSystem), zap.String("name", utils.K8sConfigMapName))
+			migrationInfo.MigratedAs = []string{fmt.Sprintf("%s/%s", utils.ConfigMapKind, utils.K8sConfigMapName)}
+		}
+	}
+
+	// the rejected configmap is recorded with the error, e.g. when an admission controller denied the request in dry-run mode
+	if applyErr != nil {
+		migrationInfo.Errors = []string{applyErr.Error()}
 	}
+	utils.ObserveMigratedResource(migrationInfo)
 
-	if err := kc.CreateOrUpdateStatusCm(mode, []model.MigratedResource{migrationInfo}, nil); err != nil {
+	// the outcome is recorded even if the migration was interrupted while the configmap was applied
+	reportCtx, cancel := utils.ReportContext(ctx)
+	defer cancel()
+	if err := kc.CreateOrUpdateStatusCm(reportCtx, mode, []model.MigratedResource{migrationInfo}, nil, nil); err != nil {
 		logger.Error("could not update status configmap", zap.Error(err))
 		return err
 	}
 	logger.Info("successfully updated status configmap")
 
+	if applyErr != nil {
+		return &utils.PartialMigrationError{Operation: "migrating the iks configmap", Errors: []error{applyErr}}
+	}
 	return nil
 }
 
+// remergeK8sConfigMap merges the migrated keys into the current state of the k8s configmap
+func remergeK8sConfigMap(ctx context.Context, kc utils.KubeClient, migratedData map[string]string) (*v1.ConfigMap, error) {
+	k8sCm, err := kc.GetConfigMap(ctx, utils.K8sConfigMapName, utils.KubeSystem)
+	if err != nil {
+		return nil, err
+	}
+	if err := kc.CreateOrUpdateBackupCm(ctx, []model.ResourceBackup{utils.NewConfigMapBackup(k8sCm, migratedData)}); err != nil {
+		return nil, err
+	}
+	if k8sCm.Data == nil {
+		k8sCm.Data = map[string]string{}
+	}
+	for key, value := range migratedData {
+		k8sCm.Data[key] = value
+	}
+	return k8sCm, nil
+}
+
 // handleConfigMapData general function to abstract parsing the individual configmap key values
-// returns the new key, value and optionally a warning message
-func handleConfigMapData(key, value string, iksCm map[string]string) (k8sKey string, k8sValue string, warning string, err error) {
+func handleConfigMapData(key, value string, iksCm map[string]string) (k8sKey string, k8sValue string, warning *model.Warning, err error) {
 	switch key {
 	case "public-ports", "private-ports":
 		// public-ports and private-ports are ignored, as users would modify this configmap parameter in two cases:
@@ -138,14 +199,21 @@ func handleConfigMapData(key, value string, iksCm map[string]string) (k8sKey str
 
 	migratorFunc, funcDefined := parsers.ConfigMapParameterParserFunctions[key]
 	if !funcDefined {
-		warning = fmt.Sprintf(utils.UnsupportedCMParameter, key)
+		unsupportedWarning := utils.NewWarningOf(utils.UnsupportedCMParameter, key)
+		warning = &unsupportedWarning
 		err = fmt.Errorf("unsupported configmap parameter")
 		return
 	}
 
-	k8sKey, k8sValue, warning, err = migratorFunc(value, iksCm)
+	k8sKey, k8sValue, parserWarning, err := migratorFunc(value, iksCm)
 	if err != nil {
-		warning = fmt.Sprintf(utils.ErrorProcessingCMParameter, key)
+		processingWarning := utils.NewWarningOf(utils.ErrorProcessingCMParameter, key)
+		return k8sKey, k8sValue, &processingWarning, err
+	}
+	if parserWarning != "" {
+		// the parser functions return one of the warning messages without formatting
+		parameterWarning := utils.NewWarningOf(parserWarning)
+		warning = &parameterWarning
 	}
 	return
 }
@@ -14,6 +14,7 @@ limitations under the License.
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -86,6 +87,7 @@ func TestHandleConfigMap(t *testing.T) {
 		iksCm                *v1.ConfigMap
 		expectedK8sCm        *v1.ConfigMap
 		expectedResourceInfo []model.MigratedResource
+		updateErr            error
 		expectedErr          error
 	}{
 		{
@@ -213,6 +215,46 @@ func TestHandleConfigMap(t *testing.T) {
 			},
 			expectedErr: nil,
 		},
+		{
+			description: "error path k8s configmap update rejected",
+			mode:        model.MigrationModeProduction,
+			k8sCm: &v1.ConfigMap{
+				ObjectMeta: v12.ObjectMeta{
+					Name:      utils.K8sConfigMapName,
+					Namespace: utils.KubeSystem,
+				},
+				// the default data is changed by the previous cases
+				Data: defaultK8sConfigMapDataWithUpdates(map[string]string{}),
+			},
+			iksCm: &v1.ConfigMap{
+				ObjectMeta: v12.ObjectMeta{
+					Name:      utils.IKSConfigMapName,
+					Namespace: utils.KubeSystem,
+				},
+				Data: map[string]string{
+					"ssl-ciphers": "HIGH:!aNULL:!MD5",
+				},
+			},
+			expectedK8sCm: &v1.ConfigMap{
+				ObjectMeta: v12.ObjectMeta{
+					Name:      utils.K8sConfigMapName,
+					Namespace: utils.KubeSystem,
+				},
+				Data: defaultK8sConfigMapDataWithUpdates(map[string]string{
+					"ssl-ciphers": "HIGH:!aNULL:!MD5",
+				}),
+			},
+			expectedResourceInfo: []model.MigratedResource{
+				{
+					Kind:      utils.ConfigMapKind,
+					Name:      utils.IKSConfigMapName,
+					Namespace: utils.KubeSystem,
+					Errors:    []string{"admission webhook denied the request"},
+				},
+			},
+			updateErr:   fmt.Errorf("admission webhook denied the request"),
+			expectedErr: &utils.PartialMigrationError{Operation: "migrating the iks configmap", Errors: []error{fmt.Errorf("admission webhook denied the request")}},
+		},
 		{
 			description: "error path missing iks configmap",
 			mode:        model.MigrationModeProduction,
@@ -256,11 +298,12 @@ func TestHandleConfigMap(t *testing.T) {
 				ExpectedK8sCm:         tc.expectedK8sCm,
 				ExpectedResourceInfo:  tc.expectedResourceInfo,
 				ExpectedMigrationMode: tc.mode,
+				UpdateCMErr:           tc.updateErr,
 			}
 
 			logger, _ := utils.GetZapLogger("")
 
-			err := HandleConfigMap(&tkc, tc.mode, logger)
+			err := HandleConfigMap(context.Background(), &tkc, tc.mode, logger)
 			assert.Equal(t, tc.expectedErr, err)
 		})
 	}
@@ -15,9 +15,11 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
 	"github.com/IBM-Cloud/iks-ingress-migration-tool/parsers"
@@ -25,6 +27,7 @@ import (
 	"go.uber.org/zap"
 	v1 "k8s.io/api/core/v1"
 	networking "k8s.io/api/networking/v1beta1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"sigs.k8s.io/yaml"
@@ -44,101 +47,72 @@ var (
 )
 
 // HandleIngressResources top level function to parse and migrate ingress resources
-func HandleIngressResources(kc utils.KubeClient, mode string, logger *zap.Logger) error {
-	// 1.) getting ingress resources
-	// 2.) processing ingress resources one-by-one
-	// 2a.) checking if ingress should be skipped (based on name+namespace or ingress class)
-	// 2b.) parsing ingress resource, creating intermediate config (IngressConfig)
-	// 2c.) creating separate intermediate configs (SingleIngressConfig)
-	// 2d.) generating new ingress resources from template
-	// 2e.) applying new ingress
-	// 2f.) update the ConfigMaps based on the ingress data
-	// 3.) create/update status cm
-
-	logger.Info("starting to migrate iks formatted ingress resources to k8s formatted ingress resources", zap.String("mode", mode))
-
-	ingresses, err := kc.GetIngressResources()
+func HandleIngressResources(ctx context.Context, kc utils.KubeClient, mode string, filter model.IngressFilter, concurrency int, logger *zap.Logger) error {
+	// 1.) getting ingress resources selected by the filter
+	// 2.) checking if ingress should be skipped (based on name+namespace or ingress class)
+	// 3.) processing ingress resources in parallel
+	// 3a.) parsing ingress resource, creating intermediate config (IngressConfig)
+	// 3b.) creating separate intermediate configs (SingleIngressConfig)
+	// 3c.) generating new ingress resources from template
+	// 3d.) applying new ingress, unless the current one was generated from the same source with the same content
+	// 4.) update the ConfigMaps based on the ingress data one-by-one in the order of the ingress list
+	// 5.) create/update status cm
+
+	logger.Info("starting to migrate iks formatted ingress resources to k8s formatted ingress resources", zap.String("mode", mode), zap.Any("filter", filter), zap.Int("concurrency", concurrency))
+
+	ingresses, err := kc.GetIngressResources(ctx, filter)
 	if err != nil {
 		logger.Error("failed to get ingress resources", zap.Error(err))
-		return err
+		return &utils.APIError{Err: err}
 	}
 	logger.Info("successfully got ingress resources", zap.Int("numberOfIngresses", len(ingresses)))
 
+	results := processIngressResources(ctx, kc, ingresses, mode, concurrency, logger)
+
 	var errors []error
+	var migratedIngresses []networking.Ingress
 	var migrationInfos []model.MigratedResource
 	var subdomainMap map[string]string
 	albSpecificData := utils.ALBSpecificData{}
-	for i := range ingresses {
-		if utils.IngressInArray(ingresses[i], skipIngresses, utils.IngressNameNamespaceEquals) {
-			logger.Info("skipping ingress resource based on its name and namespace", zap.String("name", ingresses[i].Name), zap.String("namespace", ingresses[i].Namespace))
-			continue
-		}
-		if utils.IngressInArray(ingresses[i], skipIngresses, utils.IngressClassEquals) {
-			logger.Info("skipping ingress resource based on its ingress class", zap.String("ingressClass", ingresses[i].ObjectMeta.Annotations[utils.IngressClassAnnotation]), zap.String("name", ingresses[i].Name), zap.String("namespace", ingresses[i].Namespace))
-			continue
-		}
-		// ingress resource considered to be private if it has ALB-ID annotation and specifies at least one private ALB ID
-		if strings.Contains(parsers.GetALBID(&ingresses[i], logger), "private") && mode == model.MigrationModeTest {
-			logger.Info("skipping ingress resource because it has ALB-ID annotation with at least one private ALB ID and the migration is running in 'test' mode")
+	for i, result := range results {
+		if result == nil {
+			// the ingress resource was skipped
 			continue
 		}
 
-		logger.Info("starting to process ingress resource", zap.String("name", ingresses[i].Name), zap.String("namespace", ingresses[i].Namespace))
-
-		ingressConfig, ingressToCM, albIDs, warnings, errs := getIngressConfig(kc, ingresses[i], mode, logger)
-
-		if len(errs) > 0 {
-			errors = append(errors, errs...)
-			logger.Error("failed to create ingress config", zap.String("name", ingresses[i].Name), zap.String("namespace", ingresses[i].Namespace), zap.Errors("errors", errs))
+		// the ALB specific data and the TCP port configmaps are shared by the ingress resources, so they are updated sequentially
+		var migrationInfo model.MigratedResource
+		var errs []error
+		migrationInfo, albSpecificData, errs = recordIngressResult(ctx, kc, ingresses[i], result, mode, albSpecificData, logger)
+		utils.ObserveMigratedResource(migrationInfo)
+		errors = append(errors, errs...)
+		migratedIngresses = append(migratedIngresses, ingresses[i])
+		migrationInfos = append(migrationInfos, migrationInfo)
+		if result.configErrors != nil {
 			continue
-		} else {
-			logger.Info("successfully created ingress config for resource", zap.String("name", ingresses[i].Name), zap.String("namespace", ingresses[i].Namespace))
-		}
-
-		resources, subdomains, errs := createIngressResources(kc, mode, ingressConfig, logger)
-		if errs != nil {
-			errors = append(errors, errs...)
-			warnings = append(warnings, utils.ErrorCreatingIngressResources)
-			logger.Error("errors occurred while creating and applying ingress resources", zap.Errors("errors", errors))
-		} else {
-			logger.Info("successfully created and applied ingress resources", zap.String("name", ingresses[i].Name), zap.String("namespace", ingresses[i].Namespace))
-		}
-		var cmResources []string
-		var warns []string
-		cmResources, warns, albSpecificData, errs = HandleIngressToCMData(kc, ingressToCM, albIDs, mode, albSpecificData, logger)
-		if errs != nil {
-			errors = append(errors, errs...)
-			logger.Error("error handling ingress to CM data", zap.Error(err))
-		} else {
-			logger.Info("successfully applied ingress resources into config map resources", zap.String("name", ingresses[i].Name), zap.String("namespace", ingresses[i].Namespace))
-		}
-		if warns != nil {
-			warnings = append(warnings, warns...)
-		}
-		if cmResources != nil {
-			resources = append(resources, cmResources...)
 		}
 
-		migrationInfos = append(migrationInfos, model.MigratedResource{
-			Kind:       utils.IngressKind,
-			Name:       ingresses[i].Name,
-			Namespace:  ingresses[i].Namespace,
-			Warnings:   warnings,
-			MigratedAs: resources,
-		})
-
 		if subdomainMap == nil {
-			subdomainMap = subdomains
+			subdomainMap = result.subdomains
 		} else {
-			for userSubdomain, testSubdomain := range subdomains {
+			for userSubdomain, testSubdomain := range result.subdomains {
 				subdomainMap[userSubdomain] = testSubdomain
 			}
 		}
 	}
 
-	logger.Info("migration of ingress resources finished", zap.Int("numberOfMigratedIngresses", len(migrationInfos)))
+	recordAllIngressEvents(ctx, kc, migratedIngresses, migrationInfos, concurrency, logger)
+
+	if err := ctx.Err(); err != nil {
+		logger.Warn("migration of ingress resources was interrupted", zap.Int("numberOfMigratedIngresses", len(migrationInfos)), zap.Error(err))
+		errors = append(errors, fmt.Errorf("the migration of the ingress resources was interrupted: %w", err))
+	} else {
+		logger.Info("migration of ingress resources finished", zap.Int("numberOfMigratedIngresses", len(migrationInfos)))
+	}
 
-	if err := kc.CreateOrUpdateStatusCm(mode, migrationInfos, subdomainMap); err != nil {
+	reportCtx, cancel := utils.ReportContext(ctx)
+	defer cancel()
+	if err := kc.CreateOrUpdateStatusCm(reportCtx, mode, migrationInfos, subdomainMap, &filter); err != nil {
 		logger.Error("could not update status configmap", zap.Error(err))
 		errors = append(errors, err)
 	} else {
@@ -146,14 +120,268 @@ func HandleIngressResources(kc utils.KubeClient, mode string, logger *zap.Logger
 	}
 
 	if len(errors) > 0 {
-		return fmt.Errorf("error occurred while processing ingress resources: %v", errors)
+		return &utils.PartialMigrationError{Operation: "processing ingress resources", Errors: errors}
 	}
 
 	return nil
 }
 
+// recordIngressResult applies the configmap data of the processed ingress resource and returns its migration status
+func recordIngressResult(ctx context.Context, kc utils.KubeClient, ingress networking.Ingress, result *ingressResult, mode string, albSpecificData utils.ALBSpecificData, logger *zap.Logger) (model.MigratedResource, utils.ALBSpecificData, []error) {
+	if result.configErrors != nil {
+		migrationInfo := model.MigratedResource{
+			Kind:           utils.IngressKind,
+			Name:           ingress.Name,
+			Namespace:      ingress.Namespace,
+			Warnings:       utils.WarningMessages(result.warnings),
+			Errors:         errorMessages(result.configErrors),
+			WarningDetails: result.warnings,
+		}
+		utils.AcknowledgeWarnings(&migrationInfo, &ingress, logger)
+		return migrationInfo, albSpecificData, result.configErrors
+	}
+
+	warnings := result.warnings
+	resources := result.resources
+	resourceErrors := result.resourceErrors
+	errors := append([]error{}, result.resourceErrors...)
+
+	cmResources, warns, albSpecificData, errs := HandleIngressToCMData(ctx, kc, result.ingressToCM, result.albIDs, mode, albSpecificData, logger)
+	if errs != nil {
+		errors = append(errors, errs...)
+		resourceErrors = append(resourceErrors, errs...)
+		logger.Error("error handling ingress to CM data", zap.String("name", ingress.Name), zap.String("namespace", ingress.Namespace), zap.Errors("errors", errs))
+	} else {
+		logger.Info("successfully applied ingress resources into config map resources", zap.String("name", ingress.Name), zap.String("namespace", ingress.Namespace))
+	}
+	var tcpServices []string
+	for _, tcpPort := range result.ingressToCM.TCPPorts {
+		tcpServices = append(tcpServices, tcpPort.ServiceName)
+	}
+	for _, warning := range warns {
+		warnings = append(warnings, utils.WithAffectedServices(warning, &ingress, tcpServices))
+	}
+	if cmResources != nil {
+		resources = append(resources, cmResources...)
+	}
+
+	migrationInfo := model.MigratedResource{
+		Kind:           utils.IngressKind,
+		Name:           ingress.Name,
+		Namespace:      ingress.Namespace,
+		Warnings:       utils.WarningMessages(warnings),
+		MigratedAs:     resources,
+		Unchanged:      result.unchanged,
+		Errors:         errorMessages(resourceErrors),
+		WarningDetails: warnings,
+	}
+	utils.AcknowledgeWarnings(&migrationInfo, &ingress, logger)
+	return migrationInfo, albSpecificData, errors
+}
+
+// recordIngressEvents records the outcome of the migration as events on the source ingress resource
+func recordIngressEvents(ctx context.Context, kc utils.KubeClient, ingress *networking.Ingress, migrationInfo model.MigratedResource, logger *zap.Logger) {
+	if err := kc.RecordIngressEvents(ctx, ingress, utils.NewIngressEvents(migrationInfo)); err != nil {
+		logger.Warn("error recording events on the ingress resource", zap.String("name", ingress.Name), zap.String("namespace", ingress.Namespace), zap.Error(err))
+	}
+}
+
+// recordAllIngressEvents records the events of the migrated ingress resources with concurrency parallel workers
+func recordAllIngressEvents(ctx context.Context, kc utils.KubeClient, ingresses []networking.Ingress, migrationInfos []model.MigratedResource, concurrency int, logger *zap.Logger) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if ctx.Err() != nil {
+					continue
+				}
+				recordIngressEvents(ctx, kc, &ingresses[i], migrationInfos[i], logger)
+			}
+		}()
+	}
+	for i := range ingresses {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// ingressResult contains the outcome of processing a single ingress resource by a worker
+type ingressResult struct {
+	ingressToCM utils.IngressToCM
+	albIDs      string
+	resources   []string
+	// unchanged contains the generated resources that were not applied, because they did not change since the last run
+	unchanged  []string
+	subdomains map[string]string
+	warnings   []model.Warning
+	// configErrors is set if the ingress config could not be created, so no resources were generated for the ingress resource
+	configErrors []error
+	// resourceErrors is set if some of the generated resources could not be applied
+	resourceErrors []error
+}
+
+// processIngressResources processes the ingress resources with concurrency parallel workers
+func processIngressResources(ctx context.Context, kc utils.KubeClient, ingresses []networking.Ingress, mode string, concurrency int, logger *zap.Logger) []*ingressResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]*ingressResult, len(ingresses))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if ctx.Err() != nil {
+					continue
+				}
+				results[i] = processIngressResource(ctx, kc, ingresses[i], mode, logger)
+			}
+		}()
+	}
+
+	for i := range ingresses {
+		if !skipIngressResource(ingresses[i], mode, logger) {
+			indexes <- i
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// skipIngressResource returns true if the ingress resource should not be migrated
+func skipIngressResource(ingress networking.Ingress, mode string, logger *zap.Logger) bool {
+	if utils.IngressInArray(ingress, skipIngresses, utils.IngressNameNamespaceEquals) {
+		logger.Info("skipping ingress resource based on its name and namespace", zap.String("name", ingress.Name), zap.String("namespace", ingress.Namespace))
+		utils.ObserveSkippedIngress()
+		return true
+	}
+	if utils.IngressInArray(ingress, skipIngresses, utils.IngressClassEquals) {
+		logger.Info("skipping ingress resource based on its ingress class", zap.String("ingressClass", ingress.ObjectMeta.Annotations[utils.IngressClassAnnotation]), zap.String("name", ingress.Name), zap.String("namespace", ingress.Namespace))
+		utils.ObserveSkippedIngress()
+		return true
+	}
+	// ingress resource considered to be private if it has ALB-ID annotation and specifies at least one private ALB ID
+	if strings.Contains(parsers.GetALBID(&ingress, logger), "private") && mode == model.MigrationModeTest {
+		logger.Info("skipping ingress resource because it has ALB-ID annotation with at least one private ALB ID and the migration is running in 'test' mode")
+		utils.ObserveSkippedIngress()
+		return true
+	}
+	return false
+}
+
+// processIngressResource creates and applies the new ingress resources generated from the ingress resource
+func processIngressResource(ctx context.Context, kc utils.KubeClient, ingress networking.Ingress, mode string, logger *zap.Logger) *ingressResult {
+	logger.Info("starting to process ingress resource", zap.String("name", ingress.Name), zap.String("namespace", ingress.Namespace))
+
+	ingressConfig, ingressToCM, albIDs, warnings, errs := getIngressConfig(ctx, kc, ingress, mode, logger)
+	if len(errs) > 0 {
+		logger.Error("failed to create ingress config", zap.String("name", ingress.Name), zap.String("namespace", ingress.Namespace), zap.Errors("errors", errs))
+		return &ingressResult{warnings: warnings, configErrors: errs}
+	}
+	logger.Info("successfully created ingress config for resource", zap.String("name", ingress.Name), zap.String("namespace", ingress.Namespace))
+	ingressConfig.SourceHash = utils.SourceHash(ingress)
+
+	result := &ingressResult{ingressToCM: ingressToCM, albIDs: albIDs, warnings: warnings}
+	result.resources, result.unchanged, result.subdomains, errs = createIngressResources(ctx, kc, mode, ingressConfig, logger)
+	if errs != nil {
+		result.resourceErrors = errs
+		result.warnings = append(result.warnings, utils.NewWarningOf(utils.ErrorCreatingIngressResources))
+		logger.Error("errors occurred while creating and applying ingress resources", zap.String("name", ingress.Name), zap.String("namespace", ingress.Namespace), zap.Errors("errors", errs))
+	} else {
+		logger.Info("successfully created and applied ingress resources", zap.String("name", ingress.Name), zap.String("namespace", ingress.Namespace))
+
+		// the source ingress resource refers to the generated ingress resources, so they can be found without the status configmap
+		// it is not annotated again if none of the generated ingress resources changed
+		generatedNames := generatedIngressNames(result.resources)
+		if len(result.unchanged) == len(result.resources) && ingress.Annotations[utils.MigratedToAnnotation] == strings.Join(generatedNames, ",") {
+			logger.Info("skipping the annotation of the unchanged source ingress resource", zap.String("name", ingress.Name), zap.String("namespace", ingress.Namespace))
+		} else if err := kc.AnnotateIngress(ctx, ingress.Name, ingress.Namespace, utils.SourceAnnotations(generatedNames)); err != nil {
+			logger.Error("failed to annotate the source ingress resource", zap.String("name", ingress.Name), zap.String("namespace", ingress.Namespace), zap.Error(err))
+			result.resourceErrors = []error{fmt.Errorf("failed to annotate the source ingress resource %s/%s: %v", ingress.Namespace, ingress.Name, err)}
+		}
+	}
+	return result
+}
+
+// generatedIngressNames returns the names of the generated ingress resources from the migrated resource list (e.g. Ingress/tea-server)
+func generatedIngressNames(resources []string) []string {
+	var names []string
+	for _, resource := range resources {
+		if name := strings.TrimPrefix(resource, utils.IngressKind+"/"); name != resource {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// deleteGeneratedIngresses deletes the ingress resources generated from the source ingress resource, except the kept ones
+func deleteGeneratedIngresses(ctx context.Context, kc utils.KubeClient, namespace, sourceName string, keep map[string]bool, logger *zap.Logger) []error {
+	logger = logger.With(zap.String("name", sourceName), zap.String("namespace", namespace))
+
+	generatedIngresses, err := kc.GetIngressResources(ctx, model.IngressFilter{Namespaces: []string{namespace}, Selector: utils.MigratedFromSelector(sourceName)})
+	if err != nil {
+		logger.Error("error listing the ingress resources generated from the source ingress resource", zap.Error(err))
+		return []error{err}
+	}
+
+	var errors []error
+	for _, ingress := range generatedIngresses {
+		if keep[ingress.Name] || ingress.Annotations[utils.MigratedFromAnnotation] != namespace+"/"+sourceName {
+			continue
+		}
+		if err := kc.DeleteIngress(ctx, ingress.Name, ingress.Namespace); err != nil && !k8sErrors.IsNotFound(err) {
+			logger.Error("error deleting generated ingress resource", zap.String("generatedName", ingress.Name), zap.Error(err))
+			errors = append(errors, err)
+			continue
+		}
+		logger.Info("successfully deleted generated ingress resource", zap.String("generatedName", ingress.Name))
+	}
+	return errors
+}
+
+// errorMessages returns the messages of the errors to record them in the status configmap
+func errorMessages(errs []error) []string {
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return messages
+}
+
+// annotationServices returns the services of the annotation values, the values configured for every service have no service
+func annotationServices(values map[string]string) []string {
+	var services []string
+	for service := range values {
+		services = append(services, service)
+	}
+	return services
+}
+
+// servicesWithValue returns the services of the annotation values with the value
+func servicesWithValue(values map[string]string, value string) []string {
+	var services []string
+	for service := range values {
+		if values[service] == value {
+			services = append(services, service)
+		}
+	}
+	return services
+}
+
 // getIngressConfig parses the ingress resource and returns the generated intermediate config and warnings occurred during processing
-func getIngressConfig(kc utils.KubeClient, ingress networking.Ingress, mode string, logger *zap.Logger) (utils.IngressConfig, utils.IngressToCM, string, []string, []error) {
+func getIngressConfig(ctx context.Context, kc utils.KubeClient, ingress networking.Ingress, mode string, logger *zap.Logger) (utils.IngressConfig, utils.IngressToCM, string, []model.Warning, []error) {
 	logger = logger.With(zap.String("function", "getIngressConfig"), zap.String("resourceName", ingress.Name), zap.String("resourceNamespace", ingress.Namespace))
 
 	logger.Info("starting to create ingress config")
@@ -187,7 +415,7 @@ func getIngressConfig(kc utils.KubeClient, ingress networking.Ingress, mode stri
 		}
 	}
 	if ALBIDs != "" {
-		warnings = append(warnings, utils.ALBSelection)
+		warnings = append(warnings, utils.NewWarningOf(utils.ALBSelection))
 	}
 
 	var errors []error
@@ -225,7 +453,7 @@ func getIngressConfig(kc utils.KubeClient, ingress networking.Ingress, mode stri
 	// rewrite-path ...
 	rewrites := getAnnotationByServices(&ingress, logger, parsers.GetRewrites)
 	if len(rewrites) != 0 {
-		warnings = append(warnings, utils.RewritesWarning)
+		warnings = append(warnings, utils.WithAffectedServices(utils.NewWarningOf(utils.RewritesWarning), &ingress, annotationServices(rewrites)))
 	}
 
 	// proxy-read-timeout ...
@@ -259,10 +487,10 @@ func getIngressConfig(kc utils.KubeClient, ingress networking.Ingress, mode stri
 	// the community ingress controller expects "namespace/secretname" format for the proxy-ssl-secret
 	// the community ingress controller expects "ca.crt", "tls.key", and "tls.crt" keys in the proxy-ssl-secret
 	for service, secretName := range proxySSLSecret {
-		var secretWarnings []string
+		var secretWarnings []model.Warning
 		var secret *v1.Secret
 		if secretName != "" {
-			secret, secretWarnings, err = utils.UpdateProxySecret(kc, secretName, ingress.Namespace, logger)
+			secret, secretWarnings, err = utils.UpdateProxySecret(ctx, kc, secretName, ingress.Namespace, logger)
 			if err != nil {
 				logger.Error("Could not update the ssl-services secret to be compatible with the Kubernetes Ingress controller", zap.String("service", service), zap.String("secret name", secretName))
 				errors = append(errors, err)
@@ -271,7 +499,9 @@ func getIngressConfig(kc utils.KubeClient, ingress networking.Ingress, mode stri
 			if secret != nil {
 				proxySSLSecret[service] = fmt.Sprintf("%s/%s", secret.Namespace, secretName)
 			}
-			warnings = append(warnings, secretWarnings...)
+			for _, secretWarning := range secretWarnings {
+				warnings = append(warnings, utils.WithAffectedServices(secretWarning, &ingress, []string{service}))
+			}
 		}
 	}
 
@@ -304,11 +534,11 @@ func getIngressConfig(kc utils.KubeClient, ingress networking.Ingress, mode stri
 	}
 	// there's at least one service without "secure"
 	if utils.ValueInMap("", stickyCookieSecure) {
-		warnings = append(warnings, utils.StickyCookieServicesWarningNoSecure)
+		warnings = append(warnings, utils.WithAffectedServices(utils.NewWarningOf(utils.StickyCookieServicesWarningNoSecure), &ingress, servicesWithValue(stickyCookieSecure, "")))
 	}
 	// there's at least one service without "httponly"
 	if utils.ValueInMap("", stickyCookieHttponly) {
-		warnings = append(warnings, utils.StickyCookieServicesWarningNoHttponly)
+		warnings = append(warnings, utils.WithAffectedServices(utils.NewWarningOf(utils.StickyCookieServicesWarningNoHttponly), &ingress, servicesWithValue(stickyCookieHttponly, "")))
 	}
 
 	// mutual-auth ...
@@ -319,7 +549,7 @@ func getIngressConfig(kc utils.KubeClient, ingress networking.Ingress, mode stri
 	// community ingress controller expects "namespace/secretname" format
 	var mutualAuthSecretNameWithNamespace string
 	if mutualAuthSecretName != "" {
-		secret, err := utils.LookupSecret(kc, mutualAuthSecretName, ingress.Namespace, logger)
+		secret, err := utils.LookupSecret(ctx, kc, mutualAuthSecretName, ingress.Namespace, logger)
 		if err != nil {
 			logger.Error("Could not find mutual-auth secret", zap.String("secret name", mutualAuthSecretName))
 		}
@@ -330,7 +560,7 @@ func getIngressConfig(kc utils.KubeClient, ingress networking.Ingress, mode stri
 		return (mutualAuthSecretName != "") && (mutualAuthPort != "")
 	}
 	if mutualAuthIsSet() && mutualAuthPort != "443" {
-		warnings = append(warnings, utils.MutualAuthWarningCustomPort)
+		warnings = append(warnings, utils.NewWarningOf(utils.MutualAuthWarningCustomPort))
 	}
 
 	// appid-auth ...
@@ -358,25 +588,29 @@ func getIngressConfig(kc utils.KubeClient, ingress networking.Ingress, mode stri
 	// work needs to be done when there is at least one service protected with appid authentication
 	if len(appidAuthBindingSecret) > 0 {
 		// users must enable alb-oauth2-proxy addon and add new callback URLs to make appid authentication possible with the community ingress controller
-		warnings = append(warnings, utils.AppIDAuthEnableAddon)
-		warnings = append(warnings, utils.AppIDAuthAddCallbacks)
+		appidServices := annotationServices(appidAuthBindingSecret)
+		warnings = append(warnings, utils.WithAffectedServices(utils.NewWarningOf(utils.AppIDAuthEnableAddon), &ingress, appidServices))
+		warnings = append(warnings, utils.WithAffectedServices(utils.NewWarningOf(utils.AppIDAuthAddCallbacks), &ingress, appidServices))
 		// adding/appending necessary snippets to configuration-snippet
 		var locationSnippetConflict bool
 		locationSnippets, locationSnippetConflict = AddAuthConfigToLocationSnippets(locationSnippets, appidAuthBindingSecret, appidAuthIDToken, logger)
 		if locationSnippetConflict {
-			warnings = append(warnings, utils.AppIDAuthConfigSnippetConflict)
+			warnings = append(warnings, utils.WithAffectedServices(utils.NewWarningOf(utils.AppIDAuthConfigSnippetConflict), &ingress, appidServices))
 			// if we couldn't update the configuration-snippet, we don't add auth-url and auth-signin annotations
 			appidAuthURL = func(_ string) string { return "" }
 			appidSignInURL = func(_ string) string { return "" }
 		}
 	}
 	// appid binding secret must reside in the same namespace with the created ingress resource
-	for _, appidNs := range appidAuthNamespace {
+	var appidOtherNamespaceServices []string
+	for service, appidNs := range appidAuthNamespace {
 		if ingress.Namespace != appidNs {
-			warnings = append(warnings, utils.AppIDAuthDifferentNamespace)
-			break
+			appidOtherNamespaceServices = append(appidOtherNamespaceServices, service)
 		}
 	}
+	if appidOtherNamespaceServices != nil {
+		warnings = append(warnings, utils.WithAffectedServices(utils.NewWarningOf(utils.AppIDAuthDifferentNamespace), &ingress, appidOtherNamespaceServices))
+	}
 
 	// large-client-header-buffers ...
 	largeClientHeaderBuffers := getAnnotation(&ingress, logger, parsers.GetLargeClientHeaderBuffers)
@@ -406,25 +640,25 @@ func getIngressConfig(kc utils.KubeClient, ingress networking.Ingress, mode stri
 	// location-modifier ...
 	locationModifiers := getAnnotationByServices(&ingress, logger, parsers.GetLocationModifier)
 	if len(locationModifiers) != 0 {
-		for _, locationModifier := range locationModifiers {
+		for service, locationModifier := range locationModifiers {
 			if locationModifier == "'~'" {
 				errors = append(errors, fmt.Errorf("The ingress resource cannot be migrated due to the usage of the '~' location modifier which is not supported by the Kubernetes Ingress Controller"))
-				warnings = append(warnings, utils.LocationModifierGenericWarning)
+				warnings = append(warnings, utils.WithAffectedServices(utils.NewWarningOf(utils.LocationModifierGenericWarning), &ingress, []string{service}))
 				break
 			}
 			if locationModifier == "'^~'" {
 				errors = append(errors, fmt.Errorf("The ingress resource cannot be migrated due to the usage of the '^~' location modifier which is not supported by the Kubernetes Ingress Controller"))
-				warnings = append(warnings, utils.LocationModifierGenericWarning)
+				warnings = append(warnings, utils.WithAffectedServices(utils.NewWarningOf(utils.LocationModifierGenericWarning), &ingress, []string{service}))
 				break
 			}
 			if locationModifier == "'='" && !kc.IsIngressEnhancementsEnabled() {
 				errors = append(errors, fmt.Errorf("The ingress resource cannot be migrated due to the usage of the '=' location modifier which is not supported by the Kubernetes Ingress Controller with Kubernetes versions under 1.18"))
 				errors = append(errors, fmt.Errorf("- ingress resource could not be migrated as the '=' location modifiers are not compatible with the Kubernetes Ingress Controller. Beginning with Kubernetes 1.18, paths defined in Ingress resources have a 'pathType' attribute that can be set to 'Exact' for exact matching (https://kubernetes.io/docs/concepts/services-networking/ingress/#path-types). If you want to automatically migrate the ingress resource, create a copy of it that does not have the 'ingress.bluemix.net/location-modifier' annotation, or upgrade your cluster to Kubernetes 1.18+, then run migration again"))
-				warnings = append(warnings, utils.LocationModifierGenericWarning)
+				warnings = append(warnings, utils.WithAffectedServices(utils.NewWarningOf(utils.LocationModifierGenericWarning), &ingress, []string{service}))
 				break
 			}
 		}
-		warnings = append(warnings, utils.LocationModifierWarning)
+		warnings = append(warnings, utils.WithAffectedServices(utils.NewWarningOf(utils.LocationModifierWarning), &ingress, annotationServices(locationModifiers)))
 	}
 	useRegex := func(service string) bool {
 		return locationModifiers[service] == "'~*'"
@@ -697,7 +931,7 @@ func AddAuthConfigToLocationSnippets(locationSnippets map[string][]string, bindi
 }
 
 // createIngressResources generates and applies individual ingress resources
-func createIngressResources(kc utils.KubeClient, mode string, ingressConfig utils.IngressConfig, lgr *zap.Logger) (resources []string, subdomains map[string]string, errors []error) {
+func createIngressResources(ctx context.Context, kc utils.KubeClient, mode string, ingressConfig utils.IngressConfig, lgr *zap.Logger) (resources, unchanged []string, subdomains map[string]string, errors []error) {
 	logger := lgr.With(zap.String("function", "createIngressResources"), zap.String("originalResourceName", ingressConfig.IngressObj.Name), zap.String("originalResourceNamespace", ingressConfig.IngressObj.Namespace))
 	logger.Info("starting to create and apply the ingress resources")
 
@@ -717,14 +951,26 @@ func createIngressResources(kc utils.KubeClient, mode string, ingressConfig util
 			continue
 		}
 		logger.Info("successfully generated ingress resource", zap.String("name", ing.Name))
+		utils.SetProvenance(&ing.ObjectMeta, &ingressConfig.IngressObj)
+		utils.SetContentHashes(&ing, ingressConfig.SourceHash)
+		resource := fmt.Sprintf("%s/%s", utils.IngressKind, ing.Name)
+
+		// the ingress resource is applied if it could not be read, the request errors are returned by the apply request
+		if current, err := kc.GetIngress(ctx, ing.Name, ing.Namespace); err == nil && utils.IsIngressUnchanged(current, ing) {
+			logger.Info("skipping unchanged ingress resource", zap.String("name", ing.Name))
+			kc.RecordUnchangedIngress(ing)
+			resources = append(resources, resource)
+			unchanged = append(unchanged, resource)
+			continue
+		}
 
-		if err := kc.CreateOrUpdateIngress(ing); err != nil {
+		if err := kc.CreateOrUpdateIngress(ctx, ing); err != nil {
 			logger.Error("failed to create or update ingress resource", zap.String("name", ing.Name), zap.Error(err))
 			errors = append(errors, err)
 			continue
 		}
 
-		resources = append(resources, fmt.Sprintf("%s/%s", utils.IngressKind, ing.Name))
+		resources = append(resources, resource)
 	}
 
 	return
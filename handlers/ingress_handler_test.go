@@ -14,8 +14,12 @@ limitations under the License.
 package handlers
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 
 	"bou.ke/monkey"
@@ -23,6 +27,7 @@ import (
 	"github.com/IBM-Cloud/iks-ingress-migration-tool/testutils"
 	"github.com/IBM-Cloud/iks-ingress-migration-tool/utils"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
 	v1 "k8s.io/api/core/v1"
 	networkingV1 "k8s.io/api/networking/v1"
 	networkingv1beta1 "k8s.io/api/networking/v1beta1"
@@ -46,6 +51,7 @@ func TestHandleIngressResources(t *testing.T) {
 		GetK8STCPCMErr             map[string]error
 		ingressEnhancementsEnabled bool
 		v1IngressOnly              bool
+		filter                     model.IngressFilter
 	}{
 		{
 			description: "happy path - production mode - basic ingresses",
@@ -97,6 +103,47 @@ func TestHandleIngressResources(t *testing.T) {
 				},
 			},
 		},
+		{
+			description: "happy path - production mode - basic ingresses filtered by namespace and name",
+			mode:        model.MigrationModeProduction,
+			currentIngressList: []string{
+				"basic.yaml",
+				"no_services.yaml",
+				"two_host.yaml",
+			},
+			filter: model.IngressFilter{
+				Namespaces: []string{"default"},
+				Names:      []string{"basic-ingress-*"},
+			},
+			expectedIngressList: []string{
+				"no_services_server.yaml",
+				"two_host_server.yaml",
+				"two_host_coffee_svc.yaml",
+				"two_host_coffee_svc_1.yaml",
+				"two_host_tea_svc.yaml",
+			},
+			expectedStatusResourceInfo: []model.MigratedResource{
+				{
+					Kind:      utils.IngressKind,
+					Name:      "basic-ingress-no-services",
+					Namespace: "default",
+					MigratedAs: []string{
+						"Ingress/basic-ingress-no-services-server",
+					},
+				},
+				{
+					Kind:      utils.IngressKind,
+					Name:      "basic-ingress-two-hosts",
+					Namespace: "default",
+					MigratedAs: []string{
+						"Ingress/basic-ingress-two-hosts-coffee-svc-coffee",
+						"Ingress/basic-ingress-two-hosts-tea-svc-tea",
+						"Ingress/basic-ingress-two-hosts-coffee-svc-coffee-0",
+						"Ingress/basic-ingress-two-hosts-server",
+					},
+				},
+			},
+		},
 		{
 			description: "happy path - test mode - basic ingresses",
 			mode:        model.MigrationModeTest,
@@ -216,7 +263,7 @@ func TestHandleIngressResources(t *testing.T) {
 				"no_services.yaml",
 			},
 			getError:      fmt.Errorf("error getting ingress resources"),
-			expectedError: fmt.Errorf("error getting ingress resources"),
+			expectedError: &utils.APIError{Err: fmt.Errorf("error getting ingress resources")},
 		},
 		{
 			description: "error path - error creating ingress resources",
@@ -231,10 +278,13 @@ func TestHandleIngressResources(t *testing.T) {
 					Warnings: []string{
 						utils.ErrorCreatingIngressResources,
 					},
+					Errors: []string{
+						"error creating ingress resource",
+					},
 				},
 			},
 			createError:   fmt.Errorf("error creating ingress resource"),
-			expectedError: fmt.Errorf("error occurred while processing ingress resources: [error creating ingress resource]"),
+			expectedError: &utils.PartialMigrationError{Operation: "processing ingress resources", Errors: []error{fmt.Errorf("error creating ingress resource")}},
 		},
 		{
 			description: "error path - error updating status configmap",
@@ -256,7 +306,7 @@ func TestHandleIngressResources(t *testing.T) {
 				},
 			},
 			statusUpdateError: fmt.Errorf("error writing status cm"),
-			expectedError:     fmt.Errorf("error occurred while processing ingress resources: [error writing status cm]"),
+			expectedError:     &utils.PartialMigrationError{Operation: "processing ingress resources", Errors: []error{fmt.Errorf("error writing status cm")}},
 		},
 		{
 			description: "happy path - production - ingress with appid-auth",
@@ -530,7 +580,24 @@ func TestHandleIngressResources(t *testing.T) {
 			currentIngressList: []string{
 				"location_modifier_v1.yaml",
 			},
-			expectedError: fmt.Errorf("error occurred while processing ingress resources: [The ingress resource cannot be migrated due to the usage of the '=' location modifier which is not supported by the Kubernetes Ingress Controller with Kubernetes versions under 1.18 - ingress resource could not be migrated as the '=' location modifiers are not compatible with the Kubernetes Ingress Controller. Beginning with Kubernetes 1.18, paths defined in Ingress resources have a 'pathType' attribute that can be set to 'Exact' for exact matching (https://kubernetes.io/docs/concepts/services-networking/ingress/#path-types). If you want to automatically migrate the ingress resource, create a copy of it that does not have the 'ingress.bluemix.net/location-modifier' annotation, or upgrade your cluster to Kubernetes 1.18+, then run migration again]"),
+			expectedStatusResourceInfo: []model.MigratedResource{
+				{
+					Kind:      utils.IngressKind,
+					Name:      "location-modifier-v1",
+					Namespace: "default",
+					Errors: []string{
+						"The ingress resource cannot be migrated due to the usage of the '=' location modifier which is not supported by the Kubernetes Ingress Controller with Kubernetes versions under 1.18",
+						"- ingress resource could not be migrated as the '=' location modifiers are not compatible with the Kubernetes Ingress Controller. Beginning with Kubernetes 1.18, paths defined in Ingress resources have a 'pathType' attribute that can be set to 'Exact' for exact matching (https://kubernetes.io/docs/concepts/services-networking/ingress/#path-types). If you want to automatically migrate the ingress resource, create a copy of it that does not have the 'ingress.bluemix.net/location-modifier' annotation, or upgrade your cluster to Kubernetes 1.18+, then run migration again",
+					},
+				},
+			},
+			expectedError: &utils.PartialMigrationError{
+				Operation: "processing ingress resources",
+				Errors: []error{
+					fmt.Errorf("The ingress resource cannot be migrated due to the usage of the '=' location modifier which is not supported by the Kubernetes Ingress Controller with Kubernetes versions under 1.18"),
+					fmt.Errorf("- ingress resource could not be migrated as the '=' location modifiers are not compatible with the Kubernetes Ingress Controller. Beginning with Kubernetes 1.18, paths defined in Ingress resources have a 'pathType' attribute that can be set to 'Exact' for exact matching (https://kubernetes.io/docs/concepts/services-networking/ingress/#path-types). If you want to automatically migrate the ingress resource, create a copy of it that does not have the 'ingress.bluemix.net/location-modifier' annotation, or upgrade your cluster to Kubernetes 1.18+, then run migration again"),
+				},
+			},
 		},
 		{
 			description:                "error path - production mode - location modifier is ~",
@@ -539,7 +606,22 @@ func TestHandleIngressResources(t *testing.T) {
 			currentIngressList: []string{
 				"location_modifier_not_supported_1.yaml",
 			},
-			expectedError: fmt.Errorf("error occurred while processing ingress resources: [The ingress resource cannot be migrated due to the usage of the '~' location modifier which is not supported by the Kubernetes Ingress Controller]"),
+			expectedStatusResourceInfo: []model.MigratedResource{
+				{
+					Kind:      utils.IngressKind,
+					Name:      "location-modifier-v1",
+					Namespace: "default",
+					Errors: []string{
+						"The ingress resource cannot be migrated due to the usage of the '~' location modifier which is not supported by the Kubernetes Ingress Controller",
+					},
+				},
+			},
+			expectedError: &utils.PartialMigrationError{
+				Operation: "processing ingress resources",
+				Errors: []error{
+					fmt.Errorf("The ingress resource cannot be migrated due to the usage of the '~' location modifier which is not supported by the Kubernetes Ingress Controller"),
+				},
+			},
 		},
 		{
 			description:                "error path - production mode - location modifier is ^~",
@@ -548,7 +630,22 @@ func TestHandleIngressResources(t *testing.T) {
 			currentIngressList: []string{
 				"location_modifier_not_supported_2.yaml",
 			},
-			expectedError: fmt.Errorf("error occurred while processing ingress resources: [The ingress resource cannot be migrated due to the usage of the '^~' location modifier which is not supported by the Kubernetes Ingress Controller]"),
+			expectedStatusResourceInfo: []model.MigratedResource{
+				{
+					Kind:      utils.IngressKind,
+					Name:      "location-modifier-v1",
+					Namespace: "default",
+					Errors: []string{
+						"The ingress resource cannot be migrated due to the usage of the '^~' location modifier which is not supported by the Kubernetes Ingress Controller",
+					},
+				},
+			},
+			expectedError: &utils.PartialMigrationError{
+				Operation: "processing ingress resources",
+				Errors: []error{
+					fmt.Errorf("The ingress resource cannot be migrated due to the usage of the '^~' location modifier which is not supported by the Kubernetes Ingress Controller"),
+				},
+			},
 		},
 		{
 			description: "happy path - production mode - keepalive annotations",
@@ -760,11 +857,27 @@ func TestHandleIngressResources(t *testing.T) {
 				GetK8STCPCMErr:             tc.GetK8STCPCMErr,
 				IngressEnhancementsEnabled: tc.ingressEnhancementsEnabled,
 				V1IngressOnly:              tc.v1IngressOnly,
+				ExpectedScope:              &tc.filter,
 			}
 
-			actualError := HandleIngressResources(&tkc, tc.mode, logger)
+			actualError := HandleIngressResources(context.Background(), &tkc, tc.mode, tc.filter, 4, logger)
 			assert.Equal(t, tc.expectedError, actualError)
 
+			// every warning and error of the source ingress resources is recorded as an event
+			expectedEvents := map[string]int{}
+			for _, resource := range tc.expectedStatusResourceInfo {
+				expectedEvents[utils.EventReasonMigrationWarning] += len(resource.Warnings)
+				expectedEvents[utils.EventReasonMigrationFailed] += len(resource.Errors)
+			}
+			actualEvents := map[string]int{}
+			for _, event := range tkc.Events {
+				if event.Type == v1.EventTypeWarning {
+					actualEvents[event.Reason]++
+				}
+			}
+			assert.Equal(t, expectedEvents[utils.EventReasonMigrationWarning], actualEvents[utils.EventReasonMigrationWarning])
+			assert.Equal(t, expectedEvents[utils.EventReasonMigrationFailed], actualEvents[utils.EventReasonMigrationFailed])
+
 			monkey.UnpatchAll()
 		})
 	}
@@ -1147,13 +1260,14 @@ func TestGetIngressConfig(t *testing.T) {
 				IngressEnhancementsEnabled: tc.ingressEnhancementsEnabled,
 			}
 
-			actualIngressConfig, actualIngressToCM, albIDList, actualWarnings, actualErrors := getIngressConfig(tkc, *ingressResource, tc.mode, logger)
+			actualIngressConfig, actualIngressToCM, albIDList, actualWarnings, actualErrors := getIngressConfig(context.Background(), tkc, *ingressResource, tc.mode, logger)
 
+			actualWarningMessages := utils.WarningMessages(actualWarnings)
 			sort.Strings(tc.expectedWarnings)
-			sort.Strings(actualWarnings)
+			sort.Strings(actualWarningMessages)
 
 			assert.Equal(t, expectedIngressConfig, actualIngressConfig)
-			assert.Equal(t, tc.expectedWarnings, actualWarnings)
+			assert.Equal(t, tc.expectedWarnings, actualWarningMessages)
 			assert.Equal(t, tc.expectedErrors, actualErrors)
 			if tc.expectedIngressToCM != nil {
 				assert.Equal(t, tc.expectedIngressToCM.TCPPorts, actualIngressToCM.TCPPorts)
@@ -1366,8 +1480,9 @@ func TestCreateIngressResources(t *testing.T) {
 				ExpectedSubdomainMap: tc.expectedSubdomainMap,
 			}
 
-			actualResourceList, actualSubdomainMap, actualErrors := createIngressResources(&tkc, tc.mode, *ingressConfig, logger)
+			actualResourceList, actualUnchanged, actualSubdomainMap, actualErrors := createIngressResources(context.Background(), &tkc, tc.mode, *ingressConfig, logger)
 			assert.Equal(t, tc.expectedResourceList, actualResourceList)
+			assert.Empty(t, actualUnchanged)
 			assert.Equal(t, tc.expectedSubdomainMap, actualSubdomainMap)
 			assert.Equal(t, tc.expectedErrors, actualErrors)
 
@@ -1764,3 +1879,175 @@ func Test_genereteUniqueName(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleIngressResourcesConcurrency(t *testing.T) {
+	logger := zap.NewNop()
+
+	// the ingress resources share the proxy ssl secret and the generic TCP ports configmap
+	manifests := []string{`
+apiVersion: v1
+kind: Secret
+metadata:
+  name: proxy-secret
+  namespace: default
+stringData:
+  trusted.crt: cert
+`}
+	var ports []string
+	for i := 0; i < 20; i++ {
+		port := fmt.Sprint(9000 + i)
+		ports = append(ports, port)
+		manifests = append(manifests, fmt.Sprintf(`
+apiVersion: networking.k8s.io/v1beta1
+kind: Ingress
+metadata:
+  name: tea-ingress-%[1]d
+  namespace: default
+  annotations:
+    ingress.bluemix.net/tcp-ports: "serviceName=tea-svc-%[1]d ingressPort=%[2]s servicePort=8080"
+    ingress.bluemix.net/ssl-services: "ssl-service=tea-svc-%[1]d ssl-secret=proxy-secret"
+spec:
+  rules:
+  - host: tea-%[1]d.example.com
+    http:
+      paths:
+      - path: /tea
+        backend:
+          serviceName: tea-svc-%[1]d
+          servicePort: 8080
+`, i, port))
+	}
+	manifests = append(manifests, fmt.Sprintf(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ibm-cloud-provider-ingress-cm
+  namespace: kube-system
+data:
+  public-ports: "80;443;%s"
+`, strings.Join(ports, ";")))
+
+	inputDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "manifests.yaml"), []byte(strings.Join(manifests, "---")), 0600))
+
+	// migrate returns the migrated resources recorded by the client without the timestamp of the status configmap
+	migrate := func(concurrency int) utils.KubeClient {
+		kc, err := utils.NewFileKubeClient(inputDir, logger)
+		assert.NoError(t, err)
+		assert.NoError(t, HandleIngressResources(context.Background(), kc, model.MigrationModeProduction, model.IngressFilter{}, concurrency, logger))
+		statusCm := kc.GetConfigMapContainer()[utils.KubeSystem][utils.MigrationStatusConfigMapName]
+		delete(statusCm.Data, utils.LastUpdatesTimestampParameterName)
+		return kc
+	}
+
+	sequential := migrate(1)
+	// the source ingress resources are recorded with the back-reference annotations
+	assert.Len(t, sequential.GetIngressContainer()["default"], 60)
+	assert.Len(t, sequential.GetConfigMapContainer()[utils.KubeSystem][utils.GenericK8sTCPConfigMapName].Data, 20)
+
+	for i := 0; i < 5; i++ {
+		parallel := migrate(8)
+		assert.Equal(t, sequential.GetIngressContainer(), parallel.GetIngressContainer())
+		assert.Equal(t, sequential.GetConfigMapContainer(), parallel.GetConfigMapContainer())
+		assert.Equal(t, sequential.GetSecretContainer(), parallel.GetSecretContainer())
+	}
+}
+
+func TestHandleIngressResourcesInterrupted(t *testing.T) {
+	logger := zap.NewNop()
+	inputDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "manifests.yaml"), []byte(rollbackTestManifests), 0600))
+
+	kc, err := utils.NewFileKubeClient(inputDir, logger)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = HandleIngressResources(ctx, kc, model.MigrationModeProduction, model.IngressFilter{}, 2, logger)
+	assert.EqualError(t, err, "error occurred while processing ingress resources: [the migration of the ingress resources was interrupted: context canceled]")
+	assert.Equal(t, utils.ExitCodePartialMigration, utils.ExitCode(err))
+
+	// the ingress resources were not processed, but the status is still recorded
+	assert.Empty(t, kc.GetIngressContainer())
+	status, err := utils.GetRecordedMigrationStatus(kc)
+	assert.NoError(t, err)
+	assert.Empty(t, status.MigratedResources)
+}
+
+func TestHandleIngressResourcesRerun(t *testing.T) {
+	logger := zap.NewNop()
+	defer utils.SetRunID(utils.GetRunID())
+
+	inputDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "manifests.yaml"), []byte(rollbackTestManifests), 0600))
+	kc, err := utils.NewFileKubeClient(inputDir, logger)
+	assert.NoError(t, err)
+
+	// migrate runs the migration and returns the recorded status of the source ingress resource
+	migrate := func(runID string) model.MigratedResource {
+		utils.SetRunID(runID)
+		assert.NoError(t, HandleIngressResources(context.Background(), kc, model.MigrationModeProduction, model.IngressFilter{}, 1, logger))
+		status, err := utils.GetMigrationStatus(context.Background(), kc)
+		assert.NoError(t, err)
+		assert.Len(t, status.MigratedResources, 1)
+		return status.MigratedResources[0]
+	}
+
+	first := migrate("first-run")
+	assert.Empty(t, first.Unchanged)
+	// the structured warnings are recorded with the services affected by the annotations
+	assert.Len(t, first.WarningDetails, len(first.Warnings))
+	assert.Contains(t, first.WarningDetails, model.Warning{
+		Code:        "TCP_PORT_GENERIC",
+		Severity:    utils.WarningSeverityWarning,
+		Message:     utils.TCPPortWarningWithoutALBID,
+		Annotation:  "ingress.bluemix.net/tcp-ports",
+		Services:    []string{"tea-svc"},
+		Paths:       []string{"/tea"},
+		Remediation: "Add the 'tcp-services-configmap=generic-k8s-ingress-tcp-ports' field to the deployments of the ALBs.",
+		DocURL:      "https://cloud.ibm.com/docs/containers?topic=containers-comm-ingress-annotations#comm-customize-deploy",
+	})
+	generatedIngresses := generatedIngressNames(first.MigratedAs)
+	assert.NotEmpty(t, generatedIngresses)
+
+	// the unchanged ingress resources are not rewritten, and the rerun replaces the status of the source ingress resource
+	second := migrate("second-run")
+	assert.Equal(t, first.MigratedAs, second.MigratedAs)
+	assert.Len(t, second.Unchanged, len(generatedIngresses))
+	for _, name := range generatedIngresses {
+		ingress, err := kc.GetIngress(context.Background(), name, "default")
+		assert.NoError(t, err)
+		assert.Equal(t, "first-run", ingress.Labels[utils.MigrationRunIDLabel])
+	}
+	source, err := kc.GetIngress(context.Background(), "tea-ingress", "default")
+	assert.NoError(t, err)
+	assert.Equal(t, "first-run", source.Annotations[utils.MigrationRunIDAnnotation])
+
+	// the generated ingress resource changed by hand is rewritten, even though its content hash annotations were kept
+	edited, err := kc.GetIngress(context.Background(), generatedIngresses[0], "default")
+	assert.NoError(t, err)
+	generatedSpec := edited.Spec.DeepCopy()
+	edited.Spec.Rules[0].Host = "edited.example.com"
+	assert.NoError(t, kc.CreateOrUpdateIngress(context.Background(), *edited))
+	rerun := migrate("edit-run")
+	assert.Len(t, rerun.Unchanged, len(generatedIngresses)-1)
+	assert.NotContains(t, rerun.Unchanged, utils.IngressKind+"/"+generatedIngresses[0])
+	rewritten, err := kc.GetIngress(context.Background(), generatedIngresses[0], "default")
+	assert.NoError(t, err)
+	assert.Equal(t, *generatedSpec, rewritten.Spec)
+	assert.Equal(t, "edit-run", rewritten.Labels[utils.MigrationRunIDLabel])
+
+	// the generated ingress resources of the changed source ingress resource are rewritten
+	source.Spec.Rules[0].HTTP.Paths[0].Path = "/green-tea"
+	assert.NoError(t, kc.CreateOrUpdateIngress(context.Background(), *source))
+	third := migrate("third-run")
+	assert.Empty(t, third.Unchanged)
+	for _, name := range generatedIngressNames(third.MigratedAs) {
+		ingress, err := kc.GetIngress(context.Background(), name, "default")
+		assert.NoError(t, err)
+		assert.Equal(t, "third-run", ingress.Labels[utils.MigrationRunIDLabel])
+	}
+	source, err = kc.GetIngress(context.Background(), "tea-ingress", "default")
+	assert.NoError(t, err)
+	assert.Equal(t, "third-run", source.Annotations[utils.MigrationRunIDAnnotation])
+}
@@ -14,6 +14,7 @@ limitations under the License.
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -24,7 +25,7 @@ import (
 
 // HandleIngressToCMData top level function to handle those parameters that are migrated from Ingress resources
 // into ConfigMap parameters
-func HandleIngressToCMData(kc utils.KubeClient, ingressToCM utils.IngressToCM, albIDList string, mode string, albSpecificData utils.ALBSpecificData, logger *zap.Logger) ([]string, []string, utils.ALBSpecificData, []error) {
+func HandleIngressToCMData(ctx context.Context, kc utils.KubeClient, ingressToCM utils.IngressToCM, albIDList string, mode string, albSpecificData utils.ALBSpecificData, logger *zap.Logger) ([]string, []model.Warning, utils.ALBSpecificData, []error) {
 	albSpecificData, err := utils.MergeALBSpecificData(albSpecificData, ingressToCM, albIDList, logger)
 	errors := []error{}
 	if err != nil {
@@ -32,22 +33,22 @@ func HandleIngressToCMData(kc utils.KubeClient, ingressToCM utils.IngressToCM, a
 		return nil, nil, albSpecificData, errors
 	}
 
-	resources, warnings, errs := handleTCPPorts(kc, ingressToCM, albIDList, mode, logger)
+	resources, warnings, errs := handleTCPPorts(ctx, kc, ingressToCM, albIDList, mode, logger)
 	if len(errs) != 0 {
 		return nil, nil, albSpecificData, errs
 	}
 	return resources, warnings, albSpecificData, nil
 }
 
-func handleTCPPorts(kc utils.KubeClient, ingressToCM utils.IngressToCM, albIDList string, mode string, logger *zap.Logger) ([]string, []string, []error) {
+func handleTCPPorts(ctx context.Context, kc utils.KubeClient, ingressToCM utils.IngressToCM, albIDList string, mode string, logger *zap.Logger) ([]string, []model.Warning, []error) {
 	var migratedAs []string
-	var warnings []string
+	var warnings []model.Warning
 	var errors []error
 	if len(ingressToCM.TCPPorts) == 0 {
 		return migratedAs, warnings, errors
 	}
 
-	iksCM, err := kc.GetConfigMap(utils.IKSConfigMapName, utils.KubeSystem)
+	iksCM, err := kc.GetConfigMap(ctx, utils.IKSConfigMapName, utils.KubeSystem)
 	if err != nil {
 		logger.Error("TCP ports handling. Error getting iks configmap", zap.String("namespace", utils.KubeSystem), zap.String("name", utils.IKSConfigMapName), zap.Error(err))
 		errors = append(errors, err)
@@ -73,7 +74,7 @@ func handleTCPPorts(kc utils.KubeClient, ingressToCM utils.IngressToCM, albIDLis
 			} else {
 				k8sCMName = fmt.Sprintf("%s%s", albID, utils.TCPConfigMapNameSuffix)
 			}
-			err = createK8SCM(kc, k8sTCPPortData, k8sCMName, logger)
+			err = createK8SCM(ctx, kc, k8sTCPPortData, k8sCMName, logger)
 			if err != nil {
 				errors = append(errors, err)
 				continue
@@ -85,15 +86,15 @@ func handleTCPPorts(kc utils.KubeClient, ingressToCM utils.IngressToCM, albIDLis
 	if len(migratedAs) != 0 {
 		if mode == model.MigrationModeProduction {
 			if len(albIDList) == 0 {
-				warnings = append(warnings, utils.TCPPortWarningWithoutALBID)
+				warnings = append(warnings, utils.NewWarningOf(utils.TCPPortWarningWithoutALBID))
 			} else {
-				warnings = append(warnings, utils.TCPPortWarningWithALBID)
+				warnings = append(warnings, utils.NewWarningOf(utils.TCPPortWarningWithALBID))
 			}
 		} else {
 			if len(albIDList) == 0 {
-				warnings = append(warnings, utils.TCPPortWarningWithoutALBIDTest)
+				warnings = append(warnings, utils.NewWarningOf(utils.TCPPortWarningWithoutALBIDTest))
 			} else {
-				warnings = append(warnings, utils.TCPPortWarningWithALBIDTest)
+				warnings = append(warnings, utils.NewWarningOf(utils.TCPPortWarningWithALBIDTest))
 			}
 		}
 	}
@@ -114,9 +115,9 @@ func createK8STCPPortData(ingressTCPPorts map[string]*utils.TCPPortConfig, iksCM
 	return
 }
 
-func createK8SCM(kc utils.KubeClient, TCPCMData map[string]string, CMName string, logger *zap.Logger) error {
+func createK8SCM(ctx context.Context, kc utils.KubeClient, TCPCMData map[string]string, CMName string, logger *zap.Logger) error {
 	if len(TCPCMData) != 0 {
-		err := utils.CreateOrUpdateTCPPortsCM(kc, CMName, utils.KubeSystem, TCPCMData, logger)
+		err := utils.CreateOrUpdateTCPPortsCM(ctx, kc, CMName, utils.KubeSystem, TCPCMData, logger)
 		if err != nil {
 			return err
 		}
@@ -14,6 +14,7 @@ limitations under the License.
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -385,9 +386,9 @@ func TestHandleTCPPorts(t *testing.T) {
 	}
 	for name, tc := range cases {
 		t.Run(name, func(t *testing.T) {
-			migratedAs, warnings, errors := handleTCPPorts(tc.kc, tc.ingressToCM, tc.albIDList, tc.mode, logger)
+			migratedAs, warnings, errors := handleTCPPorts(context.Background(), tc.kc, tc.ingressToCM, tc.albIDList, tc.mode, logger)
 			assert.ElementsMatch(t, tc.expectedErrs, errors)
-			assert.ElementsMatch(t, warnings, tc.expectedWarnings, warnings)
+			assert.ElementsMatch(t, tc.expectedWarnings, utils.WarningMessages(warnings))
 			assert.ElementsMatch(t, tc.expectedMigratedAs, migratedAs)
 			assert.ElementsMatch(t, tc.expectedOp, tc.kc.CalledOp)
 		})
@@ -530,7 +531,7 @@ func TestCreateK8SCM(t *testing.T) {
 	}
 	for name, tc := range cases {
 		t.Run(name, func(t *testing.T) {
-			err := createK8SCM(tc.kc, tc.TCPCMData, tc.CMName, logger)
+			err := createK8SCM(context.Background(), tc.kc, tc.TCPCMData, tc.CMName, logger)
 			assert.Equal(t, tc.expectedErr, err)
 			assert.Equal(t, tc.expectedOp, tc.kc.CalledOp)
 			assert.Equal(t, tc.expectedData, tc.kc.CMData)
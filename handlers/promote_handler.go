@@ -0,0 +1,282 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/parsers"
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/utils"
+	"go.uber.org/zap"
+	networking "k8s.io/api/networking/v1beta1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HandlePromote top level function to turn the resources of a test mode migration into production resources
+func HandlePromote(ctx context.Context, kc utils.KubeClient, logger *zap.Logger) error {
+	// 1.) get the migration status, check that it was recorded by a test mode migration
+	// 2.) promote the generated ingress resources one-by-one
+	// 2a.) replacing the test subdomains with the original hosts based on the subdomain map
+	// 2b.) replacing the test ingress class with the public or private ingress class based on the ALB-ID annotation of the source ingress
+	// 2c.) replacing the test secret with the TLS secrets of the source ingress
+	// 3.) move the data of the test k8s configmap into the k8s configmap
+	// 4.) record the promoted resources in the status configmap in production mode
+
+	logger.Info("starting to promote the test mode migration to production")
+
+	status, err := utils.GetMigrationStatus(ctx, kc)
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return fmt.Errorf("status configmap is not present on the cluster, there is nothing to promote")
+		}
+		logger.Error("error getting migration status", zap.Error(err))
+		return err
+	}
+
+	if status.Mode != model.MigrationModeTest && status.Mode != model.MigrationModeTestWithPrivate {
+		return fmt.Errorf("the last migration ran in '%s' mode, only '%s' and '%s' mode migrations can be promoted", status.Mode, model.MigrationModeTest, model.MigrationModeTestWithPrivate)
+	}
+
+	originalHosts := map[string]string{}
+	for userSubdomain, testSubdomain := range status.SubdomainMap {
+		originalHosts[testSubdomain] = userSubdomain
+	}
+
+	var errors []error
+	var migrationInfos []model.MigratedResource
+	for _, migratedResource := range status.MigratedResources {
+		switch migratedResource.Kind {
+		case utils.IngressKind:
+			if errs := promoteIngressResources(ctx, kc, migratedResource, originalHosts, logger); len(errs) > 0 {
+				errors = append(errors, errs...)
+				continue
+			}
+		case utils.ConfigMapKind:
+			if err := promoteTestK8sConfigMap(ctx, kc, logger); err != nil {
+				errors = append(errors, err)
+				continue
+			}
+			migratedResource.MigratedAs = []string{fmt.Sprintf("%s/%s", utils.ConfigMapKind, utils.K8sConfigMapName)}
+		}
+		migrationInfos = append(migrationInfos, migratedResource)
+	}
+
+	if len(errors) > 0 {
+		// the status configmap is not changed, so the promotion can be retried,
+		// the resources promoted by this run are recognized and skipped by the next one
+		return &utils.PartialMigrationError{Operation: "promoting the test mode migration", Errors: errors}
+	}
+
+	// the status is rewritten, as the migration mode of an existing status configmap can not be changed
+	if err := kc.DeleteStatusCm(ctx); err != nil && !k8sErrors.IsNotFound(err) {
+		logger.Error("error deleting status configmap", zap.Error(err))
+		return err
+	}
+	if err := kc.CreateOrUpdateStatusCm(ctx, model.MigrationModeProduction, migrationInfos, nil, status.Scope); err != nil {
+		logger.Error("could not update status configmap", zap.Error(err))
+		return err
+	}
+	logger.Info("successfully promoted the test mode migration to production")
+
+	return nil
+}
+
+// promoteIngressResources promotes the ingress resources generated from the source ingress resource
+func promoteIngressResources(ctx context.Context, kc utils.KubeClient, migratedResource model.MigratedResource, originalHosts map[string]string, logger *zap.Logger) []error {
+	logger = logger.With(zap.String("sourceName", migratedResource.Name), zap.String("sourceNamespace", migratedResource.Namespace))
+
+	source, err := kc.GetIngress(ctx, migratedResource.Name, migratedResource.Namespace)
+	if err != nil {
+		logger.Error("error getting source ingress resource", zap.Error(err))
+		return []error{err}
+	}
+
+	ingressClass := utils.PublicIngressClass
+	if strings.Contains(parsers.GetALBID(source, logger), "private") {
+		ingressClass = utils.PrivateIngressClass
+	}
+
+	var errors []error
+	var promotedNames []string
+	for _, migratedAs := range migratedResource.MigratedAs {
+		kindAndName := strings.SplitN(migratedAs, "/", 2)
+		if len(kindAndName) != 2 || kindAndName[0] != utils.IngressKind {
+			// the TCP configmaps have the same name and data in every mode
+			continue
+		}
+
+		testIngress, err := kc.GetIngress(ctx, kindAndName[1], migratedResource.Namespace)
+		if err != nil {
+			logger.Error("error getting test ingress resource", zap.String("name", kindAndName[1]), zap.Error(err))
+			errors = append(errors, err)
+			continue
+		}
+
+		if isPromotedIngress(*testIngress, ingressClass, originalHosts) {
+			promotedNames = append(promotedNames, testIngress.Name)
+			logger.Info("ingress resource was promoted by a previous run", zap.String("name", testIngress.Name))
+			continue
+		}
+
+		ingress, err := newProductionIngress(*testIngress, *source, ingressClass, originalHosts, logger)
+		if err != nil {
+			logger.Error("error promoting test ingress resource", zap.String("name", testIngress.Name), zap.Error(err))
+			errors = append(errors, err)
+			continue
+		}
+
+		if err := kc.CreateOrUpdateIngress(ctx, ingress); err != nil {
+			logger.Error("error applying promoted ingress resource", zap.String("name", ingress.Name), zap.Error(err))
+			errors = append(errors, err)
+			continue
+		}
+		promotedNames = append(promotedNames, ingress.Name)
+		logger.Info("successfully promoted test ingress resource", zap.String("name", ingress.Name), zap.String("ingressClass", ingressClass))
+	}
+
+	if len(errors) == 0 {
+		if err := kc.AnnotateIngress(ctx, source.Name, source.Namespace, utils.SourceAnnotations(promotedNames)); err != nil {
+			logger.Error("error annotating source ingress resource", zap.Error(err))
+			errors = append(errors, err)
+		}
+	}
+	return errors
+}
+
+// isPromotedIngress returns true if the generated ingress resource was already promoted
+func isPromotedIngress(ingress networking.Ingress, ingressClass string, originalHosts map[string]string) bool {
+	if ingress.Annotations[utils.IngressClassAnnotation] != ingressClass {
+		return false
+	}
+	userSubdomains := map[string]bool{}
+	for _, userSubdomain := range originalHosts {
+		userSubdomains[userSubdomain] = true
+	}
+	for _, rule := range ingress.Spec.Rules {
+		if !userSubdomains[rule.Host] {
+			return false
+		}
+	}
+	return true
+}
+
+// newProductionIngress returns the production version of the test ingress resource
+func newProductionIngress(testIngress, source networking.Ingress, ingressClass string, originalHosts map[string]string, logger *zap.Logger) (networking.Ingress, error) {
+	if testIngress.Annotations[utils.IngressClassAnnotation] != utils.TestIngressClass {
+		return networking.Ingress{}, fmt.Errorf("ingress resource %s/%s does not have the '%s' ingress class", testIngress.Namespace, testIngress.Name, utils.TestIngressClass)
+	}
+
+	ingress := networking.Ingress{
+		TypeMeta: testIngress.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        testIngress.Name,
+			Namespace:   testIngress.Namespace,
+			Labels:      map[string]string{},
+			Annotations: map[string]string{},
+		},
+		Spec: *testIngress.Spec.DeepCopy(),
+	}
+	for key, value := range testIngress.Labels {
+		ingress.Labels[key] = value
+	}
+	// the promoted ingress resource is labeled with the run that promoted it
+	utils.SetProvenance(&ingress.ObjectMeta, &source.ObjectMeta)
+	for key, value := range testIngress.Annotations {
+		ingress.Annotations[key] = value
+	}
+	ingress.Annotations[utils.IngressClassAnnotation] = ingressClass
+
+	var tlsConfigs []networking.IngressTLS
+	tlsConfigIndexes := map[string]int{}
+	for i, rule := range ingress.Spec.Rules {
+		host, found := originalHosts[rule.Host]
+		if !found {
+			return networking.Ingress{}, fmt.Errorf("host %s of ingress resource %s/%s is not a generated test subdomain", rule.Host, testIngress.Namespace, testIngress.Name)
+		}
+		ingress.Spec.Rules[i].Host = host
+
+		secret := getTLSSecret(host, source.Spec.TLS, logger)
+		if host == "" || secret == "" {
+			continue
+		}
+		if index, exists := tlsConfigIndexes[secret]; exists {
+			if !utils.ItemInSlice(host, tlsConfigs[index].Hosts) {
+				tlsConfigs[index].Hosts = append(tlsConfigs[index].Hosts, host)
+			}
+			continue
+		}
+		tlsConfigIndexes[secret] = len(tlsConfigs)
+		tlsConfigs = append(tlsConfigs, networking.IngressTLS{Hosts: []string{host}, SecretName: secret})
+	}
+	ingress.Spec.TLS = tlsConfigs
+	// the source hash of the test ingress resource is kept, as it was generated from the same source
+	utils.SetContentHashes(&ingress, testIngress.Annotations[utils.SourceHashAnnotation])
+
+	return ingress, nil
+}
+
+// promoteTestK8sConfigMap moves the data of the test k8s configmap into the k8s configmap
+func promoteTestK8sConfigMap(ctx context.Context, kc utils.KubeClient, logger *zap.Logger) error {
+	testK8sCm, err := kc.GetConfigMap(ctx, utils.TestK8sConfigMapName, utils.KubeSystem)
+	if k8sErrors.IsNotFound(err) {
+		logger.Info("test k8s configmap is not present on the cluster, it was promoted by a previous run")
+		return nil
+	}
+	if err != nil {
+		logger.Error("error getting test k8s configmap", zap.Error(err))
+		return err
+	}
+
+	// the k8s configmap is read again if it was changed while the test data was merged into it
+	err = utils.RetryOnConflict(func() error {
+		k8sCm, err := kc.GetConfigMap(ctx, utils.K8sConfigMapName, utils.KubeSystem)
+		if err != nil {
+			logger.Error("error getting k8s configmap", zap.Error(err))
+			return err
+		}
+
+		// the original values of the overwritten keys are backed up, so the rollback can restore them
+		if err := kc.CreateOrUpdateBackupCm(ctx, []model.ResourceBackup{utils.NewConfigMapBackup(k8sCm, testK8sCm.Data)}); err != nil {
+			logger.Error("failed to back up k8s configmap", zap.Error(err))
+			return err
+		}
+
+		if k8sCm.Data == nil {
+			k8sCm.Data = map[string]string{}
+		}
+		for key, value := range testK8sCm.Data {
+			k8sCm.Data[key] = value
+		}
+		return kc.UpdateConfigmap(ctx, k8sCm)
+	})
+	if err != nil {
+		logger.Error("failed to update k8s configmap", zap.Error(err))
+		return err
+	}
+
+	if err := kc.DeleteConfigMap(ctx, utils.TestK8sConfigMapName, utils.KubeSystem); err != nil && !k8sErrors.IsNotFound(err) {
+		logger.Error("failed to delete test k8s configmap", zap.Error(err))
+		return err
+	}
+	if err := utils.RemoveBackups(ctx, kc, []string{utils.BackupKey(utils.ConfigMapKind, utils.KubeSystem, utils.TestK8sConfigMapName)}); err != nil {
+		logger.Error("failed to remove the backup of the test k8s configmap", zap.Error(err))
+		return err
+	}
+	logger.Info("successfully moved the test k8s configmap data into the k8s configmap")
+	return nil
+}
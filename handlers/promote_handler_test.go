@@ -0,0 +1,186 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/utils"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const promoteTestManifests = `
+apiVersion: networking.k8s.io/v1beta1
+kind: Ingress
+metadata:
+  name: coffee-ingress
+  namespace: coffee
+  annotations:
+    ingress.bluemix.net/ALB-ID: "private-crdf253b6025d64944ab99ed63bb4567b6-alb1"
+spec:
+  tls:
+  - hosts:
+    - coffee.example.com
+    - "*.coffee.example.com"
+    secretName: coffee-secret
+  rules:
+  - host: coffee.example.com
+    http:
+      paths:
+      - path: /coffee
+        backend:
+          serviceName: coffee-svc
+          servicePort: 8080
+  - host: "*.coffee.example.com"
+    http:
+      paths:
+      - path: /
+        backend:
+          serviceName: coffee-svc
+          servicePort: 8080
+  - host: latte.example.com
+    http:
+      paths:
+      - path: /latte
+        backend:
+          serviceName: latte-svc
+          servicePort: 8080
+`
+
+func TestHandlePromote(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	utils.TestDomain = "example-cluster-xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx-m000.mon01.containers.appdomain.cloud"
+	utils.TestSecret = "example-cluster-xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx-m000"
+
+	newKubeClient := func(t *testing.T) utils.KubeClient {
+		inputDir := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "manifests.yaml"), []byte(rollbackTestManifests), 0600))
+		assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "private.yaml"), []byte(promoteTestManifests), 0600))
+		kc, err := utils.NewFileKubeClient(inputDir, logger)
+		assert.NoError(t, err)
+		return kc
+	}
+
+	t.Run("promoted resources match the production migration", func(t *testing.T) {
+		productionKc := newKubeClient(t)
+		assert.NoError(t, HandleConfigMap(context.Background(), productionKc, model.MigrationModeProduction, logger))
+		assert.NoError(t, HandleIngressResources(context.Background(), productionKc, model.MigrationModeProduction, model.IngressFilter{}, 1, logger))
+
+		kc := newKubeClient(t)
+		assert.NoError(t, HandleConfigMap(context.Background(), kc, model.MigrationModeTestWithPrivate, logger))
+		assert.NoError(t, HandleIngressResources(context.Background(), kc, model.MigrationModeTestWithPrivate, model.IngressFilter{}, 1, logger))
+		assert.NoError(t, HandlePromote(context.Background(), kc, logger))
+
+		productionIngresses, err := productionKc.GetIngressResources(context.Background(), model.IngressFilter{})
+		assert.NoError(t, err)
+		ingresses, err := kc.GetIngressResources(context.Background(), model.IngressFilter{})
+		assert.NoError(t, err)
+		assert.Equal(t, productionIngresses, ingresses)
+
+		productionK8sCm, err := productionKc.GetConfigMap(context.Background(), utils.K8sConfigMapName, utils.KubeSystem)
+		assert.NoError(t, err)
+		k8sCm, err := kc.GetConfigMap(context.Background(), utils.K8sConfigMapName, utils.KubeSystem)
+		assert.NoError(t, err)
+		assert.Equal(t, productionK8sCm.Data, k8sCm.Data)
+		_, err = kc.GetConfigMap(context.Background(), utils.TestK8sConfigMapName, utils.KubeSystem)
+		assert.True(t, k8sErrors.IsNotFound(err))
+
+		status, err := utils.GetMigrationStatus(context.Background(), kc)
+		assert.NoError(t, err)
+		productionStatus, err := utils.GetMigrationStatus(context.Background(), productionKc)
+		assert.NoError(t, err)
+		assert.Equal(t, model.MigrationModeProduction, status.Mode)
+		assert.Empty(t, status.SubdomainMap)
+		assert.Len(t, status.MigratedResources, len(productionStatus.MigratedResources))
+		for i := range status.MigratedResources {
+			assert.Equal(t, productionStatus.MigratedResources[i].MigratedAs, status.MigratedResources[i].MigratedAs)
+		}
+
+		// the rollback of the promoted migration restores the state before the test migration
+		assert.NoError(t, HandleRollback(context.Background(), kc, logger))
+		originalKc := newKubeClient(t)
+		originalK8sCm, err := originalKc.GetConfigMap(context.Background(), utils.K8sConfigMapName, utils.KubeSystem)
+		assert.NoError(t, err)
+		k8sCm, err = kc.GetConfigMap(context.Background(), utils.K8sConfigMapName, utils.KubeSystem)
+		assert.NoError(t, err)
+		assert.Equal(t, originalK8sCm.Data, k8sCm.Data)
+	})
+
+	t.Run("failed promotion is retried", func(t *testing.T) {
+		productionKc := newKubeClient(t)
+		assert.NoError(t, HandleConfigMap(context.Background(), productionKc, model.MigrationModeProduction, logger))
+		assert.NoError(t, HandleIngressResources(context.Background(), productionKc, model.MigrationModeProduction, model.IngressFilter{}, 1, logger))
+
+		kc := newKubeClient(t)
+		assert.NoError(t, HandleConfigMap(context.Background(), kc, model.MigrationModeTestWithPrivate, logger))
+		assert.NoError(t, HandleIngressResources(context.Background(), kc, model.MigrationModeTestWithPrivate, model.IngressFilter{}, 1, logger))
+
+		// the promotion of the tea ingress resource fails, the configmap and the coffee ingress resources are promoted
+		testIngress, err := kc.GetIngress(context.Background(), "tea-ingress-server", "default")
+		assert.NoError(t, err)
+		changedIngress := testIngress.DeepCopy()
+		changedIngress.Spec.Rules[0].Host = "tea.example.com"
+		assert.NoError(t, kc.CreateOrUpdateIngress(context.Background(), *changedIngress))
+		assert.Error(t, HandlePromote(context.Background(), kc, logger))
+		_, err = kc.GetConfigMap(context.Background(), utils.TestK8sConfigMapName, utils.KubeSystem)
+		assert.True(t, k8sErrors.IsNotFound(err))
+
+		// the rerun skips the promoted resources and promotes the rest
+		assert.NoError(t, kc.CreateOrUpdateIngress(context.Background(), *testIngress))
+		assert.NoError(t, HandlePromote(context.Background(), kc, logger))
+
+		productionIngresses, err := productionKc.GetIngressResources(context.Background(), model.IngressFilter{})
+		assert.NoError(t, err)
+		ingresses, err := kc.GetIngressResources(context.Background(), model.IngressFilter{})
+		assert.NoError(t, err)
+		assert.Equal(t, productionIngresses, ingresses)
+
+		productionK8sCm, err := productionKc.GetConfigMap(context.Background(), utils.K8sConfigMapName, utils.KubeSystem)
+		assert.NoError(t, err)
+		k8sCm, err := kc.GetConfigMap(context.Background(), utils.K8sConfigMapName, utils.KubeSystem)
+		assert.NoError(t, err)
+		assert.Equal(t, productionK8sCm.Data, k8sCm.Data)
+
+		status, err := utils.GetMigrationStatus(context.Background(), kc)
+		assert.NoError(t, err)
+		assert.Equal(t, model.MigrationModeProduction, status.Mode)
+	})
+
+	t.Run("production mode migration is not promoted", func(t *testing.T) {
+		kc := newKubeClient(t)
+		assert.NoError(t, HandleIngressResources(context.Background(), kc, model.MigrationModeProduction, model.IngressFilter{}, 1, logger))
+		assert.EqualError(t, HandlePromote(context.Background(), kc, logger), "the last migration ran in 'production' mode, only 'test' and 'test-with-private' mode migrations can be promoted")
+	})
+
+	t.Run("changed test ingress resource is not promoted", func(t *testing.T) {
+		kc := newKubeClient(t)
+		assert.NoError(t, HandleIngressResources(context.Background(), kc, model.MigrationModeTest, model.IngressFilter{}, 1, logger))
+
+		testIngress, err := kc.GetIngress(context.Background(), "tea-ingress-server", "default")
+		assert.NoError(t, err)
+		testIngress.Spec.Rules[0].Host = "tea.example.com"
+		assert.NoError(t, kc.CreateOrUpdateIngress(context.Background(), *testIngress))
+
+		assert.Error(t, HandlePromote(context.Background(), kc, logger))
+		status, err := utils.GetMigrationStatus(context.Background(), kc)
+		assert.NoError(t, err)
+		assert.Equal(t, model.MigrationModeTest, status.Mode)
+	})
+}
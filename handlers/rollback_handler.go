@@ -0,0 +1,246 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/utils"
+	"go.uber.org/zap"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// HandleRollback top level function to revert every migration run recorded in the status configmap
+func HandleRollback(ctx context.Context, kc utils.KubeClient, logger *zap.Logger) error {
+	// 1.) get the migration status and the backups of the changed resources
+	// 2.) delete the generated ingress resources, including the ones labeled with the source ingress resource only,
+	//     and remove the back-reference annotations of the source ingress resources
+	// 3.) delete the configmaps created by the migration, restore the original keys of the updated configmaps
+	// 4.) remove the keys added to the proxy ssl secrets
+	// 5.) delete the status and backup configmaps
+
+	logger.Info("starting to roll back the migration")
+
+	status, err := utils.GetMigrationStatus(ctx, kc)
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			logger.Warn("status configmap is not present on the cluster, there is nothing to roll back")
+			return nil
+		}
+		logger.Error("error getting migration status", zap.Error(err))
+		return err
+	}
+
+	backups, err := utils.GetBackups(ctx, kc)
+	if err != nil {
+		logger.Error("error getting resource backups", zap.Error(err))
+		return err
+	}
+	configMapBackups := map[string]model.ResourceBackup{}
+	for _, backup := range backups {
+		if backup.Kind == utils.ConfigMapKind {
+			configMapBackups[backup.Name] = backup
+		}
+	}
+
+	var errors []error
+	processedConfigMaps := map[string]bool{}
+	for _, migratedResource := range status.MigratedResources {
+		deletedIngresses := map[string]bool{}
+		for _, migratedAs := range migratedResource.MigratedAs {
+			kindAndName := strings.SplitN(migratedAs, "/", 2)
+			if len(kindAndName) != 2 {
+				logger.Warn("skipping migrated resource with unknown format", zap.String("migratedAs", migratedAs))
+				continue
+			}
+
+			switch kind, name := kindAndName[0], kindAndName[1]; kind {
+			case utils.IngressKind:
+				// the generated ingress resources are created in the namespace of the source ingress resource
+				if err := kc.DeleteIngress(ctx, name, migratedResource.Namespace); err != nil && !k8sErrors.IsNotFound(err) {
+					logger.Error("error deleting generated ingress resource", zap.String("name", name), zap.String("namespace", migratedResource.Namespace), zap.Error(err))
+					errors = append(errors, err)
+					continue
+				}
+				deletedIngresses[name] = true
+				logger.Info("successfully deleted generated ingress resource", zap.String("name", name), zap.String("namespace", migratedResource.Namespace))
+			case utils.ConfigMapKind:
+				if processedConfigMaps[name] {
+					continue
+				}
+				processedConfigMaps[name] = true
+
+				backup, backedUp := configMapBackups[name]
+				if !backedUp {
+					logger.Warn("skipping configmap without backup, it was not changed by the migration or was migrated by an older version", zap.String("name", name), zap.String("namespace", utils.KubeSystem))
+					continue
+				}
+				if err := rollbackConfigMap(ctx, kc, backup, logger); err != nil {
+					errors = append(errors, err)
+				}
+			default:
+				logger.Warn("skipping migrated resource with unknown kind", zap.String("migratedAs", migratedAs))
+			}
+		}
+
+		if migratedResource.Kind == utils.IngressKind {
+			errors = append(errors, rollbackSourceIngress(ctx, kc, migratedResource, deletedIngresses, logger)...)
+		}
+	}
+
+	for _, backup := range backups {
+		if backup.Kind != utils.SecretKind {
+			continue
+		}
+		if err := rollbackSecret(ctx, kc, backup, logger); err != nil {
+			errors = append(errors, err)
+		}
+	}
+
+	if len(errors) > 0 {
+		// the status and backup configmaps are kept, so the rollback can be retried
+		return &utils.PartialMigrationError{Operation: "rolling back the migration", Errors: errors}
+	}
+
+	if err := kc.DeleteStatusCm(ctx); err != nil && !k8sErrors.IsNotFound(err) {
+		logger.Error("error deleting status configmap", zap.Error(err))
+		return err
+	}
+	if err := kc.DeleteConfigMap(ctx, utils.MigrationBackupConfigMapName, utils.KubeSystem); err != nil && !k8sErrors.IsNotFound(err) {
+		logger.Error("error deleting backup configmap", zap.Error(err))
+		return err
+	}
+	logger.Info("successfully rolled back the migration")
+
+	return nil
+}
+
+// RecordedRunIDs returns the IDs of the migration runs recorded in the status configmap
+func RecordedRunIDs(ctx context.Context, kc utils.KubeClient, logger *zap.Logger) ([]string, error) {
+	status, err := utils.GetMigrationStatus(ctx, kc)
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var runIDs []string
+	for _, migratedResource := range status.MigratedResources {
+		if migratedResource.Kind != utils.IngressKind {
+			continue
+		}
+		ingress, err := kc.GetIngress(ctx, migratedResource.Name, migratedResource.Namespace)
+		if err != nil {
+			if k8sErrors.IsNotFound(err) {
+				logger.Warn("source ingress resource is not present on the cluster", zap.String("name", migratedResource.Name), zap.String("namespace", migratedResource.Namespace))
+				continue
+			}
+			return nil, err
+		}
+		if runID := ingress.Annotations[utils.MigrationRunIDAnnotation]; runID != "" && !utils.ItemInSlice(runID, runIDs) {
+			runIDs = append(runIDs, runID)
+		}
+	}
+	sort.Strings(runIDs)
+	return runIDs, nil
+}
+
+// rollbackSourceIngress deletes the generated ingress resources of the source ingress resource and removes its back-references
+func rollbackSourceIngress(ctx context.Context, kc utils.KubeClient, source model.MigratedResource, deletedIngresses map[string]bool, logger *zap.Logger) []error {
+	logger = logger.With(zap.String("name", source.Name), zap.String("namespace", source.Namespace))
+
+	errors := deleteGeneratedIngresses(ctx, kc, source.Namespace, source.Name, deletedIngresses, logger)
+	if err := kc.AnnotateIngress(ctx, source.Name, source.Namespace, nil); err != nil && !k8sErrors.IsNotFound(err) {
+		logger.Error("error removing the back-reference annotations of the source ingress resource", zap.Error(err))
+		errors = append(errors, err)
+	}
+	return errors
+}
+
+// rollbackConfigMap deletes the configmap if it was created by the migration, otherwise restores the original values of its keys
+func rollbackConfigMap(ctx context.Context, kc utils.KubeClient, backup model.ResourceBackup, logger *zap.Logger) error {
+	logger = logger.With(zap.String("name", backup.Name), zap.String("namespace", backup.Namespace))
+
+	// the configmap of the community ingress controller is managed by IKS, it is never deleted
+	if backup.Created && backup.Name != utils.K8sConfigMapName {
+		if err := kc.DeleteConfigMap(ctx, backup.Name, backup.Namespace); err != nil && !k8sErrors.IsNotFound(err) {
+			logger.Error("error deleting configmap", zap.Error(err))
+			return err
+		}
+		logger.Info("successfully deleted configmap")
+		return nil
+	}
+
+	if len(backup.Data) == 0 {
+		return nil
+	}
+
+	// the configmap is read again if it was changed while it was restored
+	err := utils.RetryOnConflict(func() error {
+		cm, err := kc.GetConfigMap(ctx, backup.Name, backup.Namespace)
+		if err != nil {
+			logger.Error("error getting configmap", zap.Error(err))
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		for key, originalValue := range backup.Data {
+			if originalValue == nil {
+				delete(cm.Data, key)
+			} else {
+				cm.Data[key] = *originalValue
+			}
+		}
+		return kc.UpdateConfigmap(ctx, cm)
+	})
+	if err != nil {
+		logger.Error("error restoring configmap", zap.Error(err))
+		return err
+	}
+	logger.Info("successfully restored configmap")
+	return nil
+}
+
+// rollbackSecret removes the keys added to the secret by the migration
+func rollbackSecret(ctx context.Context, kc utils.KubeClient, backup model.ResourceBackup, logger *zap.Logger) error {
+	logger = logger.With(zap.String("name", backup.Name), zap.String("namespace", backup.Namespace))
+
+	// the secret is read again if it was changed while the keys were removed
+	err := utils.RetryOnConflict(func() error {
+		secret, err := kc.GetSecret(ctx, backup.Name, backup.Namespace)
+		if err != nil {
+			if k8sErrors.IsNotFound(err) {
+				logger.Warn("secret is not present on the cluster, skipping secret rollback")
+				return nil
+			}
+			logger.Error("error getting secret", zap.Error(err))
+			return err
+		}
+		for key := range backup.Data {
+			delete(secret.Data, key)
+		}
+		return kc.UpdateSecret(ctx, secret)
+	})
+	if err != nil {
+		logger.Error("error restoring secret", zap.Error(err))
+		return err
+	}
+	logger.Info("successfully removed the keys added to the secret")
+	return nil
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/utils"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const rollbackTestManifests = `
+apiVersion: networking.k8s.io/v1beta1
+kind: Ingress
+metadata:
+  name: tea-ingress
+  namespace: default
+  annotations:
+    ingress.bluemix.net/tcp-ports: "serviceName=tea-svc ingressPort=9000 servicePort=8080"
+    ingress.bluemix.net/ssl-services: "ssl-service=tea-svc ssl-secret=proxy-secret"
+spec:
+  rules:
+  - host: tea.example.com
+    http:
+      paths:
+      - path: /tea
+        backend:
+          serviceName: tea-svc
+          servicePort: 8080
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ibm-cloud-provider-ingress-cm
+  namespace: kube-system
+data:
+  ssl-protocols: "TLSv1.2"
+  keep-alive: "8s"
+  public-ports: "80;443;9000"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ibm-k8s-controller-config
+  namespace: kube-system
+data:
+  ssl-protocols: "TLSv1.3"
+  proxy-body-size: "2m"
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: proxy-secret
+  namespace: default
+stringData:
+  trusted.crt: cert
+  client.crt: cert
+  client.key: key
+  tls.key: key
+`
+
+func TestHandleRollback(t *testing.T) {
+	logger, _ := zap.NewProduction()
+
+	inputDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "manifests.yaml"), []byte(rollbackTestManifests), 0600))
+
+	kc, err := utils.NewFileKubeClient(inputDir, logger)
+	assert.NoError(t, err)
+
+	originalK8sCm, err := kc.GetConfigMap(context.Background(), utils.K8sConfigMapName, utils.KubeSystem)
+	assert.NoError(t, err)
+	originalSecret, err := kc.GetSecret(context.Background(), "proxy-secret", "default")
+	assert.NoError(t, err)
+	originalIngresses, err := kc.GetIngressResources(context.Background(), model.IngressFilter{})
+	assert.NoError(t, err)
+
+	t.Run("nothing to roll back", func(t *testing.T) {
+		assert.NoError(t, HandleRollback(context.Background(), kc, logger))
+	})
+
+	assert.NoError(t, HandleConfigMap(context.Background(), kc, model.MigrationModeProduction, logger))
+	assert.NoError(t, HandleIngressResources(context.Background(), kc, model.MigrationModeProduction, model.IngressFilter{}, 1, logger))
+	// the second run must not overwrite the original state in the backup configmap
+	assert.NoError(t, HandleConfigMap(context.Background(), kc, model.MigrationModeProduction, logger))
+
+	// the generated ingress resources are linked to the source ingress resource
+	source, err := kc.GetIngress(context.Background(), "tea-ingress", "default")
+	assert.NoError(t, err)
+	assert.Contains(t, strings.Split(source.Annotations[utils.MigratedToAnnotation], ","), "tea-ingress-server")
+	generated, err := kc.GetIngressResources(context.Background(), model.IngressFilter{Selector: utils.MigratedFromSelector("tea-ingress")})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, generated)
+	for _, ingress := range generated {
+		assert.Equal(t, "default/tea-ingress", ingress.Annotations[utils.MigratedFromAnnotation])
+	}
+
+	// generated ingress resource that is not recorded in the migration status, e.g. by an earlier run
+	orphan := *generated[0].DeepCopy()
+	orphan.Name = "tea-ingress-orphan"
+	assert.NoError(t, kc.CreateOrUpdateIngress(context.Background(), orphan))
+
+	migratedK8sCm, err := kc.GetConfigMap(context.Background(), utils.K8sConfigMapName, utils.KubeSystem)
+	assert.NoError(t, err)
+	assert.NotEqual(t, originalK8sCm.Data, migratedK8sCm.Data)
+	_, err = kc.GetConfigMap(context.Background(), utils.GenericK8sTCPConfigMapName, utils.KubeSystem)
+	assert.NoError(t, err)
+	migratedSecret, err := kc.GetSecret(context.Background(), "proxy-secret", "default")
+	assert.NoError(t, err)
+	assert.Contains(t, migratedSecret.Data, "ca.crt")
+
+	assert.NoError(t, HandleRollback(context.Background(), kc, logger))
+
+	k8sCm, err := kc.GetConfigMap(context.Background(), utils.K8sConfigMapName, utils.KubeSystem)
+	assert.NoError(t, err)
+	assert.Equal(t, originalK8sCm.Data, k8sCm.Data)
+
+	secret, err := kc.GetSecret(context.Background(), "proxy-secret", "default")
+	assert.NoError(t, err)
+	assert.Equal(t, originalSecret.Data, secret.Data)
+
+	ingresses, err := kc.GetIngressResources(context.Background(), model.IngressFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, originalIngresses, ingresses)
+
+	for _, name := range []string{utils.GenericK8sTCPConfigMapName, utils.MigrationStatusConfigMapName, utils.StatusShardName(0), utils.MigrationBackupConfigMapName} {
+		_, err = kc.GetConfigMap(context.Background(), name, utils.KubeSystem)
+		assert.True(t, k8sErrors.IsNotFound(err), name)
+	}
+}
+
+func TestRecordedRunIDs(t *testing.T) {
+	logger := zap.NewNop()
+	defer utils.SetRunID(utils.GetRunID())
+
+	inputDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "manifests.yaml"), []byte(rollbackTestManifests+`---
+apiVersion: networking.k8s.io/v1beta1
+kind: Ingress
+metadata:
+  name: coffee-ingress
+  namespace: default
+spec:
+  rules:
+  - host: coffee.example.com
+    http:
+      paths:
+      - path: /coffee
+        backend:
+          serviceName: coffee-svc
+          servicePort: 8080
+`), 0600))
+	kc, err := utils.NewFileKubeClient(inputDir, logger)
+	assert.NoError(t, err)
+
+	// nothing is recorded before the first run
+	runIDs, err := RecordedRunIDs(context.Background(), kc, logger)
+	assert.NoError(t, err)
+	assert.Empty(t, runIDs)
+
+	utils.SetRunID("first-run")
+	assert.NoError(t, HandleIngressResources(context.Background(), kc, model.MigrationModeProduction, model.IngressFilter{}, 1, logger))
+	// the unchanged ingress resources are not migrated again, so the coffee-ingress is changed before the second run
+	coffee, err := kc.GetIngress(context.Background(), "coffee-ingress", "default")
+	assert.NoError(t, err)
+	coffee.Spec.Rules[0].Host = "espresso.example.com"
+	assert.NoError(t, kc.CreateOrUpdateIngress(context.Background(), *coffee))
+	utils.SetRunID("second-run")
+	assert.NoError(t, HandleIngressResources(context.Background(), kc, model.MigrationModeProduction, model.IngressFilter{Names: []string{"coffee-*"}}, 1, logger))
+
+	// the rollback reverts both runs, the tea-ingress was last migrated by the first one
+	runIDs, err = RecordedRunIDs(context.Background(), kc, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first-run", "second-run"}, runIDs)
+
+	// the source ingress resources deleted since are not counted
+	assert.NoError(t, kc.DeleteIngress(context.Background(), "tea-ingress", "default"))
+	runIDs, err = RecordedRunIDs(context.Background(), kc, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"second-run"}, runIDs)
+}
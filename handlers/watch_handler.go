@@ -0,0 +1,532 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/utils"
+	"go.uber.org/zap"
+	networking "k8s.io/api/networking/v1beta1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// iksConfigMapKey is the queue key of the IKS configmap, the ingress resources are queued with their <namespace>/<name> keys
+	iksConfigMapKey = "configmap:" + utils.KubeSystem + "/" + utils.IKSConfigMapName
+	// watchMaxRetries is the number of the retries of a failed resource, it is migrated again at the next resync after that
+	watchMaxRetries = 5
+	// migratedFromIndex indexes the generated ingress resources by the <namespace>/<name> of their source ingress resource
+	migratedFromIndex = "migratedFrom"
+)
+
+// WatchOptions contains the options of the watch mode, see the HandleWatch function
+type WatchOptions struct {
+	Mode   string
+	Filter model.IngressFilter
+	// Phase selects the watched resources: the IKS configmap, the ingress resources or both of them
+	Phase       string
+	Concurrency int
+	// ResyncPeriod is the period of migrating every ingress resource again, 0 disables the resync
+	ResyncPeriod time.Duration
+}
+
+// HandleWatch top level function to migrate the changes of the ingress resources and the IKS configmap until ctx is canceled
+func HandleWatch(ctx context.Context, kc utils.KubeClient, client kubernetes.Interface, options WatchOptions, logger *zap.Logger) error {
+	// 1.) record the scope of the migration in the status configmap
+	// 2.) start the informers of the ingress resources and the IKS configmap, wait for their caches to sync
+	// 3.) start the workers, every queued resource is migrated by a single worker at a time
+	// 4.) stop the workers when ctx is canceled
+
+	logger.Info("starting to watch the iks formatted ingress resources and configmap", zap.String("mode", options.Mode), zap.Any("filter", options.Filter), zap.String("phase", options.Phase), zap.Duration("resyncPeriod", options.ResyncPeriod))
+
+	if options.Phase != utils.PhaseConfigMap {
+		if err := kc.CreateOrUpdateStatusCm(ctx, options.Mode, nil, nil, &options.Filter); err != nil {
+			logger.Error("could not record the scope of the migration in the status configmap", zap.Error(err))
+			return err
+		}
+	}
+
+	w := newIngressWatcher(kc, options, logger)
+	defer w.queue.ShutDown()
+	w.observeStatus(ctx)
+
+	var informerList []cache.SharedIndexInformer
+	if options.Phase != utils.PhaseConfigMap {
+		_, ingressEnhancementsEnabled, v1IngressOnly := utils.IngressVersionAvailable(client, logger)
+		w.ingressEnhancementsEnabled = ingressEnhancementsEnabled
+		w.ingressInformer = newIngressInformer(client, v1IngressOnly, options.ResyncPeriod)
+		w.ingressInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    w.enqueueIngress,
+			UpdateFunc: func(_, newObj interface{}) { w.enqueueIngress(newObj) },
+			DeleteFunc: w.enqueueIngress,
+		})
+		informerList = append(informerList, w.ingressInformer)
+	}
+	if options.Phase != utils.PhaseIngress {
+		configMapInformer := newIKSConfigMapInformer(client, options.ResyncPeriod)
+		configMapInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(interface{}) { w.queue.Add(iksConfigMapKey) },
+			UpdateFunc: func(_, _ interface{}) { w.queue.Add(iksConfigMapKey) },
+		})
+		informerList = append(informerList, configMapInformer)
+	}
+
+	var hasSynced []cache.InformerSynced
+	for _, informer := range informerList {
+		go informer.Run(ctx.Done())
+		hasSynced = append(hasSynced, informer.HasSynced)
+	}
+	if !cache.WaitForCacheSync(ctx.Done(), hasSynced...) {
+		logger.Warn("watch was stopped before the informer caches synced")
+		return nil
+	}
+	logger.Info("informer caches synced, starting the workers", zap.Int("concurrency", options.Concurrency))
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < options.Concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for w.processNextItem(ctx) {
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	logger.Info("stopping the watch", zap.Error(ctx.Err()))
+	w.queue.ShutDown()
+	wg.Wait()
+	return nil
+}
+
+// newIngressInformer returns the informer of the ingress resources of the API version served by the cluster
+func newIngressInformer(client kubernetes.Interface, v1IngressOnly bool, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	factory := informers.NewSharedInformerFactory(client, resyncPeriod)
+	var informer cache.SharedIndexInformer
+	if v1IngressOnly {
+		informer = factory.Networking().V1().Ingresses().Informer()
+	} else {
+		informer = factory.Networking().V1beta1().Ingresses().Informer()
+	}
+	// the informer is not started yet, so adding the indexer cannot fail
+	_ = informer.AddIndexers(cache.Indexers{migratedFromIndex: migratedFromIndexFunc})
+	return informer
+}
+
+// migratedFromIndexFunc returns the source ingress resource of the generated ingress resource
+func migratedFromIndexFunc(obj interface{}) ([]string, error) {
+	object, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	if source := object.GetAnnotations()[utils.MigratedFromAnnotation]; source != "" && object.GetLabels()[utils.ManagedByLabel] == utils.FieldManager {
+		return []string{source}, nil
+	}
+	return nil, nil
+}
+
+// newIKSConfigMapInformer returns the informer of the IKS configmap only
+func newIKSConfigMapInformer(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, resyncPeriod, informers.WithNamespace(utils.KubeSystem),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", utils.IKSConfigMapName).String()
+		}))
+	return factory.Core().V1().ConfigMaps().Informer()
+}
+
+// ingressWatcher migrates the queued ingress resources and the IKS configmap
+type ingressWatcher struct {
+	kc      utils.KubeClient
+	options WatchOptions
+	logger  *zap.Logger
+	queue   workqueue.RateLimitingInterface
+	// ingressInformer is nil if the ingress resources are not watched
+	ingressInformer cache.SharedIndexInformer
+	// ingressEnhancementsEnabled is used to convert the cached v1 ingress resources
+	ingressEnhancementsEnabled bool
+
+	// tcpPortsMutex guards ingressToCM and serializes the updates of the TCP ports configmaps
+	tcpPortsMutex sync.Mutex
+	// ingressToCM contains the configmap data of the migrated ingress resources by their keys
+	ingressToCM map[string]ingressToCMData
+
+	// syncedMutex guards the synced ingress resources and the synced IKS configmap data
+	syncedMutex sync.Mutex
+	// synced contains the last sync of the ingress resources by their keys
+	synced map[string]syncedIngress
+	// iksConfigMapData is the data of the IKS configmap at its last successful sync, nil if it was not synced yet
+	iksConfigMapData map[string]string
+	// iksConfigMapGeneration is increased by every successful sync of the changed IKS configmap
+	iksConfigMapGeneration int
+}
+
+// syncedIngress contains the result of the last sync of an ingress resource
+type syncedIngress struct {
+	sourceHash string
+	// iksConfigMapGeneration is the generation of the IKS configmap the ingress resource was migrated with
+	iksConfigMapGeneration int
+	// skipped is true if the ingress resource is not migrated, see the skipIngressResource function
+	skipped bool
+	// failed is true if the sync failed, the ingress resource is migrated again at the next sync
+	failed         bool
+	generatedNames []string
+	// migrationInfo is the status of the ingress resource recorded in the status configmap
+	migrationInfo model.MigratedResource
+}
+
+// ingressToCMData contains the configmap data parsed from an ingress resource
+type ingressToCMData struct {
+	ingressToCM utils.IngressToCM
+	albIDs      string
+}
+
+func newIngressWatcher(kc utils.KubeClient, options WatchOptions, logger *zap.Logger) *ingressWatcher {
+	if options.Concurrency < 1 {
+		options.Concurrency = 1
+	}
+	return &ingressWatcher{
+		kc:          kc,
+		options:     options,
+		logger:      logger,
+		queue:       workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ingress-migrator"),
+		ingressToCM: map[string]ingressToCMData{},
+		synced:      map[string]syncedIngress{},
+	}
+}
+
+// enqueueIngress queues the source ingress resource of the object
+func (w *ingressWatcher) enqueueIngress(obj interface{}) {
+	if tombstone, deleted := obj.(cache.DeletedFinalStateUnknown); deleted {
+		obj = tombstone.Obj
+	}
+	object, err := meta.Accessor(obj)
+	if err != nil {
+		w.logger.Warn("ignoring unknown object", zap.Error(err))
+		return
+	}
+
+	if object.GetLabels()[utils.ManagedByLabel] == utils.FieldManager {
+		// the deleted objects are not in the cache of the informer anymore
+		if source := object.GetAnnotations()[utils.MigratedFromAnnotation]; source != "" {
+			if _, exists, _ := w.ingressInformer.GetStore().Get(object); !exists || w.generatedIngressChanged(obj) {
+				w.queue.Add(source)
+			}
+		}
+		return
+	}
+
+	if !utils.MatchIngressFilter(networkingIngressMeta(object), w.options.Filter) {
+		return
+	}
+	w.queue.Add(object.GetNamespace() + "/" + object.GetName())
+}
+
+// enqueueAllIngresses queues every source ingress resource in the cache of the informer
+func (w *ingressWatcher) enqueueAllIngresses() {
+	if w.ingressInformer == nil {
+		return
+	}
+	for _, obj := range w.ingressInformer.GetStore().List() {
+		w.enqueueIngress(obj)
+	}
+}
+
+// processNextItem migrates the next queued resource, it returns false when the queue was shut down
+func (w *ingressWatcher) processNextItem(ctx context.Context) bool {
+	item, shutdown := w.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer w.queue.Done(item)
+
+	key := item.(string)
+	err := w.sync(ctx, key)
+	switch {
+	case err == nil:
+		w.queue.Forget(item)
+	case ctx.Err() != nil:
+		// the watch is stopping, the resource is migrated again at the next start
+	case w.queue.NumRequeues(item) < watchMaxRetries:
+		w.logger.Warn("error migrating resource, retrying", zap.String("key", key), zap.Int("retries", w.queue.NumRequeues(item)), zap.Error(err))
+		w.queue.AddRateLimited(item)
+	default:
+		w.logger.Error("error migrating resource, it is migrated again at the next resync", zap.String("key", key), zap.Error(err))
+		w.queue.Forget(item)
+	}
+	return true
+}
+
+// sync migrates the resource of the queue key
+func (w *ingressWatcher) sync(ctx context.Context, key string) error {
+	if key == iksConfigMapKey {
+		return w.syncConfigMap(ctx)
+	}
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		w.logger.Warn("ignoring invalid queue key", zap.String("key", key), zap.Error(err))
+		return nil
+	}
+	ingress, err := w.getIngress(ctx, namespace, name)
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return w.syncDeletedIngress(ctx, namespace, name)
+		}
+		return err
+	}
+	return w.syncIngress(ctx, key, *ingress)
+}
+
+// getIngress returns the ingress resource from the cache of the informer, or from the cluster if the ingress resources are not watched
+func (w *ingressWatcher) getIngress(ctx context.Context, namespace, name string) (*networking.Ingress, error) {
+	if w.ingressInformer == nil {
+		return w.kc.GetIngress(ctx, name, namespace)
+	}
+	obj, exists, err := w.ingressInformer.GetStore().GetByKey(namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	ingress, ok := utils.IngressFromObject(obj, w.ingressEnhancementsEnabled)
+	if !exists || !ok {
+		return nil, k8sErrors.NewNotFound(networking.Resource("ingresses"), name)
+	}
+	return &ingress, nil
+}
+
+// generatedIngresses returns the ingress resources generated from the ingress resource
+func (w *ingressWatcher) generatedIngresses(ctx context.Context, ingress networking.Ingress) ([]networking.Ingress, error) {
+	if w.ingressInformer == nil {
+		return w.kc.GetIngressResources(ctx, model.IngressFilter{Namespaces: []string{ingress.Namespace}, Selector: utils.MigratedFromSelector(ingress.Name)})
+	}
+	objs, err := w.ingressInformer.GetIndexer().ByIndex(migratedFromIndex, ingress.Namespace+"/"+ingress.Name)
+	if err != nil {
+		return nil, err
+	}
+	var generatedIngresses []networking.Ingress
+	for _, obj := range objs {
+		if generated, ok := utils.IngressFromObject(obj, w.ingressEnhancementsEnabled); ok {
+			generatedIngresses = append(generatedIngresses, generated)
+		}
+	}
+	return generatedIngresses, nil
+}
+
+// generatedIngressChanged returns true if the generated ingress resource was changed since it was generated
+func (w *ingressWatcher) generatedIngressChanged(obj interface{}) bool {
+	generated, ok := utils.IngressFromObject(obj, w.ingressEnhancementsEnabled)
+	return ok && utils.GeneratedHash(generated) != generated.Annotations[utils.GeneratedHashAnnotation]
+}
+
+// syncConfigMap migrates the changed IKS configmap and queues every ingress resource again
+func (w *ingressWatcher) syncConfigMap(ctx context.Context) error {
+	iksConfigMap, err := w.kc.GetConfigMap(ctx, utils.IKSConfigMapName, utils.KubeSystem)
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return err
+	}
+	var data map[string]string
+	if iksConfigMap != nil {
+		data = iksConfigMap.Data
+	}
+
+	w.syncedMutex.Lock()
+	unchanged := w.iksConfigMapData != nil && reflect.DeepEqual(w.iksConfigMapData, data)
+	w.syncedMutex.Unlock()
+	if unchanged {
+		w.logger.Debug("skipping the unchanged iks configmap")
+		return nil
+	}
+
+	if err := HandleConfigMap(ctx, w.kc, w.options.Mode, w.logger); err != nil {
+		return err
+	}
+	w.observeStatus(ctx)
+
+	w.syncedMutex.Lock()
+	w.iksConfigMapData = data
+	if w.iksConfigMapData == nil {
+		w.iksConfigMapData = map[string]string{}
+	}
+	w.iksConfigMapGeneration++
+	w.syncedMutex.Unlock()
+	w.enqueueAllIngresses()
+	return nil
+}
+
+// syncIngress migrates the changed ingress resource and records its status
+func (w *ingressWatcher) syncIngress(ctx context.Context, key string, ingress networking.Ingress) error {
+	logger := w.logger.With(zap.String("name", ingress.Name), zap.String("namespace", ingress.Namespace))
+
+	sourceHash := utils.SourceHash(ingress)
+	w.syncedMutex.Lock()
+	previous, synced := w.synced[key]
+	iksConfigMapGeneration := w.iksConfigMapGeneration
+	w.syncedMutex.Unlock()
+	changed := !synced || previous.sourceHash != sourceHash
+	if !changed && (previous.skipped || !previous.failed && previous.iksConfigMapGeneration == iksConfigMapGeneration &&
+		w.generatedIngressesUnchanged(ctx, ingress, previous.generatedNames, sourceHash)) {
+		logger.Debug("skipping the unchanged ingress resource")
+		return nil
+	}
+
+	if skipIngressResource(ingress, w.options.Mode, logger) {
+		w.setSynced(key, syncedIngress{sourceHash: sourceHash, skipped: true})
+		return nil
+	}
+
+	result := processIngressResource(ctx, w.kc, ingress, w.options.Mode, logger)
+
+	w.tcpPortsMutex.Lock()
+	migrationInfo, _, errs := recordIngressResult(ctx, w.kc, ingress, result, w.options.Mode, w.otherALBSpecificData(key), logger)
+	if changed {
+		utils.ObserveMigratedResource(migrationInfo)
+	}
+	if result.configErrors == nil {
+		w.ingressToCM[key] = ingressToCMData{ingressToCM: result.ingressToCM, albIDs: result.albIDs}
+	}
+	w.tcpPortsMutex.Unlock()
+	recordIngressEvents(ctx, w.kc, &ingress, migrationInfo, logger)
+
+	if len(errs) == 0 {
+		keep := map[string]bool{}
+		for _, name := range generatedIngressNames(result.resources) {
+			keep[name] = true
+		}
+		errs = deleteGeneratedIngresses(ctx, w.kc, ingress.Namespace, ingress.Name, keep, logger)
+	}
+
+	current := syncedIngress{
+		sourceHash:             sourceHash,
+		iksConfigMapGeneration: iksConfigMapGeneration,
+		generatedNames:         generatedIngressNames(result.resources),
+		migrationInfo:          previous.migrationInfo,
+	}
+	// the status is written only if the recorded entry of the ingress resource was changed
+	if !synced || previous.skipped || !reflect.DeepEqual(previous.migrationInfo, migrationInfo) || len(result.subdomains) > 0 {
+		if err := w.kc.CreateOrUpdateStatusCm(ctx, w.options.Mode, []model.MigratedResource{migrationInfo}, result.subdomains, nil); err != nil {
+			logger.Error("could not update status configmap", zap.Error(err))
+			errs = append(errs, err)
+		} else {
+			current.migrationInfo = migrationInfo
+			w.observeStatus(ctx)
+		}
+	}
+	current.failed = len(errs) > 0
+	w.setSynced(key, current)
+
+	if len(errs) > 0 {
+		return &utils.PartialMigrationError{Operation: fmt.Sprintf("migrating ingress resource %s", key), Errors: errs}
+	}
+	logger.Info("successfully migrated the changes of the ingress resource")
+	return nil
+}
+
+// setSynced records the last sync of the ingress resource with the key
+func (w *ingressWatcher) setSynced(key string, synced syncedIngress) {
+	w.syncedMutex.Lock()
+	defer w.syncedMutex.Unlock()
+	w.synced[key] = synced
+}
+
+// observeStatus sets the gauges of the metrics from the current migration status
+func (w *ingressWatcher) observeStatus(ctx context.Context) {
+	status, err := utils.GetMigrationStatus(ctx, w.kc)
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		w.logger.Warn("could not read the migration status for the metrics", zap.Error(err))
+		return
+	}
+	utils.ObserveStatus(status)
+}
+
+// generatedIngressesUnchanged returns true if the generated ingress resources are unchanged since the last sync
+func (w *ingressWatcher) generatedIngressesUnchanged(ctx context.Context, ingress networking.Ingress, generatedNames []string, sourceHash string) bool {
+	generatedIngresses, err := w.generatedIngresses(ctx, ingress)
+	if err != nil {
+		return false
+	}
+	expected := map[string]bool{}
+	for _, name := range generatedNames {
+		expected[name] = true
+	}
+	found := 0
+	for _, generated := range generatedIngresses {
+		if generated.Annotations[utils.MigratedFromAnnotation] != ingress.Namespace+"/"+ingress.Name {
+			continue
+		}
+		if !expected[generated.Name] || generated.Annotations[utils.SourceHashAnnotation] != sourceHash || w.generatedIngressChanged(&generated) {
+			return false
+		}
+		found++
+	}
+	return found == len(expected)
+}
+
+// syncDeletedIngress deletes the ingress resources generated from the deleted ingress resource
+func (w *ingressWatcher) syncDeletedIngress(ctx context.Context, namespace, name string) error {
+	logger := w.logger.With(zap.String("name", name), zap.String("namespace", namespace))
+
+	w.tcpPortsMutex.Lock()
+	delete(w.ingressToCM, namespace+"/"+name)
+	w.tcpPortsMutex.Unlock()
+	w.syncedMutex.Lock()
+	delete(w.synced, namespace+"/"+name)
+	w.syncedMutex.Unlock()
+
+	if errs := deleteGeneratedIngresses(ctx, w.kc, namespace, name, nil, logger); len(errs) > 0 {
+		return &utils.PartialMigrationError{Operation: fmt.Sprintf("deleting the ingress resources generated from %s/%s", namespace, name), Errors: errs}
+	}
+	if err := w.kc.RemoveFromStatusCm(ctx, []model.MigratedResource{{Kind: utils.IngressKind, Name: name, Namespace: namespace}}); err != nil {
+		logger.Error("could not update status configmap", zap.Error(err))
+		return err
+	}
+	w.observeStatus(ctx)
+	logger.Info("successfully deleted the ingress resources generated from the deleted ingress resource")
+	return nil
+}
+
+// otherALBSpecificData returns the merged configmap data of the other ingress resources, the caller must hold tcpPortsMutex
+func (w *ingressWatcher) otherALBSpecificData(key string) utils.ALBSpecificData {
+	keys := make([]string, 0, len(w.ingressToCM))
+	for otherKey := range w.ingressToCM {
+		if otherKey != key {
+			keys = append(keys, otherKey)
+		}
+	}
+	sort.Strings(keys)
+
+	albSpecificData := utils.ALBSpecificData{}
+	for _, otherKey := range keys {
+		// the collisions between the other ingress resources were reported when they were migrated
+		albSpecificData, _ = utils.MergeALBSpecificData(albSpecificData, w.ingressToCM[otherKey].ingressToCM, w.ingressToCM[otherKey].albIDs, zap.NewNop())
+	}
+	return albSpecificData
+}
+
+// networkingIngressMeta returns an ingress resource with the metadata of the object, so it can be matched with the ingress filter
+func networkingIngressMeta(object metav1.Object) networking.Ingress {
+	return networking.Ingress{ObjectMeta: metav1.ObjectMeta{Name: object.GetName(), Namespace: object.GetNamespace(), Labels: object.GetLabels()}}
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/utils"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	networkingv1 "k8s.io/api/networking/v1"
+	networking "k8s.io/api/networking/v1beta1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestIngressWatcherSync(t *testing.T) {
+	logger := zap.NewNop()
+	ctx := context.Background()
+
+	inputDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "manifests.yaml"), []byte(rollbackTestManifests), 0600))
+	kc, err := utils.NewFileKubeClient(inputDir, logger)
+	assert.NoError(t, err)
+
+	w := newIngressWatcher(kc, WatchOptions{Mode: model.MigrationModeProduction}, logger)
+
+	// recordedResource returns the recorded status of the source ingress resource
+	recordedResource := func() (model.MigratedResource, bool) {
+		status, err := utils.GetMigrationStatus(ctx, kc)
+		assert.NoError(t, err)
+		for _, migratedResource := range status.MigratedResources {
+			if migratedResource.Kind == utils.IngressKind && migratedResource.Name == "tea-ingress" {
+				return migratedResource, true
+			}
+		}
+		return model.MigratedResource{}, false
+	}
+	migratedResource := func() model.MigratedResource {
+		migratedResource, recorded := recordedResource()
+		if !recorded {
+			t.Fatal("the status of the source ingress resource is not recorded")
+		}
+		return migratedResource
+	}
+	// metric returns the value of the metric saved by utils.WriteMetrics, the metrics are shared by the tests of the package
+	metric := func(name string) float64 {
+		outputDir := t.TempDir()
+		assert.NoError(t, utils.WriteMetrics(outputDir))
+		content, err := os.ReadFile(filepath.Join(outputDir, utils.MetricsFileName))
+		assert.NoError(t, err)
+		match := regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(name) + ` (\S+)$`).FindSubmatch(content)
+		if match == nil {
+			return 0
+		}
+		value, err := strconv.ParseFloat(string(match[1]), 64)
+		assert.NoError(t, err)
+		return value
+	}
+	migratedIngresses := `ingress_migrator_ingresses_total{result="migrated"}`
+	initialMigratedIngresses := metric(migratedIngresses)
+
+	// lastUpdates returns the timestamp of the last update of the status
+	lastUpdates := func() string {
+		statusCm, err := kc.GetConfigMap(ctx, utils.MigrationStatusConfigMapName, utils.KubeSystem)
+		assert.NoError(t, err)
+		return statusCm.Data[utils.LastUpdatesTimestampParameterName]
+	}
+
+	// the IKS configmap is migrated
+	assert.NoError(t, w.sync(ctx, iksConfigMapKey))
+	k8sCm, err := kc.GetConfigMap(ctx, utils.K8sConfigMapName, utils.KubeSystem)
+	assert.NoError(t, err)
+	assert.Equal(t, "TLSv1.2", k8sCm.Data["ssl-protocols"])
+
+	// the changed ingress resource is migrated, and its status is recorded
+	assert.NoError(t, w.sync(ctx, "default/tea-ingress"))
+	generatedIngresses := generatedIngressNames(migratedResource().MigratedAs)
+	assert.NotEmpty(t, generatedIngresses)
+	assert.Contains(t, w.ingressToCM, "default/tea-ingress")
+	assert.Equal(t, float64(2), metric("ingress_migrator_migrated_resources"))
+
+	// the generated ingress resources that are not generated anymore are deleted
+	stale := networking.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "tea-ingress-stale", Namespace: "default"}}
+	utils.SetProvenance(&stale.ObjectMeta, &metav1.ObjectMeta{Name: "tea-ingress", Namespace: "default"})
+	assert.NoError(t, kc.CreateOrUpdateIngress(ctx, stale))
+	assert.NoError(t, w.sync(ctx, "default/tea-ingress"))
+	_, err = kc.GetIngress(ctx, stale.Name, stale.Namespace)
+	assert.True(t, k8sErrors.IsNotFound(err))
+	assert.Len(t, migratedResource().Unchanged, len(generatedIngresses))
+
+	// the resync of the unchanged ingress resource and IKS configmap is skipped, the status is not written
+	updated := lastUpdates()
+	assert.NoError(t, w.sync(ctx, "default/tea-ingress"))
+	assert.NoError(t, w.sync(ctx, iksConfigMapKey))
+	assert.Equal(t, updated, lastUpdates())
+
+	// the resync rewrites the generated ingress resource changed by hand
+	edited, err := kc.GetIngress(ctx, generatedIngresses[0], "default")
+	assert.NoError(t, err)
+	original := *edited.Spec.DeepCopy()
+	edited.Spec.Rules[0].Host = "edited.example.com"
+	assert.NoError(t, kc.CreateOrUpdateIngress(ctx, *edited))
+	assert.NoError(t, w.sync(ctx, "default/tea-ingress"))
+	rewritten, err := kc.GetIngress(ctx, generatedIngresses[0], "default")
+	assert.NoError(t, err)
+	assert.Equal(t, original, rewritten.Spec)
+
+	// only the change of the source ingress resource is counted, not its resyncs
+	assert.Equal(t, initialMigratedIngresses+1, metric(migratedIngresses))
+
+	// the generated ingress resources of the deleted ingress resource are deleted
+	assert.NoError(t, kc.DeleteIngress(ctx, "tea-ingress", "default"))
+	assert.NoError(t, w.sync(ctx, "default/tea-ingress"))
+	for _, name := range generatedIngresses {
+		_, err := kc.GetIngress(ctx, name, "default")
+		assert.True(t, k8sErrors.IsNotFound(err), name)
+	}
+	_, recorded := recordedResource()
+	assert.False(t, recorded)
+	assert.NotContains(t, w.ingressToCM, "default/tea-ingress")
+	assert.NotContains(t, w.synced, "default/tea-ingress")
+	assert.Equal(t, float64(1), metric("ingress_migrator_migrated_resources"))
+
+	// the invalid queue keys are ignored
+	assert.NoError(t, w.sync(ctx, "invalid/queue/key"))
+}
+
+func TestIngressWatcherEnqueueIngress(t *testing.T) {
+	source := func(name, namespace string) *networking.Ingress {
+		return &networking.Ingress{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	}
+	generated := func(name string) *networking.Ingress {
+		ingress := source(name, "default")
+		utils.SetProvenance(&ingress.ObjectMeta, &source("tea-ingress", "default").ObjectMeta)
+		utils.SetContentHashes(ingress, "source-hash")
+		return ingress
+	}
+	edited := generated("tea-ingress-server")
+	edited.Spec.Rules = []networking.IngressRule{{Host: "edited.example.com"}}
+
+	testCases := []struct {
+		description  string
+		filter       model.IngressFilter
+		obj          interface{}
+		cached       bool
+		expectedKeys []string
+	}{
+		{
+			description:  "source ingress resource is queued",
+			obj:          source("tea-ingress", "default"),
+			expectedKeys: []string{"default/tea-ingress"},
+		},
+		{
+			description:  "source ingress resource of a deleted object tombstone is queued",
+			obj:          cache.DeletedFinalStateUnknown{Key: "default/tea-ingress", Obj: source("tea-ingress", "default")},
+			expectedKeys: []string{"default/tea-ingress"},
+		},
+		{
+			description: "source ingress resource not selected by the filter is ignored",
+			filter:      model.IngressFilter{Namespaces: []string{"tea"}},
+			obj:         source("tea-ingress", "default"),
+		},
+		{
+			description: "unchanged generated ingress resource is ignored",
+			obj:         generated("tea-ingress-server"),
+			cached:      true,
+		},
+		{
+			description:  "changed generated ingress resource queues its source ingress resource",
+			obj:          edited,
+			cached:       true,
+			expectedKeys: []string{"default/tea-ingress"},
+		},
+		{
+			description:  "deleted generated ingress resource queues its source ingress resource",
+			obj:          generated("tea-ingress-server"),
+			expectedKeys: []string{"default/tea-ingress"},
+		},
+		{
+			description: "unknown object is ignored",
+			obj:         "tea-ingress",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			w := newIngressWatcher(nil, WatchOptions{Mode: model.MigrationModeProduction, Filter: tc.filter}, zap.NewNop())
+			defer w.queue.ShutDown()
+			w.ingressInformer = newIngressInformer(fake.NewSimpleClientset(), false, 0)
+			if tc.cached {
+				assert.NoError(t, w.ingressInformer.GetStore().Add(tc.obj))
+			}
+
+			w.enqueueIngress(tc.obj)
+
+			var actualKeys []string
+			for w.queue.Len() > 0 {
+				item, _ := w.queue.Get()
+				actualKeys = append(actualKeys, item.(string))
+				w.queue.Done(item)
+			}
+			assert.Equal(t, tc.expectedKeys, actualKeys)
+		})
+	}
+}
+
+func TestIngressWatcherCachedIngresses(t *testing.T) {
+	ctx := context.Background()
+	source := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "tea-ingress", Namespace: "default"}}
+	generated := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "tea-ingress-server", Namespace: "default"}}
+	utils.SetProvenance(&generated.ObjectMeta, &source.ObjectMeta)
+	other := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "coffee-ingress-server", Namespace: "default"}}
+	utils.SetProvenance(&other.ObjectMeta, &metav1.ObjectMeta{Name: "coffee-ingress", Namespace: "default"})
+
+	w := newIngressWatcher(nil, WatchOptions{Mode: model.MigrationModeProduction}, zap.NewNop())
+	defer w.queue.ShutDown()
+	w.ingressInformer = newIngressInformer(fake.NewSimpleClientset(), true, 0)
+	for _, obj := range []interface{}{source, generated, other} {
+		assert.NoError(t, w.ingressInformer.GetIndexer().Add(obj))
+	}
+
+	// the source ingress resource is read from the cache in v1beta1 format
+	ingress, err := w.getIngress(ctx, "default", "tea-ingress")
+	assert.NoError(t, err)
+	assert.Equal(t, source.ObjectMeta, ingress.ObjectMeta)
+
+	// the ingress resource missing from the cache is not found
+	_, err = w.getIngress(ctx, "default", "latte-ingress")
+	assert.True(t, k8sErrors.IsNotFound(err))
+
+	// only the ingress resources generated from the source ingress resource are returned
+	generatedIngresses, err := w.generatedIngresses(ctx, *ingress)
+	assert.NoError(t, err)
+	if assert.Len(t, generatedIngresses, 1) {
+		assert.Equal(t, generated.Name, generatedIngresses[0].Name)
+	}
+}
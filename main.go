@@ -14,94 +14,77 @@ limitations under the License.
 package main
 
 import (
-	"flag"
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
-	"github.com/IBM-Cloud/iks-ingress-migration-tool/handlers"
-	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
 	"github.com/IBM-Cloud/iks-ingress-migration-tool/utils"
-	"go.uber.org/zap"
-)
-
-var (
-	outputDir = flag.String("outputdir", "", "specifies the path where the logs and resources should be saved")
 )
 
 func main() {
 	defer func() {
 		if r := recover(); r != nil {
-			fmt.Printf("\n\nA problem occurred while running migration-tool.\n\n")
-			panic(r)
+			fmt.Fprintf(os.Stderr, "\n\nA problem occurred while running migration-tool: %v\n\n", r)
+			os.Exit(utils.ExitCodeInternalError)
 		}
 	}()
 
-	mode := utils.GetMode()
-
-	flag.Parse()
-	if outputDir == nil || *outputDir == "" {
-		panic(fmt.Errorf("failed to read outputdir flag"))
-	}
-
-	logger, err := utils.GetZapLogger(*outputDir)
-	if err != nil {
-		panic(err)
-	}
-	logger.Info("starting ingress migrator", zap.String("mode", mode))
-
-	kubeConfigPath := os.Getenv("KUBECONFIG")
-	if kubeConfigPath == "" {
-		panic(fmt.Errorf("KUBECONFIG environment variable must be set"))
-	}
-
-	switch mode {
-	case model.MigrationModeTest, model.MigrationModeTestWithPrivate:
-		if utils.TestDomain == "" || utils.TestSecret == "" {
-			logger.Error("missing test subdomain or test secret", zap.String("mode", mode), zap.String("testDomain", utils.TestDomain), zap.String("testSecret", utils.TestSecret))
-			panic("missing test subdomain or test secret")
-		}
-	case model.MigrationModeProduction:
-	default:
-		logger.Error("unknown migration mode specified", zap.String("mode", mode))
-		panic("unknown migration mode specified")
+	// the migrate command is used when no command is specified to stay compatible with the flag-only invocation
+	args := os.Args[1:]
+	name := migrateCommand
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
 
-	kc, err := utils.NewKubeClient(kubeConfigPath, utils.ReadOnly, utils.DumpResources, logger)
-	if err != nil || kc == nil {
-		logger.Error("error getting kubeclient interface", zap.Error(err))
-		panic(fmt.Sprintf("error getting kubeclient interface %v", err))
+	cmd := lookupCommand(name)
+	if cmd == nil {
+		printUsage()
+		fmt.Fprintf(os.Stderr, "unknown command '%s'\n", name)
+		os.Exit(utils.ExitCodeConfigError)
 	}
-	logger.Info("successfully initialized kube client")
 
-	if err := kc.DeleteStatusCm(); err == nil {
-		logger.Info("successfully deleted status configmap")
-	}
+	// the resources generated by this run are labeled with its ID, see the provenance labels
+	utils.SetRunID(utils.NewRunID())
 
-	if err := handlers.HandleConfigMap(kc, mode, logger); err != nil {
-		logger.Error("error handling configmap data", zap.Error(err))
-		panic(err)
+	// the command is canceled on SIGINT and SIGTERM (e.g. when the Job is deleted), so it can still report the processed resources
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	result, err := cmd.run(ctx, args)
+	stop()
+	if name == helpCommand {
+		return
 	}
-	logger.Info("successfully migrated configmap parameters from iks to k8s")
+	os.Exit(finish(name, result, err))
+}
 
-	if err = handlers.HandleIngressResources(kc, mode, logger); err != nil {
-		logger.Error("error handling ingress resources", zap.Error(err))
-		panic(err)
+// finish prints the error and the summary of the command, and returns the exit code
+func finish(name string, result commandResult, err error) int {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 	}
-	logger.Info("successfully migrated ingress resources")
 
-	if utils.DumpResources {
-		if err := utils.DumpYAML(*outputDir, kc.GetIngressContainer()); err != nil {
-			panic(fmt.Errorf("error while dumping resources: %v", err))
+	summary := utils.NewSummary(name, result.status, err)
+	utils.ObserveRun(summary)
+	if result.outputDir != "" {
+		if writeErr := utils.WriteSummary(result.outputDir, summary); writeErr != nil {
+			fmt.Fprintf(os.Stderr, "Error writing summary: %v\n", writeErr)
 		}
-		if err := utils.DumpYAML(*outputDir, kc.GetConfigMapContainer()); err != nil {
-			panic(fmt.Errorf("error while dumping resources: %v", err))
+		if writeErr := utils.WriteMetrics(result.outputDir); writeErr != nil {
+			fmt.Fprintf(os.Stderr, "Error writing metrics: %v\n", writeErr)
 		}
-		if err := utils.DumpYAML(*outputDir, kc.GetSecretContainer()); err != nil {
-			panic(fmt.Errorf("error while dumping resources: %v", err))
-		}
-
-		if err := utils.PrintStatus(*outputDir, kubeConfigPath, kc.GetConfigMapContainer()[utils.KubeSystem][utils.MigrationStatusConfigMapName]); err != nil {
-			panic(fmt.Errorf("error printing status output: %v", err))
+		if result.report != nil {
+			result.report.Summary = &summary
+			if writeErr := utils.WriteReports(result.outputDir, result.reportFormats, *result.report); writeErr != nil {
+				fmt.Fprintf(os.Stderr, "Error writing migration report: %v\n", writeErr)
+			}
 		}
 	}
+	if summaryJSON, marshalErr := json.Marshal(summary); marshalErr == nil {
+		fmt.Println(string(summaryJSON))
+	}
+
+	return summary.ExitCode
 }
@@ -13,6 +13,8 @@ limitations under the License.
 
 package model
 
+import "time"
+
 const (
 	// MigrationModeTest is used to sign that the migration process should be started in "test" mode
 	MigrationModeTest = "test"
@@ -29,4 +31,116 @@ type MigratedResource struct {
 	Namespace  string   `json:"namespace"`
 	MigratedAs []string `json:"migratedAs"`
 	Warnings   []string `json:"warnings"`
+	Errors     []string `json:"errors,omitempty"`
+	Unchanged  []string `json:"unchanged,omitempty"`
+	// WarningDetails contains the structured form of the warnings in the same order
+	WarningDetails []Warning `json:"warningDetails,omitempty"`
+	// AcknowledgedWarnings contains the warnings suppressed by an acknowledgement, they are not in the Warnings
+	AcknowledgedWarnings []Warning `json:"acknowledgedWarnings,omitempty"`
+}
+
+// Warning represents a structured migration warning, see the utils.NewWarning function
+type Warning struct {
+	// Code is the stable identifier of the warning, e.g. TCP_PORT_ALB_ID
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	// Message is the text of the warning, it is the same as the text in the Warnings of the migrated resource
+	Message string `json:"message"`
+	// Annotation is the IKS annotation of the source ingress resource the warning is about
+	Annotation string `json:"annotation,omitempty"`
+	// Parameter is the parameter of the IKS configmap the warning is about
+	Parameter string `json:"parameter,omitempty"`
+	// Services and Paths are the backend services and the paths affected by the annotation
+	Services    []string `json:"services,omitempty"`
+	Paths       []string `json:"paths,omitempty"`
+	Remediation string   `json:"remediation,omitempty"`
+	DocURL      string   `json:"docUrl,omitempty"`
+	// Acknowledgement is set on the acknowledged warnings only
+	Acknowledgement *Acknowledgement `json:"acknowledgement,omitempty"`
+}
+
+// Acknowledgement suppresses the warnings with the code until it expires
+type Acknowledgement struct {
+	Code      string `json:"code"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Reason    string `json:"reason"`
+	// Expires is a date (e.g. 2023-06-30, the acknowledgement is valid on that day) or an RFC 3339 time
+	Expires string `json:"expires"`
+	// Source is the file, configmap or annotation the acknowledgement was loaded from
+	Source string `json:"source,omitempty"`
+}
+
+// IngressFilter represents the filters selecting the ingress resources to migrate, an empty filter selects every ingress resource
+type IngressFilter struct {
+	Namespaces         []string `json:"namespaces,omitempty"`
+	ExcludedNamespaces []string `json:"excludedNamespaces,omitempty"`
+	Selector           string   `json:"selector,omitempty"`
+	Names              []string `json:"names,omitempty"`
+}
+
+// MigrationStatus represents the contents of the status configmap
+type MigrationStatus struct {
+	Mode              string
+	MigratedResources []MigratedResource
+	SubdomainMap      map[string]string
+	Scope             *IngressFilter
+}
+
+// ResourceBackup represents the state of a resource before the migration changed it
+type ResourceBackup struct {
+	Kind      string             `json:"kind"`
+	Name      string             `json:"name"`
+	Namespace string             `json:"namespace"`
+	Created   bool               `json:"created"`
+	Data      map[string]*string `json:"data,omitempty"`
+}
+
+// Summary represents the machine-readable outcome of a command
+type Summary struct {
+	Command               string `json:"command"`
+	RunID                 string `json:"runId,omitempty"`
+	Mode                  string `json:"mode,omitempty"`
+	Result                string `json:"result"`
+	ExitCode              int    `json:"exitCode"`
+	Error                 string `json:"error,omitempty"`
+	MigratedResources     int    `json:"migratedResources"`
+	ResourcesWithWarnings int    `json:"resourcesWithWarnings"`
+	ResourcesWithErrors   int    `json:"resourcesWithErrors"`
+	AcknowledgedWarnings  int    `json:"acknowledgedWarnings"`
+	// PolicyViolations contains the violations of the policy of the --fail-on and --policy options
+	PolicyViolations []string `json:"policyViolations,omitempty"`
+}
+
+// Report represents the migration report saved into the output directory, see the --report-format option
+type Report struct {
+	Command           string             `json:"command"`
+	RunID             string             `json:"runId,omitempty"`
+	Version           string             `json:"version"`
+	GeneratedAt       time.Time          `json:"generatedAt"`
+	Mode              string             `json:"mode,omitempty"`
+	Context           string             `json:"context,omitempty"`
+	Identity          string             `json:"identity,omitempty"`
+	Scope             *IngressFilter     `json:"scope,omitempty"`
+	Summary           *Summary           `json:"summary,omitempty"`
+	SubdomainMap      map[string]string  `json:"subdomainMap,omitempty"`
+	MigratedResources []MigratedResource `json:"migratedResources"`
+	// Manifests contains the YAML manifests of the resources by their <kind>/<namespace>/<name> keys
+	Manifests map[string]string `json:"-"`
+}
+
+// ResourceChange represents the change that the migration would apply on a single resource
+type ResourceChange struct {
+	Kind      string        `json:"kind"`
+	Name      string        `json:"name"`
+	Namespace string        `json:"namespace"`
+	Action    string        `json:"action"`
+	Fields    []FieldChange `json:"fields,omitempty"`
+}
+
+// FieldChange represents the change of a single field, a nil value means that the field does not exist in that state
+type FieldChange struct {
+	Path     string  `json:"path"`
+	OldValue *string `json:"oldValue,omitempty"`
+	NewValue *string `json:"newValue,omitempty"`
 }
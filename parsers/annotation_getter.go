@@ -18,6 +18,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
 	"github.com/IBM-Cloud/iks-ingress-migration-tool/utils"
 	"go.uber.org/zap"
 	networking "k8s.io/api/networking/v1beta1"
@@ -58,40 +59,46 @@ var serviceNameOptional = map[string]bool{
 	"ingress.bluemix.net/upstream-keepalive-timeout": true,
 }
 
+// unsupportedAnnotationWarnings contains the warning messages of the annotations that can't be migrated
+var unsupportedAnnotationWarnings = map[string]string{
+	"ingress.bluemix.net/custom-errors":              utils.CustomErrorsWarning,
+	"ingress.bluemix.net/custom-error-actions":       utils.CustomErrorActionsWarning,
+	"ingress.bluemix.net/upstream-max-fails":         utils.UpstreamMaxFailsWarning,
+	"ingress.bluemix.net/proxy-external-service":     utils.ProxyExternalServiceWarning,
+	"ingress.bluemix.net/proxy-busy-buffers-size":    utils.ProxyBusyBuffersSizeWarning,
+	"ingress.bluemix.net/add-host-port":              utils.AddHostPortWarning,
+	"ingress.bluemix.net/iam-ui-auth":                utils.IAMUIAuthWarning,
+	"ingress.bluemix.net/upstream-keepalive":         utils.UpstreamKeepaliveWarning,
+	"ingress.bluemix.net/upstream-keepalive-timeout": utils.UpstreamKeepaliveTimeoutWarning,
+	"ingress.bluemix.net/upstream-fail-timeout":      utils.UpstreamFailTimeoutWarning,
+	"ingress.bluemix.net/hsts":                       utils.HSTSWarning,
+	"ingress.bluemix.net/custom-port":                utils.CustomPortWarning,
+}
+
 // GetUnsupportedAnnotationWarnings returns a list of warnings for all annotations that can't be migrated
-func GetUnsupportedAnnotationWarnings(ingEx *networking.Ingress) []string {
-	var warnings []string
+func GetUnsupportedAnnotationWarnings(ingEx *networking.Ingress) []model.Warning {
+	var warnings []model.Warning
 	for annotation := range ingEx.Annotations {
-		switch annotation {
-		case "ingress.bluemix.net/custom-errors":
-			warnings = append(warnings, utils.CustomErrorsWarning)
-		case "ingress.bluemix.net/custom-error-actions":
-			warnings = append(warnings, utils.CustomErrorActionsWarning)
-		case "ingress.bluemix.net/upstream-max-fails":
-			warnings = append(warnings, utils.UpstreamMaxFailsWarning)
-		case "ingress.bluemix.net/proxy-external-service":
-			warnings = append(warnings, utils.ProxyExternalServiceWarning)
-		case "ingress.bluemix.net/proxy-busy-buffers-size":
-			warnings = append(warnings, utils.ProxyBusyBuffersSizeWarning)
-		case "ingress.bluemix.net/add-host-port":
-			warnings = append(warnings, utils.AddHostPortWarning)
-		case "ingress.bluemix.net/iam-ui-auth":
-			warnings = append(warnings, utils.IAMUIAuthWarning)
-		case "ingress.bluemix.net/upstream-keepalive":
-			warnings = append(warnings, utils.UpstreamKeepaliveWarning)
-		case "ingress.bluemix.net/upstream-keepalive-timeout":
-			warnings = append(warnings, utils.UpstreamKeepaliveTimeoutWarning)
-		case "ingress.bluemix.net/upstream-fail-timeout":
-			warnings = append(warnings, utils.UpstreamFailTimeoutWarning)
-		case "ingress.bluemix.net/hsts":
-			warnings = append(warnings, utils.HSTSWarning)
-		case "ingress.bluemix.net/custom-port":
-			warnings = append(warnings, utils.CustomPortWarning)
+		if message, unsupported := unsupportedAnnotationWarnings[annotation]; unsupported {
+			warnings = append(warnings, utils.WithAffectedServices(utils.NewWarningOf(message), ingEx, annotationServices(ingEx, annotation)))
 		}
 	}
 	return warnings
 }
 
+// annotationServices returns the services of the annotation value, the configuration of every service has no affected services
+func annotationServices(ingEx *networking.Ingress, annotation string) []string {
+	var services []string
+	for _, svc := range utils.TrimWhiteSpaces(strings.Split(ingEx.Annotations[annotation], ";")) {
+		serviceName, err := parseServiceNameOrAllService(svc, true)
+		if err != nil || serviceName == AllIngressServiceName {
+			continue
+		}
+		services = append(services, serviceName)
+	}
+	return services
+}
+
 // GetAnnotationMap generic function that takes in the annotation string, parser function, and returns the appropriate svc to value mapping
 func GetAnnotationMap(annotation string, ingEx *networking.Ingress, parser func(string) (string, string, error), logger *zap.Logger) (map[string]string, error) {
 	space := regexp.MustCompile(`\s+`)
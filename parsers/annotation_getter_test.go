@@ -71,6 +71,37 @@ func getTestLogger() *zap.Logger {
 	return logger
 }
 
+func TestGetUnsupportedAnnotationWarnings(t *testing.T) {
+	ingress := testAnnotationIngress.DeepCopy()
+	ingress.Annotations = map[string]string{
+		"ingress.bluemix.net/upstream-max-fails":      "serviceName=tea-svc max-fails=2;serviceName=coffee-svc max-fails=3",
+		"ingress.bluemix.net/hsts":                    "enabled=true maxAge=31536000 includeSubdomains=true",
+		"ingress.bluemix.net/redirect-to-https":       "True",
+		"ingress.bluemix.net/upstream-keepalive":      "serviceName=tea-svc keepalive=32",
+		"ingress.bluemix.net/iam-ui-auth":             "serviceName=coffee-svc clientSecretNamespace=default clientId=custom clientSecret=secret redirectURL=https://example.com",
+		"ingress.bluemix.net/proxy-busy-buffers-size": "size=1K",
+	}
+
+	warnings := GetUnsupportedAnnotationWarnings(ingress)
+	assert.Len(t, warnings, 5)
+	services := map[string][]string{}
+	paths := map[string][]string{}
+	for _, warning := range warnings {
+		services[warning.Code] = warning.Services
+		paths[warning.Code] = warning.Paths
+	}
+	assert.Equal(t, map[string][]string{
+		"UPSTREAM_MAX_FAILS_UNSUPPORTED":      {"coffee-svc", "tea-svc"},
+		"HSTS_UNSUPPORTED":                    nil,
+		"UPSTREAM_KEEPALIVE_UNSUPPORTED":      {"tea-svc"},
+		"IAM_UI_AUTH_UNSUPPORTED":             {"coffee-svc"},
+		"PROXY_BUSY_BUFFERS_SIZE_UNSUPPORTED": nil,
+	}, services)
+	assert.Equal(t, []string{"/coffee", "/tea"}, paths["UPSTREAM_MAX_FAILS_UNSUPPORTED"])
+	assert.Equal(t, []string{"/coffee"}, paths["IAM_UI_AUTH_UNSUPPORTED"])
+	assert.Contains(t, warnings, utils.WithAffectedServices(utils.NewWarningOf(utils.UpstreamKeepaliveWarning), ingress, []string{"tea-svc"}))
+}
+
 func TestGetRewrites(t *testing.T) {
 	testCases := []struct {
 		description        string
@@ -0,0 +1,201 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/ghodss/yaml"
+	"go.uber.org/zap"
+	networking "k8s.io/api/networking/v1beta1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// AcknowledgedWarningsAnnotation contains the acknowledgements of the warnings of the ingress resource in YAML format
+	AcknowledgedWarningsAnnotation = ProvenancePrefix + "acknowledged-warnings"
+	// AcknowledgementsConfigMapName is the name of the configmap containing the acknowledgements of the warnings of the cluster
+	AcknowledgementsConfigMapName = "ibm-ingress-migration-acknowledgements"
+	// AcknowledgementsConfigMapKey is the key of the acknowledgements in YAML format in the acknowledgements configmap
+	AcknowledgementsConfigMapKey = "acknowledgements.yaml"
+
+	// acknowledgementDateLayout is the layout of the expiry dates, the acknowledgement is valid on the day of the expiry date
+	acknowledgementDateLayout = "2006-01-02"
+)
+
+// acknowledgements contains the acknowledgements of the file and the configmap, see the SetAcknowledgements function
+var acknowledgements []model.Acknowledgement
+
+// GetAcknowledgements returns the acknowledgements of the current run
+func GetAcknowledgements() []model.Acknowledgement {
+	return acknowledgements
+}
+
+// SetAcknowledgements sets the acknowledgements of the current run
+func SetAcknowledgements(acks []model.Acknowledgement) {
+	acknowledgements = acks
+}
+
+// LoadAcknowledgements returns the acknowledgements of the file (path may be empty) and the acknowledgements configmap
+func LoadAcknowledgements(ctx context.Context, kc KubeClient, path string, logger *zap.Logger) ([]model.Acknowledgement, error) {
+	var acks []model.Acknowledgement
+	if path != "" {
+		data, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return nil, &ConfigError{Err: fmt.Errorf("failed to read acknowledgements file: %v", err)}
+		}
+		fileAcks, err := ParseAcknowledgements(data, path)
+		if err != nil {
+			return nil, &ConfigError{Err: err}
+		}
+		acks = append(acks, fileAcks...)
+	}
+
+	cm, err := kc.GetConfigMap(ctx, AcknowledgementsConfigMapName, KubeSystem)
+	switch {
+	case k8sErrors.IsNotFound(err):
+	case err != nil:
+		logger.Error("error getting acknowledgements configmap", zap.Error(err))
+		return nil, &APIError{Err: fmt.Errorf("error getting acknowledgements configmap: %v", err)}
+	default:
+		cmAcks, err := ParseAcknowledgements([]byte(cm.Data[AcknowledgementsConfigMapKey]), fmt.Sprintf("configmap %s/%s", KubeSystem, AcknowledgementsConfigMapName))
+		if err != nil {
+			return nil, &ConfigError{Err: err}
+		}
+		acks = append(acks, cmAcks...)
+	}
+
+	logger.Info("loaded acknowledgements of warnings", zap.Int("count", len(acks)))
+	return acks, nil
+}
+
+// ParseAcknowledgements parses and validates the list of acknowledgements in YAML format, source is recorded in the acknowledgements
+func ParseAcknowledgements(data []byte, source string) ([]model.Acknowledgement, error) {
+	var acks []model.Acknowledgement
+	if err := yaml.Unmarshal(data, &acks); err != nil {
+		return nil, fmt.Errorf("failed to parse acknowledgements of %s: %v", source, err)
+	}
+	for i := range acks {
+		acks[i].Source = source
+		if err := validateAcknowledgement(acks[i]); err != nil {
+			return nil, fmt.Errorf("invalid acknowledgement #%d of %s: %v", i+1, source, err)
+		}
+	}
+	return acks, nil
+}
+
+// validateAcknowledgement checks that the acknowledgement has a known code, a reason and an expiry
+func validateAcknowledgement(ack model.Acknowledgement) error {
+	if !ItemInSlice(ack.Code, WarningCodes()) {
+		return fmt.Errorf("unknown warning code '%s'", ack.Code)
+	}
+	if strings.TrimSpace(ack.Reason) == "" {
+		return fmt.Errorf("reason must be set")
+	}
+	if _, err := acknowledgementExpiry(ack.Expires); err != nil {
+		return fmt.Errorf("invalid expiry '%s', it must be a date (e.g. 2023-06-30) or an RFC 3339 time", ack.Expires)
+	}
+	if ack.Name != "" && ack.Namespace == "" {
+		return fmt.Errorf("the name of the resource requires a namespace")
+	}
+	return nil
+}
+
+// acknowledgementExpiry returns the time the acknowledgement expires at, the dates expire at the end of the day in UTC
+func acknowledgementExpiry(expires string) (time.Time, error) {
+	if date, err := time.Parse(acknowledgementDateLayout, expires); err == nil {
+		return date.AddDate(0, 0, 1), nil
+	}
+	return time.Parse(time.RFC3339, expires)
+}
+
+// AcknowledgeWarnings moves the acknowledged warnings of the migrated resource into its AcknowledgedWarnings
+func AcknowledgeWarnings(resource *model.MigratedResource, ingress *networking.Ingress, logger *zap.Logger) {
+	// the annotation acknowledgements are appended to a copy, as the workers share the loaded acknowledgements
+	acks := append([]model.Acknowledgement(nil), acknowledgements...)
+	if ingress != nil && ingress.Annotations[AcknowledgedWarningsAnnotation] != "" {
+		annotationAcks, err := ParseAcknowledgements([]byte(ingress.Annotations[AcknowledgedWarningsAnnotation]), fmt.Sprintf("annotation of %s/%s", ingress.Namespace, ingress.Name))
+		if err != nil {
+			logger.Warn("ignoring invalid acknowledged warnings annotation", zap.String("name", ingress.Name), zap.String("namespace", ingress.Namespace), zap.Error(err))
+			warning := NewWarningOf(InvalidAcknowledgedWarningsAnnotation)
+			resource.Warnings = append(resource.Warnings, warning.Message)
+			resource.WarningDetails = append(resource.WarningDetails, warning)
+		}
+		for _, ack := range annotationAcks {
+			ack.Namespace, ack.Name = ingress.Namespace, ingress.Name
+			acks = append(acks, ack)
+		}
+	}
+	details := ResourceWarnings(*resource)
+	if len(acks) == 0 || len(details) == 0 {
+		return
+	}
+
+	now := time.Now()
+	var remainingDetails, acknowledged []model.Warning
+	for _, warning := range details {
+		if ack := matchingAcknowledgement(acks, *resource, warning.Code, now, logger); ack != nil {
+			warning.Acknowledgement = ack
+			acknowledged = append(acknowledged, warning)
+			continue
+		}
+		remainingDetails = append(remainingDetails, warning)
+	}
+	if len(acknowledged) == 0 {
+		return
+	}
+	logger.Info("acknowledged warnings of the resource", zap.String("kind", resource.Kind), zap.String("name", resource.Name), zap.String("namespace", resource.Namespace), zap.Int("acknowledged", len(acknowledged)))
+	resource.Warnings = WarningMessages(remainingDetails)
+	resource.WarningDetails = remainingDetails
+	resource.AcknowledgedWarnings = append(resource.AcknowledgedWarnings, acknowledged...)
+}
+
+// matchingAcknowledgement returns the most specific acknowledgement of the warning code that applies to the resource and has not expired
+func matchingAcknowledgement(acks []model.Acknowledgement, resource model.MigratedResource, code string, now time.Time, logger *zap.Logger) *model.Acknowledgement {
+	var matching *model.Acknowledgement
+	specificity := func(ack *model.Acknowledgement) int {
+		switch {
+		case ack.Name != "":
+			return 2
+		case ack.Namespace != "":
+			return 1
+		default:
+			return 0
+		}
+	}
+	for i := range acks {
+		ack := &acks[i]
+		if ack.Code != code || (ack.Namespace != "" && ack.Namespace != resource.Namespace) || (ack.Name != "" && ack.Name != resource.Name) {
+			continue
+		}
+		if expiry, err := acknowledgementExpiry(ack.Expires); err != nil || !now.Before(expiry) {
+			logger.Info("ignoring expired acknowledgement", zap.String("code", ack.Code), zap.String("expires", ack.Expires), zap.String("source", ack.Source))
+			continue
+		}
+		if matching == nil || specificity(ack) > specificity(matching) {
+			matching = ack
+		}
+	}
+	if matching == nil {
+		return nil
+	}
+	ack := *matching
+	return &ack
+}
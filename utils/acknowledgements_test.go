@@ -0,0 +1,337 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseAcknowledgements(t *testing.T) {
+	testCases := []struct {
+		description          string
+		data                 string
+		expectedAcks         []model.Acknowledgement
+		expectedErrorMessage string
+	}{
+		{
+			description: "cluster, namespace and resource acknowledgements",
+			data: `
+- code: CUSTOM_ERRORS_UNSUPPORTED
+  reason: custom error pages are served by the application
+  expires: "2023-06-30"
+- code: IAM_UI_AUTH_UNSUPPORTED
+  namespace: tea
+  reason: the tea namespace is protected by App ID
+  expires: "2023-06-30T12:00:00Z"
+- code: UPSTREAM_MAX_FAILS_UNSUPPORTED
+  namespace: tea
+  name: tea-ingress
+  reason: accepted by the tea team
+  expires: "2023-06-30"
+`,
+			expectedAcks: []model.Acknowledgement{
+				{Code: "CUSTOM_ERRORS_UNSUPPORTED", Reason: "custom error pages are served by the application", Expires: "2023-06-30", Source: "test"},
+				{Code: "IAM_UI_AUTH_UNSUPPORTED", Namespace: "tea", Reason: "the tea namespace is protected by App ID", Expires: "2023-06-30T12:00:00Z", Source: "test"},
+				{Code: "UPSTREAM_MAX_FAILS_UNSUPPORTED", Namespace: "tea", Name: "tea-ingress", Reason: "accepted by the tea team", Expires: "2023-06-30", Source: "test"},
+			},
+		},
+		{
+			description: "empty",
+		},
+		{
+			description:          "invalid YAML",
+			data:                 "code: CUSTOM_ERRORS_UNSUPPORTED",
+			expectedErrorMessage: "failed to parse acknowledgements of test",
+		},
+		{
+			description:          "unknown code",
+			data:                 `[{"code": "UNKNOWN_CODE", "reason": "reason", "expires": "2023-06-30"}]`,
+			expectedErrorMessage: "invalid acknowledgement #1 of test: unknown warning code 'UNKNOWN_CODE'",
+		},
+		{
+			description:          "missing reason",
+			data:                 `[{"code": "CUSTOM_ERRORS_UNSUPPORTED", "expires": "2023-06-30"}]`,
+			expectedErrorMessage: "invalid acknowledgement #1 of test: reason must be set",
+		},
+		{
+			description:          "missing expiry",
+			data:                 `[{"code": "CUSTOM_ERRORS_UNSUPPORTED", "reason": "reason"}]`,
+			expectedErrorMessage: "invalid acknowledgement #1 of test: invalid expiry ''",
+		},
+		{
+			description:          "name without namespace",
+			data:                 `[{"code": "CUSTOM_ERRORS_UNSUPPORTED", "name": "tea-ingress", "reason": "reason", "expires": "2023-06-30"}]`,
+			expectedErrorMessage: "invalid acknowledgement #1 of test: the name of the resource requires a namespace",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			acks, err := ParseAcknowledgements([]byte(tc.data), "test")
+			if tc.expectedErrorMessage != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErrorMessage)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedAcks, acks)
+		})
+	}
+}
+
+func TestLoadAcknowledgements(t *testing.T) {
+	logger := zap.NewNop()
+	expires := time.Now().AddDate(0, 1, 0).Format(acknowledgementDateLayout)
+
+	ackFile := filepath.Join(t.TempDir(), "acknowledgements.yaml")
+	assert.NoError(t, os.WriteFile(ackFile, []byte("- code: CUSTOM_ERRORS_UNSUPPORTED\n  reason: from the file\n  expires: \""+expires+"\"\n"), 0600))
+	invalidFile := filepath.Join(t.TempDir(), "invalid.yaml")
+	assert.NoError(t, os.WriteFile(invalidFile, []byte("- code: CUSTOM_ERRORS_UNSUPPORTED\n"), 0600))
+
+	kc, err := NewFileKubeClient(t.TempDir(), logger)
+	assert.NoError(t, err)
+	cmKC, err := NewFileKubeClient(t.TempDir(), logger)
+	assert.NoError(t, err)
+	assert.NoError(t, cmKC.CreateConfigMap(context.Background(), &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: AcknowledgementsConfigMapName, Namespace: KubeSystem},
+		Data:       map[string]string{AcknowledgementsConfigMapKey: "- code: HSTS_UNSUPPORTED\n  namespace: tea\n  reason: from the configmap\n  expires: \"" + expires + "\"\n"},
+	}))
+
+	testCases := []struct {
+		description   string
+		kc            KubeClient
+		path          string
+		expectedAcks  []model.Acknowledgement
+		expectedError error
+	}{
+		{
+			description: "no file and no configmap",
+			kc:          kc,
+		},
+		{
+			description: "file",
+			kc:          kc,
+			path:        ackFile,
+			expectedAcks: []model.Acknowledgement{
+				{Code: "CUSTOM_ERRORS_UNSUPPORTED", Reason: "from the file", Expires: expires, Source: ackFile},
+			},
+		},
+		{
+			description: "file and configmap",
+			kc:          cmKC,
+			path:        ackFile,
+			expectedAcks: []model.Acknowledgement{
+				{Code: "CUSTOM_ERRORS_UNSUPPORTED", Reason: "from the file", Expires: expires, Source: ackFile},
+				{Code: "HSTS_UNSUPPORTED", Namespace: "tea", Reason: "from the configmap", Expires: expires, Source: "configmap kube-system/" + AcknowledgementsConfigMapName},
+			},
+		},
+		{
+			description:   "missing file",
+			kc:            kc,
+			path:          filepath.Join(t.TempDir(), "missing.yaml"),
+			expectedError: &ConfigError{},
+		},
+		{
+			description:   "invalid file",
+			kc:            kc,
+			path:          invalidFile,
+			expectedError: &ConfigError{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			acks, err := LoadAcknowledgements(context.Background(), tc.kc, tc.path, logger)
+			if tc.expectedError != nil {
+				assert.IsType(t, tc.expectedError, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedAcks, acks)
+		})
+	}
+}
+
+func TestAcknowledgeWarnings(t *testing.T) {
+	logger := zap.NewNop()
+	expires := time.Now().AddDate(0, 1, 0).Format(acknowledgementDateLayout)
+	expired := time.Now().AddDate(0, 0, -2).Format(acknowledgementDateLayout)
+
+	newResource := func() model.MigratedResource {
+		return model.MigratedResource{
+			Kind:      IngressKind,
+			Name:      "tea-ingress",
+			Namespace: "tea",
+			Warnings:  []string{CustomErrorsWarning, HSTSWarning},
+		}
+	}
+	newIngress := func(annotation string) *networking.Ingress {
+		ingress := &networking.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "tea-ingress", Namespace: "tea"}}
+		if annotation != "" {
+			ingress.Annotations = map[string]string{AcknowledgedWarningsAnnotation: annotation}
+		}
+		return ingress
+	}
+
+	testCases := []struct {
+		description          string
+		acks                 []model.Acknowledgement
+		ingress              *networking.Ingress
+		expectedWarnings     []string
+		expectedAcknowledged []model.Acknowledgement
+	}{
+		{
+			description:      "no acknowledgements",
+			ingress:          newIngress(""),
+			expectedWarnings: []string{CustomErrorsWarning, HSTSWarning},
+		},
+		{
+			description:          "cluster acknowledgement",
+			acks:                 []model.Acknowledgement{{Code: "CUSTOM_ERRORS_UNSUPPORTED", Reason: "cluster", Expires: expires}},
+			ingress:              newIngress(""),
+			expectedWarnings:     []string{HSTSWarning},
+			expectedAcknowledged: []model.Acknowledgement{{Code: "CUSTOM_ERRORS_UNSUPPORTED", Reason: "cluster", Expires: expires}},
+		},
+		{
+			description: "the most specific acknowledgement applies",
+			acks: []model.Acknowledgement{
+				{Code: "HSTS_UNSUPPORTED", Reason: "cluster", Expires: expires},
+				{Code: "HSTS_UNSUPPORTED", Namespace: "tea", Name: "tea-ingress", Reason: "resource", Expires: expires},
+				{Code: "HSTS_UNSUPPORTED", Namespace: "tea", Reason: "namespace", Expires: expires},
+			},
+			ingress:              newIngress(""),
+			expectedWarnings:     []string{CustomErrorsWarning},
+			expectedAcknowledged: []model.Acknowledgement{{Code: "HSTS_UNSUPPORTED", Namespace: "tea", Name: "tea-ingress", Reason: "resource", Expires: expires}},
+		},
+		{
+			description: "other namespace and resource",
+			acks: []model.Acknowledgement{
+				{Code: "HSTS_UNSUPPORTED", Namespace: "coffee", Reason: "namespace", Expires: expires},
+				{Code: "CUSTOM_ERRORS_UNSUPPORTED", Namespace: "tea", Name: "coffee-ingress", Reason: "resource", Expires: expires},
+			},
+			ingress:          newIngress(""),
+			expectedWarnings: []string{CustomErrorsWarning, HSTSWarning},
+		},
+		{
+			description:      "expired acknowledgement",
+			acks:             []model.Acknowledgement{{Code: "CUSTOM_ERRORS_UNSUPPORTED", Reason: "cluster", Expires: expired}},
+			ingress:          newIngress(""),
+			expectedWarnings: []string{CustomErrorsWarning, HSTSWarning},
+		},
+		{
+			description:          "annotation acknowledgement applies to the ingress resource",
+			ingress:              newIngress(`[{"code": "HSTS_UNSUPPORTED", "namespace": "coffee", "reason": "annotation", "expires": "` + expires + `"}]`),
+			expectedWarnings:     []string{CustomErrorsWarning},
+			expectedAcknowledged: []model.Acknowledgement{{Code: "HSTS_UNSUPPORTED", Namespace: "tea", Name: "tea-ingress", Reason: "annotation", Expires: expires, Source: "annotation of tea/tea-ingress"}},
+		},
+		{
+			description:      "invalid annotation",
+			ingress:          newIngress(`[{"code": "HSTS_UNSUPPORTED"}]`),
+			expectedWarnings: []string{CustomErrorsWarning, HSTSWarning, InvalidAcknowledgedWarningsAnnotation},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			SetAcknowledgements(tc.acks)
+			defer SetAcknowledgements(nil)
+
+			resource := newResource()
+			resource.WarningDetails = NewWarnings(resource.Warnings)
+			AcknowledgeWarnings(&resource, tc.ingress, logger)
+
+			assert.Equal(t, tc.expectedWarnings, resource.Warnings)
+			assert.Len(t, resource.WarningDetails, len(tc.expectedWarnings))
+			var acknowledged []model.Acknowledgement
+			for _, warning := range resource.AcknowledgedWarnings {
+				assert.NotNil(t, warning.Acknowledgement)
+				assert.Equal(t, warning.Code, warning.Acknowledgement.Code)
+				acknowledged = append(acknowledged, *warning.Acknowledgement)
+			}
+			assert.Equal(t, tc.expectedAcknowledged, acknowledged)
+		})
+	}
+}
+
+func TestAcknowledgeWarningsConcurrently(t *testing.T) {
+	logger := zap.NewNop()
+	expires := time.Now().AddDate(0, 1, 0).Format(acknowledgementDateLayout)
+
+	// the loaded acknowledgements have spare capacity, so the annotation acknowledgements of the ingress resources
+	// migrated in parallel must not be appended to the shared slice
+	acks := make([]model.Acknowledgement, 1, 4)
+	acks[0] = model.Acknowledgement{Code: "CUSTOM_ERRORS_UNSUPPORTED", Reason: "cluster", Expires: expires}
+	SetAcknowledgements(acks)
+	defer SetAcknowledgements(nil)
+
+	names := []string{"tea-ingress", "coffee-ingress", "milk-ingress", "water-ingress"}
+	resources := make([]model.MigratedResource, 50*len(names))
+	var wg sync.WaitGroup
+	for i := range resources {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := names[i%len(names)]
+			ingress := &networking.Ingress{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "tea", Annotations: map[string]string{
+				AcknowledgedWarningsAnnotation: `[{"code": "HSTS_UNSUPPORTED", "reason": "` + name + `", "expires": "` + expires + `"}]`,
+			}}}
+			resources[i] = model.MigratedResource{Kind: IngressKind, Name: name, Namespace: "tea", Warnings: []string{HSTSWarning}}
+			resources[i].WarningDetails = NewWarnings(resources[i].Warnings)
+			AcknowledgeWarnings(&resources[i], ingress, logger)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, resource := range resources {
+		assert.Empty(t, resource.Warnings)
+		if assert.Len(t, resource.AcknowledgedWarnings, 1) {
+			assert.Equal(t, resource.Name, resource.AcknowledgedWarnings[0].Acknowledgement.Reason)
+		}
+	}
+	assert.Equal(t, []model.Acknowledgement{acks[0]}, acknowledgements)
+}
+
+func TestAcknowledgeWarningsDivergingTexts(t *testing.T) {
+	expires := time.Now().AddDate(0, 1, 0).Format(acknowledgementDateLayout)
+	SetAcknowledgements([]model.Acknowledgement{{Code: "CUSTOM_ERRORS_UNSUPPORTED", Reason: "cluster", Expires: expires}})
+	defer SetAcknowledgements(nil)
+
+	// the texts are recorded in another order than the structured warnings, e.g. edited by hand
+	resource := model.MigratedResource{
+		Kind:           IngressKind,
+		Name:           "tea-ingress",
+		Namespace:      "tea",
+		Warnings:       []string{CustomErrorsWarning, HSTSWarning},
+		WarningDetails: []model.Warning{NewWarningOf(HSTSWarning), NewWarningOf(CustomErrorsWarning)},
+	}
+	AcknowledgeWarnings(&resource, nil, zap.NewNop())
+
+	assert.Equal(t, []string{HSTSWarning}, resource.Warnings)
+	assert.Equal(t, []model.Warning{NewWarningOf(HSTSWarning)}, resource.WarningDetails)
+	if assert.Len(t, resource.AcknowledgedWarnings, 1) {
+		assert.Equal(t, "CUSTOM_ERRORS_UNSUPPORTED", resource.AcknowledgedWarnings[0].Code)
+	}
+}
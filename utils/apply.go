@@ -0,0 +1,293 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	v12 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	networking "k8s.io/api/networking/v1beta1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// FieldManager is the name of the field manager owning the fields set by the migration tool with server-side apply
+const FieldManager = "ingress-migrator"
+
+// OwnedKeys returns the keys of the map field (e.g. 'data') owned by the field manager of the migration tool
+func OwnedKeys(managedFields []v1.ManagedFieldsEntry, field string) map[string]bool {
+	owned := map[string]bool{}
+	for _, entry := range managedFields {
+		if entry.Manager != FieldManager || entry.Operation != v1.ManagedFieldsOperationApply || entry.FieldsV1 == nil {
+			continue
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		var mapFields map[string]json.RawMessage
+		if err := json.Unmarshal(fields["f:"+field], &mapFields); err != nil {
+			continue
+		}
+		for key := range mapFields {
+			if strings.HasPrefix(key, "f:") {
+				owned[strings.TrimPrefix(key, "f:")] = true
+			}
+		}
+	}
+	return owned
+}
+
+// AppliedKeys returns the keys of the desired map that are sent in the apply request
+func AppliedKeys[V any](live, desired map[string]V, owned map[string]bool) []string {
+	var keys []string
+	for key, desiredValue := range desired {
+		liveValue, exists := live[key]
+		if owned[key] || !exists || !reflect.DeepEqual(liveValue, desiredValue) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// RemovedKeys returns the keys removed from the desired map that are not owned by the migration tool
+func RemovedKeys[V any](live, desired map[string]V, owned map[string]bool) []string {
+	var keys []string
+	for key := range live {
+		if _, exists := desired[key]; !exists && !owned[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// applyObjectMeta returns the object meta sent in the apply requests without the fields set by the API server
+func applyObjectMeta(meta v1.ObjectMeta) v1.ObjectMeta {
+	return v1.ObjectMeta{
+		Name:        meta.Name,
+		Namespace:   meta.Namespace,
+		Labels:      meta.Labels,
+		Annotations: meta.Annotations,
+	}
+}
+
+func (k *kubeClient) applyOptions(force bool) v1.PatchOptions {
+	return v1.PatchOptions{FieldManager: FieldManager, Force: &force, DryRun: k.dryRunOption()}
+}
+
+// applyConfigMap applies the configmap with server-side apply and returns its resource version
+func (k *kubeClient) applyConfigMap(ctx context.Context, cm *v12.ConfigMap, force bool) (string, error) {
+	labels, annotations := ProvenanceMetadata(cm.ObjectMeta)
+	applied := v12.ConfigMap{
+		TypeMeta:   v1.TypeMeta{APIVersion: "v1", Kind: ConfigMapKind},
+		ObjectMeta: v1.ObjectMeta{Name: cm.Name, Namespace: cm.Namespace, ResourceVersion: cm.ResourceVersion, Labels: labels, Annotations: annotations},
+		Data:       cm.Data,
+	}
+	body, err := json.Marshal(applied)
+	if err != nil {
+		return "", err
+	}
+	result, err := retryRequest(ctx, k, "apply configmap", func() (*v12.ConfigMap, error) {
+		return k.GetClient().CoreV1().ConfigMaps(cm.Namespace).Patch(ctx, cm.Name, types.ApplyPatchType, body, k.applyOptions(force))
+	})
+	if err != nil {
+		return "", applyError(ConfigMapKind, cm.Namespace, cm.Name, err)
+	}
+	return result.ResourceVersion, nil
+}
+
+// applyConfigMapKeys applies the changed data keys of the configmap
+func (k *kubeClient) applyConfigMapKeys(ctx context.Context, cm *v12.ConfigMap) error {
+	return retryOnConflict(cm.ResourceVersion, func() error {
+		live, err := k.GetConfigMap(ctx, cm.Name, cm.Namespace)
+		if err != nil {
+			return err
+		}
+		if err := checkResourceVersion(v12.Resource("configmaps"), cm.ObjectMeta, live.ObjectMeta); err != nil {
+			return err
+		}
+		owned := OwnedKeys(live.ManagedFields, "data")
+
+		applied := &v12.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: cm.Name, Namespace: cm.Namespace, ResourceVersion: live.ResourceVersion, Labels: cm.Labels, Annotations: cm.Annotations}, Data: map[string]string{}}
+		for _, key := range AppliedKeys(live.Data, cm.Data, owned) {
+			applied.Data[key] = cm.Data[key]
+		}
+		resourceVersion, err := k.applyConfigMap(ctx, applied, false)
+		if err != nil {
+			return err
+		}
+
+		return k.removeKeys(ctx, ConfigMapKind, cm.Namespace, cm.Name, resourceVersion, RemovedKeys(live.Data, cm.Data, owned))
+	})
+}
+
+// applySecretKeys applies the changed data keys of the secret
+func (k *kubeClient) applySecretKeys(ctx context.Context, secret *v12.Secret) error {
+	return retryOnConflict(secret.ResourceVersion, func() error {
+		live, err := k.GetSecret(ctx, secret.Name, secret.Namespace)
+		if err != nil {
+			return err
+		}
+		if err := checkResourceVersion(v12.Resource("secrets"), secret.ObjectMeta, live.ObjectMeta); err != nil {
+			return err
+		}
+		owned := OwnedKeys(live.ManagedFields, "data")
+
+		applied := v12.Secret{
+			TypeMeta:   v1.TypeMeta{APIVersion: "v1", Kind: SecretKind},
+			ObjectMeta: v1.ObjectMeta{Name: secret.Name, Namespace: secret.Namespace, ResourceVersion: live.ResourceVersion},
+			Data:       map[string][]byte{},
+		}
+		for _, key := range AppliedKeys(live.Data, secret.Data, owned) {
+			applied.Data[key] = secret.Data[key]
+		}
+		body, err := json.Marshal(applied)
+		if err != nil {
+			return err
+		}
+		result, err := retryRequest(ctx, k, "apply secret", func() (*v12.Secret, error) {
+			return k.GetClient().CoreV1().Secrets(secret.Namespace).Patch(ctx, secret.Name, types.ApplyPatchType, body, k.applyOptions(false))
+		})
+		if err != nil {
+			return applyError(SecretKind, secret.Namespace, secret.Name, err)
+		}
+
+		return k.removeKeys(ctx, SecretKind, secret.Namespace, secret.Name, result.ResourceVersion, RemovedKeys(live.Data, secret.Data, owned))
+	})
+}
+
+// retryOnConflict calls update again on conflicts, unless the resource version was set by the caller
+func retryOnConflict(resourceVersion string, update func() error) error {
+	if resourceVersion != "" {
+		return update()
+	}
+	return RetryOnConflict(update)
+}
+
+// checkResourceVersion returns a conflict if the resource was changed since the caller read it
+func checkResourceVersion(resource schema.GroupResource, read, live v1.ObjectMeta) error {
+	if read.ResourceVersion != "" && read.ResourceVersion != live.ResourceVersion {
+		return k8sErrors.NewConflict(resource, read.Name, fmt.Errorf("the object has been modified; please apply your changes to the latest version and try again"))
+	}
+	return nil
+}
+
+// removeKeys removes the data keys that are not owned by the migration tool with a merge patch
+func (k *kubeClient) removeKeys(ctx context.Context, kind, namespace, name, resourceVersion string, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	removed := map[string]interface{}{}
+	for _, key := range keys {
+		removed[key] = nil
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"resourceVersion": resourceVersion},
+		"data":     removed,
+	})
+	if err != nil {
+		return err
+	}
+
+	options := v1.PatchOptions{FieldManager: FieldManager, DryRun: k.dryRunOption()}
+	return k.retry(ctx, "remove keys", func() error {
+		if kind == SecretKind {
+			_, err = k.GetClient().CoreV1().Secrets(namespace).Patch(ctx, name, types.MergePatchType, body, options)
+		} else {
+			_, err = k.GetClient().CoreV1().ConfigMaps(namespace).Patch(ctx, name, types.MergePatchType, body, options)
+		}
+		return err
+	})
+}
+
+// applyIngress applies the ingress resource with server-side apply, the fields set by the earlier runs but not set anymore are removed
+func (k *kubeClient) applyIngress(ctx context.Context, ing networking.Ingress) error {
+	var body []byte
+	var err error
+	if k.v1IngressOnly {
+		v1Ingress := convertV1Beta1ToV1Ingress(ing)
+		body, err = json.Marshal(networkingv1.Ingress{
+			TypeMeta:   v1.TypeMeta{APIVersion: networkingv1.SchemeGroupVersion.String(), Kind: IngressKind},
+			ObjectMeta: applyObjectMeta(v1Ingress.ObjectMeta),
+			Spec:       v1Ingress.Spec,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = retryRequest(ctx, k, "apply ingress", func() (*networkingv1.Ingress, error) {
+			return k.GetClient().NetworkingV1().Ingresses(ing.Namespace).Patch(ctx, ing.Name, types.ApplyPatchType, body, k.applyOptions(false))
+		})
+		return applyError(IngressKind, ing.Namespace, ing.Name, err)
+	}
+
+	body, err = json.Marshal(networking.Ingress{
+		TypeMeta:   v1.TypeMeta{APIVersion: networking.SchemeGroupVersion.String(), Kind: IngressKind},
+		ObjectMeta: applyObjectMeta(ing.ObjectMeta),
+		Spec:       ing.Spec,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = retryRequest(ctx, k, "apply ingress", func() (*networking.Ingress, error) {
+		return k.GetClient().NetworkingV1beta1().Ingresses(ing.Namespace).Patch(ctx, ing.Name, types.ApplyPatchType, body, k.applyOptions(false))
+	})
+	return applyError(IngressKind, ing.Namespace, ing.Name, err)
+}
+
+// applyIngressAnnotations applies only the metadata with the annotations on the ingress resource, so the other fields remain owned by their field managers
+func (k *kubeClient) applyIngressAnnotations(ctx context.Context, name, namespace string, annotations map[string]string) error {
+	ing := &unstructured.Unstructured{}
+	ing.SetAPIVersion(networking.SchemeGroupVersion.String())
+	if k.v1IngressOnly {
+		ing.SetAPIVersion(networkingv1.SchemeGroupVersion.String())
+	}
+	ing.SetKind(IngressKind)
+	ing.SetName(name)
+	ing.SetNamespace(namespace)
+	ing.SetAnnotations(annotations)
+	body, err := ing.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	if k.v1IngressOnly {
+		_, err = retryRequest(ctx, k, "apply ingress annotations", func() (*networkingv1.Ingress, error) {
+			return k.GetClient().NetworkingV1().Ingresses(namespace).Patch(ctx, name, types.ApplyPatchType, body, k.applyOptions(false))
+		})
+		return applyError(IngressKind, namespace, name, err)
+	}
+	_, err = retryRequest(ctx, k, "apply ingress annotations", func() (*networking.Ingress, error) {
+		return k.GetClient().NetworkingV1beta1().Ingresses(namespace).Patch(ctx, name, types.ApplyPatchType, body, k.applyOptions(false))
+	})
+	return applyError(IngressKind, namespace, name, err)
+}
+
+// applyError explains the field manager conflicts of the apply requests, the fields owned by other field managers are never overwritten
+func applyError(kind, namespace, name string, err error) error {
+	if err != nil && k8sErrors.IsConflict(err) && !IsResourceVersionConflict(err) {
+		return fmt.Errorf("%s %s/%s was not changed, as some of the fields are owned by other field managers: %w", kind, namespace, name, err)
+	}
+	return err
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestOwnedKeys(t *testing.T) {
+	managedFields := []v1.ManagedFieldsEntry{
+		{
+			Manager:   FieldManager,
+			Operation: v1.ManagedFieldsOperationApply,
+			FieldsV1:  &v1.FieldsV1{Raw: []byte(`{"f:data":{"f:keep-alive":{},"f:ssl-protocols":{}}}`)},
+		},
+		{
+			// the fields set with update requests are not owned by the apply requests of the migration tool
+			Manager:   FieldManager,
+			Operation: v1.ManagedFieldsOperationUpdate,
+			FieldsV1:  &v1.FieldsV1{Raw: []byte(`{"f:data":{"f:proxy-body-size":{}}}`)},
+		},
+		{
+			Manager:   "kubectl-edit",
+			Operation: v1.ManagedFieldsOperationApply,
+			FieldsV1:  &v1.FieldsV1{Raw: []byte(`{"f:data":{"f:server-tokens":{}}}`)},
+		},
+	}
+
+	assert.Equal(t, map[string]bool{"keep-alive": true, "ssl-protocols": true}, OwnedKeys(managedFields, "data"))
+	assert.Equal(t, map[string]bool{}, OwnedKeys(managedFields, "binaryData"))
+	assert.Equal(t, map[string]bool{}, OwnedKeys(nil, "data"))
+}
+
+func TestAppliedAndRemovedKeys(t *testing.T) {
+	testCases := []struct {
+		description         string
+		live                map[string]string
+		desired             map[string]string
+		owned               map[string]bool
+		expectedAppliedKeys []string
+		expectedRemovedKeys []string
+	}{
+		{
+			description: "unchanged keys owned by others are not applied",
+			live:        map[string]string{"ssl-protocols": "TLSv1.3", "proxy-body-size": "2m"},
+			desired:     map[string]string{"ssl-protocols": "TLSv1.2", "proxy-body-size": "2m", "keep-alive": "8"},
+			owned:       map[string]bool{},
+			expectedAppliedKeys: []string{
+				"keep-alive",
+				"ssl-protocols",
+			},
+		},
+		{
+			description: "unchanged keys owned by the migration tool are applied again",
+			live:        map[string]string{"ssl-protocols": "TLSv1.2", "keep-alive": "8"},
+			desired:     map[string]string{"ssl-protocols": "TLSv1.2", "keep-alive": "8"},
+			owned:       map[string]bool{"keep-alive": true},
+			expectedAppliedKeys: []string{
+				"keep-alive",
+			},
+		},
+		{
+			description: "removed keys are removed with a merge patch only if they are not owned by the migration tool",
+			live:        map[string]string{"ssl-protocols": "TLSv1.2", "keep-alive": "8", "9000": "default/tea-svc:8080"},
+			desired:     map[string]string{"ssl-protocols": "TLSv1.2"},
+			owned:       map[string]bool{"keep-alive": true},
+			expectedRemovedKeys: []string{
+				"9000",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expectedAppliedKeys, AppliedKeys(tc.live, tc.desired, tc.owned))
+			assert.Equal(t, tc.expectedRemovedKeys, RemovedKeys(tc.live, tc.desired, tc.owned))
+		})
+	}
+
+	t.Run("secret data", func(t *testing.T) {
+		live := map[string][]byte{"tls.key": []byte("key"), "trusted.crt": []byte("cert")}
+		desired := map[string][]byte{"tls.key": []byte("key"), "trusted.crt": []byte("cert"), "ca.crt": []byte("cert")}
+		assert.Equal(t, []string{"ca.crt"}, AppliedKeys(live, desired, nil))
+	})
+}
+
+func TestApplyError(t *testing.T) {
+	conflictErr := k8sErrors.NewApplyConflict([]v1.StatusCause{{Type: v1.CauseTypeFieldManagerConflict, Field: ".data.ssl-protocols"}}, `conflict with "ingress-microservice"`)
+
+	err := applyError(ConfigMapKind, KubeSystem, K8sConfigMapName, conflictErr)
+	assert.True(t, k8sErrors.IsConflict(err))
+	assert.Contains(t, err.Error(), "ConfigMap kube-system/ibm-k8s-controller-config was not changed, as some of the fields are owned by other field managers")
+	assert.Equal(t, ExitCodeAPIError, ExitCode(err))
+
+	resourceVersionConflict := k8sErrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, K8sConfigMapName, fmt.Errorf("the object has been modified"))
+	assert.Equal(t, resourceVersionConflict, applyError(ConfigMapKind, KubeSystem, K8sConfigMapName, resourceVersionConflict))
+
+	otherErr := fmt.Errorf("connection refused")
+	assert.Equal(t, otherErr, applyError(ConfigMapKind, KubeSystem, K8sConfigMapName, otherErr))
+	assert.NoError(t, applyError(ConfigMapKind, KubeSystem, K8sConfigMapName, nil))
+}
+
+func TestApplyIngressAnnotations(t *testing.T) {
+	for _, v1IngressOnly := range []bool{false, true} {
+		t.Run(fmt.Sprintf("v1 ingress only %t", v1IngressOnly), func(t *testing.T) {
+			var body map[string]interface{}
+			httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, string(types.ApplyPatchType), r.Header.Get("Content-Type"))
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{}`))
+			}))
+			defer httpServer.Close()
+			client, err := clientset.NewForConfig(&rest.Config{Host: httpServer.URL})
+			assert.NoError(t, err)
+			kc := &kubeClient{logger: zap.NewNop(), client: client, v1IngressOnly: v1IngressOnly}
+
+			assert.NoError(t, kc.applyIngressAnnotations(context.Background(), "tea-ingress", "default", map[string]string{MigratedToAnnotation: "tea-ingress-server"}))
+			apiVersion := "networking.k8s.io/v1beta1"
+			if v1IngressOnly {
+				apiVersion = "networking.k8s.io/v1"
+			}
+			// only the metadata is applied, so the spec is not owned by the migration tool
+			assert.Equal(t, map[string]interface{}{
+				"apiVersion": apiVersion,
+				"kind":       IngressKind,
+				"metadata": map[string]interface{}{
+					"name":        "tea-ingress",
+					"namespace":   "default",
+					"annotations": map[string]interface{}{MigratedToAnnotation: "tea-ingress-server"},
+				},
+			}, body)
+		})
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	v1 "k8s.io/api/core/v1"
+	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BackupKey returns the key of the resource backup in the backup configmap
+func BackupKey(kind, namespace, name string) string {
+	return fmt.Sprintf("%s.%s.%s", strings.ToLower(kind), namespace, name)
+}
+
+// NewConfigMapBackup returns the backup of the configmap keys that are changed by the update
+func NewConfigMapBackup(cm *v1.ConfigMap, update map[string]string) model.ResourceBackup {
+	backup := model.ResourceBackup{
+		Kind:      ConfigMapKind,
+		Name:      cm.Name,
+		Namespace: cm.Namespace,
+		Data:      map[string]*string{},
+	}
+	for key, value := range update {
+		originalValue, exists := cm.Data[key]
+		if !exists {
+			backup.Data[key] = nil
+		} else if originalValue != value {
+			backup.Data[key] = &originalValue
+		}
+	}
+	return backup
+}
+
+// mergeBackupCmData merges the backups into the data of the backup configmap, keeping the first recorded states
+func mergeBackupCmData(backupCm *v1.ConfigMap, backupsUpdate []model.ResourceBackup) (map[string]string, error) {
+	data := map[string]string{}
+	if backupCm != nil {
+		for key, value := range backupCm.Data {
+			data[key] = value
+		}
+	}
+
+	for _, backupUpdate := range backupsUpdate {
+		key := BackupKey(backupUpdate.Kind, backupUpdate.Namespace, backupUpdate.Name)
+		backup := backupUpdate
+		if data[key] != "" {
+			if err := json.Unmarshal([]byte(data[key]), &backup); err != nil {
+				return nil, err
+			}
+			if backup.Data == nil {
+				backup.Data = map[string]*string{}
+			}
+			for dataKey, originalValue := range backupUpdate.Data {
+				if _, recorded := backup.Data[dataKey]; !recorded {
+					backup.Data[dataKey] = originalValue
+				}
+			}
+		}
+
+		backupJSON, err := json.Marshal(backup)
+		if err != nil {
+			return nil, err
+		}
+		data[key] = string(backupJSON)
+	}
+	return data, nil
+}
+
+// newBackupCm returns with a new backup configmap containing the specified data
+func newBackupCm(data map[string]string) v1.ConfigMap {
+	return v1.ConfigMap{
+		ObjectMeta: v12.ObjectMeta{
+			Name:      MigrationBackupConfigMapName,
+			Namespace: KubeSystem,
+		},
+		Data: data,
+	}
+}
+
+// GetBackups returns the resource backups recorded in the backup configmap ordered by their keys
+func GetBackups(ctx context.Context, kc KubeClient) ([]model.ResourceBackup, error) {
+	backupCm, err := kc.GetConfigMap(ctx, MigrationBackupConfigMapName, KubeSystem)
+	if err != nil {
+		if k8serror.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var keys []string
+	for key := range backupCm.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var backups []model.ResourceBackup
+	for _, key := range keys {
+		var backup model.ResourceBackup
+		if err := json.Unmarshal([]byte(backupCm.Data[key]), &backup); err != nil {
+			return nil, fmt.Errorf("invalid backup '%s' in the backup configmap: %v", key, err)
+		}
+		backups = append(backups, backup)
+	}
+	return backups, nil
+}
+
+// RemoveBackups removes the backups with the specified keys from the backup configmap, see the BackupKey function
+func RemoveBackups(ctx context.Context, kc KubeClient, keys []string) error {
+	return RetryOnConflict(func() error {
+		backupCm, err := kc.GetConfigMap(ctx, MigrationBackupConfigMapName, KubeSystem)
+		if err != nil {
+			if k8serror.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+
+		removed := false
+		for _, key := range keys {
+			if _, exists := backupCm.Data[key]; exists {
+				delete(backupCm.Data, key)
+				removed = true
+			}
+		}
+		if !removed {
+			return nil
+		}
+		return kc.UpdateConfigmap(ctx, backupCm)
+	})
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewConfigMapBackup(t *testing.T) {
+	cm := &v1.ConfigMap{
+		ObjectMeta: v12.ObjectMeta{Name: K8sConfigMapName, Namespace: KubeSystem},
+		Data:       map[string]string{"ssl-protocols": "TLSv1.3", "proxy-body-size": "2m"},
+	}
+	originalValue := "TLSv1.3"
+
+	assert.Equal(t, model.ResourceBackup{
+		Kind:      ConfigMapKind,
+		Name:      K8sConfigMapName,
+		Namespace: KubeSystem,
+		Data: map[string]*string{
+			"ssl-protocols": &originalValue,
+			"keep-alive":    nil,
+		},
+	}, NewConfigMapBackup(cm, map[string]string{"ssl-protocols": "TLSv1.2", "proxy-body-size": "2m", "keep-alive": "8"}))
+}
+
+func TestGetBackups(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	kc, err := NewFileKubeClient(t.TempDir(), logger)
+	assert.NoError(t, err)
+
+	backups, err := GetBackups(context.Background(), kc)
+	assert.NoError(t, err)
+	assert.Empty(t, backups)
+
+	firstValue, secondValue := "first", "second"
+	assert.NoError(t, kc.CreateOrUpdateBackupCm(context.Background(), []model.ResourceBackup{
+		{Kind: ConfigMapKind, Name: K8sConfigMapName, Namespace: KubeSystem, Data: map[string]*string{"ssl-protocols": &firstValue}},
+		{Kind: ConfigMapKind, Name: GenericK8sTCPConfigMapName, Namespace: KubeSystem, Created: true},
+	}))
+	// the first recorded state of the keys is kept
+	assert.NoError(t, kc.CreateOrUpdateBackupCm(context.Background(), []model.ResourceBackup{
+		{Kind: ConfigMapKind, Name: K8sConfigMapName, Namespace: KubeSystem, Data: map[string]*string{"ssl-protocols": &secondValue, "keep-alive": nil}},
+		{Kind: ConfigMapKind, Name: GenericK8sTCPConfigMapName, Namespace: KubeSystem, Data: map[string]*string{"9000": nil}},
+		{Kind: SecretKind, Name: "proxy-secret", Namespace: "default", Data: map[string]*string{"ca.crt": nil}},
+	}))
+
+	backups, err = GetBackups(context.Background(), kc)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.ResourceBackup{
+		{Kind: ConfigMapKind, Name: GenericK8sTCPConfigMapName, Namespace: KubeSystem, Created: true, Data: map[string]*string{"9000": nil}},
+		{Kind: ConfigMapKind, Name: K8sConfigMapName, Namespace: KubeSystem, Data: map[string]*string{"ssl-protocols": &firstValue, "keep-alive": nil}},
+		{Kind: SecretKind, Name: "proxy-secret", Namespace: "default", Data: map[string]*string{"ca.crt": nil}},
+	}, backups)
+}
@@ -14,9 +14,19 @@ limitations under the License.
 package utils
 
 import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
 	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/ghodss/yaml"
 )
 
+// the variables below can be set at link time, their values are used as defaults of the runtime configuration (see the Config type)
 var (
 	// mode defines how the migration tool should operate (possible modes are 'test', 'test-with-private' and 'production')
 	// fallbacks to 'production' if not set, see the GetMode() function
@@ -31,6 +41,9 @@ var (
 
 	// DumpResources specifies whether migration tool should dump the resource YAMLs or not
 	DumpResources = true
+
+	// Version is the version of the migration tool, it is recorded in the provenance labels of the generated resources
+	Version = "dev"
 )
 
 const (
@@ -40,6 +53,8 @@ const (
 	ConfigMapKind = "ConfigMap"
 	// IngressKind ...
 	IngressKind = "Ingress"
+	// SecretKind ...
+	SecretKind = "Secret"
 
 	// IKSConfigMapName contains name of the configmap used to configure the legacy ingress controller
 	IKSConfigMapName = "ibm-cloud-provider-ingress-cm"
@@ -50,6 +65,8 @@ const (
 
 	// MigrationStatusConfigMapName contains name of the configmap used to store the migration status
 	MigrationStatusConfigMapName = "ibm-ingress-migration-status"
+	// MigrationBackupConfigMapName contains name of the configmap used to store the original state of the resources changed by the migration
+	MigrationBackupConfigMapName = "ibm-ingress-migration-backup"
 	// LastUpdatesTimestampParameterName contains name of the parameter associated with timestamp of the last update in the status configmap
 	LastUpdatesTimestampParameterName = "last-updated-timestamp"
 	// MigratedResourcesParameterName contains name of the parameter associated with migrated resources in the status configmap
@@ -58,6 +75,8 @@ const (
 	SubdomainMapParameterName = "subdomain-map"
 	// MigrationModeParameterName contains name of the parameter associated with migration mode in the status configmap
 	MigrationModeParameterName = "migration-mode"
+	// MigrationScopeParameterName contains name of the parameter associated with the ingress filters of a partial migration in the status configmap
+	MigrationScopeParameterName = "migration-scope"
 
 	// IngressClassAnnotation contains the name of the annotation used to specify class of the ingress resource
 	IngressClassAnnotation = "kubernetes.io/ingress.class"
@@ -76,6 +95,33 @@ const (
 	// for the community ingress controller
 	TCPConfigMapNameSuffix = "-k8s-ingress-tcp-ports"
 
+	// ConfigEnvPrefix is the prefix of the environment variables, e.g. MIGRATOR_TEST_DOMAIN for --test-domain
+	ConfigEnvPrefix = "MIGRATOR_"
+	// ConfigFileFlag is the name of the flag that specifies the path of the YAML configuration file
+	ConfigFileFlag = "config"
+
+	// DefaultConcurrency is the default number of the ingress resources migrated in parallel
+	DefaultConcurrency = 4
+	// DefaultQPS is the default number of the requests per second sent to the API server
+	DefaultQPS = 20
+	// DefaultBurst is the default number of the requests sent to the API server at once above the QPS limit
+	DefaultBurst = 40
+	// DefaultRequestTimeout is the default timeout of a single request sent to the API server
+	DefaultRequestTimeout = 30 * time.Second
+	// DefaultRetries is the default number of the retries of a request failed with a transient error, see the IsRetriableError function
+	DefaultRetries = 5
+	// DefaultResyncPeriod is the default period of migrating every ingress resource again in watch mode
+	DefaultResyncPeriod = 10 * time.Minute
+	// DefaultMetricsAddress is the default address of the metrics endpoint of the watch command
+	DefaultMetricsAddress = ":8080"
+
+	// PhaseAll runs every migration phase
+	PhaseAll = "all"
+	// PhaseConfigMap runs the migration of the IKS ConfigMap only
+	PhaseConfigMap = "configmap"
+	// PhaseIngress runs the migration of the Ingress resources only
+	PhaseIngress = "ingress"
+
 	RazeeSourceURLAnnotation = "razee.io/source-url"
 	RazeeBuildURLAnnotation  = "razee.io/build-url"
 )
@@ -87,3 +133,368 @@ func GetMode() string {
 	}
 	return mode
 }
+
+// SetMode sets the name of the current running mode
+func SetMode(m string) {
+	mode = m
+}
+
+// Config contains the runtime configuration of the migration tool
+type Config struct {
+	ConfigFile    string
+	Mode          string
+	TestDomain    string
+	TestSecret    string
+	ReadOnly      bool
+	DryRun        bool
+	DumpResources bool
+	OutputDir     string
+	InputDir      string
+	Phase         string
+	// connection options, see the GetRestConfig function, the impersonated groups are comma separated
+	KubeConfig string
+	Context    string
+	As         string
+	AsGroups   string
+	// ingress filters, the lists are comma separated
+	Namespaces         string
+	ExcludedNamespaces string
+	Selector           string
+	Names              string
+	// Concurrency is the number of the ingress resources migrated in parallel
+	Concurrency int
+	// QPS and Burst limit the rate of the requests sent to the API server
+	QPS   float64
+	Burst int
+	// Timeout limits the run time of the whole command, RequestTimeout limits a single request sent to the API server, 0 means no limit
+	Timeout        time.Duration
+	RequestTimeout time.Duration
+	// Retries is the maximum number of the retries of a request failed with a transient error, 0 disables the retries
+	Retries int
+	// ResyncPeriod is the period of migrating every ingress resource again in watch mode, 0 disables the resync
+	ResyncPeriod time.Duration
+	// ReportFormat is the comma separated list of the formats of the migration report, see the ReportFormatText constant and the related ones
+	ReportFormat string
+	// FailOn and PolicyFile select the warnings that fail the command, see the Policy type
+	FailOn     string
+	PolicyFile string
+	// Acknowledgements is the path of the YAML file containing the acknowledgements of the migration warnings
+	Acknowledgements string
+	// Events enables the Kubernetes events recorded on the source ingress resources with the warnings and errors of their migration
+	Events bool
+	// MetricsAddress is the address of the metrics endpoint of the watch command, an empty address disables the endpoint
+	MetricsAddress string
+	// Yes skips the confirmation of the rollback, which reverts every migration run recorded in the status configmap
+	Yes bool
+}
+
+// NewConfig returns a configuration initialized with the link time defaults
+func NewConfig() *Config {
+	return &Config{
+		Mode:           GetMode(),
+		TestDomain:     TestDomain,
+		TestSecret:     TestSecret,
+		ReadOnly:       ReadOnly,
+		DumpResources:  DumpResources,
+		Phase:          PhaseAll,
+		Concurrency:    DefaultConcurrency,
+		QPS:            DefaultQPS,
+		Burst:          DefaultBurst,
+		RequestTimeout: DefaultRequestTimeout,
+		Retries:        DefaultRetries,
+		ResyncPeriod:   DefaultResyncPeriod,
+		ReportFormat:   DefaultReportFormat,
+		Events:         true,
+		MetricsAddress: DefaultMetricsAddress,
+	}
+}
+
+// RegisterFlags registers the configuration options on the flag set, the current values are used as defaults
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.ConfigFile, ConfigFileFlag, c.ConfigFile, "specifies the path of a YAML configuration file, keys of the file are the flag names")
+	fs.StringVar(&c.Mode, "mode", c.Mode, fmt.Sprintf("specifies the migration mode ('%s', '%s' or '%s')", model.MigrationModeProduction, model.MigrationModeTest, model.MigrationModeTestWithPrivate))
+	fs.StringVar(&c.TestDomain, "test-domain", c.TestDomain, "specifies the test subdomain to use when migrating ingress resources in test modes")
+	fs.StringVar(&c.TestSecret, "test-secret", c.TestSecret, "specifies the TLS secret of the test subdomain to use in test modes")
+	fs.BoolVar(&c.ReadOnly, "read-only", c.ReadOnly, "if set, the migration tool does not create, update or delete resources on the cluster")
+	fs.BoolVar(&c.DryRun, "dry-run", c.DryRun, "if set, every change is sent to the cluster as a server-side dry-run request, so the admission controllers validate the migrated resources without persisting them")
+	fs.BoolVar(&c.DumpResources, "dump-resources", c.DumpResources, "if set, the migrated resources are saved in YAML format into the output directory")
+	fs.StringVar(&c.OutputDir, "outputdir", c.OutputDir, "specifies the path where the logs and resources should be saved")
+	fs.StringVar(&c.InputDir, "inputdir", c.InputDir, "specifies the path of a directory containing Ingress, ConfigMap and Secret manifests to migrate offline, without connecting to a cluster")
+	fs.StringVar(&c.Phase, "phase", c.Phase, fmt.Sprintf("specifies the migration phase to run ('%s', '%s' or '%s')", PhaseAll, PhaseConfigMap, PhaseIngress))
+	fs.StringVar(&c.KubeConfig, "kubeconfig", c.KubeConfig, "specifies the path of the kubeconfig, the KUBECONFIG environment variable or the service account of the pod is used if not set")
+	fs.StringVar(&c.Context, "context", c.Context, "specifies the kubeconfig context to use instead of the current context")
+	fs.StringVar(&c.As, "as", c.As, "specifies the user to impersonate")
+	fs.StringVar(&c.AsGroups, "as-group", c.AsGroups, "comma separated list of groups to impersonate, requires --as")
+	fs.StringVar(&c.Namespaces, "namespace", c.Namespaces, "comma separated list of namespaces, only the ingress resources in these namespaces are migrated")
+	fs.StringVar(&c.ExcludedNamespaces, "exclude-namespace", c.ExcludedNamespaces, "comma separated list of namespaces, the ingress resources in these namespaces are not migrated")
+	fs.StringVar(&c.Selector, "selector", c.Selector, "label selector, only the ingress resources matching the selector are migrated (e.g. 'team=tea,env!=dev')")
+	fs.StringVar(&c.Names, "name", c.Names, "comma separated list of name patterns (e.g. 'tea-*' or 'tea/*-ingress'), only the ingress resources matching one of the patterns are migrated")
+	fs.IntVar(&c.Concurrency, "concurrency", c.Concurrency, "specifies the number of the ingress resources migrated in parallel")
+	fs.Float64Var(&c.QPS, "qps", c.QPS, "specifies the maximum number of the requests per second sent to the API server")
+	fs.IntVar(&c.Burst, "burst", c.Burst, "specifies the maximum number of the requests sent to the API server at once above the QPS limit")
+	fs.DurationVar(&c.Timeout, "timeout", c.Timeout, "specifies the maximum run time of the command (e.g. '30m'), the resources processed before the timeout are still reported, 0 means no limit")
+	fs.DurationVar(&c.RequestTimeout, "request-timeout", c.RequestTimeout, "specifies the timeout of a single request sent to the API server, 0 means no limit")
+	fs.IntVar(&c.Retries, "retries", c.Retries, "specifies the maximum number of the retries of a request failed with a transient error (e.g. 429, 5xx or timeout), 0 disables the retries")
+	fs.DurationVar(&c.ResyncPeriod, "resync-period", c.ResyncPeriod, "specifies how often the watch command migrates every ingress resource again, the unchanged resources are not rewritten, 0 disables the resync")
+	fs.StringVar(&c.ReportFormat, "report-format", c.ReportFormat, fmt.Sprintf("comma separated list of the formats of the migration report ('%s', '%s', '%s', '%s', '%s' or '%s'), the formats other than '%s' are saved into the output directory",
+		ReportFormatText, ReportFormatJSON, ReportFormatYAML, ReportFormatMarkdown, ReportFormatHTML, ReportFormatJUnit, ReportFormatText))
+	fs.StringVar(&c.FailOn, "fail-on", c.FailOn, fmt.Sprintf("comma separated list of warning severities ('%s', '%s' or '%s'), warning codes and code patterns (e.g. '*_UNSUPPORTED'), the command fails with exit code %d if a warning matches one of them",
+		WarningSeverityInfo, WarningSeverityWarning, WarningSeverityCritical, ExitCodePolicyViolation))
+	fs.StringVar(&c.PolicyFile, "policy", c.PolicyFile, fmt.Sprintf("specifies the path of a YAML policy file with the 'failOn' list and the 'thresholds' limiting the number of the warnings per namespace, resource or cluster, the command fails with exit code %d if the policy is violated", ExitCodePolicyViolation))
+	fs.StringVar(&c.Acknowledgements, "acknowledgements", c.Acknowledgements, fmt.Sprintf("specifies the path of a YAML file acknowledging migration warnings, the acknowledgements of the %s/%s configmap are applied too", KubeSystem, AcknowledgementsConfigMapName))
+	fs.BoolVar(&c.Events, "events", c.Events, "if set, the warnings and errors of the migration are recorded as Kubernetes events on the source ingress resources, so 'kubectl describe ingress' shows them")
+	fs.BoolVar(&c.Yes, "yes", c.Yes, "if set, the rollback command does not ask for confirmation before reverting every migration run recorded in the status configmap")
+	fs.StringVar(&c.MetricsAddress, "metrics-address", c.MetricsAddress, fmt.Sprintf("specifies the address of the Prometheus metrics endpoint (%s) of the watch command, an empty address disables the endpoint, the other commands save the metrics into the output directory", MetricsPath))
+}
+
+// ConfigEnvName returns the name of the environment variable associated with the flag
+func ConfigEnvName(flagName string) string {
+	return ConfigEnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// LoadConfig parses the arguments, then fills the unset flags from the environment and the configuration file
+func LoadConfig(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	setOnCommandLine := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		setOnCommandLine[f.Name] = true
+	})
+
+	// the environment variables take precedence over the configuration file
+	values := map[string]string{}
+	configFile := ""
+	if f := fs.Lookup(ConfigFileFlag); f != nil {
+		configFile = f.Value.String()
+		if envValue, exists := os.LookupEnv(ConfigEnvName(ConfigFileFlag)); exists && !setOnCommandLine[ConfigFileFlag] {
+			configFile = envValue
+			values[ConfigFileFlag] = envValue
+		}
+	}
+	if configFile != "" {
+		fileValues, err := readConfigFile(configFile)
+		if err != nil {
+			return err
+		}
+		for name, value := range fileValues {
+			if fs.Lookup(name) == nil {
+				return fmt.Errorf("unknown option '%s' in configuration file %s", name, configFile)
+			}
+			values[name] = value
+		}
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if envValue, exists := os.LookupEnv(ConfigEnvName(f.Name)); exists {
+			values[f.Name] = envValue
+		}
+	})
+
+	for name, value := range values {
+		if setOnCommandLine[name] {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value '%s' for option '%s': %v", value, name, err)
+		}
+	}
+	return nil
+}
+
+// readConfigFile returns the option values of the YAML configuration file as strings
+func readConfigFile(path string) (map[string]string, error) {
+	fileBytes, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file: %v", err)
+	}
+
+	var options map[string]interface{}
+	if err := yaml.Unmarshal(fileBytes, &options); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration file %s: %v", path, err)
+	}
+
+	values := make(map[string]string)
+	for name, value := range options {
+		switch v := value.(type) {
+		case []interface{}:
+			var items []string
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[name] = strings.Join(items, ",")
+		case nil:
+			values[name] = ""
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+// Validate checks the consistency of the whole configuration
+func (c *Config) Validate(requireOutputDir bool) error {
+	switch c.Mode {
+	case model.MigrationModeTest, model.MigrationModeTestWithPrivate:
+		if c.TestDomain == "" || c.TestSecret == "" {
+			return fmt.Errorf("test subdomain and test secret must be set in '%s' mode", c.Mode)
+		}
+	case model.MigrationModeProduction:
+	default:
+		return fmt.Errorf("unknown migration mode '%s'", c.Mode)
+	}
+
+	switch c.Phase {
+	case PhaseAll, PhaseConfigMap, PhaseIngress:
+	default:
+		return fmt.Errorf("unknown migration phase '%s'", c.Phase)
+	}
+
+	if err := ValidateIngressFilter(c.IngressFilter()); err != nil {
+		return err
+	}
+
+	if c.Concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+	if c.QPS <= 0 || c.Burst < 1 {
+		return fmt.Errorf("qps must be positive and burst must be at least 1")
+	}
+
+	if c.AsGroups != "" && c.As == "" {
+		return fmt.Errorf("impersonated groups require an impersonated user")
+	}
+
+	if c.Timeout < 0 || c.RequestTimeout < 0 {
+		return fmt.Errorf("timeout and request timeout must not be negative")
+	}
+
+	if c.Retries < 0 {
+		return fmt.Errorf("retries must not be negative")
+	}
+
+	if c.ResyncPeriod < 0 {
+		return fmt.Errorf("resync period must not be negative")
+	}
+
+	if err := ValidateReportFormats(c.ReportFormats()); err != nil {
+		return err
+	}
+	if c.OutputDir == "" && c.SavesReports() {
+		return fmt.Errorf("output directory must be set to save the migration report in formats other than '%s'", ReportFormatText)
+	}
+
+	if _, err := c.Policy(); err != nil {
+		return err
+	}
+
+	if c.MetricsAddress != "" {
+		if _, _, err := net.SplitHostPort(c.MetricsAddress); err != nil {
+			return fmt.Errorf("invalid metrics address '%s': %v", c.MetricsAddress, err)
+		}
+	}
+
+	if requireOutputDir && c.OutputDir == "" {
+		return fmt.Errorf("output directory must be set")
+	}
+	if c.OutputDir != "" {
+		if info, err := os.Stat(c.OutputDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("output directory %s does not exist", c.OutputDir)
+		}
+	}
+	if c.InputDir != "" {
+		if info, err := os.Stat(c.InputDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("input directory %s does not exist", c.InputDir)
+		}
+		if c.DryRun {
+			return fmt.Errorf("dry-run mode requires a cluster, it can not be used with an input directory")
+		}
+		if c.KubeConfig != "" || c.Context != "" || c.As != "" {
+			return fmt.Errorf("kubeconfig, context and impersonation options can not be used with an input directory")
+		}
+	}
+
+	return nil
+}
+
+// Offline returns true when the resources are read from the input directory instead of the cluster
+func (c *Config) Offline() bool {
+	return c.InputDir != ""
+}
+
+// IngressFilter returns the filter selecting the ingress resources to migrate
+func (c *Config) IngressFilter() model.IngressFilter {
+	return model.IngressFilter{
+		Namespaces:         splitList(c.Namespaces),
+		ExcludedNamespaces: splitList(c.ExcludedNamespaces),
+		Selector:           strings.TrimSpace(c.Selector),
+		Names:              splitList(c.Names),
+	}
+}
+
+// ReportFormats returns the formats of the migration report
+func (c *Config) ReportFormats() []string {
+	return splitList(c.ReportFormat)
+}
+
+// PrintsReport returns true if the migration details are printed in colored text to the standard output
+func (c *Config) PrintsReport() bool {
+	return ItemInSlice(ReportFormatText, c.ReportFormats())
+}
+
+// SavesReports returns true if the migration report is saved into the output directory in at least one format
+func (c *Config) SavesReports() bool {
+	for _, format := range c.ReportFormats() {
+		if format != ReportFormatText {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy returns the policy of the policy file extended with the selectors of the fail-on option
+func (c *Config) Policy() (Policy, error) {
+	return LoadPolicy(c.PolicyFile, splitList(c.FailOn))
+}
+
+// KubeClientOptions returns the options of the KubeClient connecting to the cluster
+func (c *Config) KubeClientOptions() KubeClientOptions {
+	return KubeClientOptions{
+		KubeConfig:      c.KubeConfig,
+		Context:         c.Context,
+		As:              c.As,
+		AsGroups:        splitList(c.AsGroups),
+		ReadOnly:        c.ReadOnly,
+		DryRun:          c.DryRun,
+		RecordResources: c.DumpResources,
+		RecordEvents:    c.Events,
+		QPS:             float32(c.QPS),
+		Burst:           c.Burst,
+		RequestTimeout:  c.RequestTimeout,
+		Retries:         c.Retries,
+	}
+}
+
+// splitList splits the comma separated list and drops the empty items
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Apply sets the package level variables used during the migration according to the configuration
+func (c *Config) Apply() {
+	if c.DryRun {
+		c.ReadOnly = false
+		c.DumpResources = true
+	}
+	SetMode(c.Mode)
+	TestDomain = c.TestDomain
+	TestSecret = c.TestSecret
+	ReadOnly = c.ReadOnly
+	DumpResources = c.DumpResources
+}
@@ -0,0 +1,290 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(configFile, []byte(`
+mode: test
+test-domain: file.example.com
+test-secret: file-secret
+read-only: false
+phase: [ingress]
+`), 0600))
+
+	testCases := []struct {
+		description    string
+		args           []string
+		env            map[string]string
+		expectedConfig Config
+		expectedError  bool
+	}{
+		{
+			description: "link time defaults",
+			expectedConfig: Config{
+				Mode:           model.MigrationModeProduction,
+				ReadOnly:       true,
+				DumpResources:  true,
+				Phase:          PhaseAll,
+				Concurrency:    DefaultConcurrency,
+				QPS:            DefaultQPS,
+				Burst:          DefaultBurst,
+				RequestTimeout: DefaultRequestTimeout,
+				Retries:        DefaultRetries,
+				ResyncPeriod:   DefaultResyncPeriod,
+				ReportFormat:   DefaultReportFormat,
+				Events:         true,
+				MetricsAddress: DefaultMetricsAddress,
+			},
+		},
+		{
+			description: "configuration file",
+			args:        []string{"--config", configFile},
+			expectedConfig: Config{
+				ConfigFile:     configFile,
+				Mode:           model.MigrationModeTest,
+				TestDomain:     "file.example.com",
+				TestSecret:     "file-secret",
+				ReadOnly:       false,
+				DumpResources:  true,
+				Phase:          PhaseIngress,
+				Concurrency:    DefaultConcurrency,
+				QPS:            DefaultQPS,
+				Burst:          DefaultBurst,
+				RequestTimeout: DefaultRequestTimeout,
+				Retries:        DefaultRetries,
+				ResyncPeriod:   DefaultResyncPeriod,
+				ReportFormat:   DefaultReportFormat,
+				Events:         true,
+				MetricsAddress: DefaultMetricsAddress,
+			},
+		},
+		{
+			description: "environment variables override the configuration file",
+			env: map[string]string{
+				"MIGRATOR_CONFIG":      configFile,
+				"MIGRATOR_TEST_DOMAIN": "env.example.com",
+				"MIGRATOR_READ_ONLY":   "true",
+			},
+			expectedConfig: Config{
+				ConfigFile:     configFile,
+				Mode:           model.MigrationModeTest,
+				TestDomain:     "env.example.com",
+				TestSecret:     "file-secret",
+				ReadOnly:       true,
+				DumpResources:  true,
+				Phase:          PhaseIngress,
+				Concurrency:    DefaultConcurrency,
+				QPS:            DefaultQPS,
+				Burst:          DefaultBurst,
+				RequestTimeout: DefaultRequestTimeout,
+				Retries:        DefaultRetries,
+				ResyncPeriod:   DefaultResyncPeriod,
+				ReportFormat:   DefaultReportFormat,
+				Events:         true,
+				MetricsAddress: DefaultMetricsAddress,
+			},
+		},
+		{
+			description: "flags override environment variables and the configuration file",
+			args:        []string{"--config", configFile, "--test-domain", "flag.example.com", "--mode", model.MigrationModeTestWithPrivate, "--concurrency", "16", "--qps", "50", "--timeout", "30m"},
+			env: map[string]string{
+				"MIGRATOR_TEST_DOMAIN": "env.example.com",
+				"MIGRATOR_OUTPUTDIR":   "/tmp",
+			},
+			expectedConfig: Config{
+				ConfigFile:     configFile,
+				Mode:           model.MigrationModeTestWithPrivate,
+				TestDomain:     "flag.example.com",
+				TestSecret:     "file-secret",
+				ReadOnly:       false,
+				DumpResources:  true,
+				OutputDir:      "/tmp",
+				Phase:          PhaseIngress,
+				Concurrency:    16,
+				QPS:            50,
+				Burst:          DefaultBurst,
+				Timeout:        30 * time.Minute,
+				RequestTimeout: DefaultRequestTimeout,
+				Retries:        DefaultRetries,
+				ResyncPeriod:   DefaultResyncPeriod,
+				ReportFormat:   DefaultReportFormat,
+				Events:         true,
+				MetricsAddress: DefaultMetricsAddress,
+			},
+		},
+		{
+			description:   "invalid environment variable",
+			env:           map[string]string{"MIGRATOR_DUMP_RESOURCES": "maybe"},
+			expectedError: true,
+		},
+		{
+			description:   "missing configuration file",
+			args:          []string{"--config", filepath.Join(t.TempDir(), "missing.yaml")},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+
+			cfg := NewConfig()
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			cfg.RegisterFlags(fs)
+			err := LoadConfig(fs, tc.args)
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedConfig, *cfg)
+		})
+	}
+
+	t.Run("unknown option in configuration file", func(t *testing.T) {
+		unknownOptionFile := filepath.Join(t.TempDir(), "config.yaml")
+		assert.NoError(t, os.WriteFile(unknownOptionFile, []byte("unknown: value\n"), 0600))
+
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		NewConfig().RegisterFlags(fs)
+		assert.EqualError(t, LoadConfig(fs, []string{"--config", unknownOptionFile}), "unknown option 'unknown' in configuration file "+unknownOptionFile)
+	})
+}
+
+func TestConfigValidate(t *testing.T) {
+	existingDir := t.TempDir()
+
+	testCases := []struct {
+		description      string
+		config           Config
+		requireOutputDir bool
+		expectedError    string
+	}{
+		{
+			description: "valid production configuration",
+			config:      Config{Mode: model.MigrationModeProduction, Phase: PhaseAll, OutputDir: existingDir, Concurrency: 1, QPS: 5, Burst: 10},
+		},
+		{
+			description:   "unknown mode",
+			config:        Config{Mode: "staging", Phase: PhaseAll},
+			expectedError: "unknown migration mode 'staging'",
+		},
+		{
+			description:   "test mode without test secret",
+			config:        Config{Mode: model.MigrationModeTest, TestDomain: "example.com", Phase: PhaseAll},
+			expectedError: "test subdomain and test secret must be set in 'test' mode",
+		},
+		{
+			description:   "unknown phase",
+			config:        Config{Mode: model.MigrationModeProduction, Phase: "secrets"},
+			expectedError: "unknown migration phase 'secrets'",
+		},
+		{
+			description:   "no ingress workers",
+			config:        Config{Mode: model.MigrationModeProduction, Phase: PhaseAll, Concurrency: 0, QPS: 5, Burst: 10},
+			expectedError: "concurrency must be at least 1",
+		},
+		{
+			description:   "no client rate limit",
+			config:        Config{Mode: model.MigrationModeProduction, Phase: PhaseAll, Concurrency: 8, QPS: 0, Burst: 10},
+			expectedError: "qps must be positive and burst must be at least 1",
+		},
+		{
+			description:   "negative timeout",
+			config:        Config{Mode: model.MigrationModeProduction, Phase: PhaseAll, Concurrency: 1, QPS: 5, Burst: 10, Timeout: -time.Second},
+			expectedError: "timeout and request timeout must not be negative",
+		},
+		{
+			description:   "impersonated groups without user",
+			config:        Config{Mode: model.MigrationModeProduction, Phase: PhaseAll, Concurrency: 1, QPS: 5, Burst: 10, AsGroups: "system:masters"},
+			expectedError: "impersonated groups require an impersonated user",
+		},
+		{
+			description:   "kubeconfig context with input directory",
+			config:        Config{Mode: model.MigrationModeProduction, Phase: PhaseAll, InputDir: existingDir, Context: "staging", Concurrency: 1, QPS: 5, Burst: 10},
+			expectedError: "kubeconfig, context and impersonation options can not be used with an input directory",
+		},
+		{
+			description:   "negative retries",
+			config:        Config{Mode: model.MigrationModeProduction, Phase: PhaseAll, Concurrency: 1, QPS: 5, Burst: 10, Retries: -1},
+			expectedError: "retries must not be negative",
+		},
+		{
+			description:   "negative resync period",
+			config:        Config{Mode: model.MigrationModeProduction, Phase: PhaseAll, Concurrency: 1, QPS: 5, Burst: 10, ResyncPeriod: -time.Minute},
+			expectedError: "resync period must not be negative",
+		},
+		{
+			description:   "unknown report format",
+			config:        Config{Mode: model.MigrationModeProduction, Phase: PhaseAll, Concurrency: 1, QPS: 5, Burst: 10, ReportFormat: "text,pdf"},
+			expectedError: "unknown report format 'pdf'",
+		},
+		{
+			description:   "saved report format without output directory",
+			config:        Config{Mode: model.MigrationModeProduction, Phase: PhaseAll, Concurrency: 1, QPS: 5, Burst: 10, ReportFormat: "text, junit"},
+			expectedError: "output directory must be set to save the migration report in formats other than 'text'",
+		},
+		{
+			description:   "unknown fail-on selector",
+			config:        Config{Mode: model.MigrationModeProduction, Phase: PhaseAll, Concurrency: 1, QPS: 5, Burst: 10, FailOn: "critical,fatal"},
+			expectedError: "'fatal' matches no warning code or severity",
+		},
+		{
+			description:   "invalid metrics address",
+			config:        Config{Mode: model.MigrationModeProduction, Phase: PhaseAll, Concurrency: 1, QPS: 5, Burst: 10, MetricsAddress: "8080"},
+			expectedError: "invalid metrics address '8080': address 8080: missing port in address",
+		},
+		{
+			description:      "missing output directory",
+			config:           Config{Mode: model.MigrationModeProduction, Phase: PhaseAll, Concurrency: 1, QPS: 5, Burst: 10},
+			requireOutputDir: true,
+			expectedError:    "output directory must be set",
+		},
+		{
+			description:   "dry-run mode with input directory",
+			config:        Config{Mode: model.MigrationModeProduction, Phase: PhaseAll, InputDir: existingDir, DryRun: true, Concurrency: 1, QPS: 5, Burst: 10},
+			expectedError: "dry-run mode requires a cluster, it can not be used with an input directory",
+		},
+		{
+			description:   "non-existing input directory",
+			config:        Config{Mode: model.MigrationModeProduction, Phase: PhaseAll, InputDir: filepath.Join(existingDir, "missing"), Concurrency: 1, QPS: 5, Burst: 10},
+			expectedError: "input directory " + filepath.Join(existingDir, "missing") + " does not exist",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			err := tc.config.Validate(tc.requireOutputDir)
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.expectedError)
+		})
+	}
+}
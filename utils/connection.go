@@ -0,0 +1,119 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// InClusterContext is printed as the kubeconfig context when the migration tool runs in a pod with its service account
+const InClusterContext = "in-cluster"
+
+// ConnectionInfo describes how the migration tool connects to the cluster, it is printed with the migration status
+type ConnectionInfo struct {
+	// Context is the name of the kubeconfig context, or InClusterContext if the service account of the pod is used
+	Context string
+	// User is the identity the requests are sent with
+	User string
+	// Groups are the impersonated groups
+	Groups []string
+}
+
+// Identity returns the user and the groups the requests are sent with in a human readable format
+func (c ConnectionInfo) Identity() string {
+	if len(c.Groups) == 0 {
+		return c.User
+	}
+	return fmt.Sprintf("%s (groups: %s)", c.User, strings.Join(c.Groups, ", "))
+}
+
+// inCluster returns true if the service account of the pod should be used
+func inCluster(options KubeClientOptions) bool {
+	return options.KubeConfig == "" && options.Context == "" && os.Getenv(clientcmd.RecommendedConfigPathEnvVar) == "" &&
+		os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+}
+
+// GetRestConfig returns the rest config of the cluster and the information about the connection
+func GetRestConfig(options KubeClientOptions, logger *zap.Logger) (*rest.Config, ConnectionInfo, error) {
+	var config *rest.Config
+	var info ConnectionInfo
+	if inCluster(options) {
+		var err error
+		if config, err = rest.InClusterConfig(); err != nil {
+			logger.Error("error getting in cluster rest config", zap.Error(err))
+			return nil, info, err
+		}
+		info = ConnectionInfo{Context: InClusterContext, User: serviceAccountFromToken(config.BearerToken)}
+		logger.Info("using the service account of the pod", zap.String("user", info.User))
+	} else {
+		loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+		loadingRules.ExplicitPath = options.KubeConfig
+		clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{CurrentContext: options.Context})
+
+		rawConfig, err := clientConfig.RawConfig()
+		if err != nil {
+			logger.Error("error loading kubeconfig", zap.Error(err))
+			return nil, info, err
+		}
+		info.Context = rawConfig.CurrentContext
+		if options.Context != "" {
+			info.Context = options.Context
+		}
+		if kubeContext, exists := rawConfig.Contexts[info.Context]; exists {
+			info.User = kubeContext.AuthInfo
+		}
+
+		if config, err = clientConfig.ClientConfig(); err != nil {
+			logger.Error("error getting rest config from kubeconfig", zap.Error(err))
+			return nil, info, err
+		}
+		logger.Info("using kubeconfig", zap.String("kubeConfigPath", options.KubeConfig), zap.String("context", info.Context), zap.String("user", info.User))
+	}
+
+	if options.As != "" {
+		config.Impersonate = rest.ImpersonationConfig{UserName: options.As, Groups: options.AsGroups}
+		info.User = options.As
+		info.Groups = options.AsGroups
+		logger.Info("impersonating user", zap.String("user", options.As), zap.Strings("groups", options.AsGroups))
+	}
+
+	return config, info, nil
+}
+
+// serviceAccountFromToken returns the subject of the unverified service account token
+func serviceAccountFromToken(token string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ""
+	}
+	var claims struct {
+		Subject string `json:"sub"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+	return claims.Subject
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+const testKubeConfig = `apiVersion: v1
+kind: Config
+current-context: production
+clusters:
+  - name: production
+    cluster:
+      server: https://production.example.com:6443
+  - name: staging
+    cluster:
+      server: https://staging.example.com:6443
+users:
+  - name: admin
+    user:
+      token: admin-token
+  - name: developer
+    user:
+      token: developer-token
+contexts:
+  - name: production
+    context:
+      cluster: production
+      user: admin
+  - name: staging
+    context:
+      cluster: staging
+      user: developer
+`
+
+func TestGetRestConfig(t *testing.T) {
+	kubeConfig := filepath.Join(t.TempDir(), "kubeconfig")
+	assert.NoError(t, os.WriteFile(kubeConfig, []byte(testKubeConfig), 0600))
+
+	testCases := []struct {
+		description        string
+		options            KubeClientOptions
+		expectedHost       string
+		expectedConnection ConnectionInfo
+		expectedError      bool
+	}{
+		{
+			description:        "current context",
+			options:            KubeClientOptions{KubeConfig: kubeConfig},
+			expectedHost:       "https://production.example.com:6443",
+			expectedConnection: ConnectionInfo{Context: "production", User: "admin"},
+		},
+		{
+			description:        "selected context",
+			options:            KubeClientOptions{KubeConfig: kubeConfig, Context: "staging"},
+			expectedHost:       "https://staging.example.com:6443",
+			expectedConnection: ConnectionInfo{Context: "staging", User: "developer"},
+		},
+		{
+			description:        "impersonation",
+			options:            KubeClientOptions{KubeConfig: kubeConfig, As: "jane", AsGroups: []string{"ingress-admins", "auditors"}},
+			expectedHost:       "https://production.example.com:6443",
+			expectedConnection: ConnectionInfo{Context: "production", User: "jane", Groups: []string{"ingress-admins", "auditors"}},
+		},
+		{
+			description:   "unknown context",
+			options:       KubeClientOptions{KubeConfig: kubeConfig, Context: "development"},
+			expectedError: true,
+		},
+		{
+			description:   "missing kubeconfig",
+			options:       KubeClientOptions{KubeConfig: filepath.Join(t.TempDir(), "missing")},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			config, connection, err := GetRestConfig(tc.options, zap.NewNop())
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedHost, config.Host)
+			assert.Equal(t, tc.expectedConnection, connection)
+			assert.Equal(t, tc.options.As, config.Impersonate.UserName)
+			assert.Equal(t, tc.options.AsGroups, config.Impersonate.Groups)
+		})
+	}
+}
+
+func TestServiceAccountFromToken(t *testing.T) {
+	encode := func(payload string) string {
+		return "header." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".signature"
+	}
+
+	testCases := []struct {
+		description  string
+		token        string
+		expectedUser string
+	}{
+		{
+			description:  "service account token",
+			token:        encode(`{"iss":"kubernetes/serviceaccount","sub":"system:serviceaccount:kube-system:ibm-ingress-migrator"}`),
+			expectedUser: "system:serviceaccount:kube-system:ibm-ingress-migrator",
+		},
+		{
+			description: "not a jwt",
+			token:       "opaque-token",
+		},
+		{
+			description: "invalid payload",
+			token:       encode("not json"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expectedUser, serviceAccountFromToken(tc.token))
+		})
+	}
+}
+
+func TestConnectionInfoIdentity(t *testing.T) {
+	assert.Equal(t, "admin", ConnectionInfo{Context: "production", User: "admin"}.Identity())
+	assert.Equal(t, "jane (groups: ingress-admins, auditors)", ConnectionInfo{User: "jane", Groups: []string{"ingress-admins", "auditors"}}.Identity())
+}
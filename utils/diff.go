@@ -0,0 +1,298 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// PlanFileName is the name of the file in the output directory that contains the changes planned by the plan command
+	PlanFileName = "plan.json"
+
+	// ChangeActionCreate means that the resource does not exist yet and would be created
+	ChangeActionCreate = "create"
+	// ChangeActionUpdate means that the resource exists and some of its fields would be changed
+	ChangeActionUpdate = "update"
+	// ChangeActionNoOp means that the resource exists and would not be changed
+	ChangeActionNoOp = "no-op"
+
+	redactedValue = "<redacted>"
+)
+
+// ignoredFields are never changed by the migration or change on every run
+var ignoredFields = []string{
+	"apiVersion",
+	"kind",
+	"status",
+	"metadata.uid",
+	"metadata.resourceVersion",
+	"metadata.generation",
+	"metadata.creationTimestamp",
+	"metadata.managedFields",
+	"metadata.selfLink",
+	"metadata.annotations[kubectl.kubernetes.io/last-applied-configuration]",
+	"metadata.labels[" + MigrationRunIDLabel + "]",
+	"metadata.annotations[" + MigrationRunIDAnnotation + "]",
+	"metadata.annotations[" + SourceHashAnnotation + "]",
+	"metadata.annotations[" + GeneratedHashAnnotation + "]",
+}
+
+// PlanChanges compares the resources recorded by the migration with their current state read via live
+func PlanChanges(ctx context.Context, kc KubeClient, live KubeClient) ([]model.ResourceChange, error) {
+	var changes []model.ResourceChange
+
+	for _, namespace := range sortedKeys(kc.GetIngressContainer()) {
+		ingresses := kc.GetIngressContainer()[namespace]
+		for _, name := range sortedKeys(ingresses) {
+			desired := ingresses[name]
+			var current interface{}
+			currentIngress, err := live.GetIngress(ctx, name, namespace)
+			if err != nil && !k8sErrors.IsNotFound(err) {
+				return nil, err
+			}
+			if err == nil {
+				current = convertV1Beta1ToV1Ingress(*currentIngress)
+			}
+			change, err := diffResource(IngressKind, name, namespace, current, desired, false)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	for _, namespace := range sortedKeys(kc.GetConfigMapContainer()) {
+		configMaps := kc.GetConfigMapContainer()[namespace]
+		for _, name := range sortedKeys(configMaps) {
+			var current interface{}
+			currentCm, err := live.GetConfigMap(ctx, name, namespace)
+			if err != nil && !k8sErrors.IsNotFound(err) {
+				return nil, err
+			}
+			if err == nil {
+				current = currentCm
+			}
+			change, err := diffResource(ConfigMapKind, name, namespace, current, configMaps[name], false)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	for _, namespace := range sortedKeys(kc.GetSecretContainer()) {
+		secrets := kc.GetSecretContainer()[namespace]
+		for _, name := range sortedKeys(secrets) {
+			var current interface{}
+			currentSecret, err := live.GetSecret(ctx, name, namespace)
+			if err != nil && !k8sErrors.IsNotFound(err) {
+				return nil, err
+			}
+			if err == nil {
+				current = currentSecret
+			}
+			// the values of the secret keys are never printed
+			change, err := diffResource(SecretKind, name, namespace, current, secrets[name], true)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, nil
+}
+
+// diffResource returns the change between the current and the desired state of the resource, current is nil if the resource does not exist
+func diffResource(kind, name, namespace string, current, desired interface{}, redact bool) (model.ResourceChange, error) {
+	change := model.ResourceChange{Kind: kind, Name: name, Namespace: namespace}
+
+	desiredFields, err := flattenObject(desired)
+	if err != nil {
+		return change, err
+	}
+	currentFields := map[string]string{}
+	if current != nil {
+		if currentFields, err = flattenObject(current); err != nil {
+			return change, err
+		}
+	}
+
+	change.Fields = DiffFields(currentFields, desiredFields)
+	if redact {
+		for i := range change.Fields {
+			if change.Fields[i].OldValue != nil {
+				change.Fields[i].OldValue = stringPtr(redactedValue)
+			}
+			if change.Fields[i].NewValue != nil {
+				change.Fields[i].NewValue = stringPtr(redactedValue)
+			}
+		}
+	}
+
+	switch {
+	case current == nil:
+		change.Action = ChangeActionCreate
+	case len(change.Fields) > 0:
+		change.Action = ChangeActionUpdate
+	default:
+		change.Action = ChangeActionNoOp
+	}
+	return change, nil
+}
+
+// DiffFields returns the changes between the flattened fields ordered by path
+func DiffFields(currentFields, desiredFields map[string]string) []model.FieldChange {
+	paths := map[string]bool{}
+	for path := range currentFields {
+		paths[path] = true
+	}
+	for path := range desiredFields {
+		paths[path] = true
+	}
+
+	var fieldChanges []model.FieldChange
+	for _, path := range sortedKeys(paths) {
+		currentValue, currentExists := currentFields[path]
+		desiredValue, desiredExists := desiredFields[path]
+		if currentExists && desiredExists && currentValue == desiredValue {
+			continue
+		}
+
+		fieldChange := model.FieldChange{Path: path}
+		if currentExists {
+			fieldChange.OldValue = stringPtr(currentValue)
+		}
+		if desiredExists {
+			fieldChange.NewValue = stringPtr(desiredValue)
+		}
+		fieldChanges = append(fieldChanges, fieldChange)
+	}
+	return fieldChanges
+}
+
+// flattenObject returns the leaf fields of the object in JSON format keyed by their path
+func flattenObject(obj interface{}) (map[string]string, error) {
+	objJSON, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var unstructuredObj interface{}
+	if err := json.Unmarshal(objJSON, &unstructuredObj); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]string{}
+	if err := flattenValue("", unstructuredObj, fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func flattenValue(path string, value interface{}, fields map[string]string) error {
+	if ItemInSlice(path, ignoredFields) {
+		return nil
+	}
+
+	switch v := value.(type) {
+	case nil:
+		// the null values are the same as the missing fields
+	case map[string]interface{}:
+		for key, item := range v {
+			if err := flattenValue(joinFieldPath(path, key), item, fields); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if err := flattenValue(fmt.Sprintf("%s[%d]", path, i), item, fields); err != nil {
+				return err
+			}
+		}
+	default:
+		valueJSON, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fields[path] = string(valueJSON)
+	}
+	return nil
+}
+
+func joinFieldPath(path, key string) string {
+	if strings.ContainsAny(key, "./") {
+		return fmt.Sprintf("%s[%s]", path, key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// PrintPlan prints the planned changes in a human readable format
+func PrintPlan(w io.Writer, changes []model.ResourceChange) {
+	actionCounts := map[string]int{}
+	for _, change := range changes {
+		actionCounts[change.Action]++
+	}
+	fmt.Fprintf(w, "Plan: %d to create, %d to update, %d unchanged\n\n", actionCounts[ChangeActionCreate], actionCounts[ChangeActionUpdate], actionCounts[ChangeActionNoOp])
+
+	actionSymbols := map[string]string{ChangeActionCreate: "+", ChangeActionUpdate: "~", ChangeActionNoOp: "="}
+	for _, change := range changes {
+		fmt.Fprintf(w, "%s %s %s/%s (%s)\n", actionSymbols[change.Action], change.Kind, change.Namespace, change.Name, change.Action)
+		for _, field := range change.Fields {
+			switch {
+			case field.OldValue == nil:
+				fmt.Fprintf(w, "    + %s: %s\n", field.Path, *field.NewValue)
+			case field.NewValue == nil:
+				fmt.Fprintf(w, "    - %s: %s\n", field.Path, *field.OldValue)
+			default:
+				fmt.Fprintf(w, "    ~ %s: %s -> %s\n", field.Path, *field.OldValue, *field.NewValue)
+			}
+		}
+	}
+}
+
+// WritePlan saves the planned changes in JSON format into the output directory
+func WritePlan(outputDir string, changes []model.ResourceChange) error {
+	planJSON, err := json.MarshalIndent(changes, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outputDir, PlanFileName), append(planJSON, '\n'), 0600)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	networking "k8s.io/api/networking/v1beta1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const diffTestManifests = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ibm-k8s-controller-config
+  namespace: kube-system
+  resourceVersion: "42"
+data:
+  ssl-protocols: "TLSv1.3"
+  proxy-body-size: "2m"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: generic-k8s-ingress-tcp-ports
+  namespace: kube-system
+data:
+  "9000": "default/tea-svc:8080"
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: proxy-secret
+  namespace: default
+stringData:
+  trusted.crt: cert
+`
+
+func TestDiffFields(t *testing.T) {
+	testCases := []struct {
+		description          string
+		currentFields        map[string]string
+		desiredFields        map[string]string
+		expectedFieldChanges []model.FieldChange
+	}{
+		{
+			description:   "no changes",
+			currentFields: map[string]string{"data.keep-alive": `"8"`},
+			desiredFields: map[string]string{"data.keep-alive": `"8"`},
+		},
+		{
+			description:   "added, changed and removed fields ordered by path",
+			currentFields: map[string]string{"data.ssl-protocols": `"TLSv1.3"`, "data.proxy-body-size": `"2m"`, "data.unchanged": `"1"`},
+			desiredFields: map[string]string{"data.ssl-protocols": `"TLSv1.2"`, "data.keep-alive": `"8"`, "data.unchanged": `"1"`},
+			expectedFieldChanges: []model.FieldChange{
+				{Path: "data.keep-alive", NewValue: stringPtr(`"8"`)},
+				{Path: "data.proxy-body-size", OldValue: stringPtr(`"2m"`)},
+				{Path: "data.ssl-protocols", OldValue: stringPtr(`"TLSv1.3"`), NewValue: stringPtr(`"TLSv1.2"`)},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expectedFieldChanges, DiffFields(tc.currentFields, tc.desiredFields))
+		})
+	}
+}
+
+func TestFlattenObject(t *testing.T) {
+	ingress := networking.Ingress{
+		ObjectMeta: v12.ObjectMeta{
+			Name:            "tea-ingress",
+			Namespace:       "default",
+			ResourceVersion: "42",
+			Annotations:     map[string]string{IngressClassAnnotation: PublicIngressClass},
+		},
+		Spec: networking.IngressSpec{
+			Rules: []networking.IngressRule{{
+				Host: "tea.example.com",
+				IngressRuleValue: networking.IngressRuleValue{HTTP: &networking.HTTPIngressRuleValue{
+					Paths: []networking.HTTPIngressPath{{Path: "/tea", Backend: networking.IngressBackend{ServiceName: "tea-svc", ServicePort: intstr.FromInt(8080)}}},
+				}},
+			}},
+		},
+	}
+
+	fields, err := flattenObject(ingress)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"metadata.name":      `"tea-ingress"`,
+		"metadata.namespace": `"default"`,
+		"metadata.annotations[kubernetes.io/ingress.class]": `"public-iks-k8s-nginx"`,
+		"spec.rules[0].host":                              `"tea.example.com"`,
+		"spec.rules[0].http.paths[0].path":                `"/tea"`,
+		"spec.rules[0].http.paths[0].backend.serviceName": `"tea-svc"`,
+		"spec.rules[0].http.paths[0].backend.servicePort": `8080`,
+	}, fields)
+}
+
+func TestPlanChanges(t *testing.T) {
+	logger := zap.NewNop()
+	inputDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(inputDir, "manifests.yaml"), []byte(diffTestManifests), 0600))
+
+	kc, err := NewFileKubeClient(inputDir, logger)
+	assert.NoError(t, err)
+	live, err := NewFileKubeClient(inputDir, logger)
+	assert.NoError(t, err)
+
+	assert.NoError(t, kc.CreateOrUpdateIngress(context.Background(), networking.Ingress{
+		ObjectMeta: v12.ObjectMeta{Name: "tea-ingress-server", Namespace: "default"},
+		Spec:       networking.IngressSpec{Rules: []networking.IngressRule{{Host: "tea.example.com"}}},
+	}))
+
+	k8sCm, err := kc.GetConfigMap(context.Background(), K8sConfigMapName, KubeSystem)
+	assert.NoError(t, err)
+	k8sCm.Data["ssl-protocols"] = "TLSv1.2"
+	delete(k8sCm.Data, "proxy-body-size")
+	assert.NoError(t, kc.UpdateConfigmap(context.Background(), k8sCm))
+
+	tcpCm, err := kc.GetConfigMap(context.Background(), GenericK8sTCPConfigMapName, KubeSystem)
+	assert.NoError(t, err)
+	assert.NoError(t, kc.UpdateConfigmap(context.Background(), tcpCm))
+
+	secret, err := kc.GetSecret(context.Background(), "proxy-secret", "default")
+	assert.NoError(t, err)
+	secret.Data["ca.crt"] = []byte("cert")
+	assert.NoError(t, kc.UpdateSecret(context.Background(), secret))
+
+	changes, err := PlanChanges(context.Background(), kc, live)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.ResourceChange{
+		{
+			Kind:      IngressKind,
+			Name:      "tea-ingress-server",
+			Namespace: "default",
+			Action:    ChangeActionCreate,
+			Fields: []model.FieldChange{
+				{Path: "metadata.name", NewValue: stringPtr(`"tea-ingress-server"`)},
+				{Path: "metadata.namespace", NewValue: stringPtr(`"default"`)},
+				{Path: "spec.rules[0].host", NewValue: stringPtr(`"tea.example.com"`)},
+			},
+		},
+		{
+			Kind:      ConfigMapKind,
+			Name:      GenericK8sTCPConfigMapName,
+			Namespace: KubeSystem,
+			Action:    ChangeActionNoOp,
+		},
+		{
+			Kind:      ConfigMapKind,
+			Name:      K8sConfigMapName,
+			Namespace: KubeSystem,
+			Action:    ChangeActionUpdate,
+			Fields: []model.FieldChange{
+				{Path: "data.proxy-body-size", OldValue: stringPtr(`"2m"`)},
+				{Path: "data.ssl-protocols", OldValue: stringPtr(`"TLSv1.3"`), NewValue: stringPtr(`"TLSv1.2"`)},
+			},
+		},
+		{
+			Kind:      SecretKind,
+			Name:      "proxy-secret",
+			Namespace: "default",
+			Action:    ChangeActionUpdate,
+			Fields: []model.FieldChange{
+				{Path: "data[ca.crt]", NewValue: stringPtr(redactedValue)},
+			},
+		},
+	}, changes)
+
+	var output bytes.Buffer
+	PrintPlan(&output, changes)
+	assert.Equal(t, `Plan: 1 to create, 2 to update, 1 unchanged
+
++ Ingress default/tea-ingress-server (create)
+    + metadata.name: "tea-ingress-server"
+    + metadata.namespace: "default"
+    + spec.rules[0].host: "tea.example.com"
+= ConfigMap kube-system/generic-k8s-ingress-tcp-ports (no-op)
+~ ConfigMap kube-system/ibm-k8s-controller-config (update)
+    - data.proxy-body-size: "2m"
+    ~ data.ssl-protocols: "TLSv1.3" -> "TLSv1.2"
+~ Secret default/proxy-secret (update)
+    + data[ca.crt]: <redacted>
+`, output.String())
+}
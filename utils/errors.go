@@ -0,0 +1,132 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// ExitCodeOK is returned when the command finished without errors and warnings
+	ExitCodeOK = 0
+	// ExitCodeInternalError is returned when the command failed with an unexpected error
+	ExitCodeInternalError = 1
+	// ExitCodeConfigError is returned when the configuration or the input of the command is invalid
+	ExitCodeConfigError = 2
+	// ExitCodeAPIError is returned when the command failed because of a Kubernetes API error
+	ExitCodeAPIError = 3
+	// ExitCodePartialMigration is returned when some of the resources could not be processed
+	ExitCodePartialMigration = 4
+	// ExitCodeWarnings is returned when every resource was processed, but some of them have migration warnings
+	ExitCodeWarnings = 5
+	// ExitCodeInterrupted is returned when the command was canceled by a signal or its timeout expired
+	ExitCodeInterrupted = 6
+	// ExitCodePolicyViolation is returned when the migration warnings violate the policy of the --fail-on and --policy options
+	ExitCodePolicyViolation = 7
+)
+
+// ConfigError is returned when the configuration or the input of the migration is invalid
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// APIError is returned when a request to the Kubernetes API failed
+type APIError struct {
+	Err error
+}
+
+func (e *APIError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// PartialMigrationError is returned when the operation continued after errors, so only some of the resources were processed
+type PartialMigrationError struct {
+	Operation string
+	Errors    []error
+}
+
+func (e *PartialMigrationError) Error() string {
+	return fmt.Sprintf("error occurred while %s: %v", e.Operation, e.Errors)
+}
+
+// InterruptedError is returned when the command was canceled before it finished
+type InterruptedError struct {
+	Err   error
+	Cause error
+}
+
+func (e *InterruptedError) Error() string {
+	if e.Cause == nil {
+		return fmt.Sprintf("the command was interrupted: %v", e.Err)
+	}
+	return fmt.Sprintf("the command was interrupted: %v: %v", e.Err, e.Cause)
+}
+
+func (e *InterruptedError) Unwrap() error {
+	return e.Err
+}
+
+// PolicyViolationError is returned when the migration finished, but its warnings violate the policy, see the EvaluatePolicy function
+type PolicyViolationError struct {
+	Violations []string
+}
+
+func (e *PolicyViolationError) Error() string {
+	return fmt.Sprintf("the migration policy was violated: %s", strings.Join(e.Violations, "; "))
+}
+
+// ExitCode returns the exit code associated with the error
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitCodeOK
+	}
+
+	var configError *ConfigError
+	var apiError *APIError
+	var partialMigrationError *PartialMigrationError
+	var interruptedError *InterruptedError
+	var policyViolationError *PolicyViolationError
+	var apiStatus k8sErrors.APIStatus
+	switch {
+	case errors.As(err, &interruptedError), errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ExitCodeInterrupted
+	case errors.As(err, &configError):
+		return ExitCodeConfigError
+	case errors.As(err, &partialMigrationError):
+		return ExitCodePartialMigration
+	case errors.As(err, &policyViolationError):
+		return ExitCodePolicyViolation
+	case errors.As(err, &apiError), errors.As(err, &apiStatus):
+		return ExitCodeAPIError
+	default:
+		return ExitCodeInternalError
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestExitCode(t *testing.T) {
+	notFoundErr := k8sErrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, MigrationStatusConfigMapName)
+
+	testCases := []struct {
+		description      string
+		err              error
+		expectedExitCode int
+	}{
+		{
+			description:      "no error",
+			expectedExitCode: ExitCodeOK,
+		},
+		{
+			description:      "configuration error",
+			err:              &ConfigError{Err: fmt.Errorf("unknown migration mode 'staging'")},
+			expectedExitCode: ExitCodeConfigError,
+		},
+		{
+			description:      "api error",
+			err:              &APIError{Err: fmt.Errorf("connection refused")},
+			expectedExitCode: ExitCodeAPIError,
+		},
+		{
+			description:      "unwrapped kubernetes api error",
+			err:              notFoundErr,
+			expectedExitCode: ExitCodeAPIError,
+		},
+		{
+			description:      "wrapped kubernetes api error",
+			err:              fmt.Errorf("error getting status configmap: %w", notFoundErr),
+			expectedExitCode: ExitCodeAPIError,
+		},
+		{
+			description:      "partial migration",
+			err:              &PartialMigrationError{Operation: "processing ingress resources", Errors: []error{notFoundErr}},
+			expectedExitCode: ExitCodePartialMigration,
+		},
+		{
+			description:      "interrupted partial migration",
+			err:              &InterruptedError{Err: context.Canceled, Cause: &PartialMigrationError{Operation: "processing ingress resources", Errors: []error{notFoundErr}}},
+			expectedExitCode: ExitCodeInterrupted,
+		},
+		{
+			description:      "expired request context",
+			err:              &APIError{Err: fmt.Errorf("error getting status configmap: %w", context.DeadlineExceeded)},
+			expectedExitCode: ExitCodeInterrupted,
+		},
+		{
+			description:      "policy violation",
+			err:              &PolicyViolationError{Violations: []string{"namespace tea has 2 warnings matching 'critical', the maximum is 1"}},
+			expectedExitCode: ExitCodePolicyViolation,
+		},
+		{
+			description:      "unexpected error",
+			err:              fmt.Errorf("error while dumping resources"),
+			expectedExitCode: ExitCodeInternalError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expectedExitCode, ExitCode(tc.err))
+		})
+	}
+}
+
+func TestPartialMigrationError(t *testing.T) {
+	err := &PartialMigrationError{Operation: "processing ingress resources", Errors: []error{fmt.Errorf("first error"), fmt.Errorf("second error")}}
+	assert.EqualError(t, err, "error occurred while processing ingress resources: [first error second error]")
+}
+
+func TestInterruptedError(t *testing.T) {
+	err := &InterruptedError{Err: context.DeadlineExceeded, Cause: fmt.Errorf("first error")}
+	assert.EqualError(t, err, "the command was interrupted: context deadline exceeded: first error")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualError(t, &InterruptedError{Err: context.Canceled}, "the command was interrupted: context canceled")
+}
+
+func TestPolicyViolationError(t *testing.T) {
+	err := &PolicyViolationError{Violations: []string{"first violation", "second violation"}}
+	assert.EqualError(t, err, "the migration policy was violated: first violation; second violation")
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	v12 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	networking "k8s.io/api/networking/v1beta1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// EventReasonMigrated is the reason of the Normal event of a source ingress resource migrated without errors
+	EventReasonMigrated = "Migrated"
+	// EventReasonMigrationWarning is the reason of the Warning events of the migration warnings of a source ingress resource
+	EventReasonMigrationWarning = "MigrationWarning"
+	// EventReasonMigrationWarningAcknowledged is the reason of the Normal events of the acknowledged migration warnings
+	EventReasonMigrationWarningAcknowledged = "MigrationWarningAcknowledged"
+	// EventReasonMigrationFailed is the reason of the Warning events of the migration errors of a source ingress resource
+	EventReasonMigrationFailed = "MigrationFailed"
+
+	// maxEventMessageLength is the maximum length of the message of an event, the longer messages are truncated
+	maxEventMessageLength = 1024
+)
+
+// IngressEvent is a Kubernetes event recorded on a source ingress resource, see the NewIngressEvents function
+type IngressEvent struct {
+	// Type is v1.EventTypeNormal or v1.EventTypeWarning
+	Type    string
+	Reason  string
+	Message string
+}
+
+// NewIngressEvents returns the events of the migrated source ingress resource
+func NewIngressEvents(migratedResource model.MigratedResource) []IngressEvent {
+	var events []IngressEvent
+	for _, migrationError := range migratedResource.Errors {
+		events = append(events, IngressEvent{Type: v12.EventTypeWarning, Reason: EventReasonMigrationFailed, Message: eventMessage(migrationError)})
+	}
+	for _, warning := range ResourceWarnings(migratedResource) {
+		message := FormatWarning(warning)
+		if warning.Remediation != "" {
+			message += ". Remediation: " + warning.Remediation
+		}
+		if warning.DocURL != "" {
+			message += " (" + warning.DocURL + ")"
+		}
+		events = append(events, IngressEvent{Type: v12.EventTypeWarning, Reason: EventReasonMigrationWarning, Message: eventMessage(message)})
+	}
+	for _, warning := range migratedResource.AcknowledgedWarnings {
+		message := FormatWarning(warning) + " (acknowledged)"
+		if warning.Acknowledgement != nil {
+			message = fmt.Sprintf("%s (acknowledged until %s: %s)", FormatWarning(warning), warning.Acknowledgement.Expires, warning.Acknowledgement.Reason)
+		}
+		events = append(events, IngressEvent{Type: v12.EventTypeNormal, Reason: EventReasonMigrationWarningAcknowledged, Message: eventMessage(message)})
+	}
+	if len(migratedResource.Errors) == 0 {
+		message := "Migrated, no resources were generated"
+		if len(migratedResource.MigratedAs) > 0 {
+			message = "Migrated to " + strings.Join(migratedResource.MigratedAs, ", ")
+		}
+		events = append(events, IngressEvent{Type: v12.EventTypeNormal, Reason: EventReasonMigrated, Message: eventMessage(message)})
+	}
+	return events
+}
+
+// eventMessage returns the message truncated to the maximum length of an event message
+func eventMessage(message string) string {
+	if len(message) <= maxEventMessageLength {
+		return message
+	}
+	return message[:maxEventMessageLength-3] + "..."
+}
+
+// eventName returns the name of the event, which is the same for the same event of the same ingress resource
+func eventName(ingress *networking.Ingress, event IngressEvent) string {
+	hash := sha256.Sum256([]byte(strings.Join([]string{string(ingress.UID), event.Type, event.Reason, event.Message}, "\n")))
+	return fmt.Sprintf("%s.%x", ingress.Name, hash[:8])
+}
+
+// newEvent returns a new event of the ingress resource served with the apiVersion
+func newEvent(ingress *networking.Ingress, apiVersion string, event IngressEvent, now time.Time) *v12.Event {
+	return &v12.Event{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      eventName(ingress, event),
+			Namespace: ingress.Namespace,
+		},
+		InvolvedObject: v12.ObjectReference{
+			Kind:            IngressKind,
+			APIVersion:      apiVersion,
+			Name:            ingress.Name,
+			Namespace:       ingress.Namespace,
+			UID:             ingress.UID,
+			ResourceVersion: ingress.ResourceVersion,
+		},
+		Type:           event.Type,
+		Reason:         event.Reason,
+		Message:        event.Message,
+		Source:         v12.EventSource{Component: FieldManager},
+		FirstTimestamp: v1.NewTime(now),
+		LastTimestamp:  v1.NewTime(now),
+		Count:          1,
+	}
+}
+
+// RecordIngressEvents records the events on the source ingress resource
+func (k *kubeClient) RecordIngressEvents(ctx context.Context, ingress *networking.Ingress, events []IngressEvent) error {
+	if !k.recordEvents || k.readOnly || k.dryRun {
+		return nil
+	}
+	apiVersion := networking.SchemeGroupVersion.String()
+	if k.v1IngressOnly {
+		apiVersion = networkingv1.SchemeGroupVersion.String()
+	}
+	var errors []error
+	for _, event := range events {
+		newEvent := newEvent(ingress, apiVersion, event, time.Now())
+		err := RetryOnConflict(func() error {
+			return k.retry(ctx, "record event", func() error {
+				current, err := k.client.CoreV1().Events(ingress.Namespace).Get(ctx, newEvent.Name, v1.GetOptions{})
+				if k8sErrors.IsNotFound(err) {
+					_, err = k.client.CoreV1().Events(ingress.Namespace).Create(ctx, newEvent, v1.CreateOptions{})
+					return err
+				}
+				if err != nil {
+					return err
+				}
+				current.Count++
+				current.LastTimestamp = newEvent.LastTimestamp
+				current.InvolvedObject.ResourceVersion = newEvent.InvolvedObject.ResourceVersion
+				_, err = k.client.CoreV1().Events(ingress.Namespace).Update(ctx, current, v1.UpdateOptions{})
+				return err
+			})
+		})
+		if err != nil {
+			errors = append(errors, fmt.Errorf("error recording %s event: %v", event.Reason, err))
+		}
+	}
+	if len(errors) > 0 {
+		return fmt.Errorf("%v", errors)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	v12 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1beta1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// fakeEventServer serves the events like the API server, and records the methods of the requests
+// the first conflicts updates fail with a conflict, like if the event was changed since it was read
+type fakeEventServer struct {
+	mutex     sync.Mutex
+	events    map[string]*v12.Event
+	requests  []string
+	conflicts int
+}
+
+func (s *fakeEventServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.requests = append(s.requests, r.Method)
+	var event v12.Event
+	switch r.Method {
+	case http.MethodGet:
+		name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		current, exists := s.events[name]
+		if !exists {
+			writeStatus(w, k8sErrors.NewNotFound(v12.Resource("events"), name))
+			return
+		}
+		event = *current
+	case http.MethodPost, http.MethodPut:
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		if r.Method == http.MethodPut && s.conflicts > 0 {
+			s.conflicts--
+			writeStatus(w, k8sErrors.NewConflict(v12.Resource("events"), event.Name, fmt.Errorf("the object has been modified")))
+			return
+		}
+		s.events[event.Name] = &event
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	event.TypeMeta = v1.TypeMeta{APIVersion: "v1", Kind: "Event"}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(event)
+}
+
+func TestNewIngressEvents(t *testing.T) {
+	testCases := []struct {
+		description      string
+		migratedResource model.MigratedResource
+		expectedEvents   []IngressEvent
+	}{
+		{
+			description:      "migrated without warnings",
+			migratedResource: model.MigratedResource{Name: "tea", MigratedAs: []string{"tea-server", "tea-location-1"}},
+			expectedEvents: []IngressEvent{
+				{Type: v12.EventTypeNormal, Reason: EventReasonMigrated, Message: "Migrated to tea-server, tea-location-1"},
+			},
+		},
+		{
+			description: "migrated with warnings",
+			migratedResource: model.MigratedResource{
+				Name:       "tea",
+				MigratedAs: []string{"tea"},
+				Warnings:   []string{"first warning", "second warning"},
+				WarningDetails: []model.Warning{
+					{Code: "FIRST", Message: "first warning", Remediation: "fix it", DocURL: "https://example.com/first"},
+					{Code: "SECOND", Message: "second warning"},
+				},
+				AcknowledgedWarnings: []model.Warning{
+					{Code: "THIRD", Message: "third warning", Acknowledgement: &model.Acknowledgement{Code: "THIRD", Reason: "planned", Expires: "2023-06-30"}},
+				},
+			},
+			expectedEvents: []IngressEvent{
+				{Type: v12.EventTypeWarning, Reason: EventReasonMigrationWarning, Message: "[FIRST] first warning. Remediation: fix it (https://example.com/first)"},
+				{Type: v12.EventTypeWarning, Reason: EventReasonMigrationWarning, Message: "[SECOND] second warning"},
+				{Type: v12.EventTypeNormal, Reason: EventReasonMigrationWarningAcknowledged, Message: "[THIRD] third warning (acknowledged until 2023-06-30: planned)"},
+				{Type: v12.EventTypeNormal, Reason: EventReasonMigrated, Message: "Migrated to tea"},
+			},
+		},
+		{
+			description:      "migration failed",
+			migratedResource: model.MigratedResource{Name: "tea", Errors: []string{"first error", strings.Repeat("x", 2000)}},
+			expectedEvents: []IngressEvent{
+				{Type: v12.EventTypeWarning, Reason: EventReasonMigrationFailed, Message: "first error"},
+				{Type: v12.EventTypeWarning, Reason: EventReasonMigrationFailed, Message: strings.Repeat("x", maxEventMessageLength-3) + "..."},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expectedEvents, NewIngressEvents(tc.migratedResource))
+		})
+	}
+}
+
+func TestKubeClientRecordIngressEvents(t *testing.T) {
+	ingress := &networking.Ingress{ObjectMeta: v1.ObjectMeta{Name: "tea", Namespace: "default", UID: "tea-uid"}}
+	events := []IngressEvent{
+		{Type: v12.EventTypeWarning, Reason: EventReasonMigrationWarning, Message: "[FIRST] first warning"},
+		{Type: v12.EventTypeNormal, Reason: EventReasonMigrated, Message: "Migrated to tea"},
+	}
+
+	testCases := []struct {
+		description      string
+		recordEvents     bool
+		readOnly         bool
+		dryRun           bool
+		v1IngressOnly    bool
+		conflicts        int
+		runs             int
+		expectedRequests []string
+		expectedCount    int32
+	}{
+		{
+			description:      "events are created",
+			recordEvents:     true,
+			runs:             1,
+			expectedRequests: []string{http.MethodGet, http.MethodPost, http.MethodGet, http.MethodPost},
+			expectedCount:    1,
+		},
+		{
+			description:      "events recorded again are counted",
+			recordEvents:     true,
+			runs:             2,
+			expectedRequests: []string{http.MethodGet, http.MethodPost, http.MethodGet, http.MethodPost, http.MethodGet, http.MethodPut, http.MethodGet, http.MethodPut},
+			expectedCount:    2,
+		},
+		{
+			description:   "events changed since they were read are counted again",
+			recordEvents:  true,
+			conflicts:     2,
+			runs:          2,
+			expectedCount: 2,
+			expectedRequests: []string{http.MethodGet, http.MethodPost, http.MethodGet, http.MethodPost,
+				http.MethodGet, http.MethodPut, http.MethodGet, http.MethodPut, http.MethodGet, http.MethodPut, http.MethodGet, http.MethodPut},
+		},
+		{
+			description:      "v1 ingress resources",
+			recordEvents:     true,
+			v1IngressOnly:    true,
+			runs:             1,
+			expectedRequests: []string{http.MethodGet, http.MethodPost, http.MethodGet, http.MethodPost},
+			expectedCount:    1,
+		},
+		{
+			description: "events are disabled",
+			runs:        1,
+		},
+		{
+			description:  "read-only mode",
+			recordEvents: true,
+			readOnly:     true,
+			runs:         1,
+		},
+		{
+			description:  "dry-run mode",
+			recordEvents: true,
+			dryRun:       true,
+			runs:         1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			server := &fakeEventServer{events: map[string]*v12.Event{}, conflicts: tc.conflicts}
+			httpServer := httptest.NewServer(server)
+			defer httpServer.Close()
+			client, err := clientset.NewForConfig(&rest.Config{Host: httpServer.URL})
+			assert.NoError(t, err)
+			kc := &kubeClient{logger: zap.NewNop(), client: client, recordEvents: tc.recordEvents, readOnly: tc.readOnly, dryRun: tc.dryRun, v1IngressOnly: tc.v1IngressOnly}
+			apiVersion := "networking.k8s.io/v1beta1"
+			if tc.v1IngressOnly {
+				apiVersion = "networking.k8s.io/v1"
+			}
+
+			for i := 0; i < tc.runs; i++ {
+				assert.NoError(t, kc.RecordIngressEvents(context.Background(), ingress, events))
+			}
+
+			assert.Equal(t, tc.expectedRequests, server.requests)
+			if tc.expectedCount == 0 {
+				assert.Empty(t, server.events)
+				return
+			}
+			assert.Len(t, server.events, len(events))
+			for _, event := range events {
+				recorded := server.events[eventName(ingress, event)]
+				if assert.NotNil(t, recorded) {
+					assert.Equal(t, tc.expectedCount, recorded.Count)
+					assert.Equal(t, event.Reason, recorded.Reason)
+					assert.Equal(t, event.Type, recorded.Type)
+					assert.Equal(t, v12.ObjectReference{Kind: IngressKind, APIVersion: apiVersion, Name: "tea", Namespace: "default", UID: "tea-uid"}, recorded.InvolvedObject)
+					assert.Equal(t, FieldManager, recorded.Source.Component)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,461 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"go.uber.org/zap"
+	v12 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	networking "k8s.io/api/networking/v1beta1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+// fileKubeClient implements the KubeClient interface on the resource manifests of a local directory
+type fileKubeClient struct {
+	logger *zap.Logger
+
+	// the ingress resources are migrated by parallel workers, so every method working on the maps below holds the mutex
+	mutex sync.Mutex
+
+	ingresses  map[string]map[string]networking.Ingress
+	configMaps map[string]map[string]v12.ConfigMap
+	secrets    map[string]map[string]v12.Secret
+
+	ingressContainer   map[string]map[string]networkingv1.Ingress
+	configMapContainer map[string]map[string]v12.ConfigMap
+	secretContainer    map[string]map[string]v12.Secret
+}
+
+// NewFileKubeClient returns a KubeClient that reads the resources from the YAML and JSON files under inputDir
+func NewFileKubeClient(inputDir string, logger *zap.Logger) (KubeClient, error) {
+	kc := &fileKubeClient{
+		logger:             logger,
+		ingresses:          make(map[string]map[string]networking.Ingress),
+		configMaps:         make(map[string]map[string]v12.ConfigMap),
+		secrets:            make(map[string]map[string]v12.Secret),
+		ingressContainer:   make(map[string]map[string]networkingv1.Ingress),
+		configMapContainer: make(map[string]map[string]v12.ConfigMap),
+		secretContainer:    make(map[string]map[string]v12.Secret),
+	}
+
+	err := filepath.WalkDir(inputDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml", ".json":
+		default:
+			logger.Info("skipping file with unknown extension", zap.String("path", path))
+			return nil
+		}
+		return kc.loadFile(path)
+	})
+	if err != nil {
+		logger.Error("error loading resources from input directory", zap.String("inputDir", inputDir), zap.Error(err))
+		return nil, err
+	}
+	logger.Info("successfully loaded resources from input directory", zap.String("inputDir", inputDir))
+
+	return kc, nil
+}
+
+// loadFile decodes every document of the specified file and stores the supported resources
+func (k *fileKubeClient) loadFile(path string) error {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer file.Close() // #nosec G307
+
+	decoder := utilyaml.NewYAMLOrJSONDecoder(file, 4096)
+	for {
+		var obj unstructured.Unstructured
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to decode %s: %v", path, err)
+		}
+		// empty documents (e.g. a trailing '---') are decoded into an empty object
+		if len(obj.Object) == 0 {
+			continue
+		}
+		if err := k.loadObject(&obj); err != nil {
+			return fmt.Errorf("failed to load %s: %v", path, err)
+		}
+	}
+}
+
+// loadObject converts the decoded object into a typed resource and stores it
+func (k *fileKubeClient) loadObject(obj *unstructured.Unstructured) error {
+	if obj.IsList() {
+		return obj.EachListItem(func(item runtime.Object) error {
+			return k.loadObject(item.(*unstructured.Unstructured))
+		})
+	}
+
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace("default")
+	}
+
+	switch obj.GetKind() {
+	case IngressKind:
+		var ing networking.Ingress
+		switch obj.GetAPIVersion() {
+		case "networking.k8s.io/v1":
+			var v1Ingress networkingv1.Ingress
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &v1Ingress); err != nil {
+				return err
+			}
+			ing = convertV1ToV1Beta1Ingress(v1Ingress, true)
+		case "networking.k8s.io/v1beta1", "extensions/v1beta1":
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &ing); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported Ingress API version '%s'", obj.GetAPIVersion())
+		}
+		if _, exists := k.ingresses[ing.Namespace][ing.Name]; exists {
+			return fmt.Errorf("Ingress %s/%s is defined more than once", ing.Namespace, ing.Name)
+		}
+		k.storeIngress(ing)
+	case ConfigMapKind:
+		var cm v12.ConfigMap
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &cm); err != nil {
+			return err
+		}
+		if _, exists := k.configMaps[cm.Namespace][cm.Name]; exists {
+			return fmt.Errorf("ConfigMap %s/%s is defined more than once", cm.Namespace, cm.Name)
+		}
+		k.storeConfigMap(cm)
+	case SecretKind:
+		var secret v12.Secret
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &secret); err != nil {
+			return err
+		}
+		// stringData is merged into data by the API server, we have to do the same
+		for key, value := range secret.StringData {
+			if secret.Data == nil {
+				secret.Data = make(map[string][]byte)
+			}
+			secret.Data[key] = []byte(value)
+		}
+		secret.StringData = nil
+		if _, exists := k.secrets[secret.Namespace][secret.Name]; exists {
+			return fmt.Errorf("Secret %s/%s is defined more than once", secret.Namespace, secret.Name)
+		}
+		k.storeSecret(secret)
+	default:
+		k.logger.Info("skipping unsupported resource", zap.String("kind", obj.GetKind()), zap.String("name", obj.GetName()), zap.String("namespace", obj.GetNamespace()))
+	}
+
+	return nil
+}
+
+func (k *fileKubeClient) storeIngress(ing networking.Ingress) {
+	if _, nsExists := k.ingresses[ing.Namespace]; !nsExists {
+		k.ingresses[ing.Namespace] = make(map[string]networking.Ingress)
+	}
+	k.ingresses[ing.Namespace][ing.Name] = ing
+}
+
+func (k *fileKubeClient) storeConfigMap(cm v12.ConfigMap) {
+	if _, nsExists := k.configMaps[cm.Namespace]; !nsExists {
+		k.configMaps[cm.Namespace] = make(map[string]v12.ConfigMap)
+	}
+	k.configMaps[cm.Namespace][cm.Name] = cm
+}
+
+func (k *fileKubeClient) storeSecret(secret v12.Secret) {
+	if _, nsExists := k.secrets[secret.Namespace]; !nsExists {
+		k.secrets[secret.Namespace] = make(map[string]v12.Secret)
+	}
+	k.secrets[secret.Namespace][secret.Name] = secret
+}
+
+func (k *fileKubeClient) recordConfigMap(cm v12.ConfigMap) {
+	if _, nsExists := k.configMapContainer[cm.GetNamespace()]; !nsExists {
+		k.configMapContainer[cm.GetNamespace()] = make(map[string]v12.ConfigMap)
+	}
+	k.configMapContainer[cm.GetNamespace()][cm.GetName()] = cm
+}
+
+func (k *fileKubeClient) GetConfigMap(ctx context.Context, name, namespace string) (*v12.ConfigMap, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	cm, exists := k.configMaps[namespace][name]
+	if !exists {
+		return nil, k8sErrors.NewNotFound(v12.Resource("configmaps"), name)
+	}
+	return cm.DeepCopy(), nil
+}
+
+func (k *fileKubeClient) CreateConfigMap(ctx context.Context, cm *v12.ConfigMap) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if _, exists := k.configMaps[cm.Namespace][cm.Name]; exists {
+		return k8sErrors.NewAlreadyExists(v12.Resource("configmaps"), cm.Name)
+	}
+	k.storeConfigMap(*cm.DeepCopy())
+	k.recordConfigMap(*cm.DeepCopy())
+	return nil
+}
+
+func (k *fileKubeClient) IsNetworkingEnabled() bool {
+	return true
+}
+
+func (k *fileKubeClient) GetClient() *clientset.Clientset {
+	return nil
+}
+
+// GetIngressResources returns the loaded ingress resources selected by the filter ordered by namespace and name
+func (k *fileKubeClient) GetIngressResources(ctx context.Context, filter model.IngressFilter) ([]networking.Ingress, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	var ingresses []networking.Ingress
+	for _, nsIngresses := range k.ingresses {
+		for _, ing := range nsIngresses {
+			if MatchIngressFilter(ing, filter) {
+				ingresses = append(ingresses, *ing.DeepCopy())
+			}
+		}
+	}
+	sort.Slice(ingresses, func(i, j int) bool {
+		if ingresses[i].Namespace != ingresses[j].Namespace {
+			return ingresses[i].Namespace < ingresses[j].Namespace
+		}
+		return ingresses[i].Name < ingresses[j].Name
+	})
+	k.logger.Info("successfully got ingress resources from input directory", zap.Int("numberOfIngresses", len(ingresses)))
+	return ingresses, nil
+}
+
+func (k *fileKubeClient) GetIngress(ctx context.Context, name, namespace string) (*networking.Ingress, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	ing, exists := k.ingresses[namespace][name]
+	if !exists {
+		return nil, k8sErrors.NewNotFound(networking.Resource("ingresses"), name)
+	}
+	return ing.DeepCopy(), nil
+}
+
+func (k *fileKubeClient) CreateOrUpdateIngress(ctx context.Context, ing networking.Ingress) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.storeAndRecordIngress(ing)
+	return nil
+}
+
+// RecordUnchangedIngress records the generated ingress resource that is not stored, because the stored one is unchanged
+func (k *fileKubeClient) RecordUnchangedIngress(ing networking.Ingress) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.recordIngress(ing)
+}
+
+// AnnotateIngress sets the back-reference annotations on the source ingress resource, see the SourceAnnotations function
+func (k *fileKubeClient) AnnotateIngress(ctx context.Context, name, namespace string, annotations map[string]string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	ing, exists := k.ingresses[namespace][name]
+	if !exists {
+		return k8sErrors.NewNotFound(networking.Resource("ingresses"), name)
+	}
+	ing = *ing.DeepCopy()
+	setSourceAnnotations(&ing.ObjectMeta, annotations)
+	k.storeAndRecordIngress(ing)
+	return nil
+}
+
+// RecordIngressEvents does nothing, the events are not recorded offline
+func (k *fileKubeClient) RecordIngressEvents(ctx context.Context, ingress *networking.Ingress, events []IngressEvent) error {
+	return nil
+}
+
+// storeAndRecordIngress stores the ingress resource and records it for dumping, the caller must hold the mutex
+func (k *fileKubeClient) storeAndRecordIngress(ing networking.Ingress) {
+	k.storeIngress(*ing.DeepCopy())
+	k.recordIngress(ing)
+}
+
+// recordIngress records the ingress resource for dumping, the caller must hold the mutex
+func (k *fileKubeClient) recordIngress(ing networking.Ingress) {
+	v1ing := convertV1Beta1ToV1Ingress(ing)
+	if _, nsExists := k.ingressContainer[v1ing.GetNamespace()]; !nsExists {
+		k.ingressContainer[v1ing.GetNamespace()] = make(map[string]networkingv1.Ingress)
+	}
+	k.ingressContainer[v1ing.GetNamespace()][v1ing.GetName()] = v1ing
+}
+
+func (k *fileKubeClient) DeleteIngress(ctx context.Context, name, namespace string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if _, exists := k.ingresses[namespace][name]; !exists {
+		return k8sErrors.NewNotFound(networking.Resource("ingresses"), name)
+	}
+	delete(k.ingresses[namespace], name)
+	delete(k.ingressContainer[namespace], name)
+	return nil
+}
+
+func (k *fileKubeClient) CreateOrUpdateStatusCm(ctx context.Context, migrationModeUpdate string, migratedResourcesUpdate []model.MigratedResource, subdomainMapUpdate map[string]string, scopeUpdate *model.IngressFilter) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return updateStatusStore(fileStatusConfigMaps{k: k}, migrationModeUpdate, migratedResourcesUpdate, subdomainMapUpdate, scopeUpdate)
+}
+
+func (k *fileKubeClient) RemoveFromStatusCm(ctx context.Context, migratedResources []model.MigratedResource) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return removeFromStatusStore(fileStatusConfigMaps{k: k}, migratedResources)
+}
+
+func (k *fileKubeClient) DeleteStatusCm(ctx context.Context) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return deleteStatusStore(fileStatusConfigMaps{k: k})
+}
+
+// fileStatusConfigMaps reads and writes the configmaps of the migration status in memory, the mutex of the client must be held
+type fileStatusConfigMaps struct {
+	k *fileKubeClient
+}
+
+func (c fileStatusConfigMaps) current(name string) (*v12.ConfigMap, error) {
+	if cm, exists := c.k.configMaps[KubeSystem][name]; exists {
+		return cm.DeepCopy(), nil
+	}
+	return nil, nil
+}
+
+func (c fileStatusConfigMaps) apply(cm *v12.ConfigMap, removedKeys []string) error {
+	c.k.storeConfigMap(*cm)
+	c.k.recordConfigMap(*cm)
+	return nil
+}
+
+func (c fileStatusConfigMaps) delete(name string) error {
+	if _, exists := c.k.configMaps[KubeSystem][name]; !exists {
+		return k8sErrors.NewNotFound(v12.Resource("configmaps"), name)
+	}
+	delete(c.k.configMaps[KubeSystem], name)
+	delete(c.k.configMapContainer[KubeSystem], name)
+	return nil
+}
+
+func (k *fileKubeClient) CreateOrUpdateBackupCm(ctx context.Context, backupsUpdate []model.ResourceBackup) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	var backupCm *v12.ConfigMap
+	if cm, exists := k.configMaps[KubeSystem][MigrationBackupConfigMapName]; exists {
+		backupCm = &cm
+	}
+
+	data, err := mergeBackupCmData(backupCm, backupsUpdate)
+	if err != nil {
+		return err
+	}
+
+	if backupCm == nil {
+		cm := newBackupCm(data)
+		backupCm = &cm
+	}
+	backupCm.Data = data
+
+	k.storeConfigMap(*backupCm)
+	k.recordConfigMap(*backupCm)
+	return nil
+}
+
+func (k *fileKubeClient) UpdateConfigmap(ctx context.Context, cm *v12.ConfigMap) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if _, exists := k.configMaps[cm.Namespace][cm.Name]; !exists {
+		return k8sErrors.NewNotFound(v12.Resource("configmaps"), cm.Name)
+	}
+	k.storeConfigMap(*cm.DeepCopy())
+	k.recordConfigMap(*cm.DeepCopy())
+	return nil
+}
+
+func (k *fileKubeClient) DeleteConfigMap(ctx context.Context, name, namespace string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if _, exists := k.configMaps[namespace][name]; !exists {
+		return k8sErrors.NewNotFound(v12.Resource("configmaps"), name)
+	}
+	delete(k.configMaps[namespace], name)
+	delete(k.configMapContainer[namespace], name)
+	return nil
+}
+
+// IsIngressEnhancementsEnabled returns true, as the manifests are expected to target a cluster with Kubernetes 1.19+
+func (k *fileKubeClient) IsIngressEnhancementsEnabled() bool {
+	return true
+}
+
+func (k *fileKubeClient) GetSecret(ctx context.Context, name, namespace string) (*v12.Secret, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	secret, exists := k.secrets[namespace][name]
+	if !exists {
+		return nil, k8sErrors.NewNotFound(v12.Resource("secrets"), name)
+	}
+	return secret.DeepCopy(), nil
+}
+
+func (k *fileKubeClient) UpdateSecret(ctx context.Context, secret *v12.Secret) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if _, exists := k.secrets[secret.Namespace][secret.Name]; !exists {
+		return k8sErrors.NewNotFound(v12.Resource("secrets"), secret.Name)
+	}
+	k.storeSecret(*secret.DeepCopy())
+
+	if _, nsExists := k.secretContainer[secret.GetNamespace()]; !nsExists {
+		k.secretContainer[secret.GetNamespace()] = make(map[string]v12.Secret)
+	}
+	k.secretContainer[secret.GetNamespace()][secret.GetName()] = *secret.DeepCopy()
+	return nil
+}
+
+func (k *fileKubeClient) GetIngressContainer() map[string]map[string]networkingv1.Ingress {
+	return k.ingressContainer
+}
+func (k *fileKubeClient) GetConfigMapContainer() map[string]map[string]v12.ConfigMap {
+	return k.configMapContainer
+}
+func (k *fileKubeClient) GetSecretContainer() map[string]map[string]v12.Secret {
+	return k.secretContainer
+}
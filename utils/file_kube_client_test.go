@@ -0,0 +1,229 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	v1core "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1beta1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	testMultiDocumentManifest = `---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: tea-ingress
+  namespace: tea
+spec:
+  rules:
+  - host: tea.example.com
+    http:
+      paths:
+      - path: /tea
+        pathType: Prefix
+        backend:
+          service:
+            name: tea-svc
+            port:
+              number: 80
+---
+apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: coffee-ingress
+spec:
+  rules:
+  - host: coffee.example.com
+    http:
+      paths:
+      - path: /coffee
+        backend:
+          serviceName: coffee-svc
+          servicePort: 8080
+---
+apiVersion: v1
+kind: Deployment
+metadata:
+  name: unsupported
+---
+`
+	testListManifest = `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: ibm-cloud-provider-ingress-cm
+    namespace: kube-system
+  data:
+    ssl-ciphers: "HIGH:!aNULL:!MD5"
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: proxy-secret
+    namespace: default
+  data:
+    trusted.crt: Y2VydA==
+  stringData:
+    client.key: key
+`
+)
+
+func writeTestManifests(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0750))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	}
+	return dir
+}
+
+func TestNewFileKubeClient(t *testing.T) {
+	logger, _ := zap.NewProduction()
+
+	testCases := []struct {
+		description       string
+		files             map[string]string
+		expectedIngresses []string
+		expectedError     bool
+	}{
+		{
+			description: "multi-document and list manifests",
+			files: map[string]string{
+				"ingresses.yaml":     testMultiDocumentManifest,
+				"nested/config.yml":  testListManifest,
+				"nested/README.md":   "not a manifest",
+				"empty/nothing.json": "",
+			},
+			expectedIngresses: []string{"default/coffee-ingress", "tea/tea-ingress"},
+		},
+		{
+			description: "duplicated resources",
+			files: map[string]string{
+				"first.yaml":  testMultiDocumentManifest,
+				"second.yaml": testMultiDocumentManifest,
+			},
+			expectedError: true,
+		},
+		{
+			description: "invalid manifest",
+			files: map[string]string{
+				"invalid.yaml": "kind: [",
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			kc, err := NewFileKubeClient(writeTestManifests(t, tc.files), logger)
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			ingresses, err := kc.GetIngressResources(context.Background(), model.IngressFilter{})
+			assert.NoError(t, err)
+			var names []string
+			for _, ing := range ingresses {
+				names = append(names, ing.Namespace+"/"+ing.Name)
+			}
+			assert.Equal(t, tc.expectedIngresses, names)
+		})
+	}
+}
+
+func TestFileKubeClient(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	kc, err := NewFileKubeClient(writeTestManifests(t, map[string]string{
+		"ingresses.yaml": testMultiDocumentManifest,
+		"config.yaml":    testListManifest,
+	}), logger)
+	assert.NoError(t, err)
+
+	t.Run("v1 ingress is converted", func(t *testing.T) {
+		ingresses, err := kc.GetIngressResources(context.Background(), model.IngressFilter{})
+		assert.NoError(t, err)
+		assert.Equal(t, "tea-svc", ingresses[1].Spec.Rules[0].HTTP.Paths[0].Backend.ServiceName)
+		assert.Equal(t, networking.PathTypePrefix, *ingresses[1].Spec.Rules[0].HTTP.Paths[0].PathType)
+	})
+
+	t.Run("secret string data is merged", func(t *testing.T) {
+		secret, err := kc.GetSecret(context.Background(), "proxy-secret", "default")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]byte{"trusted.crt": []byte("cert"), "client.key": []byte("key")}, secret.Data)
+	})
+
+	t.Run("missing resources are not found", func(t *testing.T) {
+		_, err := kc.GetConfigMap(context.Background(), K8sConfigMapName, KubeSystem)
+		assert.True(t, k8serrors.IsNotFound(err))
+		_, err = kc.GetSecret(context.Background(), "proxy-secret", "other")
+		assert.True(t, k8serrors.IsNotFound(err))
+		assert.True(t, k8serrors.IsNotFound(kc.UpdateConfigmap(context.Background(), &v1core.ConfigMap{ObjectMeta: v12.ObjectMeta{Name: K8sConfigMapName, Namespace: KubeSystem}})))
+	})
+
+	t.Run("writes are recorded", func(t *testing.T) {
+		cm := &v1core.ConfigMap{
+			ObjectMeta: v12.ObjectMeta{Name: GenericK8sTCPConfigMapName, Namespace: KubeSystem},
+			Data:       map[string]string{"9000": "default/tea-svc:8080"},
+		}
+		assert.NoError(t, kc.CreateConfigMap(context.Background(), cm))
+		assert.True(t, k8serrors.IsAlreadyExists(kc.CreateConfigMap(context.Background(), cm)))
+
+		stored, err := kc.GetConfigMap(context.Background(), GenericK8sTCPConfigMapName, KubeSystem)
+		assert.NoError(t, err)
+		assert.Equal(t, cm.Data, stored.Data)
+		assert.Equal(t, cm.Data, kc.GetConfigMapContainer()[KubeSystem][GenericK8sTCPConfigMapName].Data)
+	})
+
+	t.Run("status configmap is merged", func(t *testing.T) {
+		assert.True(t, k8serrors.IsNotFound(kc.DeleteStatusCm(context.Background())))
+		assert.NoError(t, kc.CreateOrUpdateStatusCm(context.Background(), model.MigrationModeTest, []model.MigratedResource{{Kind: ConfigMapKind, Name: IKSConfigMapName}}, nil, nil))
+		assert.NoError(t, kc.CreateOrUpdateStatusCm(context.Background(), model.MigrationModeTest, []model.MigratedResource{{Kind: IngressKind, Name: "tea-ingress"}}, map[string]string{"tea.example.com": "abc.test.com"}, &model.IngressFilter{Namespaces: []string{"tea"}}))
+		assert.Error(t, kc.CreateOrUpdateStatusCm(context.Background(), model.MigrationModeProduction, nil, nil, nil))
+
+		statusCm, err := kc.GetConfigMap(context.Background(), MigrationStatusConfigMapName, KubeSystem)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"tea.example.com":"abc.test.com"}`, statusCm.Data[SubdomainMapParameterName])
+		assert.Equal(t, `{"namespaces":["tea"]}`, statusCm.Data[MigrationScopeParameterName])
+		assert.Equal(t, "1", statusCm.Data[MigrationStatusShardsParameterName])
+		// the migrated resources are stored in the shards
+		assert.NotContains(t, statusCm.Data, MigratedResourcesParameterName)
+		status, err := GetMigrationStatus(context.Background(), kc)
+		assert.NoError(t, err)
+		assert.Len(t, status.MigratedResources, 2)
+		recordedStatus, err := GetRecordedMigrationStatus(kc)
+		assert.NoError(t, err)
+		assert.Equal(t, status, recordedStatus)
+
+		assert.NoError(t, kc.DeleteStatusCm(context.Background()))
+		for _, name := range []string{MigrationStatusConfigMapName, StatusShardName(0)} {
+			_, exists := kc.GetConfigMapContainer()[KubeSystem][name]
+			assert.False(t, exists, name)
+		}
+	})
+}
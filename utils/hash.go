@@ -0,0 +1,103 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	networking "k8s.io/api/networking/v1beta1"
+)
+
+const (
+	// SourceHashAnnotation contains the content hash of the source ingress resource the ingress resource was generated from
+	SourceHashAnnotation = ProvenancePrefix + "source-hash"
+	// GeneratedHashAnnotation contains the content hash of the generated ingress resource, see the GeneratedHash function
+	GeneratedHashAnnotation = ProvenancePrefix + "generated-hash"
+
+	// lastAppliedConfigAnnotation is set by kubectl apply, it duplicates the content of the resource
+	lastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+)
+
+// hashedIngress contains the fields of the ingress resource that are covered by the content hashes
+type hashedIngress struct {
+	Labels      map[string]string      `json:"labels,omitempty"`
+	Annotations map[string]string      `json:"annotations,omitempty"`
+	Spec        networking.IngressSpec `json:"spec"`
+}
+
+// SourceHash returns the content hash of the source ingress resource
+func SourceHash(ing networking.Ingress) string {
+	return contentHash(ing, func(key string) bool {
+		return key == MigratedToAnnotation || key == MigrationRunIDAnnotation || key == lastAppliedConfigAnnotation
+	})
+}
+
+// GeneratedHash returns the content hash of the generated ingress resource
+func GeneratedHash(ing networking.Ingress) string {
+	ing = *ing.DeepCopy()
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for i := range rule.HTTP.Paths {
+			if rule.HTTP.Paths[i].PathType == nil {
+				pathType := networking.PathTypeImplementationSpecific
+				rule.HTTP.Paths[i].PathType = &pathType
+			}
+		}
+	}
+	return contentHash(ing, func(key string) bool {
+		return key == MigrationRunIDLabel || key == VersionLabel || key == SourceHashAnnotation || key == GeneratedHashAnnotation
+	})
+}
+
+// SetContentHashes sets the content hashes of the source and the generated ingress resource on the generated ingress resource
+func SetContentHashes(ing *networking.Ingress, sourceHash string) {
+	if ing.Annotations == nil {
+		ing.Annotations = map[string]string{}
+	}
+	ing.Annotations[SourceHashAnnotation] = sourceHash
+	ing.Annotations[GeneratedHashAnnotation] = GeneratedHash(*ing)
+}
+
+// IsIngressUnchanged returns true if the current ingress resource has the content of the generated one
+func IsIngressUnchanged(current *networking.Ingress, generated networking.Ingress) bool {
+	if current == nil || generated.Annotations[SourceHashAnnotation] == "" || generated.Annotations[GeneratedHashAnnotation] == "" {
+		return false
+	}
+	return current.Annotations[SourceHashAnnotation] == generated.Annotations[SourceHashAnnotation] &&
+		current.Annotations[GeneratedHashAnnotation] == generated.Annotations[GeneratedHashAnnotation] &&
+		GeneratedHash(*current) == current.Annotations[GeneratedHashAnnotation]
+}
+
+// contentHash returns the sha256 hash of the spec, labels and annotations of the ingress resource without the ignored keys
+func contentHash(ing networking.Ingress, ignored func(key string) bool) string {
+	filter := func(values map[string]string) map[string]string {
+		filtered := map[string]string{}
+		for key, value := range values {
+			if !ignored(key) {
+				filtered[key] = value
+			}
+		}
+		return filtered
+	}
+	// the keys of the maps are sorted by encoding/json, so the hash does not depend on their order
+	content, err := json.Marshal(hashedIngress{Labels: filter(ing.Labels), Annotations: filter(ing.Annotations), Spec: ing.Spec})
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(content))
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v12 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1beta1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newHashTestIngress() networking.Ingress {
+	return networking.Ingress{
+		ObjectMeta: v1.ObjectMeta{
+			Name:        "tea-ingress",
+			Namespace:   "default",
+			Labels:      map[string]string{"app": "tea"},
+			Annotations: map[string]string{IngressClassAnnotation: "iks-nginx"},
+		},
+		Spec: networking.IngressSpec{
+			Rules: []networking.IngressRule{{Host: "tea.example.com"}},
+		},
+	}
+}
+
+func TestSourceHash(t *testing.T) {
+	ing := newHashTestIngress()
+	hash := SourceHash(ing)
+	assert.Len(t, hash, 64)
+
+	testCases := []struct {
+		description string
+		change      func(ing *networking.Ingress)
+		changed     bool
+	}{
+		{
+			description: "resource version and status",
+			change: func(ing *networking.Ingress) {
+				ing.ResourceVersion = "42"
+				ing.Status.LoadBalancer.Ingress = []v12.LoadBalancerIngress{{IP: "10.0.0.1"}}
+			},
+		},
+		{
+			description: "back-reference annotations of the migration tool",
+			change: func(ing *networking.Ingress) {
+				setSourceAnnotations(&ing.ObjectMeta, map[string]string{MigratedToAnnotation: "tea-ingress-server", MigrationRunIDAnnotation: "20221014-093512-x7k2pq"})
+			},
+		},
+		{
+			description: "last applied configuration of kubectl",
+			change: func(ing *networking.Ingress) {
+				ing.Annotations[lastAppliedConfigAnnotation] = "{}"
+			},
+		},
+		{
+			description: "annotation",
+			change: func(ing *networking.Ingress) {
+				ing.Annotations["ingress.bluemix.net/redirect-to-https"] = "True"
+			},
+			changed: true,
+		},
+		{
+			description: "acknowledged warnings annotation",
+			change: func(ing *networking.Ingress) {
+				ing.Annotations[AcknowledgedWarningsAnnotation] = `[{"code": "HSTS_UNSUPPORTED", "reason": "planned", "expires": "2023-06-30"}]`
+			},
+			changed: true,
+		},
+		{
+			description: "label",
+			change: func(ing *networking.Ingress) {
+				ing.Labels["team"] = "tea"
+			},
+			changed: true,
+		},
+		{
+			description: "spec",
+			change: func(ing *networking.Ingress) {
+				ing.Spec.Rules[0].Host = "green-tea.example.com"
+			},
+			changed: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			changedIng := newHashTestIngress()
+			tc.change(&changedIng)
+			assert.Equal(t, tc.changed, SourceHash(changedIng) != hash)
+		})
+	}
+}
+
+func TestSetContentHashes(t *testing.T) {
+	defer SetRunID(GetRunID())
+
+	generate := func(runID string) networking.Ingress {
+		SetRunID(runID)
+		ing := newHashTestIngress()
+		ing.Name = "tea-ingress-server"
+		SetProvenance(&ing.ObjectMeta, &v1.ObjectMeta{Name: "tea-ingress", Namespace: "default"})
+		SetContentHashes(&ing, "source-hash")
+		return ing
+	}
+
+	current := generate("20221014-093512-x7k2pq")
+	assert.Equal(t, "source-hash", current.Annotations[SourceHashAnnotation])
+	assert.Len(t, current.Annotations[GeneratedHashAnnotation], 64)
+
+	// the run ID is not covered by the hash
+	generated := generate("20221015-101010-abcdef")
+	assert.Equal(t, current.Annotations[GeneratedHashAnnotation], generated.Annotations[GeneratedHashAnnotation])
+
+	// the hash does not cover itself
+	SetContentHashes(&generated, "source-hash")
+	assert.Equal(t, current.Annotations[GeneratedHashAnnotation], generated.Annotations[GeneratedHashAnnotation])
+}
+
+func TestIsIngressUnchanged(t *testing.T) {
+	generate := func(host, sourceHash string) networking.Ingress {
+		ing := newHashTestIngress()
+		ing.Spec.Rules[0].Host = host
+		ing.Spec.Rules[0].HTTP = &networking.HTTPIngressRuleValue{Paths: []networking.HTTPIngressPath{{Path: "/tea"}}}
+		SetContentHashes(&ing, sourceHash)
+		return ing
+	}
+	current := generate("tea.example.com", "source-hash")
+	edited := *current.DeepCopy()
+	edited.Spec.Rules[0].HTTP.Paths[0].Path = "/edited"
+	defaulted := *current.DeepCopy()
+	pathType := networking.PathTypeImplementationSpecific
+	defaulted.Spec.Rules[0].HTTP.Paths[0].PathType = &pathType
+
+	testCases := []struct {
+		description string
+		current     *networking.Ingress
+		generated   networking.Ingress
+		expected    bool
+	}{
+		{
+			description: "ingress resource does not exist",
+			generated:   generate("tea.example.com", "source-hash"),
+		},
+		{
+			description: "unchanged",
+			current:     &current,
+			generated:   generate("tea.example.com", "source-hash"),
+			expected:    true,
+		},
+		{
+			description: "current ingress resource was edited by hand",
+			current:     &edited,
+			generated:   generate("tea.example.com", "source-hash"),
+		},
+		{
+			description: "path type defaulted by the API server",
+			current:     &defaulted,
+			generated:   generate("tea.example.com", "source-hash"),
+			expected:    true,
+		},
+		{
+			description: "source changed",
+			current:     &current,
+			generated:   generate("tea.example.com", "changed-source-hash"),
+		},
+		{
+			description: "generated ingress resource changed",
+			current:     &current,
+			generated:   generate("green-tea.example.com", "source-hash"),
+		},
+		{
+			description: "current ingress resource was not generated with hashes",
+			current:     &networking.Ingress{ObjectMeta: v1.ObjectMeta{Name: "tea-ingress"}},
+			generated:   generate("tea.example.com", "source-hash"),
+		},
+		{
+			description: "generated ingress resource without source hash",
+			current:     &current,
+			generated:   generate("tea.example.com", ""),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expected, IsIngressUnchanged(tc.current, tc.generated))
+		})
+	}
+}
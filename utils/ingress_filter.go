@@ -0,0 +1,100 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	networking "k8s.io/api/networking/v1beta1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// IsIngressFilterEmpty returns true if the filter selects every ingress resource, i.e. the migration is not partial
+func IsIngressFilterEmpty(filter model.IngressFilter) bool {
+	return len(filter.Namespaces) == 0 && len(filter.ExcludedNamespaces) == 0 && filter.Selector == "" && len(filter.Names) == 0
+}
+
+// ValidateIngressFilter checks the syntax of the label selector and the name patterns of the filter
+func ValidateIngressFilter(filter model.IngressFilter) error {
+	if _, err := labels.Parse(filter.Selector); err != nil {
+		return fmt.Errorf("invalid label selector '%s': %v", filter.Selector, err)
+	}
+	for _, pattern := range filter.Names {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid name pattern '%s': %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// IngressFilterListOptions returns the list options that select the ingress resources of the filter
+func IngressFilterListOptions(filter model.IngressFilter) v1.ListOptions {
+	var fieldSelectors []fields.Selector
+	for _, namespace := range filter.ExcludedNamespaces {
+		fieldSelectors = append(fieldSelectors, fields.OneTermNotEqualSelector("metadata.namespace", namespace))
+	}
+
+	listOptions := v1.ListOptions{LabelSelector: filter.Selector}
+	if len(fieldSelectors) > 0 {
+		listOptions.FieldSelector = fields.AndSelectors(fieldSelectors...).String()
+	}
+	return listOptions
+}
+
+// MatchIngressFilter returns true if the ingress resource is selected by the filter
+func MatchIngressFilter(ingress networking.Ingress, filter model.IngressFilter) bool {
+	if len(filter.Namespaces) > 0 && !ItemInSlice(ingress.Namespace, filter.Namespaces) {
+		return false
+	}
+	if ItemInSlice(ingress.Namespace, filter.ExcludedNamespaces) {
+		return false
+	}
+
+	if filter.Selector != "" {
+		selector, err := labels.Parse(filter.Selector)
+		if err != nil || !selector.Matches(labels.Set(ingress.Labels)) {
+			return false
+		}
+	}
+
+	if len(filter.Names) == 0 {
+		return true
+	}
+	for _, pattern := range filter.Names {
+		name := ingress.Name
+		if strings.Contains(pattern, "/") {
+			name = ingress.Namespace + "/" + ingress.Name
+		}
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterIngresses returns the ingress resources selected by the filter
+func FilterIngresses(ingresses []networking.Ingress, filter model.IngressFilter) []networking.Ingress {
+	filtered := []networking.Ingress{}
+	for _, ingress := range ingresses {
+		if MatchIngressFilter(ingress, filter) {
+			filtered = append(filtered, ingress)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/stretchr/testify/assert"
+	networking "k8s.io/api/networking/v1beta1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMatchIngressFilter(t *testing.T) {
+	ingress := networking.Ingress{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "tea-ingress",
+			Namespace: "tea",
+			Labels:    map[string]string{"team": "tea", "env": "prod"},
+		},
+	}
+
+	testCases := []struct {
+		description   string
+		filter        model.IngressFilter
+		expectedMatch bool
+	}{
+		{
+			description:   "empty filter",
+			expectedMatch: true,
+		},
+		{
+			description:   "matching namespace",
+			filter:        model.IngressFilter{Namespaces: []string{"coffee", "tea"}},
+			expectedMatch: true,
+		},
+		{
+			description:   "unmatching namespace",
+			filter:        model.IngressFilter{Namespaces: []string{"coffee"}},
+			expectedMatch: false,
+		},
+		{
+			description:   "excluded namespace",
+			filter:        model.IngressFilter{ExcludedNamespaces: []string{"tea"}},
+			expectedMatch: false,
+		},
+		{
+			description:   "matching selector",
+			filter:        model.IngressFilter{Selector: "team=tea,env!=dev"},
+			expectedMatch: true,
+		},
+		{
+			description:   "unmatching selector",
+			filter:        model.IngressFilter{Selector: "team in (coffee)"},
+			expectedMatch: false,
+		},
+		{
+			description:   "matching name pattern",
+			filter:        model.IngressFilter{Names: []string{"coffee-*", "tea-*"}},
+			expectedMatch: true,
+		},
+		{
+			description:   "matching namespaced name pattern",
+			filter:        model.IngressFilter{Names: []string{"tea/*-ingress"}},
+			expectedMatch: true,
+		},
+		{
+			description:   "unmatching namespaced name pattern",
+			filter:        model.IngressFilter{Names: []string{"coffee/tea-*"}},
+			expectedMatch: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expectedMatch, MatchIngressFilter(ingress, tc.filter))
+		})
+	}
+}
+
+func TestIngressFilterListOptions(t *testing.T) {
+	assert.Equal(t, v1.ListOptions{}, IngressFilterListOptions(model.IngressFilter{Namespaces: []string{"tea"}, Names: []string{"tea-*"}}))
+	assert.Equal(t, v1.ListOptions{
+		LabelSelector: "team=tea",
+		FieldSelector: "metadata.namespace!=kube-system,metadata.namespace!=dev",
+	}, IngressFilterListOptions(model.IngressFilter{Selector: "team=tea", ExcludedNamespaces: []string{"kube-system", "dev"}}))
+}
+
+func TestValidateIngressFilter(t *testing.T) {
+	assert.NoError(t, ValidateIngressFilter(model.IngressFilter{Selector: "team=tea", Names: []string{"tea-*"}}))
+	assert.Error(t, ValidateIngressFilter(model.IngressFilter{Selector: "team in (tea"}))
+	assert.Error(t, ValidateIngressFilter(model.IngressFilter{Names: []string{"tea-["}}))
+}
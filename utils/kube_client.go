@@ -15,8 +15,8 @@ package utils
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
@@ -27,11 +27,10 @@ import (
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/apimachinery/pkg/util/wait"
 	clientset "k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
-	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
 // NetworkingIngressAvailable checks if the package "k8s.io/api/networking/v1beta1" is available or not
@@ -80,34 +79,89 @@ type kubeClient struct {
 	// if readOnly is set to true, then kubeClient will not create, update or delete anything on the target cluster
 	readOnly bool
 
+	// if dryRun is set to true, then kubeClient sends the create, update and delete requests with server-side dry-run
+	dryRun bool
+
+	// the requests failed with a transient error are sent again with this backoff, see the retryOnError function
+	retryBackoff wait.Backoff
+
+	// if recordEvents is set to true, then kubeClient records the outcome of the migration as events on the source ingress resources
+	recordEvents bool
+
 	// if recordResources is set to true, then kubeClient will save new or updated resources in the container variables below,
 	// so they can be used for dumping purposes when the migration process finished
 	recordResources    bool
+	containerMutex     sync.Mutex
 	ingressContainer   map[string]map[string]networkingv1.Ingress
 	configMapContainer map[string]map[string]v12.ConfigMap
 	secretContainer    map[string]map[string]v12.Secret
+
+	// unpersistedConfigMaps contains the configmaps owned by the migration tool written in read-only and dry-run mode
+	unpersistedConfigMaps map[string]v12.ConfigMap
 }
 
 type KubeClient interface {
-	GetConfigMap(name, namespace string) (*v12.ConfigMap, error)
-	CreateConfigMap(cm *v12.ConfigMap) error
+	GetConfigMap(ctx context.Context, name, namespace string) (*v12.ConfigMap, error)
+	CreateConfigMap(ctx context.Context, cm *v12.ConfigMap) error
 	IsNetworkingEnabled() bool
 	GetClient() *clientset.Clientset
-	GetIngressResources() ([]networking.Ingress, error)
-	CreateOrUpdateIngress(ing networking.Ingress) error
-	CreateOrUpdateStatusCm(migrationMode string, migratedResources []model.MigratedResource, subdomainMap map[string]string) error
-	DeleteStatusCm() error
-	UpdateConfigmap(cm *v12.ConfigMap) error
+	GetIngressResources(ctx context.Context, filter model.IngressFilter) ([]networking.Ingress, error)
+	GetIngress(ctx context.Context, name, namespace string) (*networking.Ingress, error)
+	CreateOrUpdateIngress(ctx context.Context, ing networking.Ingress) error
+	RecordUnchangedIngress(ing networking.Ingress)
+	DeleteIngress(ctx context.Context, name, namespace string) error
+	AnnotateIngress(ctx context.Context, name, namespace string, annotations map[string]string) error
+	RecordIngressEvents(ctx context.Context, ingress *networking.Ingress, events []IngressEvent) error
+	CreateOrUpdateStatusCm(ctx context.Context, migrationMode string, migratedResources []model.MigratedResource, subdomainMap map[string]string, scope *model.IngressFilter) error
+	RemoveFromStatusCm(ctx context.Context, migratedResources []model.MigratedResource) error
+	DeleteStatusCm(ctx context.Context) error
+	CreateOrUpdateBackupCm(ctx context.Context, backups []model.ResourceBackup) error
+	UpdateConfigmap(ctx context.Context, cm *v12.ConfigMap) error
+	DeleteConfigMap(ctx context.Context, name, namespace string) error
 	IsIngressEnhancementsEnabled() bool
-	GetSecret(name, namespace string) (*v12.Secret, error)
-	UpdateSecret(secret *v12.Secret) error
+	GetSecret(ctx context.Context, name, namespace string) (*v12.Secret, error)
+	UpdateSecret(ctx context.Context, secret *v12.Secret) error
 	GetIngressContainer() map[string]map[string]networkingv1.Ingress
 	GetConfigMapContainer() map[string]map[string]v12.ConfigMap
 	GetSecretContainer() map[string]map[string]v12.Secret
 }
 
-func NewKubeClient(kubeConfigPath string, readOnly bool, recordResources bool, logger *zap.Logger) (KubeClient, error) {
-	client, err := GetKubeClient(kubeConfigPath, logger)
+// KubeClientOptions contains the options of the KubeClient connecting to the cluster, see the fields of the kubeClient type
+type KubeClientOptions struct {
+	// KubeConfig and Context select the kubeconfig and its context, As and AsGroups set the impersonated user and groups
+	KubeConfig string
+	Context    string
+	As         string
+	AsGroups   []string
+
+	ReadOnly        bool
+	DryRun          bool
+	RecordResources bool
+	// RecordEvents enables the events on the source ingress resources, see the RecordIngressEvents function
+	RecordEvents bool
+	// QPS and Burst limit the rate of the requests sent to the API server, the client-go defaults are used if they are not set
+	QPS   float32
+	Burst int
+	// RequestTimeout limits a single request sent to the API server, the requests are also canceled with their context
+	RequestTimeout time.Duration
+	// Retries is the maximum number of the retries of a request failed with a transient error
+	Retries int
+}
+
+// ReportTimeout is the timeout of the requests recording the outcome of an interrupted operation, see the ReportContext function
+const ReportTimeout = 10 * time.Second
+
+// ReportContext returns the context of the requests recording the outcome of the operation
+func ReportContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx.Err() == nil {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(context.Background(), ReportTimeout)
+}
+
+// NewKubeClient returns a KubeClient connecting to the cluster with the rest config, see the GetRestConfig function
+func NewKubeClient(config *rest.Config, options KubeClientOptions, logger *zap.Logger) (KubeClient, error) {
+	client, err := GetKubeClient(config, options, logger)
 	if err != nil {
 		logger.Error("error getting kubeclient", zap.Error(err))
 		return nil, err
@@ -120,10 +174,13 @@ func NewKubeClient(kubeConfigPath string, readOnly bool, recordResources bool, l
 		isNetworking:               isNetworking,
 		ingressEnhancementsEnabled: ingressEnhancementsEnabled,
 		v1IngressOnly:              v1IngressOnly,
-		readOnly:                   readOnly,
+		readOnly:                   options.ReadOnly,
+		dryRun:                     options.DryRun,
+		retryBackoff:               RetryBackoff(options.Retries),
+		recordEvents:               options.RecordEvents,
 	}
 
-	if recordResources {
+	if options.RecordResources {
 		kc.recordResources = true
 		kc.ingressContainer = make(map[string]map[string]networkingv1.Ingress)
 		kc.configMapContainer = make(map[string]map[string]v12.ConfigMap)
@@ -133,24 +190,16 @@ func NewKubeClient(kubeConfigPath string, readOnly bool, recordResources bool, l
 	return kc, nil
 }
 
-func GetKubeClient(kubeConfigPath string, logger *zap.Logger) (*clientset.Clientset, error) {
-	var config *rest.Config
-	if kubeConfigPath != "" {
-		logger.Info("got path for kubeconfig", zap.String("kubeConfigPath", kubeConfigPath))
-
-		var err error
-		if config, err = clientcmd.BuildConfigFromFlags("", kubeConfigPath); err != nil {
-			logger.Error("error getting rest config from kubeconfig", zap.Error(err))
-			return nil, err
-		}
-	} else {
-		var err error
-		if config, err = rest.InClusterConfig(); err != nil {
-			logger.Error("error getting in cluster rest config", zap.Error(err))
-			return nil, err
-		}
+// GetKubeClient returns the clientset of the cluster with the rate limits and the request timeout of the options
+func GetKubeClient(config *rest.Config, options KubeClientOptions, logger *zap.Logger) (*clientset.Clientset, error) {
+	config = rest.CopyConfig(config)
+	if options.QPS > 0 {
+		config.QPS = options.QPS
 	}
-	logger.Info("successfully got rest config")
+	if options.Burst > 0 {
+		config.Burst = options.Burst
+	}
+	config.Timeout = options.RequestTimeout
 
 	kubeClient, err := clientset.NewForConfig(config)
 	if err != nil {
@@ -162,21 +211,45 @@ func GetKubeClient(kubeConfigPath string, logger *zap.Logger) (*clientset.Client
 	return kubeClient, nil
 }
 
-func (k *kubeClient) GetConfigMap(name, namespace string) (*v12.ConfigMap, error) {
-	return k.client.CoreV1().ConfigMaps(namespace).Get(context.Background(), name, v1.GetOptions{})
+// retry sends the request with the retry policy of the kube client
+func (k *kubeClient) retry(ctx context.Context, operation string, request func() error) error {
+	return retryOnError(ctx, k.retryBackoff, k.logger, operation, func() error {
+		start := time.Now()
+		err := request()
+		observeAPIRequest(operation, start, err)
+		return err
+	})
+}
+
+// retryRequest sends the request returning a resource with the retry policy of the kube client
+func retryRequest[T any](ctx context.Context, k *kubeClient, operation string, request func() (T, error)) (T, error) {
+	var result T
+	err := k.retry(ctx, operation, func() (err error) {
+		result, err = request()
+		return err
+	})
+	return result, err
 }
 
-func (k *kubeClient) CreateConfigMap(cm *v12.ConfigMap) error {
+func (k *kubeClient) GetConfigMap(ctx context.Context, name, namespace string) (*v12.ConfigMap, error) {
+	return retryRequest(ctx, k, "get configmap", func() (*v12.ConfigMap, error) {
+		return k.client.CoreV1().ConfigMaps(namespace).Get(ctx, name, v1.GetOptions{})
+	})
+}
 
-	if k.recordResources {
-		if _, nsExists := k.configMapContainer[cm.GetNamespace()]; !nsExists {
-			k.configMapContainer[cm.GetNamespace()] = make(map[string]v12.ConfigMap)
-		}
-		k.configMapContainer[cm.GetNamespace()][cm.GetName()] = *cm
-	}
+func (k *kubeClient) CreateConfigMap(ctx context.Context, cm *v12.ConfigMap) error {
+	k.recordConfigMap(*cm)
 
 	if !k.readOnly {
-		_, err := k.client.CoreV1().ConfigMaps(cm.ObjectMeta.Namespace).Create(context.Background(), cm, v1.CreateOptions{})
+		// the apply request creates or updates the configmap, so the existence is checked first
+		_, err := k.GetConfigMap(ctx, cm.Name, cm.Namespace)
+		if err == nil {
+			return k8sErrors.NewAlreadyExists(v12.Resource("configmaps"), cm.Name)
+		}
+		if !k8sErrors.IsNotFound(err) {
+			return err
+		}
+		_, err = k.applyConfigMap(ctx, cm, false)
 		return err
 	}
 
@@ -191,15 +264,40 @@ func (k *kubeClient) GetClient() *clientset.Clientset {
 	return k.client
 }
 
-func (k *kubeClient) GetIngressResources() ([]networking.Ingress, error) {
+// GetIngressResources returns the ingress resources selected by the filter
+func (k *kubeClient) GetIngressResources(ctx context.Context, filter model.IngressFilter) ([]networking.Ingress, error) {
+	logger := k.logger
+	logger.Info("getIngressResources: Getting the ingress resources", zap.Any("filter", filter))
+
+	namespaces := filter.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+
+	ingresses := []networking.Ingress{}
+	for _, namespace := range namespaces {
+		nsIngresses, err := k.listIngressResources(ctx, namespace, IngressFilterListOptions(filter))
+		if err != nil {
+			return nil, err
+		}
+		ingresses = append(ingresses, nsIngresses...)
+	}
+	logger.Info("successfully got ingress resources from cluster")
+
+	return FilterIngresses(ingresses, filter), nil
+}
+
+// listIngressResources lists the ingress resources of the namespace (all namespaces if empty) in v1beta1 format
+func (k *kubeClient) listIngressResources(ctx context.Context, namespace string, listOptions v1.ListOptions) ([]networking.Ingress, error) {
 	logger := k.logger
-	logger.Info("getIngressResources: Getting all the ingress resources")
 
 	ingressList := &networking.IngressList{
 		Items: []networking.Ingress{},
 	}
 	if k.v1IngressOnly {
-		v1IngressList, err := k.GetClient().NetworkingV1().Ingresses("").List(context.Background(), v1.ListOptions{})
+		v1IngressList, err := retryRequest(ctx, k, "list ingresses", func() (*networkingv1.IngressList, error) {
+			return k.GetClient().NetworkingV1().Ingresses(namespace).List(ctx, listOptions)
+		})
 		if err != nil {
 			logger.Error("err getting ingress resources", zap.Error(err))
 			return nil, err
@@ -209,7 +307,6 @@ func (k *kubeClient) GetIngressResources() ([]networking.Ingress, error) {
 			logger.Error("error getting ingress resources, ingress list was nil")
 			return nil, fmt.Errorf("ingress list was nil")
 		}
-		logger.Info("successfully got ingress resources from cluster")
 		for _, v1Ingress := range v1IngressList.Items {
 			v1beta1Ingress := convertV1ToV1Beta1Ingress(v1Ingress, k.ingressEnhancementsEnabled)
 			ingressList.Items = append(ingressList.Items, v1beta1Ingress)
@@ -217,7 +314,9 @@ func (k *kubeClient) GetIngressResources() ([]networking.Ingress, error) {
 		return ingressList.Items, err
 	}
 
-	ingressList, err := k.GetClient().NetworkingV1beta1().Ingresses("").List(context.Background(), v1.ListOptions{})
+	ingressList, err := retryRequest(ctx, k, "list ingresses", func() (*networking.IngressList, error) {
+		return k.GetClient().NetworkingV1beta1().Ingresses(namespace).List(ctx, listOptions)
+	})
 	if err != nil {
 		logger.Error("err getting ingress resources", zap.Error(err))
 		return nil, err
@@ -227,195 +326,336 @@ func (k *kubeClient) GetIngressResources() ([]networking.Ingress, error) {
 		logger.Error("error getting ingress resources, ingress list was nil")
 		return nil, fmt.Errorf("ingress list was nil")
 	}
-	logger.Info("successfully got ingress resources from cluster")
 
 	return ingressList.Items, err
 }
 
-func (k *kubeClient) CreateOrUpdateIngress(ing networking.Ingress) error {
-	if k.recordResources {
-		v1ing := convertV1Beta1ToV1Ingress(ing)
-		if _, nsExists := k.ingressContainer[v1ing.GetNamespace()]; !nsExists {
-			k.ingressContainer[ing.GetNamespace()] = make(map[string]networkingv1.Ingress)
+// GetIngress returns the ingress resource in v1beta1 format
+func (k *kubeClient) GetIngress(ctx context.Context, name, namespace string) (*networking.Ingress, error) {
+	if k.v1IngressOnly {
+		v1Ingress, err := retryRequest(ctx, k, "get ingress", func() (*networkingv1.Ingress, error) {
+			return k.GetClient().NetworkingV1().Ingresses(namespace).Get(ctx, name, v1.GetOptions{})
+		})
+		if err != nil {
+			return nil, err
 		}
-		k.ingressContainer[ing.GetNamespace()][ing.GetName()] = v1ing
+		v1beta1Ingress := convertV1ToV1Beta1Ingress(*v1Ingress, k.ingressEnhancementsEnabled)
+		return &v1beta1Ingress, nil
 	}
+	return retryRequest(ctx, k, "get ingress", func() (*networking.Ingress, error) {
+		return k.GetClient().NetworkingV1beta1().Ingresses(namespace).Get(ctx, name, v1.GetOptions{})
+	})
+}
+
+func (k *kubeClient) CreateOrUpdateIngress(ctx context.Context, ing networking.Ingress) error {
+	k.recordIngress(ing)
 
 	if !k.readOnly {
-		if k.v1IngressOnly {
-			v1Ingress := convertV1Beta1ToV1Ingress(ing)
-			_, err := k.GetClient().NetworkingV1().Ingresses(ing.Namespace).Create(context.Background(), &v1Ingress, v1.CreateOptions{})
-			if err != nil && k8sErrors.IsAlreadyExists(err) {
-				_, err = k.GetClient().NetworkingV1().Ingresses(ing.Namespace).Update(context.Background(), &v1Ingress, v1.UpdateOptions{})
-				return err
-			}
-			return err
-		}
-		_, err := k.GetClient().NetworkingV1beta1().Ingresses(ing.Namespace).Create(context.Background(), &ing, v1.CreateOptions{})
-		if err != nil && k8sErrors.IsAlreadyExists(err) {
-			_, err = k.GetClient().NetworkingV1beta1().Ingresses(ing.Namespace).Update(context.Background(), &ing, v1.UpdateOptions{})
-			return err
-		}
-		return err
+		return k.applyIngress(ctx, ing)
 	}
 
 	return nil
 }
 
-func (k *kubeClient) CreateOrUpdateStatusCm(migrationModeUpdate string, migratedResourcesUpdate []model.MigratedResource, subdomainMapUpdate map[string]string) error {
-	var statusCmPresent bool
-	var migratedResources []model.MigratedResource
-	var subdomainMap map[string]string
-	var migrationMode string
+func (k *kubeClient) DeleteIngress(ctx context.Context, name, namespace string) error {
+	k.forgetIngress(name, namespace)
 
-	var statusCm *v12.ConfigMap
-	if k.readOnly {
-		if nsCms, nsExists := k.configMapContainer[KubeSystem]; nsExists {
-			if cm, cmExists := nsCms[MigrationStatusConfigMapName]; cmExists {
-				statusCm = &cm
+	if !k.readOnly {
+		return k.retry(ctx, "delete ingress", func() error {
+			if k.v1IngressOnly {
+				return k.GetClient().NetworkingV1().Ingresses(namespace).Delete(ctx, name, k.deleteOptions())
 			}
-		}
-	} else {
-		cm, err := k.client.CoreV1().ConfigMaps(KubeSystem).Get(context.Background(), MigrationStatusConfigMapName, v1.GetOptions{})
-		if err != nil && !k8sErrors.IsNotFound(err) {
-			return err
-		}
-		if err == nil {
-			statusCm = cm
-		}
+			return k.GetClient().NetworkingV1beta1().Ingresses(namespace).Delete(ctx, name, k.deleteOptions())
+		})
 	}
 
-	if statusCm != nil {
-		statusCmPresent = true
-		if statusCm.Data[MigratedResourcesParameterName] != "" {
-			if err := json.Unmarshal([]byte(statusCm.Data[MigratedResourcesParameterName]), &migratedResources); err != nil {
-				return err
-			}
-		}
-		if statusCm.Data[SubdomainMapParameterName] != "" {
-			if err := json.Unmarshal([]byte(statusCm.Data[SubdomainMapParameterName]), &subdomainMap); err != nil {
-				return err
-			}
-		}
-		migrationMode = statusCm.Data[MigrationModeParameterName]
-	}
+	return nil
+}
 
-	migratedResourcesJSON, err := json.Marshal(append(migratedResources, migratedResourcesUpdate...))
+// RecordUnchangedIngress records the generated ingress resource that is not applied, because it is unchanged
+func (k *kubeClient) RecordUnchangedIngress(ing networking.Ingress) {
+	k.recordIngress(ing)
+}
+
+// AnnotateIngress sets the back-reference annotations on the source ingress resource
+func (k *kubeClient) AnnotateIngress(ctx context.Context, name, namespace string, annotations map[string]string) error {
+	ing, err := k.GetIngress(ctx, name, namespace)
 	if err != nil {
 		return err
 	}
+	setSourceAnnotations(&ing.ObjectMeta, annotations)
+	k.recordIngress(*ing)
 
-	if subdomainMap == nil {
-		subdomainMap = make(map[string]string)
+	if !k.readOnly {
+		return k.applyIngressAnnotations(ctx, name, namespace, annotations)
 	}
 
-	for userSubdomain, testSubdomain := range subdomainMapUpdate {
-		subdomainMap[userSubdomain] = testSubdomain
+	return nil
+}
+
+// CreateOrUpdateStatusCm merges the migration status update into the status configmap and its shards
+func (k *kubeClient) CreateOrUpdateStatusCm(ctx context.Context, migrationModeUpdate string, migratedResourcesUpdate []model.MigratedResource, subdomainMapUpdate map[string]string, scopeUpdate *model.IngressFilter) error {
+	return RetryOnConflict(func() error {
+		return updateStatusStore(kubeStatusConfigMaps{ctx: ctx, k: k}, migrationModeUpdate, migratedResourcesUpdate, subdomainMapUpdate, scopeUpdate)
+	})
+}
+
+// kubeStatusConfigMaps reads and writes the configmaps of the migration status on the cluster
+type kubeStatusConfigMaps struct {
+	ctx context.Context
+	k   *kubeClient
+}
+
+func (c kubeStatusConfigMaps) current(name string) (*v12.ConfigMap, error) {
+	return c.k.currentConfigMap(c.ctx, name, KubeSystem)
+}
+
+func (c kubeStatusConfigMaps) apply(cm *v12.ConfigMap, removedKeys []string) error {
+	SetProvenance(&cm.ObjectMeta, nil)
+	c.k.recordConfigMap(*cm)
+	c.k.keepUnpersistedConfigMap(cm)
+	if c.k.readOnly {
+		return nil
 	}
-	subdomainMapJSON, err := json.Marshal(subdomainMap)
+	// the configmaps of the status are owned by the migration tool, the ownership of the fields set by earlier versions is taken over
+	resourceVersion, err := c.k.applyConfigMap(c.ctx, cm, true)
 	if err != nil {
 		return err
 	}
+	return c.k.removeKeys(c.ctx, ConfigMapKind, cm.Namespace, cm.Name, resourceVersion, removedKeys)
+}
 
-	if migrationMode != "" && migrationMode != migrationModeUpdate {
-		return fmt.Errorf("migration mode should not be changed from '%s' to '%s' during a single run", migrationMode, migrationModeUpdate)
-	}
+func (c kubeStatusConfigMaps) delete(name string) error {
+	c.k.forgetUnpersistedConfigMap(name, KubeSystem)
+	return c.k.retry(c.ctx, "delete configmap", func() error {
+		return c.k.client.CoreV1().ConfigMaps(KubeSystem).Delete(c.ctx, name, c.k.deleteOptions())
+	})
+}
 
-	data := map[string]string{
-		MigratedResourcesParameterName:    string(migratedResourcesJSON),
-		LastUpdatesTimestampParameterName: time.Now().Format(time.RFC3339Nano),
-		SubdomainMapParameterName:         string(subdomainMapJSON),
-		MigrationModeParameterName:        string(migrationModeUpdate),
+// currentConfigMap returns the current state of a configmap owned by the migration tool, or nil if it does not exist
+func (k *kubeClient) currentConfigMap(ctx context.Context, name, namespace string) (*v12.ConfigMap, error) {
+	if k.readOnly || k.dryRun {
+		return k.unpersistedConfigMap(name, namespace), nil
+	}
+	cm, err := k.GetConfigMap(ctx, name, namespace)
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
 	}
-	if statusCmPresent {
-		statusCm.Data = data
+	return cm, nil
+}
 
-		if k.recordResources {
-			if _, nsExists := k.configMapContainer[statusCm.GetNamespace()]; !nsExists {
-				k.configMapContainer[statusCm.GetNamespace()] = make(map[string]v12.ConfigMap)
-			}
-			k.configMapContainer[statusCm.GetNamespace()][statusCm.GetName()] = *statusCm
+// upsertMigratedResources replaces the recorded migrated resources with their updates, and appends the new ones
+func upsertMigratedResources(migratedResources, updates []model.MigratedResource) []model.MigratedResource {
+	indexes := map[string]int{}
+	for i, migratedResource := range migratedResources {
+		indexes[migratedResourceKey(migratedResource)] = i
+	}
+	for _, update := range updates {
+		key := migratedResourceKey(update)
+		if i, recorded := indexes[key]; recorded {
+			migratedResources[i] = update
+			continue
 		}
+		indexes[key] = len(migratedResources)
+		migratedResources = append(migratedResources, update)
+	}
+	return migratedResources
+}
 
-		if !k.readOnly {
-			if _, err = k.GetClient().CoreV1().ConfigMaps(KubeSystem).Update(context.Background(), statusCm, v1.UpdateOptions{}); err != nil {
-				return err
-			}
+// migratedResourceKey identifies the migrated resource in the migration status
+func migratedResourceKey(migratedResource model.MigratedResource) string {
+	return migratedResource.Kind + "/" + migratedResource.Namespace + "/" + migratedResource.Name
+}
+
+// RemoveFromStatusCm removes the migrated resources from the migration status, see the removeFromStatusStore function
+func (k *kubeClient) RemoveFromStatusCm(ctx context.Context, migratedResources []model.MigratedResource) error {
+	return RetryOnConflict(func() error {
+		return removeFromStatusStore(kubeStatusConfigMaps{ctx: ctx, k: k}, migratedResources)
+	})
+}
+
+// DeleteStatusCm deletes the status configmap and its shards
+func (k *kubeClient) DeleteStatusCm(ctx context.Context) error {
+	if !k.readOnly {
+		return deleteStatusStore(kubeStatusConfigMaps{ctx: ctx, k: k})
+	}
+	return nil
+}
+
+// CreateOrUpdateBackupCm records the original state of the resources in the backup configmap
+func (k *kubeClient) CreateOrUpdateBackupCm(ctx context.Context, backupsUpdate []model.ResourceBackup) error {
+	return RetryOnConflict(func() error {
+		backupCm, err := k.currentConfigMap(ctx, MigrationBackupConfigMapName, KubeSystem)
+		if err != nil {
+			return err
 		}
-	} else {
-		newStatusCm := v12.ConfigMap{
-			ObjectMeta: v1.ObjectMeta{
-				Name:      MigrationStatusConfigMapName,
-				Namespace: KubeSystem,
-			},
-			Data: data,
+
+		data, err := mergeBackupCmData(backupCm, backupsUpdate)
+		if err != nil {
+			return err
 		}
 
-		if k.recordResources {
-			if _, nsExists := k.configMapContainer[newStatusCm.GetNamespace()]; !nsExists {
-				k.configMapContainer[newStatusCm.GetNamespace()] = make(map[string]v12.ConfigMap)
-			}
-			k.configMapContainer[newStatusCm.GetNamespace()][newStatusCm.GetName()] = newStatusCm
+		if backupCm == nil {
+			cm := newBackupCm(data)
+			backupCm = &cm
 		}
+		backupCm.Data = data
+		SetProvenance(&backupCm.ObjectMeta, nil)
+
+		k.recordConfigMap(*backupCm)
+		k.keepUnpersistedConfigMap(backupCm)
 
 		if !k.readOnly {
-			if _, err = k.GetClient().CoreV1().ConfigMaps(newStatusCm.ObjectMeta.Namespace).Create(context.Background(), &newStatusCm, v1.CreateOptions{}); err != nil {
-				return err
-			}
+			// the backup configmap is owned by the migration tool, the ownership of the fields set by earlier versions is taken over
+			_, err = k.applyConfigMap(ctx, backupCm, true)
+			return err
 		}
+
+		return nil
+	})
+}
+
+func (k *kubeClient) UpdateConfigmap(ctx context.Context, cm *v12.ConfigMap) error {
+	k.recordConfigMap(*cm)
+
+	if !k.readOnly {
+		return k.applyConfigMapKeys(ctx, cm)
 	}
 
 	return nil
 }
 
-func (k *kubeClient) DeleteStatusCm() error {
+func (k *kubeClient) DeleteConfigMap(ctx context.Context, name, namespace string) error {
+	k.forgetConfigMap(name, namespace)
+
 	if !k.readOnly {
-		return k.client.CoreV1().ConfigMaps(KubeSystem).Delete(context.Background(), MigrationStatusConfigMapName, v1.DeleteOptions{})
+		return k.retry(ctx, "delete configmap", func() error {
+			return k.GetClient().CoreV1().ConfigMaps(namespace).Delete(ctx, name, k.deleteOptions())
+		})
+	}
+
+	return nil
+}
+
+// dryRunOption returns the value of the DryRun field of the request options
+func (k *kubeClient) dryRunOption() []string {
+	if k.dryRun {
+		return []string{v1.DryRunAll}
 	}
 	return nil
 }
 
-func (k *kubeClient) UpdateConfigmap(cm *v12.ConfigMap) error {
+func (k *kubeClient) deleteOptions() v1.DeleteOptions {
+	return v1.DeleteOptions{DryRun: k.dryRunOption()}
+}
 
-	if k.recordResources {
-		if _, nsExists := k.configMapContainer[cm.GetNamespace()]; !nsExists {
-			k.configMapContainer[cm.GetNamespace()] = make(map[string]v12.ConfigMap)
-		}
-		k.configMapContainer[cm.GetNamespace()][cm.GetName()] = *cm
-	}
+func (k *kubeClient) IsIngressEnhancementsEnabled() bool {
+	return k.ingressEnhancementsEnabled
+}
+
+func (k *kubeClient) GetSecret(ctx context.Context, name, namespace string) (*v12.Secret, error) {
+	return retryRequest(ctx, k, "get secret", func() (*v12.Secret, error) {
+		return k.client.CoreV1().Secrets(namespace).Get(ctx, name, v1.GetOptions{})
+	})
+}
+
+func (k *kubeClient) UpdateSecret(ctx context.Context, secret *v12.Secret) error {
+	k.recordSecret(*secret)
 
 	if !k.readOnly {
-		_, err := k.GetClient().CoreV1().ConfigMaps(cm.Namespace).Update(context.Background(), cm, v1.UpdateOptions{})
-		return err
+		return k.applySecretKeys(ctx, secret)
 	}
 
 	return nil
 }
 
-func (k *kubeClient) IsIngressEnhancementsEnabled() bool {
-	return k.ingressEnhancementsEnabled
+func (k *kubeClient) recordIngress(ing networking.Ingress) {
+	if !k.recordResources {
+		return
+	}
+	k.containerMutex.Lock()
+	defer k.containerMutex.Unlock()
+	if _, nsExists := k.ingressContainer[ing.GetNamespace()]; !nsExists {
+		k.ingressContainer[ing.GetNamespace()] = make(map[string]networkingv1.Ingress)
+	}
+	k.ingressContainer[ing.GetNamespace()][ing.GetName()] = convertV1Beta1ToV1Ingress(ing)
 }
 
-func (k *kubeClient) GetSecret(name, namespace string) (*v12.Secret, error) {
-	return k.client.CoreV1().Secrets(namespace).Get(context.Background(), name, v1.GetOptions{})
+func (k *kubeClient) forgetIngress(name, namespace string) {
+	if !k.recordResources {
+		return
+	}
+	k.containerMutex.Lock()
+	defer k.containerMutex.Unlock()
+	delete(k.ingressContainer[namespace], name)
 }
 
-func (k *kubeClient) UpdateSecret(secret *v12.Secret) error {
-	if k.recordResources {
-		if _, nsExists := k.secretContainer[secret.GetNamespace()]; !nsExists {
-			k.secretContainer[secret.GetNamespace()] = make(map[string]v12.Secret)
-		}
-		k.secretContainer[secret.GetNamespace()][secret.GetName()] = *secret
+func (k *kubeClient) recordConfigMap(cm v12.ConfigMap) {
+	if !k.recordResources {
+		return
+	}
+	k.containerMutex.Lock()
+	defer k.containerMutex.Unlock()
+	if _, nsExists := k.configMapContainer[cm.GetNamespace()]; !nsExists {
+		k.configMapContainer[cm.GetNamespace()] = make(map[string]v12.ConfigMap)
 	}
+	k.configMapContainer[cm.GetNamespace()][cm.GetName()] = cm
+}
 
-	if !k.readOnly {
-		_, err := k.GetClient().CoreV1().Secrets(secret.Namespace).Update(context.Background(), secret, v1.UpdateOptions{})
-		return err
+// keepUnpersistedConfigMap keeps a copy of the configmap in memory in read-only and dry-run mode
+func (k *kubeClient) keepUnpersistedConfigMap(cm *v12.ConfigMap) {
+	if !k.readOnly && !k.dryRun {
+		return
 	}
+	k.containerMutex.Lock()
+	defer k.containerMutex.Unlock()
+	if k.unpersistedConfigMaps == nil {
+		k.unpersistedConfigMaps = map[string]v12.ConfigMap{}
+	}
+	k.unpersistedConfigMaps[cm.Namespace+"/"+cm.Name] = *cm.DeepCopy()
+}
 
+// forgetUnpersistedConfigMap removes the configmap kept in memory
+func (k *kubeClient) forgetUnpersistedConfigMap(name, namespace string) {
+	k.containerMutex.Lock()
+	defer k.containerMutex.Unlock()
+	delete(k.unpersistedConfigMaps, namespace+"/"+name)
+}
+
+// unpersistedConfigMap returns a copy of the configmap kept in memory, or nil if the configmap was not kept
+func (k *kubeClient) unpersistedConfigMap(name, namespace string) *v12.ConfigMap {
+	k.containerMutex.Lock()
+	defer k.containerMutex.Unlock()
+	if cm, cmExists := k.unpersistedConfigMaps[namespace+"/"+name]; cmExists {
+		return cm.DeepCopy()
+	}
 	return nil
 }
 
+func (k *kubeClient) forgetConfigMap(name, namespace string) {
+	if !k.recordResources {
+		return
+	}
+	k.containerMutex.Lock()
+	defer k.containerMutex.Unlock()
+	delete(k.configMapContainer[namespace], name)
+}
+
+func (k *kubeClient) recordSecret(secret v12.Secret) {
+	if !k.recordResources {
+		return
+	}
+	k.containerMutex.Lock()
+	defer k.containerMutex.Unlock()
+	if _, nsExists := k.secretContainer[secret.GetNamespace()]; !nsExists {
+		k.secretContainer[secret.GetNamespace()] = make(map[string]v12.Secret)
+	}
+	k.secretContainer[secret.GetNamespace()][secret.GetName()] = secret
+}
+
 func (k *kubeClient) GetIngressContainer() map[string]map[string]networkingv1.Ingress {
 	return k.ingressContainer
 }
@@ -425,7 +665,3 @@ func (k *kubeClient) GetConfigMapContainer() map[string]map[string]v12.ConfigMap
 func (k *kubeClient) GetSecretContainer() map[string]map[string]v12.Secret {
 	return k.secretContainer
 }
-
-func LoadKubeConfig(path string) (*clientcmdapi.Config, error) {
-	return clientcmd.LoadFromFile(path)
-}
@@ -0,0 +1,373 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	v12 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// fakeConfigMapServer serves the configmaps of the kube-system namespace like the API server: the resource version
+// is increased on every change, and the requests with an outdated resource version are rejected with a conflict
+type fakeConfigMapServer struct {
+	mutex      sync.Mutex
+	configMaps map[string]*v12.ConfigMap
+	version    int
+	// failures are returned for the next requests, before the requests are served
+	failures []*k8sErrors.StatusError
+	// beforePatch is called before a patch request is served, e.g. to change the configmap concurrently
+	beforePatch func(s *fakeConfigMapServer, name string)
+	requests    []string
+}
+
+func (s *fakeConfigMapServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.requests = append(s.requests, r.Method)
+	if len(s.failures) > 0 {
+		failure := s.failures[0]
+		s.failures = s.failures[1:]
+		writeStatus(w, failure)
+		return
+	}
+
+	name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	switch r.Method {
+	case http.MethodGet:
+		cm, exists := s.configMaps[name]
+		if !exists {
+			writeStatus(w, k8sErrors.NewNotFound(v12.Resource("configmaps"), name))
+			return
+		}
+		writeObject(w, cm)
+	case http.MethodPatch:
+		if s.beforePatch != nil {
+			s.beforePatch(s, name)
+		}
+		body, _ := io.ReadAll(r.Body)
+		var patch v12.ConfigMap
+		_ = json.Unmarshal(body, &patch)
+
+		cm, exists := s.configMaps[name]
+		if !exists {
+			cm = &v12.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: name, Namespace: KubeSystem}, Data: map[string]string{}}
+		}
+		if patch.ResourceVersion != "" && patch.ResourceVersion != cm.ResourceVersion {
+			writeStatus(w, k8sErrors.NewConflict(v12.Resource("configmaps"), name, fmt.Errorf("the object has been modified")))
+			return
+		}
+		var removed struct {
+			Data map[string]*string `json:"data"`
+		}
+		_ = json.Unmarshal(body, &removed)
+		for key, value := range removed.Data {
+			if value == nil {
+				delete(cm.Data, key)
+			} else {
+				cm.Data[key] = *value
+			}
+		}
+		s.update(cm)
+		writeObject(w, cm)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// update stores the configmap with a new resource version
+func (s *fakeConfigMapServer) update(cm *v12.ConfigMap) {
+	s.version++
+	cm.ResourceVersion = strconv.Itoa(s.version)
+	s.configMaps[cm.Name] = cm
+}
+
+func writeObject(w http.ResponseWriter, cm *v12.ConfigMap) {
+	cm.TypeMeta = v1.TypeMeta{APIVersion: "v1", Kind: ConfigMapKind}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(cm)
+}
+
+func writeStatus(w http.ResponseWriter, err *k8sErrors.StatusError) {
+	status := err.ErrStatus
+	status.TypeMeta = v1.TypeMeta{APIVersion: "v1", Kind: "Status"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(int(status.Code))
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// newFakeServerKubeClient returns a kubeClient sending the requests to the fake server with short retry delays
+func newFakeServerKubeClient(t *testing.T, server *fakeConfigMapServer) *kubeClient {
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	client, err := clientset.NewForConfig(&rest.Config{Host: httpServer.URL})
+	assert.NoError(t, err)
+	return &kubeClient{
+		logger:       zap.NewNop(),
+		client:       client,
+		retryBackoff: wait.Backoff{Duration: time.Millisecond, Factor: 2, Steps: 2},
+	}
+}
+
+func TestKubeClientRetriesTransientErrors(t *testing.T) {
+	unavailable := k8sErrors.NewServiceUnavailable("the API server is shutting down")
+	internalError := k8sErrors.NewInternalError(fmt.Errorf("etcd leader changed"))
+
+	testCases := []struct {
+		description      string
+		failures         []*k8sErrors.StatusError
+		expectedError    bool
+		expectedRequests int
+	}{
+		{
+			description:      "no failures",
+			expectedRequests: 2,
+		},
+		{
+			description:      "get and patch failures are retried",
+			failures:         []*k8sErrors.StatusError{unavailable, internalError},
+			expectedRequests: 4,
+		},
+		{
+			description:      "retries exhausted",
+			failures:         []*k8sErrors.StatusError{unavailable, unavailable, unavailable},
+			expectedError:    true,
+			expectedRequests: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			server := &fakeConfigMapServer{configMaps: map[string]*v12.ConfigMap{}, failures: tc.failures}
+			server.update(&v12.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: K8sConfigMapName, Namespace: KubeSystem}, Data: map[string]string{"ssl-protocols": "TLSv1.2"}})
+			kc := newFakeServerKubeClient(t, server)
+
+			err := kc.UpdateConfigmap(context.Background(), &v12.ConfigMap{
+				ObjectMeta: v1.ObjectMeta{Name: K8sConfigMapName, Namespace: KubeSystem},
+				Data:       map[string]string{"ssl-protocols": "TLSv1.2", "keep-alive": "8"},
+			})
+			if tc.expectedError {
+				assert.True(t, k8sErrors.IsServiceUnavailable(err))
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "8", server.configMaps[K8sConfigMapName].Data["keep-alive"])
+			}
+			assert.Len(t, server.requests, tc.expectedRequests)
+		})
+	}
+}
+
+func TestKubeClientUpdateConfigmapConflict(t *testing.T) {
+	server := &fakeConfigMapServer{configMaps: map[string]*v12.ConfigMap{}}
+	server.update(&v12.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: K8sConfigMapName, Namespace: KubeSystem}, Data: map[string]string{"ssl-protocols": "TLSv1.2"}})
+	kc := newFakeServerKubeClient(t, server)
+
+	t.Run("the configmap was changed since the caller read it", func(t *testing.T) {
+		cm, err := kc.GetConfigMap(context.Background(), K8sConfigMapName, KubeSystem)
+		assert.NoError(t, err)
+		server.update(&v12.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: K8sConfigMapName, Namespace: KubeSystem}, Data: map[string]string{"ssl-protocols": "TLSv1.3", "use-http2": "true"}})
+
+		cm.Data["keep-alive"] = "8"
+		err = kc.UpdateConfigmap(context.Background(), cm)
+		assert.True(t, IsResourceVersionConflict(err))
+		assert.Equal(t, map[string]string{"ssl-protocols": "TLSv1.3", "use-http2": "true"}, server.configMaps[K8sConfigMapName].Data)
+	})
+
+	t.Run("the configmap was changed during the update", func(t *testing.T) {
+		server.beforePatch = func(s *fakeConfigMapServer, name string) {
+			s.beforePatch = nil
+			s.update(&v12.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: name, Namespace: KubeSystem}, Data: map[string]string{"ssl-protocols": "TLSv1.3", "use-http2": "false"}})
+		}
+
+		err := kc.UpdateConfigmap(context.Background(), &v12.ConfigMap{
+			ObjectMeta: v1.ObjectMeta{Name: K8sConfigMapName, Namespace: KubeSystem},
+			Data:       map[string]string{"ssl-protocols": "TLSv1.3", "use-http2": "false", "keep-alive": "8"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"ssl-protocols": "TLSv1.3", "use-http2": "false", "keep-alive": "8"}, server.configMaps[K8sConfigMapName].Data)
+	})
+}
+
+func TestUpsertMigratedResources(t *testing.T) {
+	tea := model.MigratedResource{Kind: IngressKind, Name: "tea", Namespace: "default", MigratedAs: []string{"Ingress/tea-server"}}
+	coffee := model.MigratedResource{Kind: IngressKind, Name: "coffee", Namespace: "default", MigratedAs: []string{"Ingress/coffee-server"}}
+	k8sCm := model.MigratedResource{Kind: ConfigMapKind, Name: IKSConfigMapName, Namespace: KubeSystem, MigratedAs: []string{"ConfigMap/" + K8sConfigMapName}}
+	unchangedTea := model.MigratedResource{Kind: IngressKind, Name: "tea", Namespace: "default", MigratedAs: []string{"Ingress/tea-server"}, Unchanged: []string{"Ingress/tea-server"}}
+
+	testCases := []struct {
+		description       string
+		migratedResources []model.MigratedResource
+		updates           []model.MigratedResource
+		expected          []model.MigratedResource
+	}{
+		{
+			description: "first run",
+			updates:     []model.MigratedResource{k8sCm, tea},
+			expected:    []model.MigratedResource{k8sCm, tea},
+		},
+		{
+			description:       "new resources are appended",
+			migratedResources: []model.MigratedResource{k8sCm, tea},
+			updates:           []model.MigratedResource{coffee},
+			expected:          []model.MigratedResource{k8sCm, tea, coffee},
+		},
+		{
+			description:       "rerun replaces the recorded resources in place",
+			migratedResources: []model.MigratedResource{k8sCm, tea, coffee},
+			updates:           []model.MigratedResource{unchangedTea},
+			expected:          []model.MigratedResource{k8sCm, unchangedTea, coffee},
+		},
+		{
+			description:       "same name in another namespace is a different resource",
+			migratedResources: []model.MigratedResource{tea},
+			updates:           []model.MigratedResource{{Kind: IngressKind, Name: "tea", Namespace: "shop"}},
+			expected:          []model.MigratedResource{tea, {Kind: IngressKind, Name: "tea", Namespace: "shop"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expected, upsertMigratedResources(tc.migratedResources, tc.updates))
+		})
+	}
+}
+
+// serverStatusConfigMaps changes the configmaps of the migration status on the fake server directly, the mutex of the server must be held
+type serverStatusConfigMaps struct {
+	s *fakeConfigMapServer
+}
+
+func (c serverStatusConfigMaps) current(name string) (*v12.ConfigMap, error) {
+	if cm, exists := c.s.configMaps[name]; exists {
+		return cm.DeepCopy(), nil
+	}
+	return nil, nil
+}
+
+func (c serverStatusConfigMaps) apply(cm *v12.ConfigMap, removedKeys []string) error {
+	c.s.update(cm.DeepCopy())
+	return nil
+}
+
+func (c serverStatusConfigMaps) delete(name string) error {
+	delete(c.s.configMaps, name)
+	return nil
+}
+
+func TestKubeClientCreateOrUpdateStatusCmConflict(t *testing.T) {
+	server := &fakeConfigMapServer{configMaps: map[string]*v12.ConfigMap{}}
+	assert.NoError(t, updateStatusStore(serverStatusConfigMaps{s: server}, model.MigrationModeProduction, []model.MigratedResource{{Kind: IngressKind, Name: "tea", Namespace: "default"}}, nil, nil))
+
+	// another instance of the migration tool records a resource between the read and the update of the shard
+	server.beforePatch = func(s *fakeConfigMapServer, name string) {
+		s.beforePatch = nil
+		assert.NoError(t, updateStatusStore(serverStatusConfigMaps{s: s}, model.MigrationModeProduction, []model.MigratedResource{{Kind: IngressKind, Name: "coffee", Namespace: "default"}}, nil, nil))
+	}
+	kc := newFakeServerKubeClient(t, server)
+
+	err := kc.CreateOrUpdateStatusCm(context.Background(), model.MigrationModeProduction, []model.MigratedResource{{Kind: IngressKind, Name: "juice", Namespace: "default"}}, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{http.MethodGet, http.MethodGet, http.MethodPatch, http.MethodGet, http.MethodGet, http.MethodPatch, http.MethodPatch}, server.requests)
+
+	status, err := LoadMigrationStatus(func(name string) (*v12.ConfigMap, error) {
+		if cm, exists := server.configMaps[name]; exists {
+			return cm, nil
+		}
+		return nil, k8sErrors.NewNotFound(v12.Resource("configmaps"), name)
+	})
+	assert.NoError(t, err)
+	var names []string
+	for _, resource := range status.MigratedResources {
+		names = append(names, resource.Name)
+	}
+	assert.Equal(t, []string{"tea", "coffee", "juice"}, names)
+}
+
+func TestKubeClientCreateOrUpdateStatusCmDryRun(t *testing.T) {
+	server := &fakeConfigMapServer{configMaps: map[string]*v12.ConfigMap{}}
+	kc := newFakeServerKubeClient(t, server)
+	kc.dryRun = true
+
+	// the updates are merged into the status kept in memory, as the dry-run requests are not persisted
+	for _, name := range []string{"tea", "coffee"} {
+		assert.NoError(t, kc.CreateOrUpdateStatusCm(context.Background(), model.MigrationModeProduction, []model.MigratedResource{{Kind: IngressKind, Name: name, Namespace: "default"}}, nil, nil))
+	}
+	status, err := LoadMigrationStatus(func(name string) (*v12.ConfigMap, error) {
+		if cm := kc.unpersistedConfigMap(name, KubeSystem); cm != nil {
+			return cm, nil
+		}
+		return nil, k8sErrors.NewNotFound(v12.Resource("configmaps"), name)
+	})
+	assert.NoError(t, err)
+	var names []string
+	for _, resource := range status.MigratedResources {
+		names = append(names, resource.Name)
+	}
+	assert.Equal(t, []string{"tea", "coffee"}, names)
+}
+
+func TestKubeClientCreateOrUpdateStatusCmLegacyStatus(t *testing.T) {
+	// earlier versions recorded the migrated resources in the status configmap with an update, not with server-side apply
+	server := &fakeConfigMapServer{configMaps: map[string]*v12.ConfigMap{}}
+	server.update(&v12.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{Name: MigrationStatusConfigMapName, Namespace: KubeSystem},
+		Data: map[string]string{
+			MigrationModeParameterName:     model.MigrationModeProduction,
+			SubdomainMapParameterName:      "{}",
+			MigratedResourcesParameterName: `[{"kind":"Ingress","name":"tea","namespace":"default","warnings":["legacy warning"]},{"kind":"Ingress","name":"coffee","namespace":"default"}]`,
+		},
+	})
+	kc := newFakeServerKubeClient(t, server)
+	loadStatus := func() *model.MigrationStatus {
+		status, err := LoadMigrationStatus(func(name string) (*v12.ConfigMap, error) {
+			if cm, exists := server.configMaps[name]; exists {
+				return cm.DeepCopy(), nil
+			}
+			return nil, k8sErrors.NewNotFound(v12.Resource("configmaps"), name)
+		})
+		assert.NoError(t, err)
+		return status
+	}
+
+	// the first update moves the legacy resources into the shards and removes their key
+	tea := model.MigratedResource{Kind: IngressKind, Name: "tea", Namespace: "default", MigratedAs: []string{"Ingress/tea"}}
+	assert.NoError(t, kc.CreateOrUpdateStatusCm(context.Background(), model.MigrationModeProduction, []model.MigratedResource{tea}, nil, nil))
+	assert.NotContains(t, server.configMaps[MigrationStatusConfigMapName].Data, MigratedResourcesParameterName)
+	assert.Equal(t, []model.MigratedResource{tea, {Kind: IngressKind, Name: "coffee", Namespace: "default"}}, loadStatus().MigratedResources)
+
+	// the later updates are not overwritten by the legacy resources
+	coffee := model.MigratedResource{Kind: IngressKind, Name: "coffee", Namespace: "default", MigratedAs: []string{"Ingress/coffee"}}
+	assert.NoError(t, kc.CreateOrUpdateStatusCm(context.Background(), model.MigrationModeProduction, []model.MigratedResource{coffee}, nil, nil))
+	assert.Equal(t, []model.MigratedResource{tea, coffee}, loadStatus().MigratedResources)
+}
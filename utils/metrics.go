@@ -0,0 +1,225 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// MetricsNamespace is the prefix of the names of the metrics
+	MetricsNamespace = "ingress_migrator"
+	// MetricsFileName is the name of the metrics file saved into the output directory, it can be read by the textfile collector of the node exporter
+	MetricsFileName = "ingress-migrator.prom"
+	// MetricsPath is the path of the metrics endpoint served by the watch command
+	MetricsPath = "/metrics"
+
+	// IngressResultMigrated, IngressResultFailed and IngressResultSkipped are the values of the result label of the processed ingress resources
+	IngressResultMigrated = "migrated"
+	IngressResultFailed   = "failed"
+	IngressResultSkipped  = "skipped"
+)
+
+// migrationMetrics contains the metrics of the run of the migration tool
+type migrationMetrics struct {
+	registry *prometheus.Registry
+
+	ingresses          *prometheus.CounterVec
+	generatedResources prometheus.Counter
+	warnings           *prometheus.CounterVec
+	apiRequestDuration *prometheus.HistogramVec
+	apiRequestErrors   *prometheus.CounterVec
+
+	lastRun               *prometheus.GaugeVec
+	lastRunTimestamp      prometheus.Gauge
+	lastRunExitCode       prometheus.Gauge
+	migratedResources     prometheus.Gauge
+	resourcesWithWarnings prometheus.Gauge
+	resourcesWithErrors   prometheus.Gauge
+	acknowledgedWarnings  prometheus.Gauge
+}
+
+// metrics are the metrics of the current run, the ingress resources are migrated by parallel workers, but the metrics are safe for concurrent use
+var metrics = newMigrationMetrics()
+
+// newMigrationMetrics returns the metrics registered on a new registry, so only the metrics of the migration tool are exported
+func newMigrationMetrics() *migrationMetrics {
+	registry := prometheus.NewRegistry()
+	factory := promauto.With(registry)
+	return &migrationMetrics{
+		registry: registry,
+		ingresses: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "ingresses_total",
+			Help:      "Number of the processed source Ingress resources by result (migrated, failed or skipped).",
+		}, []string{"result"}),
+		generatedResources: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "generated_resources_total",
+			Help:      "Number of the resources generated from the source resources, including the unchanged ones.",
+		}),
+		warnings: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "warnings_total",
+			Help:      "Number of the migration warnings that were not acknowledged by code and severity.",
+		}, []string{"code", "severity"}),
+		apiRequestDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: MetricsNamespace,
+			Name:      "api_request_duration_seconds",
+			Help:      "Latency of the requests sent to the API server by operation, every retry is observed.",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+		}, []string{"operation"}),
+		apiRequestErrors: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "api_request_errors_total",
+			Help:      "Number of the failed requests sent to the API server by operation and reason of the error.",
+		}, []string{"operation", "reason"}),
+		lastRun: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "last_run_info",
+			Help:      "Command, mode, result and version of the last run, the value is always 1.",
+		}, []string{"command", "mode", "result", "version"}),
+		lastRunTimestamp: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "last_run_timestamp_seconds",
+			Help:      "Unix time of the end of the last run.",
+		}),
+		lastRunExitCode: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "last_run_exit_code",
+			Help:      "Exit code of the last run.",
+		}),
+		migratedResources: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "migrated_resources",
+			Help:      "Number of the resources recorded in the migration status.",
+		}),
+		resourcesWithWarnings: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "resources_with_warnings",
+			Help:      "Number of the resources with migration warnings in the migration status.",
+		}),
+		resourcesWithErrors: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "resources_with_errors",
+			Help:      "Number of the resources with migration errors in the migration status.",
+		}),
+		acknowledgedWarnings: factory.NewGauge(prometheus.GaugeOpts{
+			Namespace: MetricsNamespace,
+			Name:      "acknowledged_warnings",
+			Help:      "Number of the acknowledged migration warnings in the migration status.",
+		}),
+	}
+}
+
+// ObserveMigratedResource counts the processed source resource, its generated resources and its warnings
+func ObserveMigratedResource(migratedResource model.MigratedResource) {
+	if migratedResource.Kind == IngressKind {
+		result := IngressResultMigrated
+		if len(migratedResource.Errors) > 0 {
+			result = IngressResultFailed
+		}
+		metrics.ingresses.WithLabelValues(result).Inc()
+	}
+	metrics.generatedResources.Add(float64(len(migratedResource.MigratedAs)))
+	for _, warning := range ResourceWarnings(migratedResource) {
+		metrics.warnings.WithLabelValues(warning.Code, warning.Severity).Inc()
+	}
+}
+
+// ObserveSkippedIngress counts the source ingress resource that was not migrated, e.g. because of its ingress class
+func ObserveSkippedIngress() {
+	metrics.ingresses.WithLabelValues(IngressResultSkipped).Inc()
+}
+
+// observeAPIRequest records the latency of the request sent to the API server, and counts it if it failed
+func observeAPIRequest(operation string, start time.Time, err error) {
+	metrics.apiRequestDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.apiRequestErrors.WithLabelValues(operation, apiErrorReason(err)).Inc()
+	}
+}
+
+// apiErrorReason returns the reason of the API error, or Unknown if the request failed without a response
+func apiErrorReason(err error) string {
+	if reason := k8sErrors.ReasonForError(err); reason != "" {
+		return string(reason)
+	}
+	return "Unknown"
+}
+
+// ObserveRun sets the gauges of the last run from the summary of the command
+func ObserveRun(summary model.Summary) {
+	metrics.lastRun.Reset()
+	metrics.lastRun.WithLabelValues(summary.Command, summary.Mode, summary.Result, Version).Set(1)
+	metrics.lastRunTimestamp.SetToCurrentTime()
+	metrics.lastRunExitCode.Set(float64(summary.ExitCode))
+	observeStatusCounts(summary)
+}
+
+// ObserveStatus sets the gauges of the migrated resources from the migration status
+func ObserveStatus(status *model.MigrationStatus) {
+	observeStatusCounts(NewSummary("", status, nil))
+}
+
+// observeStatusCounts sets the gauges of the migrated resources from the counts of the summary
+func observeStatusCounts(summary model.Summary) {
+	metrics.migratedResources.Set(float64(summary.MigratedResources))
+	metrics.resourcesWithWarnings.Set(float64(summary.ResourcesWithWarnings))
+	metrics.resourcesWithErrors.Set(float64(summary.ResourcesWithErrors))
+	metrics.acknowledgedWarnings.Set(float64(summary.AcknowledgedWarnings))
+}
+
+// WriteMetrics atomically saves the metrics in the Prometheus text format into the output directory
+func WriteMetrics(outputDir string) error {
+	return prometheus.WriteToTextfile(filepath.Join(outputDir, MetricsFileName), metrics.registry)
+}
+
+// ServeMetrics serves the metrics on the address until ctx is done
+func ServeMetrics(ctx context.Context, address string, logger *zap.Logger) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("error serving the metrics", zap.String("address", address), zap.Error(err))
+		}
+	}()
+	logger.Info("serving the metrics", zap.String("address", listener.Addr().String()), zap.String("path", MetricsPath))
+	return nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	v12 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// resetMetrics replaces the metrics with new ones for the duration of the test
+func resetMetrics(t *testing.T) {
+	previous := metrics
+	metrics = newMigrationMetrics()
+	t.Cleanup(func() { metrics = previous })
+}
+
+func TestObserveMigratedResource(t *testing.T) {
+	resetMetrics(t)
+
+	ObserveMigratedResource(model.MigratedResource{Kind: IngressKind, Name: "coffee", MigratedAs: []string{"ingress/coffee", "ingress/coffee-server"}})
+	ObserveMigratedResource(model.MigratedResource{
+		Kind:       IngressKind,
+		Name:       "tea",
+		MigratedAs: []string{"ingress/tea"},
+		Warnings:   []string{"first warning", "second warning"},
+		WarningDetails: []model.Warning{
+			{Code: "HSTS_UNSUPPORTED", Severity: WarningSeverityWarning},
+			{Code: "HSTS_UNSUPPORTED", Severity: WarningSeverityWarning},
+		},
+	})
+	ObserveMigratedResource(model.MigratedResource{Kind: IngressKind, Name: "juice", Errors: []string{"error"}})
+	ObserveMigratedResource(model.MigratedResource{Kind: ConfigMapKind, Name: IKSConfigMapName, MigratedAs: []string{"configmap/" + K8sConfigMapName}})
+	ObserveSkippedIngress()
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.ingresses.WithLabelValues(IngressResultMigrated)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.ingresses.WithLabelValues(IngressResultFailed)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.ingresses.WithLabelValues(IngressResultSkipped)))
+	assert.Equal(t, float64(4), testutil.ToFloat64(metrics.generatedResources))
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.warnings.WithLabelValues("HSTS_UNSUPPORTED", WarningSeverityWarning)))
+}
+
+func TestObserveAPIRequest(t *testing.T) {
+	resetMetrics(t)
+
+	observeAPIRequest("get configmap", time.Now(), nil)
+	observeAPIRequest("get configmap", time.Now(), k8sErrors.NewNotFound(v12.Resource("configmaps"), "tea"))
+	observeAPIRequest("patch configmap", time.Now(), fmt.Errorf("connection refused"))
+
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics.apiRequestDuration))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.apiRequestErrors.WithLabelValues("get configmap", "NotFound")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.apiRequestErrors.WithLabelValues("patch configmap", "Unknown")))
+}
+
+func TestObserveStatus(t *testing.T) {
+	resetMetrics(t)
+
+	ObserveStatus(&model.MigrationStatus{MigratedResources: []model.MigratedResource{
+		{Kind: ConfigMapKind, Name: IKSConfigMapName},
+		{Kind: IngressKind, Name: "tea", Warnings: []string{"warning"}, AcknowledgedWarnings: []model.Warning{{Code: "HSTS_UNSUPPORTED"}}},
+		{Kind: IngressKind, Name: "coffee", Errors: []string{"error"}},
+	}})
+	assert.Equal(t, float64(3), testutil.ToFloat64(metrics.migratedResources))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.resourcesWithWarnings))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.resourcesWithErrors))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.acknowledgedWarnings))
+	// the gauges of the last run are not set
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.lastRun))
+
+	ObserveStatus(nil)
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.migratedResources))
+}
+
+func TestWriteMetrics(t *testing.T) {
+	resetMetrics(t)
+	outputDir := t.TempDir()
+
+	ObserveSkippedIngress()
+	ObserveRun(model.Summary{Command: "migrate", Mode: model.MigrationModeProduction, Result: ResultPartial, ExitCode: ExitCodePartialMigration, MigratedResources: 3, ResourcesWithErrors: 1})
+	// the gauges of the last run replace the gauges of the previous run
+	ObserveRun(model.Summary{Command: "migrate", Mode: model.MigrationModeProduction, Result: ResultWarnings, ExitCode: ExitCodeWarnings, MigratedResources: 3, ResourcesWithWarnings: 2})
+	assert.NoError(t, WriteMetrics(outputDir))
+
+	content, err := os.ReadFile(filepath.Join(outputDir, MetricsFileName))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `ingress_migrator_ingresses_total{result="skipped"} 1`)
+	assert.Contains(t, string(content), fmt.Sprintf(`ingress_migrator_last_run_info{command="migrate",mode="production",result="warnings",version="%s"} 1`, Version))
+	assert.NotContains(t, string(content), `result="partial"`)
+	assert.Contains(t, string(content), "ingress_migrator_last_run_exit_code 5")
+	assert.Contains(t, string(content), "ingress_migrator_migrated_resources 3")
+	assert.Contains(t, string(content), "ingress_migrator_resources_with_warnings 2")
+	assert.Contains(t, string(content), "ingress_migrator_resources_with_errors 0")
+}
+
+func TestServeMetrics(t *testing.T) {
+	resetMetrics(t)
+	ObserveSkippedIngress()
+
+	// the address of the endpoint is taken from a listener closed before serving the metrics on it
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := listener.Addr().String()
+	assert.NoError(t, listener.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, ServeMetrics(ctx, address, zap.NewNop()))
+	// the address is in use until ctx is done
+	assert.Error(t, ServeMetrics(ctx, address, zap.NewNop()))
+
+	response, err := http.Get("http://" + address + MetricsPath)
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Contains(t, string(body), `ingress_migrator_ingresses_total{result="skipped"} 1`)
+}
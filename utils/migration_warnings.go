@@ -14,6 +14,16 @@ limitations under the License.
 */
 package utils
 
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	networking "k8s.io/api/networking/v1beta1"
+)
+
 const (
 	// UnsupportedCMParameter is returned when there is no parser function defined for iks configmap parameter
 	UnsupportedCMParameter = "The '%s' parameter could not be migrated."
@@ -78,7 +88,197 @@ const (
 	CustomPortWarning = "Annotation 'ingress.bluemix.net/custom-port' cannot be automatically migrated. To configure custom HTTP and HTTPS ports for an ALB, see https://cloud.ibm.com/docs/containers?topic=containers-comm-ingress-annotations#comm-customize-deploy"
 	//LocationModifierGenericWarning is returned when the ingress resource has such a value in the 'ingress.bluemix.net/location-modifier' annotation which is not supported by the Kubernetes Ingress Controller
 	LocationModifierGenericWarning = "Ingress resource cannot be migrated because values in the 'ingress.bluemix.net/location-modifier' annotation are not supported in the Kubernetes Ingress implementation. To automatically migrate the Ingress resource, create a copy of the resource file, remove the 'ingress.bluemix.net/location-modifier' annotation, apply the file in your cluster, and run the migration again."
+	// InvalidAcknowledgedWarningsAnnotation is returned when the acknowledged warnings annotation of the ingress resource can not be parsed
+	InvalidAcknowledgedWarningsAnnotation = "The 'ingress-migrator.cloud.ibm.com/acknowledged-warnings' annotation is invalid, so no warnings are acknowledged by it. Find the parsing error in the migration logs."
 	//SSLServicesSecretWarning is returned when the ingress resource has a secret value in the 'ingress.bluemix.net/ssl-services' annotation and the content of the secret may not be appropriate
 	// #nosec G101
 	SSLServicesSecretWarning = "The secret '%s/%s' that is specified in the 'ingress.bluemix.net/ssl-services' annotation might be unusable for enforcing TLS to backend services. Edit the secret to ensure that the contents of '%s' and '%s' match."
 )
+
+const (
+	// WarningSeverityInfo is the severity of the warnings about behavior changes that need no action in most cases
+	WarningSeverityInfo = "info"
+	// WarningSeverityWarning is the severity of the warnings about configuration that has to be migrated manually
+	WarningSeverityWarning = "warning"
+	// WarningSeverityCritical is the severity of the configuration that is lost or breaks the resource
+	WarningSeverityCritical = "critical"
+
+	// UnknownWarningCode is the code of the warnings that are not in the warning registry, e.g. the warnings recorded by another version
+	UnknownWarningCode = "UNKNOWN"
+)
+
+// warningDefinition describes a warning of the registry, its message is matched with the text of the warnings
+type warningDefinition struct {
+	code     string
+	severity string
+	// message is one of the warning texts above, the '%s' verbs match any quoted value
+	message     string
+	annotation  string
+	parameter   string
+	remediation string
+	// pattern matches the texts formatted from the message, the first submatch is the parameter of the IKS configmap warnings
+	pattern *regexp.Regexp
+}
+
+// warningRegistry contains every warning of the migration tool with its stable code
+var warningRegistry = []warningDefinition{
+	{code: "CM_PARAMETER_UNSUPPORTED", severity: WarningSeverityWarning, message: UnsupportedCMParameter, remediation: "Set the equivalent option in the 'ibm-k8s-controller-config' ConfigMap manually, if there is one."},
+	{code: "CM_PARAMETER_FAILED", severity: WarningSeverityCritical, message: ErrorProcessingCMParameter, remediation: "Fix the value of the parameter in the IKS ConfigMap and run the migration again."},
+	{code: "CM_SSL_DHPARAM", severity: WarningSeverityWarning, message: SSLDHParamFile, parameter: "ssl-dhparam-file", remediation: "Create a secret with the DH parameters and reference it in the 'ibm-k8s-controller-config' ConfigMap."},
+	{code: "INGRESS_CREATE_FAILED", severity: WarningSeverityCritical, message: ErrorCreatingIngressResources, remediation: "Check the errors of the resource and run the migration again."},
+	{code: "ALB_ID_SELECTION", severity: WarningSeverityInfo, message: ALBSelection, annotation: "ingress.bluemix.net/ALB-ID", remediation: "Use a custom Ingress class if the Ingress was applied to a select group of ALBs."},
+	{code: "CUSTOM_ERRORS_UNSUPPORTED", severity: WarningSeverityWarning, message: CustomErrorsWarning, annotation: "ingress.bluemix.net/custom-errors", remediation: "Configure the custom error pages of the Kubernetes Ingress Controller."},
+	{code: "CUSTOM_ERROR_ACTIONS_UNSUPPORTED", severity: WarningSeverityWarning, message: CustomErrorActionsWarning, annotation: "ingress.bluemix.net/custom-error-actions", remediation: "Configure the custom error pages of the Kubernetes Ingress Controller."},
+	{code: "UPSTREAM_MAX_FAILS_UNSUPPORTED", severity: WarningSeverityWarning, message: UpstreamMaxFailsWarning, annotation: "ingress.bluemix.net/upstream-max-fails", remediation: "Remove the annotation, there is no equivalent option."},
+	{code: "PROXY_EXTERNAL_SERVICE_UNSUPPORTED", severity: WarningSeverityCritical, message: ProxyExternalServiceWarning, annotation: "ingress.bluemix.net/proxy-external-service", remediation: "Proxy the external service in a configuration snippet, or redirect to it permanently."},
+	{code: "PROXY_BUSY_BUFFERS_SIZE_UNSUPPORTED", severity: WarningSeverityWarning, message: ProxyBusyBuffersSizeWarning, annotation: "ingress.bluemix.net/proxy-busy-buffers-size", remediation: "Set the proxy buffer size annotation on the generated Ingress resources."},
+	{code: "ADD_HOST_PORT_UNSUPPORTED", severity: WarningSeverityWarning, message: AddHostPortWarning, annotation: "ingress.bluemix.net/add-host-port", remediation: "Set the host header in a server snippet or with the 'proxy-set-headers' ConfigMap option."},
+	{code: "IAM_UI_AUTH_UNSUPPORTED", severity: WarningSeverityCritical, message: IAMUIAuthWarning, annotation: "ingress.bluemix.net/iam-ui-auth", remediation: "Protect the application with another authentication method before the Kubernetes Ingress Controller serves it."},
+	{code: "STICKY_COOKIE_SECURE", severity: WarningSeverityInfo, message: StickyCookieServicesWarningNoSecure, annotation: "ingress.bluemix.net/sticky-cookie-services", remediation: "Make sure the clients send the sticky cookie over HTTPS only."},
+	{code: "STICKY_COOKIE_HTTPONLY", severity: WarningSeverityInfo, message: StickyCookieServicesWarningNoHttponly, annotation: "ingress.bluemix.net/sticky-cookie-services", remediation: "Make sure the application does not read the sticky cookie in the browser."},
+	{code: "MUTUAL_AUTH_CUSTOM_PORT", severity: WarningSeverityCritical, message: MutualAuthWarningCustomPort, annotation: "ingress.bluemix.net/mutual-auth", remediation: "Serve the application on port 443 to keep the mutual authentication."},
+	{code: "TCP_PORT_ALB_ID", severity: WarningSeverityWarning, message: TCPPortWarningWithALBID, annotation: "ingress.bluemix.net/tcp-ports", remediation: "Add the 'tcp-services-configmap=<ALB-ID>-k8s-ingress-tcp-ports' field to the deployment of the ALB."},
+	{code: "TCP_PORT_GENERIC", severity: WarningSeverityWarning, message: TCPPortWarningWithoutALBID, annotation: "ingress.bluemix.net/tcp-ports", remediation: "Add the 'tcp-services-configmap=generic-k8s-ingress-tcp-ports' field to the deployments of the ALBs."},
+	{code: "TCP_PORT_ALB_ID_TEST", severity: WarningSeverityWarning, message: TCPPortWarningWithALBIDTest, annotation: "ingress.bluemix.net/tcp-ports", remediation: "Append '--tcp-services-configmap=<ALB-ID>-k8s-ingress-tcp-ports' to the arguments of the test ALB deployment."},
+	{code: "TCP_PORT_GENERIC_TEST", severity: WarningSeverityWarning, message: TCPPortWarningWithoutALBIDTest, annotation: "ingress.bluemix.net/tcp-ports", remediation: "Append '--tcp-services-configmap=generic-k8s-ingress-tcp-ports' to the arguments of the test ALB deployment."},
+	{code: "UPSTREAM_KEEPALIVE_UNSUPPORTED", severity: WarningSeverityWarning, message: UpstreamKeepaliveWarning, annotation: "ingress.bluemix.net/upstream-keepalive", remediation: "Set the 'upstream-keepalive-connections' option in the 'ibm-k8s-controller-config' ConfigMap."},
+	{code: "UPSTREAM_KEEPALIVE_TIMEOUT_UNSUPPORTED", severity: WarningSeverityWarning, message: UpstreamKeepaliveTimeoutWarning, annotation: "ingress.bluemix.net/upstream-keepalive-timeout", remediation: "Set the 'upstream-keepalive-timeout' option in the 'ibm-k8s-controller-config' ConfigMap."},
+	{code: "UPSTREAM_FAIL_TIMEOUT_UNSUPPORTED", severity: WarningSeverityWarning, message: UpstreamFailTimeoutWarning, annotation: "ingress.bluemix.net/upstream-fail-timeout", remediation: "Remove the annotation, there is no equivalent option."},
+	{code: "APPID_AUTH_ADDON", severity: WarningSeverityWarning, message: AppIDAuthEnableAddon, annotation: "ingress.bluemix.net/appid-auth", remediation: "Enable the ALB OAuth-Proxy cluster add-on."},
+	{code: "APPID_AUTH_CALLBACKS", severity: WarningSeverityWarning, message: AppIDAuthAddCallbacks, annotation: "ingress.bluemix.net/appid-auth", remediation: "Add the new callback URLs to every App ID instance."},
+	{code: "APPID_AUTH_NAMESPACE", severity: WarningSeverityCritical, message: AppIDAuthDifferentNamespace, annotation: "ingress.bluemix.net/appid-auth", remediation: "Bind the App ID service instance to the namespace of the Ingress resource."},
+	{code: "APPID_AUTH_SNIPPET_CONFLICT", severity: WarningSeverityCritical, message: AppIDAuthConfigSnippetConflict, annotation: "ingress.bluemix.net/appid-auth", remediation: "Add the App ID authentication configuration to the configuration snippet manually."},
+	{code: "REWRITE_PATH_CASE_INSENSITIVE", severity: WarningSeverityInfo, message: RewritesWarning, annotation: "ingress.bluemix.net/rewrite-path", remediation: "Check that the other paths of the host still match the same requests."},
+	{code: "LOCATION_MODIFIER_CASE_INSENSITIVE", severity: WarningSeverityInfo, message: LocationModifierWarning, annotation: "ingress.bluemix.net/location-modifier", remediation: "Check that the other paths of the host still match the same requests."},
+	{code: "HSTS_UNSUPPORTED", severity: WarningSeverityWarning, message: HSTSWarning, annotation: "ingress.bluemix.net/hsts", remediation: "Configure HSTS in the 'ibm-k8s-controller-config' ConfigMap."},
+	{code: "CUSTOM_PORT_UNSUPPORTED", severity: WarningSeverityWarning, message: CustomPortWarning, annotation: "ingress.bluemix.net/custom-port", remediation: "Customize the ports of the ALB deployments."},
+	{code: "LOCATION_MODIFIER_UNSUPPORTED", severity: WarningSeverityCritical, message: LocationModifierGenericWarning, annotation: "ingress.bluemix.net/location-modifier", remediation: "Remove the annotation from a copy of the Ingress resource and run the migration again."},
+	{code: "ACKNOWLEDGEMENT_INVALID", severity: WarningSeverityWarning, message: InvalidAcknowledgedWarningsAnnotation, annotation: AcknowledgedWarningsAnnotation, remediation: "Fix the list of acknowledgements in the annotation, every acknowledgement needs a known code, a reason and an expiry."},
+	{code: "SSL_SERVICES_SECRET", severity: WarningSeverityWarning, message: SSLServicesSecretWarning, annotation: "ingress.bluemix.net/ssl-services", remediation: "Make sure the keys of the secret contain the same certificates."},
+}
+
+// docURLRegexp matches the first link of a warning text
+var docURLRegexp = regexp.MustCompile(`https?://[^\s]*[^\s.,)]`)
+
+func init() {
+	for i := range warningRegistry {
+		pattern := strings.ReplaceAll(regexp.QuoteMeta(warningRegistry[i].message), "%s", "([^']*)")
+		warningRegistry[i].pattern = regexp.MustCompile("^" + pattern + "$")
+	}
+}
+
+// WarningCodes returns the codes of every warning of the registry
+func WarningCodes() []string {
+	codes := make([]string, 0, len(warningRegistry))
+	for _, definition := range warningRegistry {
+		codes = append(codes, definition.code)
+	}
+	return codes
+}
+
+// NewWarningOf returns the warning of the registry with the message formatted with the args
+func NewWarningOf(message string, args ...interface{}) model.Warning {
+	text := message
+	if len(args) > 0 {
+		text = fmt.Sprintf(message, args...)
+	}
+	for _, definition := range warningRegistry {
+		if definition.message != message {
+			continue
+		}
+		warning := definition.newWarning(text)
+		if warning.Parameter == "" && warning.Annotation == "" && len(args) > 0 {
+			warning.Parameter = fmt.Sprint(args[0])
+		}
+		return warning
+	}
+	return unknownWarning(text)
+}
+
+// NewWarning returns the structured form of a recorded warning text
+func NewWarning(message string) model.Warning {
+	for _, definition := range warningRegistry {
+		submatches := definition.pattern.FindStringSubmatch(message)
+		if submatches == nil {
+			continue
+		}
+		warning := definition.newWarning(message)
+		if warning.Parameter == "" && warning.Annotation == "" && len(submatches) > 1 {
+			warning.Parameter = submatches[1]
+		}
+		return warning
+	}
+	return unknownWarning(message)
+}
+
+// newWarning returns the warning of the definition with the text
+func (definition warningDefinition) newWarning(text string) model.Warning {
+	return model.Warning{
+		Code:        definition.code,
+		Severity:    definition.severity,
+		Message:     text,
+		Annotation:  definition.annotation,
+		Parameter:   definition.parameter,
+		Remediation: definition.remediation,
+		DocURL:      docURLRegexp.FindString(text),
+	}
+}
+
+// unknownWarning returns the warning of a text that is not in the registry
+func unknownWarning(text string) model.Warning {
+	return model.Warning{Code: UnknownWarningCode, Severity: WarningSeverityWarning, Message: text, DocURL: docURLRegexp.FindString(text)}
+}
+
+// NewWarnings returns the structured form of the recorded warning texts, see the NewWarning function
+func NewWarnings(messages []string) []model.Warning {
+	var warnings []model.Warning
+	for _, message := range messages {
+		warnings = append(warnings, NewWarning(message))
+	}
+	return warnings
+}
+
+// WarningMessages returns the texts of the warnings, they are recorded in the Warnings of the migrated resource
+func WarningMessages(warnings []model.Warning) []string {
+	var messages []string
+	for _, warning := range warnings {
+		messages = append(messages, warning.Message)
+	}
+	return messages
+}
+
+// WithAffectedServices returns the warning with the affected services and their paths
+func WithAffectedServices(warning model.Warning, ingress *networking.Ingress, services []string) model.Warning {
+	warning.Services, warning.Paths = nil, nil
+	for _, service := range services {
+		if service != "" && !ItemInSlice(service, warning.Services) {
+			warning.Services = append(warning.Services, service)
+		}
+	}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			if ItemInSlice(path.Backend.ServiceName, warning.Services) && !ItemInSlice(PathOrDefault(path.Path), warning.Paths) {
+				warning.Paths = append(warning.Paths, PathOrDefault(path.Path))
+			}
+		}
+	}
+	sort.Strings(warning.Services)
+	sort.Strings(warning.Paths)
+	return warning
+}
+
+// ResourceWarnings returns the structured warnings of the migrated resource
+func ResourceWarnings(migratedResource model.MigratedResource) []model.Warning {
+	if len(migratedResource.WarningDetails) == len(migratedResource.Warnings) {
+		return migratedResource.WarningDetails
+	}
+	return NewWarnings(migratedResource.Warnings)
+}
+
+// FormatWarning returns the text of the warning prefixed with its code, e.g. to print it
+func FormatWarning(warning model.Warning) string {
+	return fmt.Sprintf("[%s] %s", warning.Code, warning.Message)
+}
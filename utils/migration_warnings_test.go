@@ -0,0 +1,182 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/stretchr/testify/assert"
+	networking "k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestWarningRegistry(t *testing.T) {
+	codes := map[string]bool{}
+	for _, definition := range warningRegistry {
+		assert.False(t, codes[definition.code], "duplicate warning code %s", definition.code)
+		codes[definition.code] = true
+		assert.Contains(t, []string{WarningSeverityInfo, WarningSeverityWarning, WarningSeverityCritical}, definition.severity, definition.code)
+		assert.NotEmpty(t, definition.remediation, definition.code)
+
+		// every warning text formatted from the message is recognized
+		var args []interface{}
+		for i := 0; i < strings.Count(definition.message, "%s"); i++ {
+			args = append(args, fmt.Sprintf("value%d", i))
+		}
+		message := definition.message
+		if len(args) > 0 {
+			message = fmt.Sprintf(definition.message, args...)
+		}
+		assert.Equal(t, definition.code, NewWarning(message).Code, message)
+		assert.Equal(t, definition.code, NewWarningOf(definition.message, args...).Code, message)
+		assert.Equal(t, message, NewWarningOf(definition.message, args...).Message)
+	}
+	assert.Len(t, WarningCodes(), len(warningRegistry))
+}
+
+func TestNewWarning(t *testing.T) {
+	testCases := []struct {
+		description     string
+		message         string
+		expectedWarning model.Warning
+	}{
+		{
+			description: "configmap parameter",
+			message:     fmt.Sprintf(UnsupportedCMParameter, "server-tokens"),
+			expectedWarning: model.Warning{
+				Code:        "CM_PARAMETER_UNSUPPORTED",
+				Severity:    WarningSeverityWarning,
+				Message:     "The 'server-tokens' parameter could not be migrated.",
+				Parameter:   "server-tokens",
+				Remediation: "Set the equivalent option in the 'ibm-k8s-controller-config' ConfigMap manually, if there is one.",
+			},
+		},
+		{
+			description: "annotation with doc link",
+			message:     TCPPortWarningWithALBID,
+			expectedWarning: model.Warning{
+				Code:        "TCP_PORT_ALB_ID",
+				Severity:    WarningSeverityWarning,
+				Message:     TCPPortWarningWithALBID,
+				Annotation:  "ingress.bluemix.net/tcp-ports",
+				Remediation: "Add the 'tcp-services-configmap=<ALB-ID>-k8s-ingress-tcp-ports' field to the deployment of the ALB.",
+				DocURL:      "https://cloud.ibm.com/docs/containers?topic=containers-comm-ingress-annotations#comm-customize-deploy",
+			},
+		},
+		{
+			description: "formatted annotation warning has no parameter",
+			message:     fmt.Sprintf(SSLServicesSecretWarning, "default", "proxy-secret", "client.crt", "tls.crt"),
+			expectedWarning: model.Warning{
+				Code:        "SSL_SERVICES_SECRET",
+				Severity:    WarningSeverityWarning,
+				Message:     "The secret 'default/proxy-secret' that is specified in the 'ingress.bluemix.net/ssl-services' annotation might be unusable for enforcing TLS to backend services. Edit the secret to ensure that the contents of 'client.crt' and 'tls.crt' match.",
+				Annotation:  "ingress.bluemix.net/ssl-services",
+				Remediation: "Make sure the keys of the secret contain the same certificates.",
+			},
+		},
+		{
+			description:     "unknown warning",
+			message:         "The tea is cold, see https://example.com/tea.",
+			expectedWarning: model.Warning{Code: UnknownWarningCode, Severity: WarningSeverityWarning, Message: "The tea is cold, see https://example.com/tea.", DocURL: "https://example.com/tea"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expectedWarning, NewWarning(tc.message))
+		})
+	}
+}
+
+func TestNewWarningOf(t *testing.T) {
+	// the parameter of the configmap warnings is the first arg
+	warning := NewWarningOf(UnsupportedCMParameter, "server-tokens")
+	assert.Equal(t, "CM_PARAMETER_UNSUPPORTED", warning.Code)
+	assert.Equal(t, "The 'server-tokens' parameter could not be migrated.", warning.Message)
+	assert.Equal(t, "server-tokens", warning.Parameter)
+
+	// the annotation warnings have no parameter
+	warning = NewWarningOf(SSLServicesSecretWarning, "default", "proxy-secret", "client.crt", "tls.crt")
+	assert.Equal(t, "SSL_SERVICES_SECRET", warning.Code)
+	assert.Equal(t, "ingress.bluemix.net/ssl-services", warning.Annotation)
+	assert.Empty(t, warning.Parameter)
+
+	// the parameter of the definition is kept
+	assert.Equal(t, "CM_SSL_DHPARAM", NewWarningOf(SSLDHParamFile).Code)
+	assert.Equal(t, "ssl-dhparam-file", NewWarningOf(SSLDHParamFile).Parameter)
+
+	assert.Equal(t, model.Warning{Code: UnknownWarningCode, Severity: WarningSeverityWarning, Message: "The tea is cold."}, NewWarningOf("The tea is cold."))
+}
+
+func TestWithAffectedServices(t *testing.T) {
+	backend := func(service string) networking.IngressBackend {
+		return networking.IngressBackend{ServiceName: service, ServicePort: intstr.FromInt(8080)}
+	}
+	ingress := &networking.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "tea-ingress", Namespace: "default"},
+		Spec: networking.IngressSpec{
+			Rules: []networking.IngressRule{{
+				Host: "tea.example.com",
+				IngressRuleValue: networking.IngressRuleValue{HTTP: &networking.HTTPIngressRuleValue{Paths: []networking.HTTPIngressPath{
+					{Path: "/tea", Backend: backend("tea-svc")},
+					{Path: "/green-tea", Backend: backend("tea-svc")},
+					{Backend: backend("coffee-svc")},
+					{Path: "/milk", Backend: backend("milk-svc")},
+				}}},
+			}, {
+				Host: "coffee.example.com",
+			}},
+		},
+	}
+
+	warning := WithAffectedServices(NewWarningOf(StickyCookieServicesWarningNoSecure), ingress, []string{"tea-svc", "coffee-svc", "tea-svc", ""})
+	assert.Equal(t, "STICKY_COOKIE_SECURE", warning.Code)
+	assert.Equal(t, []string{"coffee-svc", "tea-svc"}, warning.Services)
+	assert.Equal(t, []string{"/", "/green-tea", "/tea"}, warning.Paths)
+
+	// the services without a rule have no paths
+	warning = WithAffectedServices(NewWarningOf(TCPPortWarningWithoutALBID), ingress, []string{"tcp-svc"})
+	assert.Equal(t, []string{"tcp-svc"}, warning.Services)
+	assert.Empty(t, warning.Paths)
+
+	// the configuration of every service has no affected services
+	warning = WithAffectedServices(NewWarningOf(HSTSWarning), ingress, []string{""})
+	assert.Empty(t, warning.Services)
+	assert.Empty(t, warning.Paths)
+}
+
+func TestWarningMessages(t *testing.T) {
+	assert.Nil(t, WarningMessages(nil))
+	assert.Equal(t, []string{HSTSWarning, "The 'server-tokens' parameter could not be migrated."},
+		WarningMessages([]model.Warning{NewWarningOf(HSTSWarning), NewWarningOf(UnsupportedCMParameter, "server-tokens")}))
+}
+
+func TestResourceWarnings(t *testing.T) {
+	recorded := model.MigratedResource{
+		Warnings:       []string{HSTSWarning},
+		WarningDetails: []model.Warning{{Code: "HSTS_UNSUPPORTED", Message: HSTSWarning, Services: []string{"tea-svc"}}},
+	}
+	assert.Equal(t, recorded.WarningDetails, ResourceWarnings(recorded))
+
+	// the resources recorded without structured warnings
+	recorded.WarningDetails = nil
+	warnings := ResourceWarnings(recorded)
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, "HSTS_UNSUPPORTED", warnings[0].Code)
+	assert.Equal(t, "[HSTS_UNSUPPORTED] "+HSTSWarning, FormatWarning(warnings[0]))
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/ghodss/yaml"
+	networking "k8s.io/api/networking/v1beta1"
+)
+
+const (
+	// PolicyPerNamespace counts the warnings of the resources in the same namespace together
+	PolicyPerNamespace = "namespace"
+	// PolicyPerResource counts the warnings of every resource separately
+	PolicyPerResource = "resource"
+	// PolicyPerCluster counts the warnings of every resource together
+	PolicyPerCluster = "cluster"
+)
+
+// Policy selects the migration warnings that fail the command
+type Policy struct {
+	// FailOn contains the selectors of the warnings that fail the command
+	FailOn []string `json:"failOn,omitempty"`
+	// Thresholds limit the number of the selected warnings
+	Thresholds []PolicyThreshold `json:"thresholds,omitempty"`
+}
+
+// PolicyThreshold fails the command when more than Max warnings match the selectors in its scope
+type PolicyThreshold struct {
+	Match []string `json:"match"`
+	Max   int      `json:"max"`
+	Per   string   `json:"per,omitempty"`
+}
+
+// Empty returns true if the policy fails on nothing
+func (p Policy) Empty() bool {
+	return len(p.FailOn) == 0 && len(p.Thresholds) == 0
+}
+
+// LoadPolicy returns the policy of the file (path may be empty) extended with the selectors of the --fail-on option
+func LoadPolicy(path string, failOn []string) (Policy, error) {
+	var policy Policy
+	if path != "" {
+		data, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return policy, fmt.Errorf("failed to read policy file: %v", err)
+		}
+		if err := yaml.Unmarshal(data, &policy); err != nil {
+			return policy, fmt.Errorf("failed to parse policy file %s: %v", path, err)
+		}
+	}
+	policy.FailOn = append(policy.FailOn, failOn...)
+	return policy, ValidatePolicy(policy)
+}
+
+// ValidatePolicy checks the selectors and the thresholds of the policy
+func ValidatePolicy(policy Policy) error {
+	for _, selector := range policy.FailOn {
+		if err := validateWarningSelector(selector); err != nil {
+			return err
+		}
+	}
+	for i, threshold := range policy.Thresholds {
+		if len(threshold.Match) == 0 {
+			return fmt.Errorf("threshold #%d of the policy must match at least one warning code or severity", i+1)
+		}
+		for _, selector := range threshold.Match {
+			if err := validateWarningSelector(selector); err != nil {
+				return err
+			}
+		}
+		if threshold.Max < 0 {
+			return fmt.Errorf("the maximum of threshold #%d of the policy must not be negative", i+1)
+		}
+		if threshold.Per != "" && !ItemInSlice(threshold.Per, []string{PolicyPerNamespace, PolicyPerResource, PolicyPerCluster}) {
+			return fmt.Errorf("unknown scope '%s' of threshold #%d of the policy, it must be '%s', '%s' or '%s'", threshold.Per, i+1, PolicyPerNamespace, PolicyPerResource, PolicyPerCluster)
+		}
+	}
+	return nil
+}
+
+// validateWarningSelector checks that the selector is a warning severity or it matches at least one warning code
+func validateWarningSelector(selector string) error {
+	if ItemInSlice(selector, []string{WarningSeverityInfo, WarningSeverityWarning, WarningSeverityCritical}) {
+		return nil
+	}
+	if _, err := path.Match(selector, ""); err != nil {
+		return fmt.Errorf("invalid warning code pattern '%s': %v", selector, err)
+	}
+	for _, code := range WarningCodes() {
+		if matched, _ := path.Match(selector, code); matched {
+			return nil
+		}
+	}
+	return fmt.Errorf("'%s' matches no warning code or severity", selector)
+}
+
+// matchingSelector returns the first selector matching the severity or the code of the warning, or an empty string
+func matchingSelector(selectors []string, warning model.Warning) string {
+	for _, selector := range selectors {
+		if selector == warning.Severity {
+			return selector
+		}
+		if matched, err := path.Match(selector, warning.Code); err == nil && matched {
+			return selector
+		}
+	}
+	return ""
+}
+
+// EvaluatePolicy returns the violations of the policy by the unacknowledged warnings of the migration status
+func EvaluatePolicy(policy Policy, status *model.MigrationStatus) []string {
+	if status == nil || policy.Empty() {
+		return nil
+	}
+
+	var violations []string
+	for _, migratedResource := range status.MigratedResources {
+		for _, warning := range ResourceWarnings(migratedResource) {
+			if selector := matchingSelector(policy.FailOn, warning); selector != "" {
+				violations = append(violations, fmt.Sprintf("%s %s: %s matches '%s'", migratedResource.Kind, resourceKey(migratedResource), FormatWarning(warning), selector))
+			}
+		}
+	}
+
+	for _, threshold := range policy.Thresholds {
+		counts := map[string]int{}
+		for _, migratedResource := range status.MigratedResources {
+			for _, warning := range ResourceWarnings(migratedResource) {
+				if matchingSelector(threshold.Match, warning) != "" {
+					counts[thresholdKey(threshold, migratedResource)]++
+				}
+			}
+		}
+		keys := make([]string, 0, len(counts))
+		for key := range counts {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if counts[key] > threshold.Max {
+				violations = append(violations, fmt.Sprintf("%s has %d warnings matching '%s', the maximum is %d", key, counts[key], strings.Join(threshold.Match, ","), threshold.Max))
+			}
+		}
+	}
+	return violations
+}
+
+// StatusInScope returns the migration status with the migrated resources in the scope of a migration run only
+func StatusInScope(status *model.MigrationStatus, phase string, ingresses []networking.Ingress) *model.MigrationStatus {
+	if status == nil {
+		return nil
+	}
+	selected := map[string]bool{}
+	for _, ingress := range ingresses {
+		selected[ingress.Namespace+"/"+ingress.Name] = true
+	}
+
+	scoped := *status
+	scoped.MigratedResources = nil
+	for _, migratedResource := range status.MigratedResources {
+		switch migratedResource.Kind {
+		case IngressKind:
+			if phase == PhaseConfigMap || !selected[resourceKey(migratedResource)] {
+				continue
+			}
+		default:
+			if phase == PhaseIngress {
+				continue
+			}
+		}
+		scoped.MigratedResources = append(scoped.MigratedResources, migratedResource)
+	}
+	return &scoped
+}
+
+// thresholdKey returns the name of the group the warnings of the resource are counted in
+func thresholdKey(threshold PolicyThreshold, migratedResource model.MigratedResource) string {
+	switch threshold.Per {
+	case PolicyPerCluster:
+		return "the cluster"
+	case PolicyPerResource:
+		return fmt.Sprintf("%s %s", migratedResource.Kind, resourceKey(migratedResource))
+	default:
+		return fmt.Sprintf("namespace %s", migratedResource.Namespace)
+	}
+}
+
+// resourceKey returns the <namespace>/<name> of the migrated resource
+func resourceKey(migratedResource model.MigratedResource) string {
+	return fmt.Sprintf("%s/%s", migratedResource.Namespace, migratedResource.Name)
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/stretchr/testify/assert"
+	networking "k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.yaml")
+	assert.NoError(t, os.WriteFile(policyFile, []byte(`
+failOn:
+- critical
+thresholds:
+- match: ["*_UNSUPPORTED"]
+  max: 3
+- match: [warning]
+  max: 10
+  per: cluster
+`), 0600))
+	invalidFile := filepath.Join(t.TempDir(), "invalid.yaml")
+	assert.NoError(t, os.WriteFile(invalidFile, []byte("failOn: critical\n"), 0600))
+
+	testCases := []struct {
+		description          string
+		path                 string
+		failOn               []string
+		expectedPolicy       Policy
+		expectedErrorMessage string
+	}{
+		{
+			description: "no policy",
+		},
+		{
+			description:    "fail-on option",
+			failOn:         []string{"HSTS_UNSUPPORTED", "TCP_PORT_*"},
+			expectedPolicy: Policy{FailOn: []string{"HSTS_UNSUPPORTED", "TCP_PORT_*"}},
+		},
+		{
+			description: "policy file extended with the fail-on option",
+			path:        policyFile,
+			failOn:      []string{"HSTS_UNSUPPORTED"},
+			expectedPolicy: Policy{
+				FailOn: []string{WarningSeverityCritical, "HSTS_UNSUPPORTED"},
+				Thresholds: []PolicyThreshold{
+					{Match: []string{"*_UNSUPPORTED"}, Max: 3},
+					{Match: []string{WarningSeverityWarning}, Max: 10, Per: PolicyPerCluster},
+				},
+			},
+		},
+		{
+			description:          "missing file",
+			path:                 filepath.Join(t.TempDir(), "missing.yaml"),
+			expectedErrorMessage: "failed to read policy file",
+		},
+		{
+			description:          "invalid file",
+			path:                 invalidFile,
+			expectedErrorMessage: "failed to parse policy file",
+		},
+		{
+			description:          "unknown code",
+			failOn:               []string{"UNKNOWN_CODE"},
+			expectedErrorMessage: "'UNKNOWN_CODE' matches no warning code or severity",
+		},
+		{
+			description:          "invalid pattern",
+			failOn:               []string{"HSTS_["},
+			expectedErrorMessage: "invalid warning code pattern 'HSTS_['",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			policy, err := LoadPolicy(tc.path, tc.failOn)
+			if tc.expectedErrorMessage != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErrorMessage)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPolicy, policy)
+		})
+	}
+}
+
+func TestValidatePolicy(t *testing.T) {
+	testCases := []struct {
+		description          string
+		policy               Policy
+		expectedErrorMessage string
+	}{
+		{
+			description: "valid policy",
+			policy: Policy{
+				FailOn:     []string{WarningSeverityCritical, "APPID_AUTH_*"},
+				Thresholds: []PolicyThreshold{{Match: []string{WarningSeverityInfo}, Max: 0, Per: PolicyPerResource}},
+			},
+		},
+		{
+			description:          "threshold without selectors",
+			policy:               Policy{Thresholds: []PolicyThreshold{{Max: 1}}},
+			expectedErrorMessage: "threshold #1 of the policy must match at least one warning code or severity",
+		},
+		{
+			description:          "threshold with unknown selector",
+			policy:               Policy{Thresholds: []PolicyThreshold{{Match: []string{"fatal"}, Max: 1}}},
+			expectedErrorMessage: "'fatal' matches no warning code or severity",
+		},
+		{
+			description:          "negative maximum",
+			policy:               Policy{Thresholds: []PolicyThreshold{{Match: []string{WarningSeverityWarning}, Max: -1}}},
+			expectedErrorMessage: "the maximum of threshold #1 of the policy must not be negative",
+		},
+		{
+			description:          "unknown scope",
+			policy:               Policy{Thresholds: []PolicyThreshold{{Match: []string{WarningSeverityWarning}, Max: 1, Per: "zone"}}},
+			expectedErrorMessage: "unknown scope 'zone' of threshold #1 of the policy, it must be 'namespace', 'resource' or 'cluster'",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			err := ValidatePolicy(tc.policy)
+			if tc.expectedErrorMessage == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.expectedErrorMessage)
+		})
+	}
+}
+
+func TestEvaluatePolicy(t *testing.T) {
+	status := &model.MigrationStatus{
+		Mode: model.MigrationModeProduction,
+		MigratedResources: []model.MigratedResource{
+			{Kind: IngressKind, Name: "tea-ingress", Namespace: "tea", Warnings: []string{IAMUIAuthWarning, HSTSWarning}},
+			{Kind: IngressKind, Name: "green-tea-ingress", Namespace: "tea", Warnings: []string{HSTSWarning}},
+			{Kind: IngressKind, Name: "coffee-ingress", Namespace: "coffee", Warnings: []string{CustomErrorsWarning},
+				AcknowledgedWarnings: []model.Warning{{Code: "IAM_UI_AUTH_UNSUPPORTED", Severity: WarningSeverityCritical}}},
+		},
+	}
+
+	testCases := []struct {
+		description        string
+		policy             Policy
+		status             *model.MigrationStatus
+		expectedViolations []string
+	}{
+		{
+			description: "no status",
+			policy:      Policy{FailOn: []string{WarningSeverityCritical}},
+		},
+		{
+			description: "empty policy",
+			status:      status,
+		},
+		{
+			description: "fail on severity, the acknowledged warnings are ignored",
+			policy:      Policy{FailOn: []string{WarningSeverityCritical}},
+			status:      status,
+			expectedViolations: []string{
+				"Ingress tea/tea-ingress: [IAM_UI_AUTH_UNSUPPORTED] " + IAMUIAuthWarning + " matches 'critical'",
+			},
+		},
+		{
+			description: "fail on code pattern",
+			policy:      Policy{FailOn: []string{"CUSTOM_ERROR*"}},
+			status:      status,
+			expectedViolations: []string{
+				"Ingress coffee/coffee-ingress: [CUSTOM_ERRORS_UNSUPPORTED] " + CustomErrorsWarning + " matches 'CUSTOM_ERROR*'",
+			},
+		},
+		{
+			description: "threshold per namespace",
+			policy:      Policy{Thresholds: []PolicyThreshold{{Match: []string{"*_UNSUPPORTED"}, Max: 2}}},
+			status:      status,
+			expectedViolations: []string{
+				"namespace tea has 3 warnings matching '*_UNSUPPORTED', the maximum is 2",
+			},
+		},
+		{
+			description: "threshold per resource",
+			policy:      Policy{Thresholds: []PolicyThreshold{{Match: []string{"HSTS_UNSUPPORTED", WarningSeverityCritical}, Max: 1, Per: PolicyPerResource}}},
+			status:      status,
+			expectedViolations: []string{
+				"Ingress tea/tea-ingress has 2 warnings matching 'HSTS_UNSUPPORTED,critical', the maximum is 1",
+			},
+		},
+		{
+			description: "threshold per cluster",
+			policy:      Policy{Thresholds: []PolicyThreshold{{Match: []string{WarningSeverityWarning}, Max: 2, Per: PolicyPerCluster}}},
+			status:      status,
+			expectedViolations: []string{
+				"the cluster has 3 warnings matching 'warning', the maximum is 2",
+			},
+		},
+		{
+			description: "threshold not exceeded",
+			policy:      Policy{Thresholds: []PolicyThreshold{{Match: []string{WarningSeverityWarning}, Max: 3, Per: PolicyPerCluster}}},
+			status:      status,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expectedViolations, EvaluatePolicy(tc.policy, tc.status))
+		})
+	}
+}
+
+func TestStatusInScope(t *testing.T) {
+	configMap := model.MigratedResource{Kind: ConfigMapKind, Name: IKSConfigMapName, Namespace: KubeSystem, Warnings: []string{HSTSWarning}}
+	tea := model.MigratedResource{Kind: IngressKind, Name: "tea-ingress", Namespace: "tea", Warnings: []string{HSTSWarning}}
+	coffee := model.MigratedResource{Kind: IngressKind, Name: "coffee-ingress", Namespace: "coffee", Warnings: []string{HSTSWarning}}
+	status := &model.MigrationStatus{Mode: model.MigrationModeProduction, MigratedResources: []model.MigratedResource{configMap, tea, coffee}}
+	ingresses := []networking.Ingress{{ObjectMeta: metav1.ObjectMeta{Name: "tea-ingress", Namespace: "tea"}}}
+
+	testCases := []struct {
+		description       string
+		status            *model.MigrationStatus
+		phase             string
+		expectedResources []model.MigratedResource
+	}{
+		{
+			description: "no status",
+		},
+		{
+			description:       "both phases",
+			status:            status,
+			phase:             PhaseAll,
+			expectedResources: []model.MigratedResource{configMap, tea},
+		},
+		{
+			description:       "ingress phase",
+			status:            status,
+			phase:             PhaseIngress,
+			expectedResources: []model.MigratedResource{tea},
+		},
+		{
+			description:       "configmap phase",
+			status:            status,
+			phase:             PhaseConfigMap,
+			expectedResources: []model.MigratedResource{configMap},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			scoped := StatusInScope(tc.status, tc.phase, ingresses)
+			if tc.status == nil {
+				assert.Nil(t, scoped)
+				return
+			}
+			assert.Equal(t, tc.expectedResources, scoped.MigratedResources)
+			assert.Len(t, tc.status.MigratedResources, 3)
+		})
+	}
+}
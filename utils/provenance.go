@@ -0,0 +1,163 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// ProvenancePrefix is the prefix of the labels and annotations set by the migration tool to link the generated resources to their source
+	ProvenancePrefix = "ingress-migrator.cloud.ibm.com/"
+
+	// ManagedByLabel is set to FieldManager on every resource generated by the migration tool
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	// MigratedFromLabel contains the name of the source resource in the same namespace, names longer than 63 characters are shortened with a hash
+	MigratedFromLabel = ProvenancePrefix + "migrated-from"
+	// MigrationRunIDLabel contains the ID of the run that generated or last updated the resource, see the NewRunID function
+	MigrationRunIDLabel = ProvenancePrefix + "migration-run-id"
+	// VersionLabel contains the version of the migration tool that generated or last updated the resource
+	VersionLabel = ProvenancePrefix + "version"
+
+	// MigratedFromAnnotation contains the <namespace>/<name> of the source resource
+	MigratedFromAnnotation = ProvenancePrefix + "migrated-from"
+	// MigratedToAnnotation is set on the source ingress resource, it contains the comma separated names of the generated ingress resources
+	MigratedToAnnotation = ProvenancePrefix + "migrated-to"
+	// MigrationRunIDAnnotation is set on the source ingress resource, it contains the ID of the run that migrated it
+	MigrationRunIDAnnotation = ProvenancePrefix + "migration-run-id"
+)
+
+// runID identifies the current run of the migration tool in the provenance labels, see the SetRunID function
+var runID = ""
+
+// GetRunID returns the ID of the current run, it is empty if it was not set
+func GetRunID() string {
+	return runID
+}
+
+// SetRunID sets the ID of the current run
+func SetRunID(id string) {
+	runID = id
+}
+
+// NewRunID returns a new run ID containing the UTC start time of the run and a random suffix, e.g. 20221014-093512-x7k2pq
+func NewRunID() string {
+	suffix, err := RandomString(6)
+	if err != nil {
+		suffix = "000000"
+	}
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102-150405"), suffix)
+}
+
+// SetProvenance sets the provenance labels and annotations on a resource generated from source
+func SetProvenance(meta *v1.ObjectMeta, source *v1.ObjectMeta) {
+	if meta.Labels == nil {
+		meta.Labels = map[string]string{}
+	}
+	meta.Labels[ManagedByLabel] = FieldManager
+	meta.Labels[VersionLabel] = LabelValue(Version)
+	if runID != "" {
+		meta.Labels[MigrationRunIDLabel] = LabelValue(runID)
+	}
+	if source != nil {
+		if meta.Annotations == nil {
+			meta.Annotations = map[string]string{}
+		}
+		meta.Labels[MigratedFromLabel] = LabelValue(source.Name)
+		meta.Annotations[MigratedFromAnnotation] = fmt.Sprintf("%s/%s", source.Namespace, source.Name)
+	}
+}
+
+// HasProvenance returns true if the label or annotation is set by the SetProvenance function
+func HasProvenance(key string) bool {
+	return key == ManagedByLabel || strings.HasPrefix(key, ProvenancePrefix)
+}
+
+// ProvenanceMetadata returns the provenance labels and annotations of the resource
+func ProvenanceMetadata(meta v1.ObjectMeta) (map[string]string, map[string]string) {
+	filter := func(values map[string]string) map[string]string {
+		var filtered map[string]string
+		for key, value := range values {
+			if !HasProvenance(key) || (key == ManagedByLabel && value != FieldManager) {
+				continue
+			}
+			if filtered == nil {
+				filtered = map[string]string{}
+			}
+			filtered[key] = value
+		}
+		return filtered
+	}
+	return filter(meta.Labels), filter(meta.Annotations)
+}
+
+// SourceAnnotations returns the back-reference annotations of the source ingress resource migrated as the generated ingress resources
+func SourceAnnotations(generatedNames []string) map[string]string {
+	annotations := map[string]string{MigratedToAnnotation: strings.Join(generatedNames, ",")}
+	if runID != "" {
+		annotations[MigrationRunIDAnnotation] = runID
+	}
+	return annotations
+}
+
+// setSourceAnnotations replaces the back-reference annotations of the source ingress resource with the annotations
+func setSourceAnnotations(meta *v1.ObjectMeta, annotations map[string]string) {
+	delete(meta.Annotations, MigratedToAnnotation)
+	delete(meta.Annotations, MigrationRunIDAnnotation)
+	if len(annotations) == 0 {
+		return
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	for key, value := range annotations {
+		meta.Annotations[key] = value
+	}
+}
+
+// MigratedFromSelector returns the label selector of the resources generated from the source resource
+func MigratedFromSelector(sourceName string) string {
+	return labels.SelectorFromSet(labels.Set{ManagedByLabel: FieldManager, MigratedFromLabel: LabelValue(sourceName)}).String()
+}
+
+// LabelValue returns the value shortened to a valid label value
+func LabelValue(value string) string {
+	if len(validation.IsValidLabelValue(value)) == 0 {
+		return value
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(value)))[:10]
+	var b strings.Builder
+	for _, r := range value {
+		if b.Len() >= validation.LabelValueMaxLength-len(hash)-1 {
+			break
+		}
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	prefix := strings.Trim(b.String(), "-_.")
+	if prefix == "" {
+		return hash
+	}
+	return prefix + "-" + hash
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestLabelValue(t *testing.T) {
+	longName := strings.Repeat("a", 70)
+
+	testCases := []struct {
+		description string
+		value       string
+		expected    string
+	}{
+		{
+			description: "valid value",
+			value:       "tea-ingress",
+			expected:    "tea-ingress",
+		},
+		{
+			description: "empty value",
+			value:       "",
+			expected:    "",
+		},
+		{
+			description: "invalid characters are replaced",
+			value:       "v1.2.3+dirty",
+			expected:    "v1.2.3-dirty-4a97a16609",
+		},
+		{
+			description: "long value is shortened",
+			value:       longName,
+			expected:    strings.Repeat("a", 52) + "-6bd5e50348",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			actual := LabelValue(tc.value)
+			assert.Equal(t, tc.expected, actual)
+			assert.Empty(t, validation.IsValidLabelValue(actual))
+		})
+	}
+
+	// the hash keeps the shortened values unique
+	assert.NotEqual(t, LabelValue(longName), LabelValue(longName+"b"))
+}
+
+func TestSetProvenance(t *testing.T) {
+	defer SetRunID(GetRunID())
+	source := &v1.ObjectMeta{Name: "tea-ingress", Namespace: "default"}
+
+	testCases := []struct {
+		description         string
+		runID               string
+		meta                v1.ObjectMeta
+		source              *v1.ObjectMeta
+		expectedLabels      map[string]string
+		expectedAnnotations map[string]string
+	}{
+		{
+			description: "generated from source",
+			runID:       "20221014-093512-x7k2pq",
+			meta:        v1.ObjectMeta{Name: "tea-ingress-server", Annotations: map[string]string{IngressClassAnnotation: PublicIngressClass}},
+			source:      source,
+			expectedLabels: map[string]string{
+				ManagedByLabel:      FieldManager,
+				VersionLabel:        Version,
+				MigrationRunIDLabel: "20221014-093512-x7k2pq",
+				MigratedFromLabel:   "tea-ingress",
+			},
+			expectedAnnotations: map[string]string{
+				IngressClassAnnotation: PublicIngressClass,
+				MigratedFromAnnotation: "default/tea-ingress",
+			},
+		},
+		{
+			description: "generated from multiple sources without run ID",
+			meta:        v1.ObjectMeta{Name: GenericK8sTCPConfigMapName, Labels: map[string]string{"app": "ingress"}},
+			expectedLabels: map[string]string{
+				"app":          "ingress",
+				ManagedByLabel: FieldManager,
+				VersionLabel:   Version,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			SetRunID(tc.runID)
+			SetProvenance(&tc.meta, tc.source)
+			assert.Equal(t, tc.expectedLabels, tc.meta.Labels)
+			assert.Equal(t, tc.expectedAnnotations, tc.meta.Annotations)
+		})
+	}
+}
+
+func TestProvenanceMetadata(t *testing.T) {
+	meta := v1.ObjectMeta{
+		Labels: map[string]string{
+			"app":             "ingress",
+			ManagedByLabel:    FieldManager,
+			VersionLabel:      "v1.0.0",
+			MigratedFromLabel: "tea-ingress",
+		},
+		Annotations: map[string]string{
+			IngressClassAnnotation: PublicIngressClass,
+			MigratedFromAnnotation: "default/tea-ingress",
+		},
+	}
+	actualLabels, actualAnnotations := ProvenanceMetadata(meta)
+	assert.Equal(t, map[string]string{ManagedByLabel: FieldManager, VersionLabel: "v1.0.0", MigratedFromLabel: "tea-ingress"}, actualLabels)
+	assert.Equal(t, map[string]string{MigratedFromAnnotation: "default/tea-ingress"}, actualAnnotations)
+
+	// the managed-by label set by other tools is not applied
+	actualLabels, actualAnnotations = ProvenanceMetadata(v1.ObjectMeta{Labels: map[string]string{ManagedByLabel: "Helm"}})
+	assert.Nil(t, actualLabels)
+	assert.Nil(t, actualAnnotations)
+}
+
+func TestSetSourceAnnotations(t *testing.T) {
+	defer SetRunID(GetRunID())
+	SetRunID("20221014-093512-x7k2pq")
+
+	meta := v1.ObjectMeta{Annotations: map[string]string{IngressClassAnnotation: "iks-nginx"}}
+	setSourceAnnotations(&meta, SourceAnnotations([]string{"tea-ingress-server", "tea-ingress-tea-svc-tea"}))
+	assert.Equal(t, map[string]string{
+		IngressClassAnnotation:   "iks-nginx",
+		MigratedToAnnotation:     "tea-ingress-server,tea-ingress-tea-svc-tea",
+		MigrationRunIDAnnotation: "20221014-093512-x7k2pq",
+	}, meta.Annotations)
+
+	setSourceAnnotations(&meta, nil)
+	assert.Equal(t, map[string]string{IngressClassAnnotation: "iks-nginx"}, meta.Annotations)
+}
+
+func TestMigratedFromSelector(t *testing.T) {
+	generated := v1.ObjectMeta{Name: "tea-ingress-server"}
+	SetProvenance(&generated, &v1.ObjectMeta{Name: "tea-ingress", Namespace: "default"})
+
+	selector, err := labels.Parse(MigratedFromSelector("tea-ingress"))
+	assert.NoError(t, err)
+	assert.True(t, selector.Matches(labels.Set(generated.Labels)))
+
+	selector, err = labels.Parse(MigratedFromSelector("coffee-ingress"))
+	assert.NoError(t, err)
+	assert.False(t, selector.Matches(labels.Set(generated.Labels)))
+}
@@ -0,0 +1,386 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/ghodss/yaml"
+	"go.uber.org/zap"
+)
+
+const (
+	// ReportFormatText prints the migration details in colored text to the standard output, see the PrintStatus function
+	ReportFormatText = "text"
+	// ReportFormatJSON saves the migration report in JSON format
+	ReportFormatJSON = "json"
+	// ReportFormatYAML saves the migration report in YAML format
+	ReportFormatYAML = "yaml"
+	// ReportFormatMarkdown saves the migration report in Markdown format, e.g. to comment it on a pull request
+	ReportFormatMarkdown = "markdown"
+	// ReportFormatHTML saves the migration report as an HTML page with the source and generated manifests side by side
+	ReportFormatHTML = "html"
+	// ReportFormatJUnit saves the migration report in JUnit XML format, every migrated resource is a test case
+	ReportFormatJUnit = "junit"
+
+	// ReportFileName is the name of the report files in the output directory, the extension depends on the format
+	ReportFileName = "migration-report"
+	// DefaultReportFormat is the default format of the migration report
+	DefaultReportFormat = ReportFormatText
+
+	markdownReportTemplate = "report.md.tmpl"
+	htmlReportTemplate     = "report.html.tmpl"
+)
+
+// reportFileExtensions contains the file extensions of the report formats saved into the output directory
+var reportFileExtensions = map[string]string{
+	ReportFormatJSON:     ".json",
+	ReportFormatYAML:     ".yaml",
+	ReportFormatMarkdown: ".md",
+	ReportFormatHTML:     ".html",
+	ReportFormatJUnit:    ".xml",
+}
+
+// ValidateReportFormats returns an error if a report format is unknown
+func ValidateReportFormats(formats []string) error {
+	for _, format := range formats {
+		if _, known := reportFileExtensions[format]; !known && format != ReportFormatText {
+			return fmt.Errorf("unknown report format '%s'", format)
+		}
+	}
+	return nil
+}
+
+// ReportFilePath returns the path of the report file of the format in the output directory
+func ReportFilePath(outputDir, format string) string {
+	return filepath.Join(outputDir, ReportFileName+reportFileExtensions[format])
+}
+
+// ManifestKey returns the key of a resource manifest in the migration report
+func ManifestKey(kind, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
+
+// NewReport returns the migration report of the command based on the recorded migration status (status may be nil)
+func NewReport(command string, connection ConnectionInfo, status *model.MigrationStatus) *model.Report {
+	report := &model.Report{
+		Command:           command,
+		RunID:             runID,
+		Version:           Version,
+		GeneratedAt:       time.Now().UTC().Truncate(time.Second),
+		Context:           connection.Context,
+		Identity:          connection.Identity(),
+		MigratedResources: []model.MigratedResource{},
+	}
+	if status != nil {
+		report.Mode = status.Mode
+		report.Scope = status.Scope
+		report.SubdomainMap = status.SubdomainMap
+		for _, migratedResource := range status.MigratedResources {
+			migratedResource.WarningDetails = ResourceWarnings(migratedResource)
+			report.MigratedResources = append(report.MigratedResources, migratedResource)
+		}
+	}
+	return report
+}
+
+// AddReportManifests adds the manifests of the source and generated resources to the report
+func AddReportManifests(ctx context.Context, kc KubeClient, report *model.Report, logger *zap.Logger) {
+	report.Manifests = map[string]string{}
+	add := func(kind, namespace, name string, obj interface{}, err error) {
+		if err != nil {
+			logger.Warn("could not read the manifest of the report", zap.String("kind", kind), zap.String("name", name), zap.String("namespace", namespace), zap.Error(err))
+			return
+		}
+		manifest, err := reportManifest(kind, obj)
+		if err != nil {
+			logger.Warn("could not marshal the manifest of the report", zap.String("kind", kind), zap.String("name", name), zap.String("namespace", namespace), zap.Error(err))
+			return
+		}
+		report.Manifests[ManifestKey(kind, namespace, name)] = manifest
+	}
+
+	for _, migratedResource := range report.MigratedResources {
+		switch migratedResource.Kind {
+		case IngressKind:
+			ingress, err := kc.GetIngress(ctx, migratedResource.Name, migratedResource.Namespace)
+			add(IngressKind, migratedResource.Namespace, migratedResource.Name, ingress, err)
+		case ConfigMapKind:
+			cm, err := kc.GetConfigMap(ctx, migratedResource.Name, migratedResource.Namespace)
+			add(ConfigMapKind, migratedResource.Namespace, migratedResource.Name, cm, err)
+		}
+
+		for _, generated := range migratedResource.MigratedAs {
+			kind, name, found := strings.Cut(generated, "/")
+			if !found {
+				continue
+			}
+			switch kind {
+			case IngressKind:
+				if ingress, recorded := kc.GetIngressContainer()[migratedResource.Namespace][name]; recorded {
+					add(kind, migratedResource.Namespace, name, ingress, nil)
+				} else {
+					ingress, err := kc.GetIngress(ctx, name, migratedResource.Namespace)
+					add(kind, migratedResource.Namespace, name, ingress, err)
+				}
+			case ConfigMapKind:
+				// the configmaps are generated in the kube-system namespace
+				if cm, recorded := kc.GetConfigMapContainer()[KubeSystem][name]; recorded {
+					add(kind, KubeSystem, name, cm, nil)
+				} else {
+					cm, err := kc.GetConfigMap(ctx, name, KubeSystem)
+					add(kind, KubeSystem, name, cm, err)
+				}
+			}
+		}
+	}
+}
+
+// reportManifest returns the YAML manifest of the resource without its managed fields and status
+func reportManifest(kind string, obj interface{}) (string, error) {
+	objBytes, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(objBytes, &object); err != nil {
+		return "", err
+	}
+	// the type meta is not set on the resources read via the typed client
+	if _, set := object["kind"]; !set {
+		object["kind"] = kind
+	}
+	if metadata, isMap := object["metadata"].(map[string]interface{}); isMap {
+		delete(metadata, "managedFields")
+	}
+	delete(object, "status")
+
+	manifest, err := yaml.Marshal(object)
+	return string(manifest), err
+}
+
+// WriteReports saves the migration report into the output directory in every format except text
+func WriteReports(outputDir string, formats []string, report model.Report) error {
+	for _, format := range formats {
+		if format == ReportFormatText {
+			continue
+		}
+		var buffer bytes.Buffer
+		if err := WriteReport(&buffer, format, report); err != nil {
+			return fmt.Errorf("error writing %s report: %v", format, err)
+		}
+		if err := os.WriteFile(ReportFilePath(outputDir, format), buffer.Bytes(), 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteReport writes the migration report in the format
+func WriteReport(w io.Writer, format string, report model.Report) error {
+	switch format {
+	case ReportFormatJSON:
+		reportJSON, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(reportJSON, '\n'))
+		return err
+	case ReportFormatYAML:
+		reportYAML, err := yaml.Marshal(report)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(reportYAML)
+		return err
+	case ReportFormatMarkdown:
+		tmpl, err := template.New(markdownReportTemplate).Funcs(template.FuncMap{"cell": markdownCell, "warnings": ResourceWarnings}).ParseFS(files, filepath.Join(templatesDir, markdownReportTemplate))
+		if err != nil {
+			return err
+		}
+		return tmpl.Execute(w, report)
+	case ReportFormatHTML:
+		tmpl, err := htmltemplate.New(htmlReportTemplate).Funcs(htmltemplate.FuncMap{"warnings": ResourceWarnings}).ParseFS(files, filepath.Join(templatesDir, htmlReportTemplate))
+		if err != nil {
+			return err
+		}
+		return tmpl.Execute(w, newHTMLReport(report))
+	case ReportFormatJUnit:
+		return writeJUnitReport(w, report)
+	default:
+		return fmt.Errorf("unknown report format '%s'", format)
+	}
+}
+
+// markdownCell escapes the value, so it can be written into a cell of a Markdown table
+func markdownCell(value string) string {
+	return strings.NewReplacer("|", "\\|", "\n", "<br>").Replace(value)
+}
+
+// htmlReport is the view of the migration report rendered by the HTML template
+type htmlReport struct {
+	model.Report
+	Resources []htmlReportResource
+}
+
+// htmlReportResource is a migrated resource with its source and generated manifests
+type htmlReportResource struct {
+	model.MigratedResource
+	Source    string
+	Generated []htmlReportManifest
+}
+
+// htmlReportManifest is the manifest of a generated resource
+type htmlReportManifest struct {
+	Name      string
+	Unchanged bool
+	Manifest  string
+}
+
+func newHTMLReport(report model.Report) htmlReport {
+	view := htmlReport{Report: report}
+	for _, migratedResource := range report.MigratedResources {
+		resource := htmlReportResource{
+			MigratedResource: migratedResource,
+			Source:           report.Manifests[ManifestKey(migratedResource.Kind, migratedResource.Namespace, migratedResource.Name)],
+		}
+		for _, generated := range migratedResource.MigratedAs {
+			kind, name, _ := strings.Cut(generated, "/")
+			namespace := migratedResource.Namespace
+			if kind == ConfigMapKind {
+				namespace = KubeSystem
+			}
+			resource.Generated = append(resource.Generated, htmlReportManifest{
+				Name:      generated,
+				Unchanged: ItemInSlice(generated, migratedResource.Unchanged),
+				Manifest:  report.Manifests[ManifestKey(kind, namespace, name)],
+			})
+		}
+		view.Resources = append(view.Resources, resource)
+	}
+	return view
+}
+
+// junitTestSuites is the root element of the JUnit XML report
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnitReport writes the migration report in JUnit XML format
+func writeJUnitReport(w io.Writer, report model.Report) error {
+	suite := junitTestSuite{
+		Name:      "ingress-migration",
+		Timestamp: report.GeneratedAt.Format(time.RFC3339),
+		Properties: []junitProperty{
+			{Name: "command", Value: report.Command},
+			{Name: "runId", Value: report.RunID},
+			{Name: "mode", Value: report.Mode},
+			{Name: "version", Value: report.Version},
+		},
+	}
+	for _, migratedResource := range report.MigratedResources {
+		testCase := junitTestCase{
+			Name:      fmt.Sprintf("%s/%s", migratedResource.Namespace, migratedResource.Name),
+			ClassName: migratedResource.Kind,
+		}
+		if len(migratedResource.Errors) > 0 {
+			testCase.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d migration error(s)", len(migratedResource.Errors)),
+				Type:    "MigrationError",
+				Text:    strings.Join(migratedResource.Errors, "\n"),
+			}
+			suite.Failures++
+		}
+		var output []string
+		for _, generated := range migratedResource.MigratedAs {
+			output = append(output, "migrated to: "+generated)
+		}
+		for _, warning := range ResourceWarnings(migratedResource) {
+			output = append(output, fmt.Sprintf("%s: %s", warning.Severity, FormatWarning(warning)))
+		}
+		for _, warning := range migratedResource.AcknowledgedWarnings {
+			output = append(output, fmt.Sprintf("acknowledged: %s", FormatWarning(warning)))
+		}
+		testCase.SystemOut = strings.Join(output, "\n")
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	if report.Summary != nil && len(report.Summary.PolicyViolations) > 0 {
+		suite.TestCases = append(suite.TestCases, junitTestCase{
+			Name:      "migration policy",
+			ClassName: "Policy",
+			Failure: &junitFailure{
+				Message: fmt.Sprintf("%d policy violation(s)", len(report.Summary.PolicyViolations)),
+				Type:    "PolicyViolation",
+				Text:    strings.Join(report.Summary.PolicyViolations, "\n"),
+			},
+		})
+		suite.Failures++
+	}
+	suite.Tests = len(suite.TestCases)
+
+	suites := junitTestSuites{Name: "ingress-migrator", Tests: suite.Tests, Failures: suite.Failures, Suites: []junitTestSuite{suite}}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
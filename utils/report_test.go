@@ -0,0 +1,264 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	networking "k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testReport returns a migration report with a migrated, a failed and a pipe-named resource with an HTML warning
+func testReport() model.Report {
+	return model.Report{
+		Command:     migrateCommandName,
+		RunID:       "20221014-093512-x7k2pq",
+		Version:     "v1.2.3",
+		GeneratedAt: time.Date(2022, 10, 14, 9, 35, 12, 0, time.UTC),
+		Mode:        model.MigrationModeProduction,
+		Context:     "tea-cluster",
+		Identity:    "admin",
+		Summary:     &model.Summary{Command: migrateCommandName, Result: ResultPartial, ExitCode: ExitCodePartialMigration, MigratedResources: 2, ResourcesWithWarnings: 1, ResourcesWithErrors: 1},
+		MigratedResources: []model.MigratedResource{
+			{Kind: IngressKind, Name: "tea-ingress", Namespace: "default", MigratedAs: []string{"Ingress/tea-ingress-server"}, Warnings: []string{"<script>alert('tea')</script> | unsupported"}, Unchanged: []string{"Ingress/tea-ingress-server"}},
+			{Kind: IngressKind, Name: "coffee-ingress", Namespace: "default", Errors: []string{"error creating ingress resource"}},
+		},
+		Manifests: map[string]string{
+			ManifestKey(IngressKind, "default", "tea-ingress"):        "kind: Ingress\nmetadata:\n  name: tea-ingress\n",
+			ManifestKey(IngressKind, "default", "tea-ingress-server"): "kind: Ingress\nmetadata:\n  name: tea-ingress-server\n",
+		},
+	}
+}
+
+func TestValidateReportFormats(t *testing.T) {
+	assert.NoError(t, ValidateReportFormats(nil))
+	assert.NoError(t, ValidateReportFormats([]string{ReportFormatText, ReportFormatJSON, ReportFormatYAML, ReportFormatMarkdown, ReportFormatHTML, ReportFormatJUnit}))
+	assert.EqualError(t, ValidateReportFormats([]string{ReportFormatJSON, "pdf"}), "unknown report format 'pdf'")
+}
+
+func TestWriteReport(t *testing.T) {
+	testCases := []struct {
+		format           string
+		expectedContents []string
+		notExpected      []string
+	}{
+		{
+			format:           ReportFormatJSON,
+			expectedContents: []string{`"runId": "20221014-093512-x7k2pq"`, `"generatedAt": "2022-10-14T09:35:12Z"`, `"result": "partial"`},
+			notExpected:      []string{"manifests", "kind: Ingress"},
+		},
+		{
+			format:           ReportFormatYAML,
+			expectedContents: []string{"runId: 20221014-093512-x7k2pq", "- Ingress/tea-ingress-server", "exitCode: 4"},
+		},
+		{
+			format: ReportFormatMarkdown,
+			expectedContents: []string{
+				"| Result | **partial** (exit code 4) |",
+				"| Ingress | default | tea-ingress | `Ingress/tea-ingress-server` | 1 | 0 |",
+				"### Ingress default/coffee-ingress",
+				"- **UNKNOWN** (warning): <script>",
+				"- error creating ingress resource",
+			},
+		},
+		{
+			format: ReportFormatHTML,
+			expectedContents: []string{
+				"<h2>Ingress default/tea-ingress</h2>",
+				"<pre>kind: Ingress\nmetadata:\n  name: tea-ingress-server\n</pre>",
+				"&lt;script&gt;alert(&#39;tea&#39;)&lt;/script&gt; | unsupported",
+				`<span class="unchanged">(unchanged)</span>`,
+				"<strong>UNKNOWN</strong> (warning)",
+				"<p>No generated resources.</p>",
+			},
+			notExpected: []string{"<script>"},
+		},
+		{
+			format:           ReportFormatJUnit,
+			expectedContents: []string{`<testsuites name="ingress-migrator" tests="2" failures="1">`, `<failure message="1 migration error(s)" type="MigrationError">error creating ingress resource</failure>`},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			var buffer bytes.Buffer
+			assert.NoError(t, WriteReport(&buffer, tc.format, testReport()))
+			for _, expected := range tc.expectedContents {
+				assert.Contains(t, buffer.String(), expected)
+			}
+			for _, notExpected := range tc.notExpected {
+				assert.NotContains(t, buffer.String(), notExpected)
+			}
+		})
+	}
+
+	assert.EqualError(t, WriteReport(&bytes.Buffer{}, "pdf", testReport()), "unknown report format 'pdf'")
+}
+
+func TestWriteReportPolicyViolations(t *testing.T) {
+	report := testReport()
+	report.Summary = &model.Summary{
+		Result:           ResultPolicyViolation,
+		ExitCode:         ExitCodePolicyViolation,
+		Error:            "the migration policy was violated: namespace default has 2 warnings matching 'critical', the maximum is 1",
+		PolicyViolations: []string{"namespace default has 2 warnings matching 'critical', the maximum is 1"},
+	}
+
+	testCases := []struct {
+		format           string
+		expectedContents []string
+	}{
+		{
+			format:           ReportFormatMarkdown,
+			expectedContents: []string{"| Policy violations | namespace default has 2 warnings matching 'critical', the maximum is 1 |"},
+		},
+		{
+			format:           ReportFormatHTML,
+			expectedContents: []string{`<tr><td>Policy violations</td><td class="error">namespace default has 2 warnings matching &#39;critical&#39;, the maximum is 1</td></tr>`},
+		},
+		{
+			format: ReportFormatJUnit,
+			expectedContents: []string{
+				`<testsuites name="ingress-migrator" tests="3" failures="2">`,
+				`<failure message="1 policy violation(s)" type="PolicyViolation">namespace default has 2 warnings matching &#39;critical&#39;, the maximum is 1</failure>`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			var buffer bytes.Buffer
+			assert.NoError(t, WriteReport(&buffer, tc.format, report))
+			for _, expected := range tc.expectedContents {
+				assert.Contains(t, buffer.String(), expected)
+			}
+			assert.NotContains(t, buffer.String(), "the migration policy was violated")
+		})
+	}
+}
+
+func TestWriteReportAcknowledgedWarnings(t *testing.T) {
+	report := testReport()
+	report.MigratedResources[0].AcknowledgedWarnings = []model.Warning{
+		{Code: "HSTS_UNSUPPORTED", Severity: WarningSeverityWarning, Acknowledgement: &model.Acknowledgement{Code: "HSTS_UNSUPPORTED", Reason: "planned", Expires: "2023-06-30"}},
+		// recorded by hand or by an older version without the acknowledgement
+		{Code: "CUSTOM_PORT_UNSUPPORTED", Severity: WarningSeverityWarning},
+	}
+
+	for _, format := range []string{ReportFormatMarkdown, ReportFormatHTML} {
+		t.Run(format, func(t *testing.T) {
+			var buffer bytes.Buffer
+			assert.NoError(t, WriteReport(&buffer, format, report))
+			assert.Contains(t, buffer.String(), "acknowledged until 2023-06-30, planned")
+			assert.Contains(t, buffer.String(), "CUSTOM_PORT_UNSUPPORTED")
+		})
+	}
+}
+
+func TestWriteReportRoundTrip(t *testing.T) {
+	report := testReport()
+
+	var jsonBuffer bytes.Buffer
+	assert.NoError(t, WriteReport(&jsonBuffer, ReportFormatJSON, report))
+	var jsonReport model.Report
+	assert.NoError(t, json.Unmarshal(jsonBuffer.Bytes(), &jsonReport))
+
+	var yamlBuffer bytes.Buffer
+	assert.NoError(t, WriteReport(&yamlBuffer, ReportFormatYAML, report))
+	var yamlReport model.Report
+	assert.NoError(t, yaml.Unmarshal(yamlBuffer.Bytes(), &yamlReport))
+
+	// the manifests are rendered in the HTML report only
+	report.Manifests = nil
+	assert.Equal(t, report, jsonReport)
+	assert.Equal(t, report, yamlReport)
+
+	var junitBuffer bytes.Buffer
+	assert.NoError(t, WriteReport(&junitBuffer, ReportFormatJUnit, report))
+	var suites junitTestSuites
+	assert.NoError(t, xml.Unmarshal(junitBuffer.Bytes(), &suites))
+	assert.Len(t, suites.Suites, 1)
+	assert.Len(t, suites.Suites[0].TestCases, 2)
+	assert.Equal(t, "default/tea-ingress", suites.Suites[0].TestCases[0].Name)
+	assert.Equal(t, IngressKind, suites.Suites[0].TestCases[0].ClassName)
+	assert.Nil(t, suites.Suites[0].TestCases[0].Failure)
+	assert.Equal(t, "migrated to: Ingress/tea-ingress-server\nwarning: [UNKNOWN] <script>alert('tea')</script> | unsupported", suites.Suites[0].TestCases[0].SystemOut)
+	assert.NotNil(t, suites.Suites[0].TestCases[1].Failure)
+}
+
+func TestWriteReports(t *testing.T) {
+	outputDir := t.TempDir()
+	assert.NoError(t, WriteReports(outputDir, []string{ReportFormatText, ReportFormatJSON, ReportFormatJUnit}, testReport()))
+
+	entries, err := os.ReadDir(outputDir)
+	assert.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"migration-report.json", "migration-report.xml"}, names)
+}
+
+func TestAddReportManifests(t *testing.T) {
+	logger := zap.NewNop()
+	kc, err := NewFileKubeClient(writeTestManifests(t, map[string]string{"manifests.yaml": `
+apiVersion: networking.k8s.io/v1beta1
+kind: Ingress
+metadata:
+  name: tea-ingress
+  namespace: default
+spec:
+  rules:
+  - host: tea.example.com
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ibm-cloud-provider-ingress-cm
+  namespace: kube-system
+data:
+  keep-alive: "8s"
+`}), logger)
+	assert.NoError(t, err)
+
+	generated := networking.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "tea-ingress-server", Namespace: "default"}}
+	assert.NoError(t, kc.CreateOrUpdateIngress(context.Background(), generated))
+
+	report := NewReport(migrateCommandName, ConnectionInfo{}, &model.MigrationStatus{
+		Mode: model.MigrationModeProduction,
+		MigratedResources: []model.MigratedResource{
+			{Kind: IngressKind, Name: "tea-ingress", Namespace: "default", MigratedAs: []string{"Ingress/tea-ingress-server", "Ingress/tea-ingress-missing"}},
+			{Kind: ConfigMapKind, Name: IKSConfigMapName, Namespace: KubeSystem, MigratedAs: []string{"ConfigMap/" + K8sConfigMapName}},
+		},
+	})
+	AddReportManifests(context.Background(), kc, report, logger)
+
+	assert.Contains(t, report.Manifests[ManifestKey(IngressKind, "default", "tea-ingress")], "host: tea.example.com")
+	assert.Contains(t, report.Manifests[ManifestKey(IngressKind, "default", "tea-ingress")], "kind: Ingress")
+	assert.Contains(t, report.Manifests[ManifestKey(IngressKind, "default", "tea-ingress-server")], "name: tea-ingress-server")
+	assert.Contains(t, report.Manifests[ManifestKey(ConfigMapKind, KubeSystem, IKSConfigMapName)], "keep-alive: 8s")
+	assert.NotContains(t, report.Manifests, ManifestKey(IngressKind, "default", "tea-ingress-missing"))
+	assert.NotContains(t, report.Manifests, ManifestKey(ConfigMapKind, KubeSystem, K8sConfigMapName))
+}
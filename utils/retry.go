@@ -0,0 +1,122 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+// maxRetryDelay is the maximum delay of the retries of the requests failed with a transient error
+const maxRetryDelay = 30 * time.Second
+
+// RetryBackoff returns the backoff of the requests failed with a transient error
+func RetryBackoff(retries int) wait.Backoff {
+	return wait.Backoff{
+		Duration: 500 * time.Millisecond,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    retries,
+	}
+}
+
+// IsRetriableError returns true if the request failed with a transient error
+func IsRetriableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if _, suggestsDelay := k8sErrors.SuggestsClientDelay(err); suggestsDelay {
+		return true
+	}
+	if k8sErrors.IsTooManyRequests(err) || k8sErrors.IsServerTimeout(err) || k8sErrors.IsTimeout(err) ||
+		k8sErrors.IsInternalError(err) || k8sErrors.IsServiceUnavailable(err) || k8sErrors.IsUnexpectedServerError(err) {
+		return true
+	}
+	var status k8sErrors.APIStatus
+	if errors.As(err, &status) && status.Status().Code >= 500 {
+		return true
+	}
+	if utilnet.IsConnectionReset(err) || utilnet.IsConnectionRefused(err) || utilnet.IsProbableEOF(err) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// IsResourceVersionConflict returns true if the resource was changed since it was read
+func IsResourceVersionConflict(err error) bool {
+	if !k8sErrors.IsConflict(err) {
+		return false
+	}
+	var status k8sErrors.APIStatus
+	if errors.As(err, &status) && status.Status().Details != nil {
+		for _, cause := range status.Status().Details.Causes {
+			if cause.Type == v1.CauseTypeFieldManagerConflict {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// RetryOnConflict calls update again if the resource was changed since it was read
+func RetryOnConflict(update func() error) error {
+	return retry.OnError(retry.DefaultRetry, IsResourceVersionConflict, update)
+}
+
+// retryOnError calls request again until it succeeds or fails with an error that is not retriable
+func retryOnError(ctx context.Context, backoff wait.Backoff, logger *zap.Logger, operation string, request func() error) error {
+	for {
+		err := request()
+		if err == nil || !IsRetriableError(err) || backoff.Steps < 1 || ctx.Err() != nil {
+			return err
+		}
+
+		delay := retryDelay(&backoff, err)
+		logger.Warn("request failed with a transient error, retrying", zap.String("operation", operation), zap.Duration("delay", delay), zap.Int("remainingRetries", backoff.Steps), zap.Error(err))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryDelay returns the delay of the next retry of the request failed with the error
+func retryDelay(backoff *wait.Backoff, err error) time.Duration {
+	delay := backoff.Step()
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	// the delay of the backoff stops growing, so it does not overflow after many retries
+	if backoff.Duration > maxRetryDelay {
+		backoff.Duration = maxRetryDelay
+	}
+	if seconds, suggestsDelay := k8sErrors.SuggestsClientDelay(err); suggestsDelay && time.Duration(seconds)*time.Second > delay {
+		delay = time.Duration(seconds) * time.Second
+	}
+	return delay
+}
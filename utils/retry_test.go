@@ -0,0 +1,199 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	v12 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestIsRetriableError(t *testing.T) {
+	configMaps := v12.Resource("configmaps")
+
+	testCases := []struct {
+		description string
+		err         error
+		expected    bool
+	}{
+		{
+			description: "no error",
+		},
+		{
+			description: "too many requests",
+			err:         k8sErrors.NewTooManyRequests("the server is overloaded", 1),
+			expected:    true,
+		},
+		{
+			description: "internal server error",
+			err:         k8sErrors.NewInternalError(fmt.Errorf("etcd leader changed")),
+			expected:    true,
+		},
+		{
+			description: "service unavailable",
+			err:         k8sErrors.NewServiceUnavailable("the API server is shutting down"),
+			expected:    true,
+		},
+		{
+			description: "bad gateway",
+			err:         k8sErrors.NewGenericServerResponse(502, "PATCH", configMaps, MigrationStatusConfigMapName, "", 0, false),
+			expected:    true,
+		},
+		{
+			description: "server timeout",
+			err:         k8sErrors.NewServerTimeout(configMaps, "get", 0),
+			expected:    true,
+		},
+		{
+			description: "connection reset",
+			err:         &url.Error{Op: "Get", URL: "https://cluster.example.com", Err: syscall.ECONNRESET},
+			expected:    true,
+		},
+		{
+			description: "unexpected EOF",
+			err:         &url.Error{Op: "Get", URL: "https://cluster.example.com", Err: io.ErrUnexpectedEOF},
+			expected:    true,
+		},
+		{
+			description: "not found",
+			err:         k8sErrors.NewNotFound(configMaps, MigrationStatusConfigMapName),
+		},
+		{
+			description: "conflict",
+			err:         k8sErrors.NewConflict(configMaps, MigrationStatusConfigMapName, fmt.Errorf("the object has been modified")),
+		},
+		{
+			description: "forbidden",
+			err:         k8sErrors.NewForbidden(configMaps, MigrationStatusConfigMapName, fmt.Errorf("access denied")),
+		},
+		{
+			description: "canceled context",
+			err:         context.Canceled,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expected, IsRetriableError(tc.err))
+		})
+	}
+}
+
+func TestIsResourceVersionConflict(t *testing.T) {
+	configMaps := v12.Resource("configmaps")
+	fieldManagerConflict := k8sErrors.NewApplyConflict([]v1.StatusCause{{Type: v1.CauseTypeFieldManagerConflict, Field: ".data.ssl-protocols"}}, "conflict with \"kubectl\"")
+
+	assert.True(t, IsResourceVersionConflict(k8sErrors.NewConflict(configMaps, K8sConfigMapName, fmt.Errorf("the object has been modified"))))
+	assert.True(t, IsResourceVersionConflict(fmt.Errorf("wrapped: %w", k8sErrors.NewConflict(configMaps, K8sConfigMapName, fmt.Errorf("the object has been modified")))))
+	assert.False(t, IsResourceVersionConflict(fieldManagerConflict))
+	assert.False(t, IsResourceVersionConflict(applyError(ConfigMapKind, KubeSystem, K8sConfigMapName, fieldManagerConflict)))
+	assert.False(t, IsResourceVersionConflict(k8sErrors.NewNotFound(configMaps, K8sConfigMapName)))
+	assert.False(t, IsResourceVersionConflict(nil))
+}
+
+func TestRetryOnError(t *testing.T) {
+	backoff := wait.Backoff{Duration: time.Millisecond, Factor: 2, Steps: 3}
+	unavailable := k8sErrors.NewServiceUnavailable("the API server is shutting down")
+
+	testCases := []struct {
+		description      string
+		failures         []error
+		cancel           bool
+		expectedError    error
+		expectedRequests int
+	}{
+		{
+			description:      "success",
+			expectedRequests: 1,
+		},
+		{
+			description:      "success after transient errors",
+			failures:         []error{unavailable, k8sErrors.NewTooManyRequests("the server is overloaded", 0)},
+			expectedRequests: 3,
+		},
+		{
+			description:      "retries exhausted",
+			failures:         []error{unavailable, unavailable, unavailable, unavailable, unavailable},
+			expectedError:    unavailable,
+			expectedRequests: 4,
+		},
+		{
+			description:      "error is not retried",
+			failures:         []error{k8sErrors.NewNotFound(v12.Resource("configmaps"), K8sConfigMapName)},
+			expectedError:    k8sErrors.NewNotFound(v12.Resource("configmaps"), K8sConfigMapName),
+			expectedRequests: 1,
+		},
+		{
+			description:      "context canceled",
+			failures:         []error{unavailable, unavailable},
+			cancel:           true,
+			expectedError:    unavailable,
+			expectedRequests: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.cancel {
+				cancel()
+			}
+
+			requests := 0
+			err := retryOnError(ctx, backoff, zap.NewNop(), "get configmap", func() error {
+				requests++
+				if requests <= len(tc.failures) {
+					return tc.failures[requests-1]
+				}
+				return nil
+			})
+			assert.Equal(t, tc.expectedError, err)
+			assert.Equal(t, tc.expectedRequests, requests)
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	unavailable := k8sErrors.NewServiceUnavailable("the API server is shutting down")
+
+	// every retry is sent, the delays grow up to maxRetryDelay
+	backoff := RetryBackoff(20)
+	var delays []time.Duration
+	for backoff.Steps > 0 {
+		delays = append(delays, retryDelay(&backoff, unavailable))
+	}
+	assert.Len(t, delays, 20)
+	assert.InDelta(t, 500*time.Millisecond, delays[0], float64(50*time.Millisecond))
+	for i := 1; i < len(delays); i++ {
+		assert.GreaterOrEqual(t, delays[i], delays[i-1])
+		assert.LessOrEqual(t, delays[i], maxRetryDelay)
+	}
+	assert.Equal(t, maxRetryDelay, delays[len(delays)-1])
+
+	// the delay suggested by the API server is respected, even if it is longer than maxRetryDelay
+	backoff = RetryBackoff(1)
+	assert.Equal(t, time.Minute, retryDelay(&backoff, k8sErrors.NewTooManyRequests("the server is overloaded", 60)))
+}
@@ -0,0 +1,466 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	v12 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// the migration status is stored in the status configmap and its shards:
+// the status configmap contains the mode, the scope and the subdomain map of the migration and the number of the shards,
+// the migrated resources are distributed among the shards by the hash of their kind, namespace and name,
+// so the status of hundreds of ingress resources does not exceed the size limit of a single configmap (1 MiB)
+// the resources found in another shard than their hash selects are left over by an interrupted resharding, they are ignored
+
+const (
+	// MigrationStatusShardsParameterName contains name of the parameter associated with the number of the shards in the status configmap
+	MigrationStatusShardsParameterName = "shards"
+	// StatusShardMaxSize is the maximum size of the migrated resources in a shard in bytes
+	StatusShardMaxSize = 512 * 1024
+	// maxStatusShards limits the number of the shards of the migration status
+	maxStatusShards = 256
+)
+
+// StatusShardName returns the name of the configmap of the shard of the migration status
+func StatusShardName(shard int) string {
+	return fmt.Sprintf("%s-%d", MigrationStatusConfigMapName, shard)
+}
+
+// statusConfigMaps reads and writes the configmaps of the migration status in the kube-system namespace
+type statusConfigMaps interface {
+	// current returns the current state of the configmap, or nil if it does not exist
+	current(name string) (*v12.ConfigMap, error)
+	// apply creates or updates the configmap and removes the removedKeys from it,
+	// the update fails with a conflict if the configmap was changed since it was read
+	apply(cm *v12.ConfigMap, removedKeys []string) error
+	// delete deletes the configmap, it returns a not found error if the configmap does not exist
+	delete(name string) error
+}
+
+// updateStatusStore merges the migration status update into the status configmap and its shards
+func updateStatusStore(configMaps statusConfigMaps, migrationModeUpdate string, migratedResourcesUpdate []model.MigratedResource, subdomainMapUpdate map[string]string, scopeUpdate *model.IngressFilter) error {
+	statusCm, err := configMaps.current(MigrationStatusConfigMapName)
+	if err != nil {
+		return err
+	}
+	data, legacyResources, err := mergeStatusCmData(statusCm, migrationModeUpdate, subdomainMapUpdate, scopeUpdate)
+	if err != nil {
+		return err
+	}
+	shardCount := statusShardCount(statusCm)
+	updates := upsertMigratedResources(legacyResources, migratedResourcesUpdate)
+
+	shards, fits, err := updateStatusShards(configMaps, shardCount, updates)
+	if err != nil {
+		return err
+	}
+	// the existing shards are rewritten after the new number of the shards is recorded when resharding,
+	// so they keep the resources of the old layout until then
+	var resharded []*v12.ConfigMap
+	if !fits {
+		previousShardCount := shardCount
+		if shards, shardCount, err = reshardStatus(configMaps, shardCount, updates); err != nil {
+			return err
+		}
+		resharded, shards = shards[:previousShardCount], shards[previousShardCount:]
+	}
+	// the new shards are written first, so the status configmap never refers to shards that were not written
+	for _, shard := range shards {
+		if err := configMaps.apply(shard, nil); err != nil {
+			return err
+		}
+	}
+
+	data[MigrationStatusShardsParameterName] = strconv.Itoa(shardCount)
+	if statusCm == nil {
+		cm := newStatusCm(data)
+		statusCm = &cm
+	}
+	// the keys that are not set anymore are removed explicitly, as the keys written by earlier versions without
+	// server-side apply (e.g. the legacy migrated resources) are not removed by applying the configmap without them
+	var removedKeys []string
+	for key := range statusCm.Data {
+		if _, kept := data[key]; !kept {
+			removedKeys = append(removedKeys, key)
+		}
+	}
+	sort.Strings(removedKeys)
+	statusCm.Data = data
+	if err := configMaps.apply(statusCm, removedKeys); err != nil {
+		return err
+	}
+
+	for _, shard := range resharded {
+		if err := configMaps.apply(shard, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeFromStatusStore removes the migrated resources from their shards
+func removeFromStatusStore(configMaps statusConfigMaps, removedResources []model.MigratedResource) error {
+	statusCm, err := configMaps.current(MigrationStatusConfigMapName)
+	if err != nil || statusCm == nil {
+		return err
+	}
+	if !isShardedStatus(*statusCm) {
+		if err := updateStatusStore(configMaps, statusCm.Data[MigrationModeParameterName], nil, nil, nil); err != nil {
+			return err
+		}
+		if statusCm, err = configMaps.current(MigrationStatusConfigMapName); err != nil {
+			return err
+		}
+	}
+	shardCount := statusShardCount(statusCm)
+
+	removed := map[int]map[string]bool{}
+	for _, removedResource := range removedResources {
+		shard := statusShardIndex(removedResource, shardCount)
+		if removed[shard] == nil {
+			removed[shard] = map[string]bool{}
+		}
+		removed[shard][migratedResourceKey(removedResource)] = true
+	}
+	indexes := make([]int, 0, len(removed))
+	for shard := range removed {
+		indexes = append(indexes, shard)
+	}
+	sort.Ints(indexes)
+
+	for _, shard := range indexes {
+		shardCm, migratedResources, err := readStatusShard(configMaps, shard, shardCount)
+		if err != nil {
+			return err
+		}
+		var kept []model.MigratedResource
+		for _, migratedResource := range migratedResources {
+			if !removed[shard][migratedResourceKey(migratedResource)] {
+				kept = append(kept, migratedResource)
+			}
+		}
+		if shardCm == nil || len(kept) == len(migratedResources) {
+			continue
+		}
+		updated, err := newStatusShard(shardCm, shard, kept)
+		if err != nil {
+			return err
+		}
+		if err := configMaps.apply(updated, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateStatusShards returns the shards with the updates merged, fits is false if one of them is too large
+func updateStatusShards(configMaps statusConfigMaps, shardCount int, updates []model.MigratedResource) (shards []*v12.ConfigMap, fits bool, err error) {
+	shardUpdates := map[int][]model.MigratedResource{}
+	for _, update := range updates {
+		shard := statusShardIndex(update, shardCount)
+		shardUpdates[shard] = append(shardUpdates[shard], update)
+	}
+	indexes := make([]int, 0, len(shardUpdates))
+	for shard := range shardUpdates {
+		indexes = append(indexes, shard)
+	}
+	sort.Ints(indexes)
+
+	for _, shard := range indexes {
+		shardCm, migratedResources, err := readStatusShard(configMaps, shard, shardCount)
+		if err != nil {
+			return nil, false, err
+		}
+		updated, err := newStatusShard(shardCm, shard, upsertMigratedResources(migratedResources, shardUpdates[shard]))
+		if err != nil {
+			return nil, false, err
+		}
+		if len(updated.Data[MigratedResourcesParameterName]) > StatusShardMaxSize {
+			return nil, false, nil
+		}
+		shards = append(shards, updated)
+	}
+	return shards, true, nil
+}
+
+// reshardStatus distributes every recorded resource among more shards and returns them in order
+func reshardStatus(configMaps statusConfigMaps, shardCount int, updates []model.MigratedResource) ([]*v12.ConfigMap, int, error) {
+	var migratedResources []model.MigratedResource
+	for shard := 0; shard < shardCount; shard++ {
+		_, shardResources, err := readStatusShard(configMaps, shard, shardCount)
+		if err != nil {
+			return nil, 0, err
+		}
+		migratedResources = append(migratedResources, shardResources...)
+	}
+	migratedResources = upsertMigratedResources(migratedResources, updates)
+
+	current := map[int]*v12.ConfigMap{}
+	for count := shardCount * 2; count <= maxStatusShards; count *= 2 {
+		buckets := make([][]model.MigratedResource, count)
+		for _, migratedResource := range migratedResources {
+			shard := statusShardIndex(migratedResource, count)
+			buckets[shard] = append(buckets[shard], migratedResource)
+		}
+
+		var shards []*v12.ConfigMap
+		for shard, bucket := range buckets {
+			if _, read := current[shard]; !read {
+				shardCm, err := configMaps.current(StatusShardName(shard))
+				if err != nil {
+					return nil, 0, err
+				}
+				current[shard] = shardCm
+			}
+			updated, err := newStatusShard(current[shard], shard, bucket)
+			if err != nil {
+				return nil, 0, err
+			}
+			if len(updated.Data[MigratedResourcesParameterName]) > StatusShardMaxSize {
+				shards = nil
+				break
+			}
+			shards = append(shards, updated)
+		}
+		if shards != nil {
+			return shards, count, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("the migration status of %d resources does not fit into %d configmaps", len(migratedResources), maxStatusShards)
+}
+
+// readStatusShard returns the current state of the shard (nil if it does not exist) and its migrated resources
+func readStatusShard(configMaps statusConfigMaps, shard, shardCount int) (*v12.ConfigMap, []model.MigratedResource, error) {
+	shardCm, err := configMaps.current(StatusShardName(shard))
+	if err != nil || shardCm == nil {
+		return nil, nil, err
+	}
+	migratedResources, err := parseShardResources(*shardCm, shard, shardCount)
+	return shardCm, migratedResources, err
+}
+
+// parseShardResources returns the migrated resources of the shard that belong to it with shardCount shards
+func parseShardResources(shardCm v12.ConfigMap, shard, shardCount int) ([]model.MigratedResource, error) {
+	migratedResources, err := parseMigratedResources(shardCm)
+	if err != nil {
+		return nil, err
+	}
+	var shardResources []model.MigratedResource
+	for _, migratedResource := range migratedResources {
+		if statusShardIndex(migratedResource, shardCount) == shard {
+			shardResources = append(shardResources, migratedResource)
+		}
+	}
+	return shardResources, nil
+}
+
+// newStatusShard returns the shard (based on its current state, which may be nil) containing the migrated resources
+func newStatusShard(shardCm *v12.ConfigMap, shard int, migratedResources []model.MigratedResource) (*v12.ConfigMap, error) {
+	updated := &v12.ConfigMap{ObjectMeta: v1.ObjectMeta{Name: StatusShardName(shard), Namespace: KubeSystem}}
+	if shardCm != nil {
+		updated = shardCm.DeepCopy()
+	}
+	if migratedResources == nil {
+		migratedResources = []model.MigratedResource{}
+	}
+	migratedResourcesJSON, err := json.Marshal(migratedResources)
+	if err != nil {
+		return nil, err
+	}
+	updated.Data = map[string]string{MigratedResourcesParameterName: string(migratedResourcesJSON)}
+	return updated, nil
+}
+
+// statusShardIndex returns the shard the migrated resource is stored in
+func statusShardIndex(migratedResource model.MigratedResource, shardCount int) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(migratedResource.Kind + "/" + migratedResource.Namespace + "/" + migratedResource.Name))
+	return int(hash.Sum32() % uint32(shardCount))
+}
+
+// statusShardCount returns the number of the shards recorded in the status configmap
+func statusShardCount(statusCm *v12.ConfigMap) int {
+	if statusCm == nil {
+		return 1
+	}
+	count, err := strconv.Atoi(statusCm.Data[MigrationStatusShardsParameterName])
+	if err != nil || count < 1 {
+		return 1
+	}
+	return count
+}
+
+// deleteStatusStore deletes the shards and the status configmap, it returns a not found error if the status configmap does not exist
+func deleteStatusStore(configMaps statusConfigMaps) error {
+	statusCm, err := configMaps.current(MigrationStatusConfigMapName)
+	if err != nil {
+		return err
+	}
+	for shard := 0; shard < statusShardCount(statusCm); shard++ {
+		if err := configMaps.delete(StatusShardName(shard)); err != nil && !k8sErrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return configMaps.delete(MigrationStatusConfigMapName)
+}
+
+// mergeStatusCmData returns the merged data of the status configmap and the resources recorded in it by earlier versions
+func mergeStatusCmData(statusCm *v12.ConfigMap, migrationModeUpdate string, subdomainMapUpdate map[string]string, scopeUpdate *model.IngressFilter) (map[string]string, []model.MigratedResource, error) {
+	var legacyResources []model.MigratedResource
+	var subdomainMap map[string]string
+	var migrationMode string
+	var migrationScope string
+
+	if statusCm != nil {
+		// the legacy resources are ignored once the status is sharded, they were moved into the shards then
+		if !isShardedStatus(*statusCm) {
+			var err error
+			if legacyResources, err = parseMigratedResources(*statusCm); err != nil {
+				return nil, nil, err
+			}
+		}
+		if statusCm.Data[SubdomainMapParameterName] != "" {
+			if err := json.Unmarshal([]byte(statusCm.Data[SubdomainMapParameterName]), &subdomainMap); err != nil {
+				return nil, nil, err
+			}
+		}
+		migrationMode = statusCm.Data[MigrationModeParameterName]
+		migrationScope = statusCm.Data[MigrationScopeParameterName]
+	}
+
+	if scopeUpdate != nil {
+		migrationScope = ""
+		if !IsIngressFilterEmpty(*scopeUpdate) {
+			migrationScopeJSON, err := json.Marshal(scopeUpdate)
+			if err != nil {
+				return nil, nil, err
+			}
+			migrationScope = string(migrationScopeJSON)
+		}
+	}
+
+	if subdomainMap == nil {
+		subdomainMap = make(map[string]string)
+	}
+	for userSubdomain, testSubdomain := range subdomainMapUpdate {
+		subdomainMap[userSubdomain] = testSubdomain
+	}
+	subdomainMapJSON, err := json.Marshal(subdomainMap)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if migrationMode != "" && migrationMode != migrationModeUpdate {
+		return nil, nil, fmt.Errorf("migration mode should not be changed from '%s' to '%s' during a single run", migrationMode, migrationModeUpdate)
+	}
+
+	data := map[string]string{
+		LastUpdatesTimestampParameterName: time.Now().Format(time.RFC3339Nano),
+		SubdomainMapParameterName:         string(subdomainMapJSON),
+		MigrationModeParameterName:        string(migrationModeUpdate),
+	}
+	if migrationScope != "" {
+		data[MigrationScopeParameterName] = migrationScope
+	}
+	return data, legacyResources, nil
+}
+
+// newStatusCm returns with a new status configmap containing the specified data
+func newStatusCm(data map[string]string) v12.ConfigMap {
+	return v12.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      MigrationStatusConfigMapName,
+			Namespace: KubeSystem,
+		},
+		Data: data,
+	}
+}
+
+// isShardedStatus returns true if the migrated resources are stored in the shards
+func isShardedStatus(statusCm v12.ConfigMap) bool {
+	_, sharded := statusCm.Data[MigrationStatusShardsParameterName]
+	return sharded
+}
+
+// parseMigratedResources returns the migrated resources of the status configmap or a shard
+func parseMigratedResources(cm v12.ConfigMap) ([]model.MigratedResource, error) {
+	var migratedResources []model.MigratedResource
+	if cm.Data[MigratedResourcesParameterName] != "" {
+		if err := json.Unmarshal([]byte(cm.Data[MigratedResourcesParameterName]), &migratedResources); err != nil {
+			return nil, fmt.Errorf("failed to parse the migrated resources of configmap %s: %v", cm.Name, err)
+		}
+	}
+	return migratedResources, nil
+}
+
+// LoadMigrationStatus reads the migration status from the status configmap and its shards
+func LoadMigrationStatus(getConfigMap func(name string) (*v12.ConfigMap, error)) (*model.MigrationStatus, error) {
+	statusCm, err := getConfigMap(MigrationStatusConfigMapName)
+	if err != nil {
+		return nil, err
+	}
+	status, err := ParseMigrationStatus(*statusCm)
+	if err != nil {
+		return nil, err
+	}
+	if isShardedStatus(*statusCm) {
+		status.MigratedResources = nil
+	}
+	shardCount := statusShardCount(statusCm)
+	for shard := 0; shard < shardCount; shard++ {
+		shardCm, err := getConfigMap(StatusShardName(shard))
+		if k8sErrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		migratedResources, err := parseShardResources(*shardCm, shard, shardCount)
+		if err != nil {
+			return nil, err
+		}
+		status.MigratedResources = append(status.MigratedResources, migratedResources...)
+	}
+	return status, nil
+}
+
+// GetMigrationStatus reads the migration status from the status configmap and its shards
+func GetMigrationStatus(ctx context.Context, kc KubeClient) (*model.MigrationStatus, error) {
+	return LoadMigrationStatus(func(name string) (*v12.ConfigMap, error) {
+		return kc.GetConfigMap(ctx, name, KubeSystem)
+	})
+}
+
+// GetRecordedMigrationStatus reads the migration status from the configmaps recorded by the client
+func GetRecordedMigrationStatus(kc KubeClient) (*model.MigrationStatus, error) {
+	recorded := kc.GetConfigMapContainer()[KubeSystem]
+	return LoadMigrationStatus(func(name string) (*v12.ConfigMap, error) {
+		cm, exists := recorded[name]
+		if !exists {
+			return nil, k8sErrors.NewNotFound(v12.Resource("configmaps"), name)
+		}
+		return &cm, nil
+	})
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStatusStoreSharding(t *testing.T) {
+	kc, err := NewFileKubeClient(t.TempDir(), zap.NewNop())
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	// hundreds of ingress resources with long warnings exceed the size of a single configmap
+	var migratedResources []model.MigratedResource
+	for i := 0; i < 300; i++ {
+		migratedResources = append(migratedResources, model.MigratedResource{
+			Kind:      IngressKind,
+			Name:      fmt.Sprintf("tea-ingress-%d", i),
+			Namespace: "default",
+			Warnings:  []string{strings.Repeat("w", 4000)},
+		})
+	}
+	assert.NoError(t, kc.CreateOrUpdateStatusCm(ctx, model.MigrationModeProduction, migratedResources[:10], nil, nil))
+	statusCm, err := kc.GetConfigMap(ctx, MigrationStatusConfigMapName, KubeSystem)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", statusCm.Data[MigrationStatusShardsParameterName])
+
+	assert.NoError(t, kc.CreateOrUpdateStatusCm(ctx, model.MigrationModeProduction, migratedResources[10:], nil, nil))
+	statusCm, err = kc.GetConfigMap(ctx, MigrationStatusConfigMapName, KubeSystem)
+	assert.NoError(t, err)
+	shardCount := statusShardCount(statusCm)
+	assert.Greater(t, shardCount, 1)
+	for shard := 0; shard < shardCount; shard++ {
+		shardCm, err := kc.GetConfigMap(ctx, StatusShardName(shard), KubeSystem)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, len(shardCm.Data[MigratedResourcesParameterName]), StatusShardMaxSize)
+	}
+
+	// an update replaces the recorded status of the resource in its shard
+	update := model.MigratedResource{Kind: IngressKind, Name: "tea-ingress-42", Namespace: "default", MigratedAs: []string{"Ingress/tea-ingress-42-server"}}
+	assert.NoError(t, kc.CreateOrUpdateStatusCm(ctx, model.MigrationModeProduction, []model.MigratedResource{update}, nil, nil))
+
+	status, err := GetMigrationStatus(ctx, kc)
+	assert.NoError(t, err)
+	assert.Len(t, status.MigratedResources, len(migratedResources))
+	assert.Contains(t, status.MigratedResources, update)
+
+	assert.NoError(t, kc.DeleteStatusCm(ctx))
+	for shard := 0; shard < shardCount; shard++ {
+		_, err := kc.GetConfigMap(ctx, StatusShardName(shard), KubeSystem)
+		assert.True(t, k8sErrors.IsNotFound(err), StatusShardName(shard))
+	}
+	assert.True(t, k8sErrors.IsNotFound(kc.DeleteStatusCm(ctx)))
+}
+
+// interruptedStatusConfigMaps fails every write after the first applies writes
+type interruptedStatusConfigMaps struct {
+	fileStatusConfigMaps
+	applied *[]string
+	applies int
+}
+
+func (c interruptedStatusConfigMaps) apply(cm *v1.ConfigMap, removedKeys []string) error {
+	if len(*c.applied) == c.applies {
+		return fmt.Errorf("interrupted")
+	}
+	*c.applied = append(*c.applied, cm.Name)
+	return c.fileStatusConfigMaps.apply(cm, removedKeys)
+}
+
+func TestStatusStoreInterruptedResharding(t *testing.T) {
+	var migratedResources []model.MigratedResource
+	for i := 0; i < 300; i++ {
+		migratedResources = append(migratedResources, model.MigratedResource{
+			Kind:      IngressKind,
+			Name:      fmt.Sprintf("tea-ingress-%d", i),
+			Namespace: "default",
+			Warnings:  []string{strings.Repeat("w", 2000)},
+		})
+	}
+
+	for applies := 0; applies <= 3; applies++ {
+		t.Run(fmt.Sprintf("interrupted after %d writes", applies), func(t *testing.T) {
+			kc, err := NewFileKubeClient(t.TempDir(), zap.NewNop())
+			assert.NoError(t, err)
+			ctx := context.Background()
+			assert.NoError(t, kc.CreateOrUpdateStatusCm(ctx, model.MigrationModeProduction, migratedResources[:200], nil, nil))
+			statusCm, err := kc.GetConfigMap(ctx, MigrationStatusConfigMapName, KubeSystem)
+			assert.NoError(t, err)
+			assert.Equal(t, "1", statusCm.Data[MigrationStatusShardsParameterName])
+
+			// the shards are written before the status configmap, the existing shard after it
+			applied := []string{}
+			configMaps := interruptedStatusConfigMaps{fileStatusConfigMaps: fileStatusConfigMaps{k: kc.(*fileKubeClient)}, applied: &applied, applies: applies}
+			err = updateStatusStore(configMaps, model.MigrationModeProduction, migratedResources[200:], nil, nil)
+			if applies < 3 {
+				assert.EqualError(t, err, "interrupted")
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, []string{StatusShardName(1), MigrationStatusConfigMapName, StatusShardName(0)}[:len(applied)], applied)
+
+			// the recorded resources are read exactly once, the updates of the existing shard are lost until it is written
+			status, err := GetMigrationStatus(ctx, kc)
+			assert.NoError(t, err)
+			expected := append([]model.MigratedResource(nil), migratedResources[:200]...)
+			for _, update := range migratedResources[200:] {
+				if applies >= 3 || applies == 2 && statusShardIndex(update, 2) == 1 {
+					expected = append(expected, update)
+				}
+			}
+			assert.ElementsMatch(t, expected, status.MigratedResources)
+
+			// the next update completes the migration status
+			assert.NoError(t, kc.CreateOrUpdateStatusCm(ctx, model.MigrationModeProduction, migratedResources[200:], nil, nil))
+			status, err = GetMigrationStatus(ctx, kc)
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, migratedResources, status.MigratedResources)
+		})
+	}
+}
+
+func TestStatusStoreResourceTooLarge(t *testing.T) {
+	kc, err := NewFileKubeClient(t.TempDir(), zap.NewNop())
+	assert.NoError(t, err)
+
+	tooLarge := model.MigratedResource{Kind: IngressKind, Name: "tea-ingress", Namespace: "default", Warnings: []string{strings.Repeat("w", StatusShardMaxSize)}}
+	err = kc.CreateOrUpdateStatusCm(context.Background(), model.MigrationModeProduction, []model.MigratedResource{tooLarge}, nil, nil)
+	assert.EqualError(t, err, "the migration status of 1 resources does not fit into 256 configmaps")
+}
+
+func TestStatusStoreLegacyStatusConfigMap(t *testing.T) {
+	kc, err := NewFileKubeClient(t.TempDir(), zap.NewNop())
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	// earlier versions recorded the migrated resources in the status configmap
+	assert.NoError(t, kc.CreateConfigMap(ctx, &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: MigrationStatusConfigMapName, Namespace: KubeSystem},
+		Data: map[string]string{
+			MigrationModeParameterName:     model.MigrationModeProduction,
+			MigratedResourcesParameterName: `[{"kind":"ConfigMap","name":"ibm-cloud-provider-ingress-cm","namespace":"kube-system"},{"kind":"Ingress","name":"tea-ingress","namespace":"default"}]`,
+		},
+	}))
+	status, err := GetMigrationStatus(ctx, kc)
+	assert.NoError(t, err)
+	assert.Len(t, status.MigratedResources, 2)
+
+	// the next update moves them into the shards
+	update := model.MigratedResource{Kind: IngressKind, Name: "tea-ingress", Namespace: "default", MigratedAs: []string{"Ingress/tea-ingress-server"}}
+	assert.NoError(t, kc.CreateOrUpdateStatusCm(ctx, model.MigrationModeProduction, []model.MigratedResource{update}, nil, nil))
+	statusCm, err := kc.GetConfigMap(ctx, MigrationStatusConfigMapName, KubeSystem)
+	assert.NoError(t, err)
+	assert.NotContains(t, statusCm.Data, MigratedResourcesParameterName)
+
+	status, err = GetMigrationStatus(ctx, kc)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.MigratedResource{
+		{Kind: ConfigMapKind, Name: IKSConfigMapName, Namespace: KubeSystem},
+		update,
+	}, status.MigratedResources)
+}
+
+func TestStatusStoreRemove(t *testing.T) {
+	kc, err := NewFileKubeClient(t.TempDir(), zap.NewNop())
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	// nothing is recorded without a status configmap
+	assert.NoError(t, kc.RemoveFromStatusCm(ctx, []model.MigratedResource{{Kind: IngressKind, Name: "tea-ingress", Namespace: "default"}}))
+	_, err = kc.GetConfigMap(ctx, MigrationStatusConfigMapName, KubeSystem)
+	assert.True(t, k8sErrors.IsNotFound(err))
+
+	// the legacy resources are moved into the shards before the removal
+	assert.NoError(t, kc.CreateConfigMap(ctx, &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: MigrationStatusConfigMapName, Namespace: KubeSystem},
+		Data: map[string]string{
+			MigrationModeParameterName:     model.MigrationModeProduction,
+			MigratedResourcesParameterName: `[{"kind":"ConfigMap","name":"ibm-cloud-provider-ingress-cm","namespace":"kube-system"},{"kind":"Ingress","name":"tea-ingress","namespace":"default"}]`,
+		},
+	}))
+	coffee := model.MigratedResource{Kind: IngressKind, Name: "coffee-ingress", Namespace: "default", MigratedAs: []string{"Ingress/coffee-ingress-server"}}
+	assert.NoError(t, kc.RemoveFromStatusCm(ctx, []model.MigratedResource{{Kind: IngressKind, Name: "tea-ingress", Namespace: "default"}, coffee}))
+
+	status, err := GetMigrationStatus(ctx, kc)
+	assert.NoError(t, err)
+	assert.Equal(t, model.MigrationModeProduction, status.Mode)
+	assert.Equal(t, []model.MigratedResource{{Kind: ConfigMapKind, Name: IKSConfigMapName, Namespace: KubeSystem}}, status.MigratedResources)
+
+	assert.NoError(t, kc.CreateOrUpdateStatusCm(ctx, model.MigrationModeProduction, []model.MigratedResource{coffee}, nil, nil))
+	assert.NoError(t, kc.RemoveFromStatusCm(ctx, []model.MigratedResource{{Kind: ConfigMapKind, Name: IKSConfigMapName, Namespace: KubeSystem}}))
+	status, err = GetMigrationStatus(ctx, kc)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.MigratedResource{coffee}, status.MigratedResources)
+}
+
+func TestLoadMigrationStatus(t *testing.T) {
+	configMaps := map[string]*v1.ConfigMap{
+		MigrationStatusConfigMapName: {
+			ObjectMeta: metav1.ObjectMeta{Name: MigrationStatusConfigMapName, Namespace: KubeSystem},
+			Data: map[string]string{
+				MigrationModeParameterName:         model.MigrationModeTest,
+				SubdomainMapParameterName:          `{"tea.example.com":"abc.test.com"}`,
+				MigrationScopeParameterName:        `{"namespaces":["tea"]}`,
+				MigrationStatusShardsParameterName: "3",
+			},
+		},
+		StatusShardName(0): {
+			ObjectMeta: metav1.ObjectMeta{Name: StatusShardName(0), Namespace: KubeSystem},
+			Data:       map[string]string{MigratedResourcesParameterName: `[{"kind":"Ingress","name":"tea-ingress","namespace":"tea"}]`},
+		},
+		// the second shard is missing, e.g. it had no resources
+		StatusShardName(2): {
+			ObjectMeta: metav1.ObjectMeta{Name: StatusShardName(2), Namespace: KubeSystem},
+			Data:       map[string]string{MigratedResourcesParameterName: `[{"kind":"Ingress","name":"green-tea-ingress","namespace":"tea"}]`},
+		},
+	}
+	getConfigMap := func(name string) (*v1.ConfigMap, error) {
+		if cm, exists := configMaps[name]; exists {
+			return cm, nil
+		}
+		return nil, k8sErrors.NewNotFound(v1.Resource("configmaps"), name)
+	}
+
+	status, err := LoadMigrationStatus(getConfigMap)
+	assert.NoError(t, err)
+	assert.Equal(t, &model.MigrationStatus{
+		Mode:         model.MigrationModeTest,
+		SubdomainMap: map[string]string{"tea.example.com": "abc.test.com"},
+		Scope:        &model.IngressFilter{Namespaces: []string{"tea"}},
+		MigratedResources: []model.MigratedResource{
+			{Kind: IngressKind, Name: "tea-ingress", Namespace: "tea"},
+			{Kind: IngressKind, Name: "green-tea-ingress", Namespace: "tea"},
+		},
+	}, status)
+
+	configMaps[StatusShardName(2)].Data[MigratedResourcesParameterName] = "["
+	_, err = LoadMigrationStatus(getConfigMap)
+	assert.EqualError(t, err, "failed to parse the migrated resources of configmap ibm-ingress-migration-status-2: unexpected end of JSON input")
+
+	delete(configMaps, MigrationStatusConfigMapName)
+	_, err = LoadMigrationStatus(getConfigMap)
+	assert.True(t, k8sErrors.IsNotFound(err))
+}
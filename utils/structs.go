@@ -44,6 +44,9 @@ type IngressConfig struct {
 
 	IngressClass string
 	Servers      []Server
+
+	// SourceHash is the content hash of the source ingress resource, see the SourceHash function
+	SourceHash string
 }
 
 type TLSConfig struct {
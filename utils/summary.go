@@ -0,0 +1,101 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+)
+
+const (
+	// SummaryFileName is the name of the file in the output directory that contains the summary of the command
+	SummaryFileName = "summary.json"
+
+	// ResultSuccess means that the command finished without errors and warnings
+	ResultSuccess = "success"
+	// ResultWarnings means that every resource was processed, but some of them have migration warnings
+	ResultWarnings = "warnings"
+	// ResultPartial means that some of the resources could not be processed
+	ResultPartial = "partial"
+	// ResultInterrupted means that the command was canceled by a signal or its timeout expired, only some of the resources were processed
+	ResultInterrupted = "interrupted"
+	// ResultPolicyViolation means that every resource was processed, but the migration warnings violate the policy
+	ResultPolicyViolation = "policy-violation"
+	// ResultFailed means that the command failed
+	ResultFailed = "failed"
+)
+
+// NewSummary returns the summary of the command based on the returned error and the recorded migration status (status may be nil)
+func NewSummary(command string, status *model.MigrationStatus, err error) model.Summary {
+	summary := model.Summary{
+		Command:  command,
+		RunID:    runID,
+		ExitCode: ExitCode(err),
+	}
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	var policyViolationError *PolicyViolationError
+	if errors.As(err, &policyViolationError) {
+		summary.PolicyViolations = policyViolationError.Violations
+	}
+
+	if status != nil {
+		summary.Mode = status.Mode
+		summary.MigratedResources = len(status.MigratedResources)
+		for _, migratedResource := range status.MigratedResources {
+			if len(migratedResource.Warnings) > 0 {
+				summary.ResourcesWithWarnings++
+			}
+			if len(migratedResource.Errors) > 0 {
+				summary.ResourcesWithErrors++
+			}
+			// the acknowledged warnings are counted, but they do not change the result
+			summary.AcknowledgedWarnings += len(migratedResource.AcknowledgedWarnings)
+		}
+	}
+
+	if summary.ExitCode == ExitCodeOK && summary.ResourcesWithWarnings > 0 {
+		summary.ExitCode = ExitCodeWarnings
+	}
+
+	switch summary.ExitCode {
+	case ExitCodeOK:
+		summary.Result = ResultSuccess
+	case ExitCodeWarnings:
+		summary.Result = ResultWarnings
+	case ExitCodePartialMigration:
+		summary.Result = ResultPartial
+	case ExitCodeInterrupted:
+		summary.Result = ResultInterrupted
+	case ExitCodePolicyViolation:
+		summary.Result = ResultPolicyViolation
+	default:
+		summary.Result = ResultFailed
+	}
+	return summary
+}
+
+// WriteSummary saves the summary in JSON format into the output directory
+func WriteSummary(outputDir string, summary model.Summary) error {
+	summaryJSON, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outputDir, SummaryFileName), append(summaryJSON, '\n'), 0600)
+}
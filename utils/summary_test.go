@@ -0,0 +1,165 @@
+/*
+Copyright 2022 The Kubernetes Authors All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
+	"github.com/stretchr/testify/assert"
+)
+
+const migrateCommandName = "migrate"
+
+func TestNewSummary(t *testing.T) {
+	status := &model.MigrationStatus{
+		Mode: model.MigrationModeProduction,
+		MigratedResources: []model.MigratedResource{
+			{Kind: IngressKind, Name: "coffee-ingress", Namespace: "default", MigratedAs: []string{"Ingress/coffee-ingress-coffee-example-com"}},
+			{Kind: IngressKind, Name: "tea-ingress", Namespace: "default", Warnings: []string{"warning"}},
+		},
+	}
+	failedStatus := &model.MigrationStatus{
+		Mode: model.MigrationModeProduction,
+		MigratedResources: []model.MigratedResource{
+			{Kind: IngressKind, Name: "tea-ingress", Namespace: "default", Warnings: []string{"warning"}, Errors: []string{"error"}},
+		},
+	}
+
+	acknowledgedStatus := &model.MigrationStatus{
+		Mode: model.MigrationModeProduction,
+		MigratedResources: []model.MigratedResource{
+			{Kind: IngressKind, Name: "tea-ingress", Namespace: "default", AcknowledgedWarnings: []model.Warning{{Code: "CUSTOM_ERRORS_UNSUPPORTED"}}},
+		},
+	}
+
+	testCases := []struct {
+		description     string
+		status          *model.MigrationStatus
+		err             error
+		expectedSummary model.Summary
+	}{
+		{
+			description: "success without status",
+			expectedSummary: model.Summary{
+				Command:  migrateCommandName,
+				Result:   ResultSuccess,
+				ExitCode: ExitCodeOK,
+			},
+		},
+		{
+			description: "success with warnings",
+			status:      status,
+			expectedSummary: model.Summary{
+				Command:               migrateCommandName,
+				Mode:                  model.MigrationModeProduction,
+				Result:                ResultWarnings,
+				ExitCode:              ExitCodeWarnings,
+				MigratedResources:     2,
+				ResourcesWithWarnings: 1,
+			},
+		},
+		{
+			description: "success with acknowledged warnings",
+			status:      acknowledgedStatus,
+			expectedSummary: model.Summary{
+				Command:              migrateCommandName,
+				Mode:                 model.MigrationModeProduction,
+				Result:               ResultSuccess,
+				ExitCode:             ExitCodeOK,
+				MigratedResources:    1,
+				AcknowledgedWarnings: 1,
+			},
+		},
+		{
+			description: "partial migration",
+			status:      failedStatus,
+			err:         &PartialMigrationError{Operation: "processing ingress resources", Errors: []error{fmt.Errorf("error")}},
+			expectedSummary: model.Summary{
+				Command:               migrateCommandName,
+				Mode:                  model.MigrationModeProduction,
+				Result:                ResultPartial,
+				ExitCode:              ExitCodePartialMigration,
+				Error:                 "error occurred while processing ingress resources: [error]",
+				MigratedResources:     1,
+				ResourcesWithWarnings: 1,
+				ResourcesWithErrors:   1,
+			},
+		},
+		{
+			description: "interrupted migration",
+			status:      status,
+			err:         &InterruptedError{Err: context.Canceled},
+			expectedSummary: model.Summary{
+				Command:               migrateCommandName,
+				Mode:                  model.MigrationModeProduction,
+				Result:                ResultInterrupted,
+				ExitCode:              ExitCodeInterrupted,
+				Error:                 "the command was interrupted: context canceled",
+				MigratedResources:     2,
+				ResourcesWithWarnings: 1,
+			},
+		},
+		{
+			description: "policy violation",
+			status:      status,
+			err:         &PolicyViolationError{Violations: []string{"violation"}},
+			expectedSummary: model.Summary{
+				Command:               migrateCommandName,
+				Mode:                  model.MigrationModeProduction,
+				Result:                ResultPolicyViolation,
+				ExitCode:              ExitCodePolicyViolation,
+				Error:                 "the migration policy was violated: violation",
+				MigratedResources:     2,
+				ResourcesWithWarnings: 1,
+				PolicyViolations:      []string{"violation"},
+			},
+		},
+		{
+			description: "configuration error",
+			err:         &ConfigError{Err: fmt.Errorf("output directory must be set")},
+			expectedSummary: model.Summary{
+				Command:  migrateCommandName,
+				Result:   ResultFailed,
+				ExitCode: ExitCodeConfigError,
+				Error:    "output directory must be set",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expectedSummary, NewSummary(migrateCommandName, tc.status, tc.err))
+		})
+	}
+}
+
+func TestWriteSummary(t *testing.T) {
+	outputDir := t.TempDir()
+	summary := NewSummary(migrateCommandName, nil, &APIError{Err: fmt.Errorf("connection refused")})
+	assert.NoError(t, WriteSummary(outputDir, summary))
+
+	summaryJSON, err := os.ReadFile(filepath.Join(outputDir, SummaryFileName))
+	assert.NoError(t, err)
+	var actualSummary model.Summary
+	assert.NoError(t, json.Unmarshal(summaryJSON, &actualSummary))
+	assert.Equal(t, summary, actualSummary)
+	assert.Equal(t, ResultFailed, actualSummary.Result)
+	assert.Equal(t, ExitCodeAPIError, actualSummary.ExitCode)
+}
@@ -14,8 +14,10 @@ limitations under the License.
 package utils
 
 import (
+	"context"
 	"fmt"
 	"sort"
+	"sync"
 	"testing"
 
 	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
@@ -43,10 +45,12 @@ type TestKClient struct {
 	ExpectedSubdomainMap       map[string]string
 	ExpectedMigrationMode      string
 	CreateIngErr               error
+	UpdateCMErr                error
 	K8STCPCMList               []*v1.ConfigMap
 	GetIKSCMErr                error
 	GetK8STCPCMErr             map[string]error
 	CalledOp                   []string
+	Events                     []IngressEvent
 	CMData                     map[string]map[string]string
 	IngressEnhancementsEnabled bool
 	Secret                     *v1.Secret
@@ -55,9 +59,14 @@ type TestKClient struct {
 	GetNamespace               string
 	ReferenceSecretInDefaultNS bool
 	V1IngressOnly              bool
+	ExpectedScope              *model.IngressFilter
+	Backups                    []model.ResourceBackup
+
+	// the ingress resources are migrated by parallel workers, mutex guards the recorded calls
+	mutex sync.Mutex
 }
 
-func (k *TestKClient) GetConfigMap(name, namespace string) (*v1.ConfigMap, error) {
+func (k *TestKClient) GetConfigMap(ctx context.Context, name, namespace string) (*v1.ConfigMap, error) {
 	if name == IKSConfigMapName && namespace == KubeSystem {
 		if k.IksCm != nil {
 			return k.IksCm, nil
@@ -85,7 +94,9 @@ func (k *TestKClient) GetConfigMap(name, namespace string) (*v1.ConfigMap, error
 	return nil, fmt.Errorf("failed to get configmap")
 }
 
-func (k *TestKClient) CreateConfigMap(cm *v1.ConfigMap) error {
+func (k *TestKClient) CreateConfigMap(ctx context.Context, cm *v1.ConfigMap) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
 	k.CalledOp = append(k.CalledOp, "+ create/"+cm.GetName())
 	if k.CMData == nil {
 		k.CMData = make(map[string]map[string]string)
@@ -102,18 +113,34 @@ func (k *TestKClient) GetClient() *clientset.Clientset {
 	return nil
 }
 
-func (k *TestKClient) GetIngressResources() ([]networking.Ingress, error) {
+func (k *TestKClient) GetIngressResources(ctx context.Context, filter model.IngressFilter) ([]networking.Ingress, error) {
 	if k.V1IngressOnly {
 		for _, v1Ingress := range k.V1IngressList {
 			v1beta1Ingress := convertV1ToV1Beta1Ingress(v1Ingress, k.IngressEnhancementsEnabled)
 			k.IngressList = append(k.IngressList, v1beta1Ingress)
 		}
 	}
-	return k.IngressList, k.GetIngressErr
+	if k.IngressList == nil || k.GetIngressErr != nil {
+		return k.IngressList, k.GetIngressErr
+	}
+	return FilterIngresses(k.IngressList, filter), nil
 }
 
-func (k *TestKClient) CreateOrUpdateIngress(ing networking.Ingress) error {
+func (k *TestKClient) GetIngress(ctx context.Context, name, namespace string) (*networking.Ingress, error) {
+	for _, ing := range k.IngressList {
+		if ing.Name == name && ing.Namespace == namespace {
+			return ing.DeepCopy(), nil
+		}
+	}
+	return nil, k8serrors.NewNotFound(networking.Resource("ingresses"), name)
+}
+
+func (k *TestKClient) CreateOrUpdateIngress(ctx context.Context, ing networking.Ingress) error {
 	if k.CreateIngErr == nil {
+		// the expected ingress resources are compared without the provenance labels and annotations
+		assert.Equal(k.T, FieldManager, ing.Labels[ManagedByLabel])
+		ing = *ing.DeepCopy()
+		ing.Labels, ing.Annotations = withoutProvenance(ing.Labels), withoutProvenance(ing.Annotations)
 		if k.V1IngressOnly {
 			v1Ingress := convertV1Beta1ToV1Ingress(ing)
 			v1Ingress.Kind = "Ingress"
@@ -136,7 +163,65 @@ func (k *TestKClient) CreateOrUpdateIngress(ing networking.Ingress) error {
 	return k.CreateIngErr
 }
 
-func (k *TestKClient) CreateOrUpdateStatusCm(migrationModeUpdate string, migratedResourcesUpdate []model.MigratedResource, subdomainMapUpdate map[string]string) error {
+func (k *TestKClient) RecordUnchangedIngress(ing networking.Ingress) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.CalledOp = append(k.CalledOp, "= unchanged/"+ing.Name)
+}
+
+// withoutProvenance returns the labels or annotations without the ones set by the SetProvenance function
+func withoutProvenance(values map[string]string) map[string]string {
+	var filtered map[string]string
+	for key, value := range values {
+		if HasProvenance(key) {
+			continue
+		}
+		if filtered == nil {
+			filtered = map[string]string{}
+		}
+		filtered[key] = value
+	}
+	return filtered
+}
+
+func (k *TestKClient) AnnotateIngress(ctx context.Context, name, namespace string, annotations map[string]string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if len(annotations) == 0 {
+		k.CalledOp = append(k.CalledOp, "- annotate/"+name)
+	} else {
+		k.CalledOp = append(k.CalledOp, "+ annotate/"+name+"="+annotations[MigratedToAnnotation])
+	}
+	return nil
+}
+
+func (k *TestKClient) RecordIngressEvents(ctx context.Context, ingress *networking.Ingress, events []IngressEvent) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.Events = append(k.Events, events...)
+	return nil
+}
+
+func (k *TestKClient) DeleteIngress(ctx context.Context, name, namespace string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.CalledOp = append(k.CalledOp, "- delete/"+name)
+	return nil
+}
+
+func (k *TestKClient) CreateOrUpdateStatusCm(ctx context.Context, migrationModeUpdate string, migratedResourcesUpdate []model.MigratedResource, subdomainMapUpdate map[string]string, scopeUpdate *model.IngressFilter) error {
+	// the structured warnings are derived from the warning texts, they are compared with the texts only
+	var resourceUpdates []model.MigratedResource
+	for _, resourceUpdate := range migratedResourcesUpdate {
+		assert.Len(k.T, resourceUpdate.WarningDetails, len(resourceUpdate.Warnings))
+		for i, warning := range resourceUpdate.WarningDetails {
+			assert.Equal(k.T, resourceUpdate.Warnings[i], warning.Message)
+		}
+		resourceUpdate.WarningDetails = nil
+		resourceUpdates = append(resourceUpdates, resourceUpdate)
+	}
+	migratedResourcesUpdate = resourceUpdates
+
 	for _, resourceUpdate := range k.ExpectedResourceInfo {
 		sort.Strings(resourceUpdate.Warnings)
 	}
@@ -147,14 +232,30 @@ func (k *TestKClient) CreateOrUpdateStatusCm(migrationModeUpdate string, migrate
 	assert.Equal(k.T, k.ExpectedMigrationMode, migrationModeUpdate)
 	assert.Equal(k.T, k.ExpectedResourceInfo, migratedResourcesUpdate)
 	assert.Equal(k.T, k.ExpectedSubdomainMap, subdomainMapUpdate)
+	if k.ExpectedScope != nil {
+		assert.Equal(k.T, k.ExpectedScope, scopeUpdate)
+	}
 	return k.StatusCmErr
 }
 
-func (k *TestKClient) DeleteStatusCm() error {
+func (k *TestKClient) RemoveFromStatusCm(ctx context.Context, migratedResources []model.MigratedResource) error {
+	return k.StatusCmErr
+}
+
+func (k *TestKClient) DeleteStatusCm(ctx context.Context) error {
 	return nil
 }
 
-func (k *TestKClient) UpdateConfigmap(cm *v1.ConfigMap) error {
+func (k *TestKClient) CreateOrUpdateBackupCm(ctx context.Context, backups []model.ResourceBackup) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.Backups = append(k.Backups, backups...)
+	return nil
+}
+
+func (k *TestKClient) UpdateConfigmap(ctx context.Context, cm *v1.ConfigMap) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
 	k.CalledOp = append(k.CalledOp, "+ update/"+cm.GetName())
 	if k.CMData == nil {
 		k.CMData = make(map[string]map[string]string)
@@ -164,6 +265,13 @@ func (k *TestKClient) UpdateConfigmap(cm *v1.ConfigMap) error {
 	case K8sConfigMapName, TestK8sConfigMapName:
 		assert.Equal(k.T, k.ExpectedK8sCm, cm)
 	}
+	return k.UpdateCMErr
+}
+
+func (k *TestKClient) DeleteConfigMap(ctx context.Context, name, namespace string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.CalledOp = append(k.CalledOp, "- delete/"+name)
 	return nil
 }
 
@@ -171,7 +279,7 @@ func (k *TestKClient) IsIngressEnhancementsEnabled() bool {
 	return k.IngressEnhancementsEnabled
 }
 
-func (k *TestKClient) GetSecret(name, namespace string) (*v1.Secret, error) {
+func (k *TestKClient) GetSecret(ctx context.Context, name, namespace string) (*v1.Secret, error) {
 	if k.ReferenceSecretInDefaultNS && namespace == "default" {
 		return &v1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
@@ -200,7 +308,9 @@ func (k *TestKClient) GetSecret(name, namespace string) (*v1.Secret, error) {
 	}, nil
 }
 
-func (k *TestKClient) UpdateSecret(secret *v1.Secret) error {
+func (k *TestKClient) UpdateSecret(ctx context.Context, secret *v1.Secret) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
 	k.CalledOp = append(k.CalledOp, "+ update/"+secret.GetName())
 	k.UpdatedSecret = secret
 	return nil
@@ -15,6 +15,7 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"embed"
 	"encoding/json"
@@ -25,6 +26,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"text/tabwriter"
 	"text/template"
 	"time"
@@ -204,34 +206,50 @@ func TrimWhiteSpaces(s []string) []string {
 	return noWhiteSpaceSlice
 }
 
-func CreateOrUpdateTCPPortsCM(kc KubeClient, cmName string, namespace string, data map[string]string, logger *zap.Logger) error {
-	k8sTCPCM, err := kc.GetConfigMap(cmName, namespace)
-	if err != nil {
-		if !k8serror.IsNotFound(err) {
-			logger.Error("error getting k8s TCP configmap", zap.String("namespace", namespace), zap.String("name", cmName), zap.Error(err))
-			return err
-		}
-		k8sTCPCM := &v1.ConfigMap{
-			ObjectMeta: v12.ObjectMeta{
-				Name:      cmName,
-				Namespace: namespace,
-			},
-			Data: data,
-		}
-		if err = kc.CreateConfigMap(k8sTCPCM); err != nil {
-			logger.Error("error creating k8s TCP configmap", zap.String("namespace", namespace), zap.String("name", cmName), zap.Error(err))
-			return err
-		}
-	} else {
-		for k, v := range data {
-			k8sTCPCM.Data[k] = v
-		}
-		if err = kc.UpdateConfigmap(k8sTCPCM); err != nil {
-			logger.Error("error updating k8s TCP configmap", zap.String("namespace", namespace), zap.String("name", cmName), zap.Error(err))
-			return err
+// CreateOrUpdateTCPPortsCM merges the data into the TCP ports configmap
+func CreateOrUpdateTCPPortsCM(ctx context.Context, kc KubeClient, cmName string, namespace string, data map[string]string, logger *zap.Logger) error {
+	return RetryOnConflict(func() error {
+		k8sTCPCM, err := kc.GetConfigMap(ctx, cmName, namespace)
+		if err != nil {
+			if !k8serror.IsNotFound(err) {
+				logger.Error("error getting k8s TCP configmap", zap.String("namespace", namespace), zap.String("name", cmName), zap.Error(err))
+				return err
+			}
+			k8sTCPCM := &v1.ConfigMap{
+				ObjectMeta: v12.ObjectMeta{
+					Name:      cmName,
+					Namespace: namespace,
+				},
+				Data: data,
+			}
+			// only the configmaps created by the migration are labeled, the existing ones remain owned by their field managers
+			SetProvenance(&k8sTCPCM.ObjectMeta, nil)
+			if err = kc.CreateOrUpdateBackupCm(ctx, []model.ResourceBackup{{Kind: ConfigMapKind, Name: cmName, Namespace: namespace, Created: true}}); err != nil {
+				logger.Error("error backing up k8s TCP configmap", zap.String("namespace", namespace), zap.String("name", cmName), zap.Error(err))
+				return err
+			}
+			if err = kc.CreateConfigMap(ctx, k8sTCPCM); err != nil {
+				logger.Error("error creating k8s TCP configmap", zap.String("namespace", namespace), zap.String("name", cmName), zap.Error(err))
+				return err
+			}
+		} else {
+			if err = kc.CreateOrUpdateBackupCm(ctx, []model.ResourceBackup{NewConfigMapBackup(k8sTCPCM, data)}); err != nil {
+				logger.Error("error backing up k8s TCP configmap", zap.String("namespace", namespace), zap.String("name", cmName), zap.Error(err))
+				return err
+			}
+			if k8sTCPCM.Data == nil {
+				k8sTCPCM.Data = map[string]string{}
+			}
+			for k, v := range data {
+				k8sTCPCM.Data[k] = v
+			}
+			if err = kc.UpdateConfigmap(ctx, k8sTCPCM); err != nil {
+				logger.Error("error updating k8s TCP configmap", zap.String("namespace", namespace), zap.String("name", cmName), zap.Error(err))
+				return err
+			}
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
 func MergeALBSpecificData(albSpecificData ALBSpecificData, ingressToCM IngressToCM, albIDList string, logger *zap.Logger) (ALBSpecificData, error) {
@@ -279,7 +297,7 @@ func ParseALBIDList(albIDList string) (albIDArray []string) {
 	return
 }
 
-func LookupSecret(kc KubeClient, secretName, namespace string, logger *zap.Logger) (*v1.Secret, error) {
+func LookupSecret(ctx context.Context, kc KubeClient, secretName, namespace string, logger *zap.Logger) (*v1.Secret, error) {
 	securedNamespace := "ibm-cert-store"
 	defaultNamespace := "default"
 	namespacesSearched := []string{} // Maintain namespaces searched for error logging
@@ -294,7 +312,7 @@ func LookupSecret(kc KubeClient, secretName, namespace string, logger *zap.Logge
 	// 	2.2 If not Reference Secret, then use it
 	// 3. Check for Secret in the secure namespace
 
-	secret, err := kc.GetSecret(secretName, namespace)
+	secret, err := kc.GetSecret(ctx, secretName, namespace)
 	logger.Info("Checking for secret in namespace", zap.String("secretName", secretName), zap.String("namespace", namespace))
 	namespacesSearched = append(namespacesSearched, namespace)
 
@@ -304,7 +322,7 @@ func LookupSecret(kc KubeClient, secretName, namespace string, logger *zap.Logge
 		if namespace == defaultNamespace {
 			if isReferenceSecret(secret) {
 				logger.Info("Reference Secret, Checking for secret in Secured Namespace", zap.String("secretName", secretName), zap.String("namespace", securedNamespace))
-				secret, err = kc.GetSecret(secretName, securedNamespace)
+				secret, err = kc.GetSecret(ctx, secretName, securedNamespace)
 				namespacesSearched = append(namespacesSearched, securedNamespace)
 
 				if err != nil {
@@ -321,7 +339,7 @@ func LookupSecret(kc KubeClient, secretName, namespace string, logger *zap.Logge
 		}
 	}
 
-	secret, err = kc.GetSecret(secretName, defaultNamespace)
+	secret, err = kc.GetSecret(ctx, secretName, defaultNamespace)
 	logger.Info("Checking for secret in namespace", zap.String("secretName", secretName), zap.String("namespace", defaultNamespace))
 	namespacesSearched = append(namespacesSearched, defaultNamespace)
 	if err != nil {
@@ -330,7 +348,7 @@ func LookupSecret(kc KubeClient, secretName, namespace string, logger *zap.Logge
 		logger.Info("Secret found in default Namespace ", zap.String("secretName", secretName), zap.String("namespace", defaultNamespace))
 		if isReferenceSecret(secret) {
 			logger.Info("Reference Secret, Checking for secret in Secured Namespace", zap.String("secretName", secretName), zap.String("namespace", securedNamespace))
-			secret, err = kc.GetSecret(secretName, securedNamespace)
+			secret, err = kc.GetSecret(ctx, secretName, securedNamespace)
 			namespacesSearched = append(namespacesSearched, securedNamespace)
 			if err != nil {
 				logger.Info("Could not find secret in namespace", zap.String("secretName", secretName), zap.String("namespace", securedNamespace), zap.Error(err))
@@ -343,7 +361,7 @@ func LookupSecret(kc KubeClient, secretName, namespace string, logger *zap.Logge
 		}
 	}
 
-	secret, err = kc.GetSecret(secretName, securedNamespace)
+	secret, err = kc.GetSecret(ctx, secretName, securedNamespace)
 	logger.Info("Checking for secret in namespace", zap.String("secretName", secretName), zap.String("namespace", securedNamespace))
 	namespacesSearched = append(namespacesSearched, securedNamespace)
 	if err != nil {
@@ -357,29 +375,56 @@ func LookupSecret(kc KubeClient, secretName, namespace string, logger *zap.Logge
 	return nil, err
 }
 
-func UpdateProxySecret(kc KubeClient, secretName, namespace string, logger *zap.Logger) (secret *v1.Secret, warnings []string, err error) {
+// proxySecretMutex serializes the updates of the proxy ssl secrets
+var proxySecretMutex sync.Mutex
+
+// UpdateProxySecret copies the proxy ssl keys of the secret to the keys used by the Kubernetes Ingress controller
+func UpdateProxySecret(ctx context.Context, kc KubeClient, secretName, namespace string, logger *zap.Logger) (secret *v1.Secret, warnings []model.Warning, err error) {
 	if secretName == "" {
 		return nil, nil, nil
 	}
-	secret, err = LookupSecret(kc, secretName, namespace, logger)
+	proxySecretMutex.Lock()
+	defer proxySecretMutex.Unlock()
+
+	err = RetryOnConflict(func() error {
+		secret, warnings, err = updateProxySecret(ctx, kc, secretName, namespace, logger)
+		return err
+	})
+	return secret, warnings, err
+}
+
+func updateProxySecret(ctx context.Context, kc KubeClient, secretName, namespace string, logger *zap.Logger) (secret *v1.Secret, warnings []model.Warning, err error) {
+	secret, err = LookupSecret(ctx, kc, secretName, namespace, logger)
 	if err != nil {
 		logger.Error("Could not get the proxy ssl secret", zap.String("secret name", secretName), zap.String("namespace", namespace), zap.Error(err))
 		return
 	}
 
 	// create the ca.crt, tls.crt and tls.key records in the secret data for the Kubernetes Ingress controller
+	backup := model.ResourceBackup{Kind: SecretKind, Name: secret.Name, Namespace: secret.Namespace, Data: map[string]*string{}}
 	for source, target := range map[string]string{
 		"trusted.crt": "ca.crt",
 		"client.crt":  "tls.crt",
 		"client.key":  "tls.key",
 	} {
-		warning := copySecretKeyOrWarningIfNotEqual(secret, source, target, logger)
-		if warning != "" {
-			warnings = append(warnings, warning)
+		_, targetExists := secret.Data[target]
+		if warning := copySecretKeyOrWarningIfNotEqual(secret, source, target, logger); warning != nil {
+			warnings = append(warnings, *warning)
+		}
+		if _, exists := secret.Data[target]; exists && !targetExists {
+			backup.Data[target] = nil
+		}
+	}
+
+	// the added keys are backed up, so the rollback can remove them
+	if len(backup.Data) > 0 {
+		if err = kc.CreateOrUpdateBackupCm(ctx, []model.ResourceBackup{backup}); err != nil {
+			logger.Error("Could not back up the proxy ssl secret", zap.String("secret name", secretName), zap.Any("namespace", secret.Namespace), zap.Error(err))
+			return secret, warnings, err
 		}
 	}
 
-	if err = kc.UpdateSecret(secret); err != nil {
+	if err = kc.UpdateSecret(ctx, secret); err != nil {
 		logger.Error("Could not update the proxy ssl secret", zap.String("secret name", secretName), zap.Any("namespace", secret.Namespace), zap.Error(err))
 	}
 
@@ -391,18 +436,19 @@ func isReferenceSecret(secret *v1.Secret) bool {
 	return referenceSecret != nil
 }
 
-func copySecretKeyOrWarningIfNotEqual(secret *v1.Secret, sourceKey, targetKey string, logger *zap.Logger) string {
+func copySecretKeyOrWarningIfNotEqual(secret *v1.Secret, sourceKey, targetKey string, logger *zap.Logger) *model.Warning {
 	if _, exists := secret.Data[sourceKey]; exists {
 		if _, exists := secret.Data[targetKey]; !exists {
 			secret.Data[targetKey] = secret.Data[sourceKey]
 		} else {
 			if !bytes.Equal(secret.Data[targetKey], secret.Data[sourceKey]) {
 				logger.Warn("The contents of the source and target keys are not identical in the secret", zap.String("secret name", secret.GetName()), zap.String("namespace", secret.GetNamespace()), zap.String("source key", sourceKey), zap.String("target key", targetKey))
-				return fmt.Sprintf(SSLServicesSecretWarning, secret.GetNamespace(), secret.GetName(), sourceKey, targetKey)
+				warning := NewWarningOf(SSLServicesSecretWarning, secret.GetNamespace(), secret.GetName(), sourceKey, targetKey)
+				return &warning
 			}
 		}
 	}
-	return ""
+	return nil
 }
 
 func DumpYAML(dumpdir string, resourceMap interface{}) error {
@@ -427,6 +473,16 @@ func DumpYAML(dumpdir string, resourceMap interface{}) error {
 			resourceName := resourceIterator.Key().Interface().(string)
 			resource := resourceIterator.Value().Interface()
 
+			// the type meta is not set on the core resources read via the typed client, but it is needed to apply the dumped files
+			switch r := resource.(type) {
+			case v1.ConfigMap:
+				r.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: ConfigMapKind}
+				resource = r
+			case v1.Secret:
+				r.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: SecretKind}
+				resource = r
+			}
+
 			yamlBytes, err := yaml.Marshal(resource)
 			if err != nil {
 				return err
@@ -441,40 +497,52 @@ func DumpYAML(dumpdir string, resourceMap interface{}) error {
 	return nil
 }
 
-func PrintStatus(dumpDir string, kubeConfigPath string, statusCM v1.ConfigMap) error {
-	var context string
-	if kubeConfigPath != "" {
-		kubeConfig, err := LoadKubeConfig(kubeConfigPath)
-		if err != nil {
-			return err
-		}
-		context = kubeConfig.CurrentContext
+// PrintStatus prints the migration status recorded in the status configmap and its shards
+func PrintStatus(dumpDir string, connection ConnectionInfo, status *model.MigrationStatus) error {
+	if status == nil {
+		status = &model.MigrationStatus{}
 	}
-
 	boldGreen := color.New(color.FgGreen, color.Bold)
 	boldYellow := color.New(color.FgYellow, color.Bold)
 	boldCyan := color.New(color.FgCyan, color.Bold)
 	boldRed := color.New(color.FgRed, color.Bold)
 	boldMagenta := color.New(color.FgMagenta, color.Bold)
 
-	// finish message
-	fmt.Print(boldGreen.Sprintf("Migration finished!\n"))
-	fmt.Printf("Find the migration logs and the migrated resources in YAML format under the %s directory.\n\n", boldCyan.Sprint(dumpDir))
+	// finish message and frequently asked questions are printed only at the end of a migration (when dumpDir is set)
+	if dumpDir != "" {
+		fmt.Print(boldGreen.Sprintf("Migration finished!\n"))
+		fmt.Printf("Find the migration logs and the migrated resources in YAML format under the %s directory.\n\n", boldCyan.Sprint(dumpDir))
 
-	// frequently asked questions
-	fmt.Print(boldMagenta.Sprintf("Frequently Asked Questions\n\n"))
+		fmt.Print(boldMagenta.Sprintf("Frequently Asked Questions\n\n"))
 
-	for q, a := range faq {
-		fmt.Printf("%s %s\n", boldYellow.Sprint("Q:"), q)
-		fmt.Printf("%s %s\n\n", boldGreen.Sprint("A:"), a)
+		for q, a := range faq {
+			fmt.Printf("%s %s\n", boldYellow.Sprint("Q:"), q)
+			fmt.Printf("%s %s\n\n", boldGreen.Sprint("A:"), a)
+		}
 	}
 
 	// migration details
 	fmt.Print(boldMagenta.Sprintf("Migration Details\n\n"))
 
 	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 1, '\t', tabwriter.AlignRight)
-	fmt.Fprintf(writer, "%s\t%s\n", boldYellow.Sprint("KubeConfig context:"), context)
-	fmt.Fprintf(writer, "%s\t%s\n\n", boldYellow.Sprint("Migration mode:"), GetMode())
+	fmt.Fprintf(writer, "%s\t%s\n", boldYellow.Sprint("KubeConfig context:"), connection.Context)
+	fmt.Fprintf(writer, "%s\t%s\n", boldYellow.Sprint("Identity:"), connection.Identity())
+	// the status configmap contains the mode of the recorded migration, which may differ from the current mode
+	migrationMode := status.Mode
+	if migrationMode == "" {
+		migrationMode = GetMode()
+	}
+	fmt.Fprintf(writer, "%s\t%s\n", boldYellow.Sprint("Migration mode:"), migrationMode)
+	// partial migrations record the filters selecting the migrated ingress resources
+	migrationScope := "all ingress resources"
+	if status.Scope != nil {
+		scopeJSON, err := json.Marshal(status.Scope)
+		if err != nil {
+			return err
+		}
+		migrationScope = "partial, ingress resources matching " + string(scopeJSON)
+	}
+	fmt.Fprintf(writer, "%s\t%s\n\n", boldYellow.Sprint("Migration scope:"), migrationScope)
 	if err := writer.Flush(); err != nil {
 		return err
 	}
@@ -482,12 +550,7 @@ func PrintStatus(dumpDir string, kubeConfigPath string, statusCM v1.ConfigMap) e
 	// migrated resources
 	fmt.Print(boldMagenta.Sprintf("Migrated Resources\n\n"))
 
-	var migratedResources []model.MigratedResource
-	if err := json.Unmarshal([]byte(statusCM.Data[MigratedResourcesParameterName]), &migratedResources); err != nil {
-		return err
-	}
-
-	for _, migratedResource := range migratedResources {
+	for _, migratedResource := range status.MigratedResources {
 		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 1, '\t', tabwriter.AlignRight)
 		fmt.Fprintf(writer, "%s\t%s\n", boldYellow.Sprint("Resource name:"), migratedResource.Name)
 		fmt.Fprintf(writer, "%s\t%s\n", boldYellow.Sprint("Resource namespace:"), migratedResource.Namespace)
@@ -498,25 +561,79 @@ func PrintStatus(dumpDir string, kubeConfigPath string, statusCM v1.ConfigMap) e
 		fmt.Println(boldYellow.Sprint("Migrated to:"))
 		if len(migratedResource.MigratedAs) > 0 {
 			for _, migratedTo := range migratedResource.MigratedAs {
-				fmt.Printf("- %s\n", migratedTo)
+				if ItemInSlice(migratedTo, migratedResource.Unchanged) {
+					fmt.Printf("- %s (unchanged)\n", migratedTo)
+				} else {
+					fmt.Printf("- %s\n", migratedTo)
+				}
 			}
 		} else {
 			fmt.Println("No generated resources.")
 		}
 		fmt.Println(boldRed.Sprint("Resource migration warnings:"))
 		if len(migratedResource.Warnings) > 0 {
-			for _, warning := range migratedResource.Warnings {
-				fmt.Printf("- %s\n", warning)
+			for _, warning := range ResourceWarnings(migratedResource) {
+				fmt.Printf("- %s\n", FormatWarning(warning))
 			}
 		} else {
 			fmt.Println("No warnings.")
 		}
+		if len(migratedResource.AcknowledgedWarnings) > 0 {
+			fmt.Println(boldYellow.Sprint("Acknowledged warnings:"))
+			for _, warning := range migratedResource.AcknowledgedWarnings {
+				if warning.Acknowledgement == nil {
+					fmt.Printf("- %s\n", FormatWarning(warning))
+					continue
+				}
+				fmt.Printf("- %s (acknowledged until %s: %s)\n", FormatWarning(warning), warning.Acknowledgement.Expires, warning.Acknowledgement.Reason)
+			}
+		}
+		if len(migratedResource.Errors) > 0 {
+			fmt.Println(boldRed.Sprint("Resource migration errors:"))
+			for _, migrationError := range migratedResource.Errors {
+				fmt.Printf("- %s\n", migrationError)
+			}
+		}
 		fmt.Println()
 	}
 
 	return nil
 }
 
+// ParseMigrationStatus returns the migration status recorded in the status configmap without its shards
+func ParseMigrationStatus(statusCM v1.ConfigMap) (*model.MigrationStatus, error) {
+	status := &model.MigrationStatus{
+		Mode: statusCM.Data[MigrationModeParameterName],
+	}
+	var err error
+	if status.MigratedResources, err = parseMigratedResources(statusCM); err != nil {
+		return nil, err
+	}
+	if statusCM.Data[SubdomainMapParameterName] != "" {
+		if err := json.Unmarshal([]byte(statusCM.Data[SubdomainMapParameterName]), &status.SubdomainMap); err != nil {
+			return nil, err
+		}
+	}
+	if statusCM.Data[MigrationScopeParameterName] != "" {
+		status.Scope = &model.IngressFilter{}
+		if err := json.Unmarshal([]byte(statusCM.Data[MigrationScopeParameterName]), status.Scope); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// IngressFromObject returns the ingress resource of a v1 or v1beta1 ingress object in v1beta1 format
+func IngressFromObject(obj interface{}, ingressEnhancementsEnabled bool) (networking.Ingress, bool) {
+	switch ingress := obj.(type) {
+	case *networking.Ingress:
+		return *ingress, true
+	case *networkingv1.Ingress:
+		return convertV1ToV1Beta1Ingress(*ingress, ingressEnhancementsEnabled), true
+	}
+	return networking.Ingress{}, false
+}
+
 func convertV1ToV1Beta1Ingress(v1Ingress networkingv1.Ingress, ingressEnhancementsEnabled bool) (v1beta1Ingress networking.Ingress) {
 	// Meta
 	v1beta1Ingress.ObjectMeta = *v1Ingress.ObjectMeta.DeepCopy()
@@ -14,11 +14,13 @@ limitations under the License.
 package utils
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"testing"
 
 	"bou.ke/monkey"
+	"github.com/IBM-Cloud/iks-ingress-migration-tool/model"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 	v1 "k8s.io/api/apps/v1"
@@ -635,7 +637,7 @@ func TestCreateOrUpdateTCPPortsCM(t *testing.T) {
 	}
 	for name, tc := range cases {
 		t.Run(name, func(t *testing.T) {
-			err := CreateOrUpdateTCPPortsCM(tc.kc, tc.cmName, "mynamespace", tc.cmData, logger)
+			err := CreateOrUpdateTCPPortsCM(context.Background(), tc.kc, tc.cmName, "mynamespace", tc.cmData, logger)
 			assert.Equal(t, tc.expectedErr, err)
 			assert.EqualValues(t, tc.expectedOp, tc.kc.CalledOp)
 			assert.Equal(t, tc.expectedData, tc.kc.CMData)
@@ -651,7 +653,7 @@ func TestUpdateProxySecret(t *testing.T) {
 		expectedErr       error
 		expectedSecret    *v1core.Secret
 		expectedOperation []string
-		expectedWarning   []string
+		expectedWarning   []model.Warning
 	}{
 		"Secret not found": {
 			kc: &TestKClient{
@@ -1016,7 +1018,7 @@ func TestUpdateProxySecret(t *testing.T) {
 				},
 			},
 			expectedOperation: []string{"+ update/mysecret"},
-			expectedWarning:   []string{fmt.Sprintf(SSLServicesSecretWarning, "ingress", "mysecret", "trusted.crt", "ca.crt")},
+			expectedWarning:   []model.Warning{NewWarningOf(SSLServicesSecretWarning, "ingress", "mysecret", "trusted.crt", "ca.crt")},
 		},
 		"Secret found in ingress namespace, tls.crt exists in the secret, tls.crt and client.crt are different": {
 			kc: &TestKClient{
@@ -1052,7 +1054,7 @@ func TestUpdateProxySecret(t *testing.T) {
 				},
 			},
 			expectedOperation: []string{"+ update/mysecret"},
-			expectedWarning:   []string{fmt.Sprintf(SSLServicesSecretWarning, "ingress", "mysecret", "client.crt", "tls.crt")},
+			expectedWarning:   []model.Warning{NewWarningOf(SSLServicesSecretWarning, "ingress", "mysecret", "client.crt", "tls.crt")},
 		},
 		"Secret found in ingress namespace, tls.key exists in the secret, tls.key and client.key are different": {
 			kc: &TestKClient{
@@ -1088,7 +1090,7 @@ func TestUpdateProxySecret(t *testing.T) {
 				},
 			},
 			expectedOperation: []string{"+ update/mysecret"},
-			expectedWarning:   []string{fmt.Sprintf(SSLServicesSecretWarning, "ingress", "mysecret", "client.key", "tls.key")},
+			expectedWarning:   []model.Warning{NewWarningOf(SSLServicesSecretWarning, "ingress", "mysecret", "client.key", "tls.key")},
 		},
 	}
 	for name, tc := range cases {
@@ -1098,7 +1100,7 @@ func TestUpdateProxySecret(t *testing.T) {
 			if tc.kc.Secret != nil {
 				secretName = tc.kc.Secret.Name
 			}
-			secret, warning, err := UpdateProxySecret(tc.kc, secretName, tc.ingressNS, logger)
+			secret, warning, err := UpdateProxySecret(context.Background(), tc.kc, secretName, tc.ingressNS, logger)
 			assert.Equal(t, tc.expectedErr, err)
 			assert.Equal(t, tc.expectedSecret, secret)
 			assert.Equal(t, tc.expectedOperation, tc.kc.CalledOp)
@@ -1958,3 +1960,54 @@ func TestConvertV1Beta1ToV1Ingress(t *testing.T) {
 		})
 	}
 }
+
+func TestIngressFromObject(t *testing.T) {
+	meta := v12.ObjectMeta{Name: "tea-ingress", Namespace: "default"}
+	className := "public-iks-k8s-nginx"
+
+	testCases := []struct {
+		description     string
+		obj             interface{}
+		expectedIngress networking.Ingress
+		expectedOk      bool
+	}{
+		{
+			description:     "v1beta1 ingress resource",
+			obj:             &networking.Ingress{ObjectMeta: meta},
+			expectedIngress: networking.Ingress{ObjectMeta: meta},
+			expectedOk:      true,
+		},
+		{
+			description:     "v1 ingress resource is converted",
+			obj:             &networkingv1.Ingress{ObjectMeta: meta, Spec: networkingv1.IngressSpec{IngressClassName: &className}},
+			expectedIngress: networking.Ingress{ObjectMeta: meta, Spec: networking.IngressSpec{IngressClassName: &className}},
+			expectedOk:      true,
+		},
+		{
+			description: "unknown object",
+			obj:         "tea-ingress",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			ingress, ok := IngressFromObject(tc.obj, true)
+			assert.Equal(t, tc.expectedOk, ok)
+			assert.Equal(t, tc.expectedIngress, ingress)
+		})
+	}
+}
+
+func TestPrintStatusAcknowledgedWarnings(t *testing.T) {
+	status := &model.MigrationStatus{MigratedResources: []model.MigratedResource{{
+		Kind:      IngressKind,
+		Name:      "tea-ingress",
+		Namespace: "default",
+		AcknowledgedWarnings: []model.Warning{
+			{Code: "HSTS_UNSUPPORTED", Acknowledgement: &model.Acknowledgement{Code: "HSTS_UNSUPPORTED", Reason: "planned", Expires: "2023-06-30"}},
+			// recorded by hand or by an older version without the acknowledgement
+			{Code: "CUSTOM_PORT_UNSUPPORTED"},
+		},
+	}}}
+	assert.NoError(t, PrintStatus("", ConnectionInfo{}, status))
+}